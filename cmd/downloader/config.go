@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix starts the environment variables that set flag defaults, e.g.
+// CLOUDGET_MAX_CONNECTIONS for -max-connections
+const envPrefix = "CLOUDGET_"
+
+// configEnv names a config file to read instead of the default one
+const configEnv = envPrefix + "CONFIG"
+
+// defaultConfigPath returns where the config file is looked for, normally
+// ~/.config/cloudget/config.yaml
+func defaultConfigPath() (string, error) {
+	if path := os.Getenv(configEnv); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cloudget", "config.yaml"), nil
+}
+
+// readConfigFile reads flag defaults from a YAML file of flag names and
+// values, such as "max-connections: 16". A missing file has no defaults.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	home, _ := os.UserHomeDir()
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		text := fmt.Sprint(value)
+		if rest, ok := strings.CutPrefix(text, "~/"); ok && home != "" {
+			text = filepath.Join(home, rest)
+		}
+		values[name] = text
+	}
+	return values, nil
+}
+
+// envDefaults returns flag defaults from CLOUDGET_* variables in environ,
+// mapping CLOUDGET_OUTPUT_DIR to output-dir and so on
+func envDefaults(environ []string) map[string]string {
+	values := make(map[string]string)
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || key == configEnv {
+			continue
+		}
+		if name, ok := strings.CutPrefix(key, envPrefix); ok && name != "" {
+			values[strings.ReplaceAll(strings.ToLower(name), "_", "-")] = value
+		}
+	}
+	return values
+}
+
+// loadDefaults sets the flags in flags from the config file and then from
+// the environment, before the command line is parsed, so flags given on the
+// command line win over environment variables, which win over the file.
+// Unknown names in the file are an error, unknown variables are ignored
+// since the environment is shared with other programs.
+func loadDefaults(flags *flag.FlagSet, configPath string, environ []string) error {
+	if configPath != "" {
+		values, err := readConfigFile(configPath)
+		if err != nil {
+			return err
+		}
+		if err := setFlags(flags, values, configPath, true); err != nil {
+			return err
+		}
+	}
+
+	return setFlags(flags, envDefaults(environ), "environment", false)
+}
+
+// setFlags sets each named flag to its value, in name order so errors are
+// reported consistently
+func setFlags(flags *flag.FlagSet, values map[string]string, source string, strict bool) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if flags.Lookup(name) == nil {
+			if strict {
+				return fmt.Errorf("unknown option %q in %s", name, source)
+			}
+			continue
+		}
+		if err := flags.Set(name, values[name]); err != nil {
+			return fmt.Errorf("invalid value %q for %s in %s: %w", values[name], name, source, err)
+		}
+	}
+	return nil
+}
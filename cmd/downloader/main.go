@@ -1,39 +1,89 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"flag"
 	"fmt"
+	"html"
+	"io"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/milindmadhukar/cloudget/pkg/downloader"
 	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/progress"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
 var (
 	url            = flag.String("url", "", "URL to download")
 	urls           = flag.String("urls", "", "Comma-separated list of URLs to download")
-	urlFile        = flag.String("url-file", "", "File containing URLs to download (one per line)")
+	urlFile        = flag.String("url-file", "", "File containing URLs to download (one per line, optionally followed by an output filename), \"-\" reads them from stdin")
 	outputDir      = flag.String("output-dir", ".", "Output directory for downloads")
-	outputPath     = flag.String("output", "", "Specific output file path (for single URL)")
+	outputPath     = flag.String("output", "", "Specific output file path (for single URL, \"-\" writes to stdout)")
 	filename       = flag.String("filename", "", "Custom filename (for single URL)")
+	selectFile     = flag.String("select-file", "", "Download only the file with this name from a multi-file WeTransfer")
+	linkPassword   = flag.String("link-password", "", "Password that opens password-protected share links, such as Dropbox links")
+	decompress     = flag.Bool("decompress", false, "Decompress gzip downloads and drop the .gz from their names")
+	exportFormat   = flag.String("export-format", "", "Download Google Docs, Sheets and Slides editor links exported in this format (e.g., pdf, docx, xlsx)")
 	maxConnections = flag.Int("max-connections", 8, "Maximum concurrent connections per download")
 	chunkSize      = flag.String("chunk-size", "2MB", "Chunk size for downloads (e.g., 1MB, 512KB)")
-	timeout        = flag.Duration("timeout", 300*time.Second, "Download timeout")
+	minChunkedSize = flag.String("min-chunked-size", "1MB", "Files smaller than this are downloaded without chunking")
+	writeBuffer    = flag.String("write-buffer", "0", "Buffer up to this much of the finished chunks (e.g., 32MB) and write them in contiguous runs, for network filesystems")
+	useMmap        = flag.Bool("mmap", false, "Preallocate large files and write chunks through a memory mapping, for fast local disks (needs -journal)")
+	segments       = flag.Int("segments", 0, "Split each download into this many contiguous segments streamed in parallel instead of chunks")
+	noChunk        = flag.Bool("no-chunk", false, "Download each file with a single request, without chunks or ranges, for hosts that mishandle them")
+	fastSmall      = flag.Bool("fast-small-files", false, "Skip the HEAD request for plain links and take file details from the download's own response, for batches of many small files")
+	adaptive       = flag.Bool("adaptive-concurrency", false, "Start with one connection and add more while throughput improves")
+	insecure       = flag.Bool("insecure", false, "Skip TLS certificate verification (use only for trusted self-signed endpoints)")
+	caCertFile     = flag.String("cacert", "", "PEM file with additional CA certificates to trust")
+	useNetrc       = flag.Bool("netrc", false, "Send credentials from ~/.netrc (or $NETRC) to the hosts it lists")
+	netrcFile      = flag.String("netrc-file", "", "Send credentials from this netrc file to the hosts it lists")
+	timeout        = flag.Duration("timeout", 300*time.Second, "Timeout for each download")
+	totalTimeout   = flag.Duration("total-timeout", 0, "Stop the whole batch after this long, cancelling the download in flight and skipping the rest (0 for no limit)")
+	connectTimeout = flag.Duration("connect-timeout", 0, "Give up on connecting to a server after this long (0 uses the default)")
+	tlsTimeout     = flag.Duration("tls-timeout", 0, "Give up on a TLS handshake after this long (0 uses the default)")
+	headerTimeout  = flag.Duration("header-timeout", 0, "Give up when response headers take longer than this (0 waits for the download timeout)")
+	maxAttempts    = flag.Int("max-attempts", 1, "Retry a download from the start this many times in total when it fails with a transient error")
+	rotateUA       = flag.Bool("rotate-user-agent", false, "Send a different browser User-Agent with each request to Google Drive and WeTransfer")
+	httpVersion    = flag.String("http-version", "auto", "HTTP version to use: auto, h1, h2 or h3 (h3 falls back to TCP for hosts without QUIC)")
+	resolveHosts   = flag.String("resolve", "", "Comma-separated host=IP pairs to connect to instead of resolving the host (e.g., cdn.example.com=203.0.113.7 or staging.example.com=127.0.0.1:8443)")
+	dnsServer      = flag.String("dns-server", "", "Resolve hosts with the DNS server at this IP (port 53 unless given) instead of the system resolver")
+	maxRedirects   = flag.Int("max-redirects", 10, "Maximum redirects followed per request (0 disables redirects)")
+	followHTML     = flag.Bool("follow-html-redirects", false, "Follow HTML landing pages that redirect with a meta refresh or script")
 	resume         = flag.Bool("resume", true, "Enable download resume")
+	journal        = flag.Bool("journal", false, "Sync each chunk to disk and journal it, so a resume after a crash only trusts journaled chunks")
+	contentDisp    = flag.Bool("content-disposition", false, "Rename each file to the name the server gives in its download response when that differs")
+	noClobber      = flag.Bool("no-clobber", false, "Skip downloads whose output file already exists instead of overwriting it")
+	minFreeSpace   = flag.String("min-free-space", "0", "Refuse downloads that would leave less than this much free space on the output disk (e.g., 10GB)")
+	useTempFile    = flag.Bool("temp-file", true, "Download to a .cloudget.part file and rename it once complete")
 	verifyHash     = flag.String("verify-hash", "", "Expected hash for verification")
-	hashAlgorithm  = flag.String("hash-algorithm", "sha256", "Hash algorithm (md5, sha1, sha256, sha512)")
+	hashAlgorithm  = flag.String("hash-algorithm", "sha256", "Hash algorithm (md5, sha1, sha256, sha512), inferred from the -verify-hash length when not set")
+	writeChecksums = flag.String("write-checksums", "", "Write a sha256sum-style manifest of downloaded files to this path")
+	preservePath   = flag.Bool("preserve-path", false, "Recreate the URL path under the output directory for direct links")
+	groupByService = flag.Bool("group-by-service", false, "Put each file in a subdirectory of the output directory named after its service")
 	verbose        = flag.Bool("verbose", false, "Enable verbose logging")
+	debugHTTP      = flag.Bool("debug-http", false, "Log the headers of every HTTP request and response, with credentials redacted (implies -verbose)")
 	quiet          = flag.Bool("quiet", false, "Suppress all output except errors")
 	showProgress   = flag.Bool("progress", true, "Show download progress")
+	progressMode   = flag.String("progress-mode", "bar", "How progress is shown: bar, plain (a line with speed and ETA every few seconds) or none")
 	showHelp       = flag.Bool("help", false, "Show help message")
 )
 
 func main() {
+	// Without a home directory there's no config file, only the environment
+	configPath, _ := defaultConfigPath()
+	if err := loadDefaults(flag.CommandLine, configPath, os.Environ()); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid defaults: %v\n", err)
+		os.Exit(2)
+	}
 	flag.Parse()
 
 	if *showHelp {
@@ -45,7 +95,7 @@ func main() {
 	logger := logrus.New()
 	if *quiet {
 		logger.SetLevel(logrus.ErrorLevel)
-	} else if *verbose {
+	} else if *verbose || *debugHTTP {
 		logger.SetLevel(logrus.DebugLevel)
 	} else {
 		logger.SetLevel(logrus.InfoLevel)
@@ -57,51 +107,217 @@ func main() {
 		logger.Fatalf("Invalid chunk size: %v", err)
 	}
 
+	minChunkedBytes, err := parseSize(*minChunkedSize)
+	if err != nil {
+		logger.Fatalf("Invalid minimum chunked size: %v", err)
+	}
+
+	writeBufferBytes, err := parseSize(*writeBuffer)
+	if err != nil {
+		logger.Fatalf("Invalid write buffer size: %v", err)
+	}
+
+	minFreeBytes, err := parseSize(*minFreeSpace)
+	if err != nil {
+		logger.Fatalf("Invalid minimum free space: %v", err)
+	}
+
+	version, err := utils.ParseHTTPVersion(*httpVersion)
+	if err != nil {
+		logger.Fatalf("Invalid HTTP version: %v", err)
+	}
+
+	dnsOverride, err := parseDNSOverrides(*resolveHosts)
+	if err != nil {
+		logger.Fatalf("Invalid -resolve: %v", err)
+	}
+
+	// Config and environment defaults count as set, they're explicit choices too
+	algorithmSet := false
+	flag.Visit(func(f *flag.Flag) {
+		algorithmSet = algorithmSet || f.Name == "hash-algorithm"
+	})
+	algorithm := resolveHashAlgorithm(*hashAlgorithm, *verifyHash, algorithmSet)
+
+	mode, err := progress.ParseMode(*progressMode)
+	if err != nil {
+		logger.Fatalf("Invalid progress mode: %v", err)
+	}
+	if !*showProgress || *quiet {
+		mode = progress.ModeNone
+	}
+
 	// Collect URLs to download
-	urlList, err := collectURLs()
+	requests, err := collectURLs(os.Stdin, isPipe(os.Stdin))
 	if err != nil {
 		logger.Fatalf("Error collecting URLs: %v", err)
 	}
 
-	if len(urlList) == 0 {
-		logger.Fatal("No URLs provided. Use -url, -urls, or -url-file to specify URLs to download.")
+	if len(requests) == 0 {
+		logger.Fatal("No URLs provided. Use -url, -urls, or -url-file, or pipe URLs to stdin, to specify URLs to download.")
+	}
+
+	netrcPath, err := resolveNetrcPath(*useNetrc, *netrcFile)
+	if err != nil {
+		logger.Fatalf("Invalid netrc option: %v", err)
 	}
 
 	// Create download manager
-	manager := downloader.NewManager(&downloader.ManagerOptions{
-		MaxConnections: *maxConnections,
-		ChunkSize:      chunkSizeBytes,
-		Timeout:        *timeout,
-		OutputDir:      *outputDir,
-		Resume:         *resume,
-		VerifyHash:     *verifyHash != "",
-		HashAlgorithm:  *hashAlgorithm,
+	// Build the client here so a bad CA or netrc file stops the run instead of being logged
+	httpClient, err := utils.NewHTTPClientWithConfig(&utils.ClientConfig{
+		InsecureSkipVerify:    *insecure,
+		CACertFile:            *caCertFile,
+		MaxIdleConnsPerHost:   *maxConnections,
+		DialTimeout:           *connectTimeout,
+		TLSHandshakeTimeout:   *tlsTimeout,
+		ResponseHeaderTimeout: *headerTimeout,
+		NetrcFile:             netrcPath,
+		HTTPVersion:           version,
+		DNSOverride:           dnsOverride,
+		DNSServer:             *dnsServer,
 	})
+	if err != nil {
+		logger.Fatalf("Invalid HTTP client configuration: %v", err)
+	}
+
+	manager := downloader.NewManagerWithClient(&downloader.ManagerOptions{
+		MaxConnections:      *maxConnections,
+		ChunkSize:           chunkSizeBytes,
+		Timeout:             *timeout,
+		OutputDir:           *outputDir,
+		Resume:              *resume,
+		ResumeSaveInterval:  downloader.DefaultResumeSaveInterval,
+		VerifyHash:          *verifyHash != "",
+		HashAlgorithm:       algorithm,
+		PreservePath:        *preservePath,
+		MinChunkedSize:      minChunkedBytes,
+		AdaptiveConcurrency: *adaptive,
+		InsecureSkipVerify:  *insecure,
+		CACertFile:          *caCertFile,
+		UseTempFile:         *useTempFile,
+		MaxRedirects:        redirectLimit(*maxRedirects),
+		RotateUserAgent:     *rotateUA,
+		Segments:            *segments,
+		FollowHTMLRedirects: *followHTML,
+		Journal:             *journal,
+		MaxDownloadAttempts: *maxAttempts,
+		GroupByService:      *groupByService,
+		DebugHTTP:           *debugHTTP,
+		ProgressMode:        mode,
+		ForceSimpleDownload: *noChunk,
+		MinFreeSpace:        minFreeBytes,
+		SmallFileFastPath:   *fastSmall,
+		WriteBufferSize:     writeBufferBytes,
+		UseMmap:             *useMmap,
+		HTTPVersion:         version,
+		ConflictResolver:    conflictResolver(*noClobber),
+		UseResponseFilename: *contentDisp,
+		ExportFormat:        *exportFormat,
+	}, httpClient)
 
 	manager.SetLogger(logger)
 
-	// Download all URLs
+	// Anything the cloud services don't recognize is fetched as a plain link
+	manager.RegisterDirectService()
+
+	// Download all URLs, within the total timeout if there is one
 	ctx := context.Background()
+	if *totalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *totalTimeout)
+		defer cancel()
+	}
 	overallStart := time.Now()
-	var totalBytes int64
-	var successCount, failCount int
-
-	for i, downloadURL := range urlList {
-		logger.Infof("Downloading %d/%d: %s", i+1, len(urlList), downloadURL)
-
-		// Create download request
-		req := &interfaces.DownloadRequest{
-			URL:            downloadURL,
-			OutputPath:     *outputPath,
-			CustomFilename: *filename,
-			VerifyHash:     *verifyHash,
+	summary := runBatch(ctx, manager, requests, logger, algorithm)
+
+	if err := manager.Close(); err != nil {
+		logger.Warnf("Failed to shut down download manager: %v", err)
+	}
+
+	// Show overall summary
+	overallDuration := time.Since(overallStart)
+	overallSpeed := float64(summary.totalBytes) / overallDuration.Seconds() / 1024 / 1024 // MB/s
+
+	logger.Infof("=== Download Summary ===")
+	logger.Infof("Total URLs: %d", len(requests))
+	logger.Infof("Successful: %d", summary.successCount)
+	logger.Infof("Failed: %d", summary.failCount)
+	if len(summary.skipped) > 0 {
+		logger.Infof("Skipped (total timeout): %d", len(summary.skipped))
+	}
+	logger.Infof("Total size: %s", formatBytes(summary.totalBytes))
+	logger.Infof("Total time: %.1f seconds", overallDuration.Seconds())
+	logger.Infof("Overall speed: %.1f MB/s", overallSpeed)
+
+	if *writeChecksums != "" && len(summary.downloadedFiles) > 0 {
+		if err := writeChecksumManifest(*writeChecksums, summary.downloadedFiles, algorithm); err != nil {
+			logger.Errorf("Failed to write checksum manifest: %v", err)
+			os.Exit(1)
+		}
+		logger.Infof("Checksums written to: %s", *writeChecksums)
+	}
+
+	if summary.failCount > 0 || len(summary.skipped) > 0 {
+		os.Exit(1)
+	}
+}
+
+// batchSummary tallies the outcome of a batch of downloads
+type batchSummary struct {
+	totalBytes      int64
+	successCount    int
+	failCount       int
+	skipped         []string // URLs never started because the total timeout expired
+	downloadedFiles []string
+}
+
+// runBatch downloads requests one after the other, filling them in from the
+// flags. Once ctx is done the download in flight is cancelled and counted as
+// failed, and the URLs after it are skipped.
+func runBatch(ctx context.Context, manager *downloader.Manager, requests []*interfaces.DownloadRequest, logger *logrus.Logger, algorithm string) *batchSummary {
+	summary := &batchSummary{}
+
+	for i, req := range requests {
+		if ctx.Err() != nil {
+			for _, skipped := range requests[i:] {
+				summary.skipped = append(summary.skipped, skipped.URL)
+			}
+			logger.Errorf("Total timeout reached, skipping %d remaining downloads:", len(summary.skipped))
+			for _, skipped := range summary.skipped {
+				logger.Errorf("  %s", skipped)
+			}
+			break
+		}
+
+		logger.Infof("Downloading %d/%d: %s", i+1, len(requests), req.URL)
+
+		// Fill in the request from flags, names given in the URL file take precedence
+		req.OutputPath = *outputPath
+		req.VerifyHash = *verifyHash
+		req.SelectFile = *selectFile
+		req.Password = *linkPassword
+		req.Decompress = *decompress
+		if req.CustomFilename == "" {
+			req.CustomFilename = *filename
+		}
+
+		if *noClobber {
+			if err := checkNoClobber(ctx, manager, req); err != nil {
+				logger.Errorf("Skipping download: %v", err)
+				summary.failCount++
+				continue
+			}
 		}
 
 		// Perform download
 		result, err := manager.Download(ctx, req)
 		if err != nil {
-			logger.Errorf("Download failed: %v", err)
-			failCount++
+			if ctx.Err() != nil {
+				logger.Errorf("Download cancelled, total timeout reached: %v", err)
+			} else {
+				logger.Errorf("Download failed: %v", err)
+			}
+			summary.failCount++
 			continue
 		}
 
@@ -110,40 +326,42 @@ func main() {
 		logger.Infof("File: %s", result.FilePath)
 		logger.Infof("Size: %s", formatBytes(result.Size))
 		logger.Infof("Time: %.1f seconds", result.Duration.Seconds())
-		logger.Infof("Speed: %.1f MB/s", result.Speed)
+		logger.Infof("Speed: %.1f MB/s (peak %.1f MB/s)", result.Speed, result.PeakSpeed)
+		logger.Infof("Chunks: %d, Retries: %d, Resumed: %t", result.ChunksUsed, result.Retries, result.Resumed)
+		if *verbose && result.FinalURL != "" {
+			logger.Infof("Source: %s", result.FinalURL)
+		}
 
 		if result.Hash != "" {
-			logger.Infof("Hash (%s): %s", *hashAlgorithm, result.Hash)
+			logger.Infof("Hash (%s): %s", algorithm, result.Hash)
 		}
 
-		totalBytes += result.Size
-		successCount++
+		summary.totalBytes += result.Size
+		summary.successCount++
+
+		// stdout carries the file data itself when streaming, so keep it clean
+		if result.FilePath == downloader.StdoutPath {
+			continue
+		}
+		summary.downloadedFiles = append(summary.downloadedFiles, result.FilePath)
 		fmt.Println() // Empty line between downloads
 	}
 
-	// Show overall summary
-	overallDuration := time.Since(overallStart)
-	overallSpeed := float64(totalBytes) / overallDuration.Seconds() / 1024 / 1024 // MB/s
-
-	logger.Infof("=== Download Summary ===")
-	logger.Infof("Total URLs: %d", len(urlList))
-	logger.Infof("Successful: %d", successCount)
-	logger.Infof("Failed: %d", failCount)
-	logger.Infof("Total size: %s", formatBytes(totalBytes))
-	logger.Infof("Total time: %.1f seconds", overallDuration.Seconds())
-	logger.Infof("Overall speed: %.1f MB/s", overallSpeed)
-
-	if failCount > 0 {
-		os.Exit(1)
-	}
+	return summary
 }
 
-func collectURLs() ([]string, error) {
-	var urlList []string
+// stdinURLFile as -url-file reads the URL list from standard input
+const stdinURLFile = "-"
+
+// collectURLs gathers the download requests given by flags. The URL list is
+// read from stdin for -url-file -, or when no URLs were given and stdinPiped
+// says something is piped in.
+func collectURLs(stdin io.Reader, stdinPiped bool) ([]*interfaces.DownloadRequest, error) {
+	var requests []*interfaces.DownloadRequest
 
 	// Single URL
 	if *url != "" {
-		urlList = append(urlList, *url)
+		requests = append(requests, &interfaces.DownloadRequest{URL: *url})
 	}
 
 	// Multiple URLs (comma-separated)
@@ -152,39 +370,211 @@ func collectURLs() ([]string, error) {
 		for _, u := range multipleURLs {
 			u = strings.TrimSpace(u)
 			if u != "" {
-				urlList = append(urlList, u)
+				requests = append(requests, &interfaces.DownloadRequest{URL: u})
 			}
 		}
 	}
 
 	// URLs from file
-	if *urlFile != "" {
-		fileURLs, err := readURLsFromFile(*urlFile)
+	if *urlFile != "" && *urlFile != stdinURLFile {
+		fileRequests, err := readURLsFromFile(*urlFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read URLs from file: %w", err)
 		}
-		urlList = append(urlList, fileURLs...)
+		requests = append(requests, fileRequests...)
 	}
 
-	return urlList, nil
+	// URLs from stdin, as in cat urls.txt | cloudget
+	if *urlFile == stdinURLFile || (len(requests) == 0 && stdinPiped) {
+		stdinRequests, err := readURLs(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read URLs from stdin: %w", err)
+		}
+		requests = append(requests, stdinRequests...)
+	}
+
+	return requests, nil
+}
+
+// isPipe reports whether f is a pipe or file rather than a terminal
+func isPipe(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
 }
 
-func readURLsFromFile(filename string) ([]string, error) {
+// webloc files are property lists holding the link in the string after the URL key
+var weblocURLRe = regexp.MustCompile(`<key>URL</key>\s*<string>([^<]+)</string>`)
+
+// readURLsFromFile reads download requests from a URL list in the format
+// readURLs accepts. Windows .url shortcuts and macOS .webloc files are also
+// accepted and yield their single link.
+func readURLsFromFile(filename string) ([]*interfaces.DownloadRequest, error) {
 	content, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	var urls []string
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".webloc":
+		matches := weblocURLRe.FindSubmatch(content)
+		if matches == nil {
+			return nil, fmt.Errorf("no URL found in %s", filename)
+		}
+		return []*interfaces.DownloadRequest{{URL: html.UnescapeString(strings.TrimSpace(string(matches[1])))}}, nil
+	case ".url":
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if value, ok := strings.CutPrefix(line, "URL="); ok && value != "" {
+				return []*interfaces.DownloadRequest{{URL: value}}, nil
+			}
+		}
+		return nil, fmt.Errorf("no URL found in %s", filename)
+	}
+
+	return readURLs(bytes.NewReader(content))
+}
+
+// readURLs reads download requests from a URL list. Each line holds a URL
+// optionally followed by whitespace and an output filename, blank lines and
+// lines starting with # are skipped.
+func readURLs(r io.Reader) ([]*interfaces.DownloadRequest, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []*interfaces.DownloadRequest
 	lines := strings.Split(string(content), "\n")
 	for _, line := range lines {
+		// TrimSpace also drops the \r left over from CRLF line endings
 		line = strings.TrimSpace(line)
-		if line != "" && !strings.HasPrefix(line, "#") {
-			urls = append(urls, line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		req := &interfaces.DownloadRequest{URL: line}
+		if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+			req.URL = line[:i]
+			req.CustomFilename = strings.TrimSpace(line[i:])
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, nil
+}
+
+// conflictResolver keeps existing files with -no-clobber, which also covers
+// the name a file is renamed to with -content-disposition
+func conflictResolver(noClobber bool) downloader.ConflictResolver {
+	if !noClobber {
+		return nil
+	}
+	return func(existingPath string, info *interfaces.FileInfo) (string, downloader.ConflictAction) {
+		return "", downloader.ConflictSkip
+	}
+}
+
+// resolveHashAlgorithm returns the hash algorithm to use. Unless one was
+// chosen explicitly, it's inferred from the length of the -verify-hash
+// digest, so an MD5 digest is checked as MD5, and lengths that match no
+// algorithm keep the default.
+func resolveHashAlgorithm(algorithm, verifyHash string, explicit bool) string {
+	if explicit || verifyHash == "" {
+		return algorithm
+	}
+	if detected := utils.NewHashCalculator().DetectHashAlgorithm(verifyHash); detected != "unknown" {
+		return detected
+	}
+	return algorithm
+}
+
+// redirectLimit converts the -max-redirects flag, where 0 means no
+// redirects, to ManagerOptions.MaxRedirects, where 0 means the default
+func redirectLimit(flagValue int) int {
+	if flagValue <= 0 {
+		return -1
+	}
+	return flagValue
+}
+
+// checkNoClobber returns an error if the file req would be saved to already
+// exists, so -no-clobber never overwrites anything
+func checkNoClobber(ctx context.Context, manager *downloader.Manager, req *interfaces.DownloadRequest) error {
+	path, err := manager.ResolveOutputPath(ctx, req)
+	if err != nil {
+		return err
+	}
+	if path == downloader.StdoutPath {
+		return nil
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		// A named pipe is streamed into, not overwritten
+		if info.Mode()&os.ModeNamedPipe != 0 {
+			return nil
+		}
+		return fmt.Errorf("%s already exists, not overwriting", path)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// writeChecksumManifest writes "<hash>  <path>" lines compatible with sha256sum -c and friends
+func writeChecksumManifest(manifestPath string, files []string, algorithm string) error {
+	hashCalculator := utils.NewHashCalculator()
+
+	var manifest strings.Builder
+	for _, file := range files {
+		hash, err := hashCalculator.CalculateHash(file, algorithm)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", file, err)
 		}
+		fmt.Fprintf(&manifest, "%s  %s\n", hash, file)
 	}
 
-	return urls, nil
+	return os.WriteFile(manifestPath, []byte(manifest.String()), 0644)
+}
+
+// resolveNetrcPath returns the netrc file to read credentials from, or ""
+// for none. An explicit -netrc-file has to exist, a missing default file
+// just means there are no credentials.
+func resolveNetrcPath(useDefault bool, file string) (string, error) {
+	if file != "" {
+		return file, nil
+	}
+	if !useDefault {
+		return "", nil
+	}
+
+	path, err := utils.DefaultNetrcPath()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", nil
+	}
+	return path, nil
+}
+
+// parseDNSOverrides parses comma-separated host=IP pairs, where the IP may
+// carry a port, into the overrides map of the HTTP client
+func parseDNSOverrides(value string) (map[string]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	overrides := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		host, target, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		host, target = strings.TrimSpace(host), strings.TrimSpace(target)
+		if !ok || host == "" || target == "" {
+			return nil, fmt.Errorf("%q is not a host=IP pair", pair)
+		}
+		overrides[host] = target
+	}
+	return overrides, nil
 }
 
 func parseSize(sizeStr string) (int64, error) {
@@ -272,11 +662,15 @@ Supported Services:
   - Dropbox (dropbox.com/s/, dropbox.com/scl/fi/)
   - Google Drive (drive.google.com, docs.google.com)
   - WeTransfer (we.tl, wetransfer.com)
+  - Direct HTTP(S) links (any other URL)
 
 Notes:
   - URLs are automatically converted to direct download links
   - Downloads support resume functionality by default
   - Large files are downloaded in chunks for better performance
   - Hash verification is optional but recommended for important files
+  - Defaults for any option can be set in ~/.config/cloudget/config.yaml
+    (or the file named by CLOUDGET_CONFIG) and in CLOUDGET_* environment
+    variables, e.g. CLOUDGET_MAX_CONNECTIONS=16
 `)
 }
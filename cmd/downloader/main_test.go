@@ -2,13 +2,73 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/milindmadhukar/cloudget/pkg/downloader"
 	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 )
 
+// testService routes test.com URLs to a local test server path
+type testService struct {
+	serverURL string
+}
+
+func (s *testService) IsSupported(url string) bool {
+	return strings.Contains(url, "test.com")
+}
+
+func (s *testService) GetServiceName() string {
+	return "Test"
+}
+
+func (s *testService) ConvertURL(url string) (string, error) {
+	return s.serverURL + url[strings.Index(url, "test.com")+len("test.com"):], nil
+}
+
+func (s *testService) GetFileInfo(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+	directURL, _ := s.ConvertURL(url)
+	resp, err := http.Head(directURL)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return &interfaces.FileInfo{
+		URL:      directURL,
+		Filename: filepath.Base(directURL),
+		Size:     resp.ContentLength,
+	}, nil
+}
+
+func (s *testService) PrepareDownload(ctx context.Context, url string) (string, error) {
+	return s.ConvertURL(url)
+}
+
+func newTestFileServer(files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		if r.Method != http.MethodHead {
+			io.WriteString(w, content)
+		}
+	}))
+}
+
 func TestManagerInitialization(t *testing.T) {
 	manager := downloader.NewManager(nil)
 	if manager == nil {
@@ -132,3 +192,551 @@ func TestDownloadManagerInterface(t *testing.T) {
 		t.Logf("Cancel returned error (expected): %v", err)
 	}
 }
+
+func TestWriteChecksumManifest(t *testing.T) {
+	files := map[string]string{
+		"first.txt":  "first file content",
+		"second.txt": "second file content",
+	}
+
+	server := newTestFileServer(files)
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	manager := downloader.NewManager(&downloader.ManagerOptions{
+		MaxConnections: 4,
+		ChunkSize:      1024 * 1024,
+		Timeout:        30 * time.Second,
+		OutputDir:      tmpDir,
+		HashAlgorithm:  "sha256",
+	})
+	manager.RegisterService(&testService{serverURL: server.URL})
+
+	var downloaded []string
+	for name := range files {
+		result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/" + name})
+		if err != nil {
+			t.Fatalf("Download of %s failed: %v", name, err)
+		}
+		downloaded = append(downloaded, result.FilePath)
+	}
+
+	manifestPath := filepath.Join(tmpDir, "SHA256SUMS")
+	if err := writeChecksumManifest(manifestPath, downloaded, "sha256"); err != nil {
+		t.Fatalf("writeChecksumManifest failed: %v", err)
+	}
+
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(manifest)), "\n")
+	if len(lines) != len(files) {
+		t.Fatalf("Expected %d manifest lines, got %d", len(files), len(lines))
+	}
+
+	hashCalculator := utils.NewHashCalculator()
+	for _, line := range lines {
+		hash, path, ok := strings.Cut(line, "  ")
+		if !ok {
+			t.Fatalf("Manifest line is not in sha256sum format: %q", line)
+		}
+
+		expected, err := hashCalculator.CalculateHash(path, "sha256")
+		if err != nil {
+			t.Fatalf("Failed to recompute hash for %s: %v", path, err)
+		}
+		if hash != expected {
+			t.Errorf("Hash for %s = %s, want %s", path, hash, expected)
+		}
+	}
+}
+
+func TestReadURLsFromFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		want     []interfaces.DownloadRequest
+	}{
+		{
+			name:     "plain list",
+			filename: "urls.txt",
+			content:  "https://example.com/a.zip\nhttps://example.com/b.zip\n",
+			want: []interfaces.DownloadRequest{
+				{URL: "https://example.com/a.zip"},
+				{URL: "https://example.com/b.zip"},
+			},
+		},
+		{
+			name:     "two-column format",
+			filename: "urls.txt",
+			content:  "https://example.com/a.zip  first.zip\nhttps://example.com/b\tsecond file.bin\nhttps://example.com/c.zip\n",
+			want: []interfaces.DownloadRequest{
+				{URL: "https://example.com/a.zip", CustomFilename: "first.zip"},
+				{URL: "https://example.com/b", CustomFilename: "second file.bin"},
+				{URL: "https://example.com/c.zip"},
+			},
+		},
+		{
+			name:     "CRLF line endings",
+			filename: "urls.txt",
+			content:  "https://example.com/a.zip\r\n\r\nhttps://example.com/b.zip  b.zip\r\n   \r\n",
+			want: []interfaces.DownloadRequest{
+				{URL: "https://example.com/a.zip"},
+				{URL: "https://example.com/b.zip", CustomFilename: "b.zip"},
+			},
+		},
+		{
+			name:     "comments and blank lines",
+			filename: "urls.txt",
+			content:  "# downloads for today\n\n  # indented comment\nhttps://example.com/a.zip\n\n",
+			want: []interfaces.DownloadRequest{
+				{URL: "https://example.com/a.zip"},
+			},
+		},
+		{
+			name:     "windows shortcut",
+			filename: "link.url",
+			content:  "[InternetShortcut]\r\nURL=https://example.com/a.zip\r\n",
+			want: []interfaces.DownloadRequest{
+				{URL: "https://example.com/a.zip"},
+			},
+		},
+		{
+			name:     "webloc",
+			filename: "link.webloc",
+			content: `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>URL</key>
+	<string>https://example.com/a.zip?x=1&amp;y=2</string>
+</dict>
+</plist>`,
+			want: []interfaces.DownloadRequest{
+				{URL: "https://example.com/a.zip?x=1&y=2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.filename)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write URL file: %v", err)
+			}
+
+			got, err := readURLsFromFile(path)
+			if err != nil {
+				t.Fatalf("readURLsFromFile() error = %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("readURLsFromFile() returned %d requests, want %d", len(got), len(tt.want))
+			}
+			for i, req := range got {
+				if req.URL != tt.want[i].URL || req.CustomFilename != tt.want[i].CustomFilename {
+					t.Errorf("request %d = {%q, %q}, want {%q, %q}",
+						i, req.URL, req.CustomFilename, tt.want[i].URL, tt.want[i].CustomFilename)
+				}
+			}
+		})
+	}
+
+	t.Run("shortcut without URL", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "empty.url")
+		if err := os.WriteFile(path, []byte("[InternetShortcut]\n"), 0644); err != nil {
+			t.Fatalf("Failed to write URL file: %v", err)
+		}
+		if _, err := readURLsFromFile(path); err == nil {
+			t.Error("Expected error for shortcut without URL")
+		}
+	})
+}
+
+func TestReadURLs(t *testing.T) {
+	input := "# piped in\nhttps://example.com/a.zip\r\n\nhttps://example.com/b.zip  b-renamed.zip\n"
+
+	got, err := readURLs(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("readURLs() error = %v", err)
+	}
+
+	want := []interfaces.DownloadRequest{
+		{URL: "https://example.com/a.zip"},
+		{URL: "https://example.com/b.zip", CustomFilename: "b-renamed.zip"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("readURLs() returned %d requests, want %d", len(got), len(want))
+	}
+	for i, req := range got {
+		if req.URL != want[i].URL || req.CustomFilename != want[i].CustomFilename {
+			t.Errorf("request %d = {%q, %q}, want {%q, %q}", i, req.URL, req.CustomFilename, want[i].URL, want[i].CustomFilename)
+		}
+	}
+}
+
+func TestCollectURLs_Stdin(t *testing.T) {
+	defer func(u, f string) { *url, *urlFile = u, f }(*url, *urlFile)
+
+	tests := []struct {
+		name       string
+		url        string
+		urlFile    string
+		stdinPiped bool
+		want       []string
+	}{
+		{name: "url-file dash reads stdin", urlFile: "-", want: []string{"https://example.com/piped.zip"}},
+		{name: "piped stdin without URL flags", stdinPiped: true, want: []string{"https://example.com/piped.zip"}},
+		{name: "URL flag takes precedence over piped stdin", url: "https://example.com/flag.zip", stdinPiped: true, want: []string{"https://example.com/flag.zip"}},
+		{name: "terminal stdin is not read", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*url, *urlFile = tt.url, tt.urlFile
+
+			got, err := collectURLs(strings.NewReader("https://example.com/piped.zip\n"), tt.stdinPiped)
+			if err != nil {
+				t.Fatalf("collectURLs() error = %v", err)
+			}
+
+			var gotURLs []string
+			for _, req := range got {
+				gotURLs = append(gotURLs, req.URL)
+			}
+			if strings.Join(gotURLs, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("collectURLs() = %v, want %v", gotURLs, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNoClobber(t *testing.T) {
+	server := newTestFileServer(map[string]string{
+		"existing.txt": "already downloaded",
+		"fresh.txt":    "not downloaded yet",
+	})
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	manager := downloader.NewManager(&downloader.ManagerOptions{
+		ChunkSize: 1024 * 1024,
+		Timeout:   30 * time.Second,
+		OutputDir: tmpDir,
+	})
+	manager.RegisterService(&testService{serverURL: server.URL})
+
+	existing := filepath.Join(tmpDir, "existing.txt")
+	if err := os.WriteFile(existing, []byte("keep me"), 0644); err != nil {
+		t.Fatalf("Failed to create existing file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		req     *interfaces.DownloadRequest
+		wantErr bool
+	}{
+		{"existing file is refused", &interfaces.DownloadRequest{URL: "https://test.com/existing.txt"}, true},
+		{"missing file is allowed", &interfaces.DownloadRequest{URL: "https://test.com/fresh.txt"}, false},
+		{"custom filename is checked", &interfaces.DownloadRequest{URL: "https://test.com/fresh.txt", CustomFilename: "existing.txt"}, true},
+		{"explicit output path is checked", &interfaces.DownloadRequest{URL: "https://test.com/fresh.txt", OutputPath: existing}, true},
+		{"stdout is never refused", &interfaces.DownloadRequest{URL: "https://test.com/existing.txt", OutputPath: downloader.StdoutPath}, false},
+		{"missing directory is allowed", &interfaces.DownloadRequest{URL: "https://test.com/fresh.txt", OutputPath: filepath.Join(tmpDir, "new", "fresh.txt")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkNoClobber(context.Background(), manager, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkNoClobber() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(existing)
+	if err != nil || string(data) != "keep me" {
+		t.Errorf("existing file was modified: %q, %v", data, err)
+	}
+
+	// Checking leaves no directories or write-check files behind
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "existing.txt" {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("output directory holds %q after checking, want only existing.txt", names)
+	}
+}
+
+func TestResolveNetrcPath(t *testing.T) {
+	existing := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(existing, []byte("default login a password b\n"), 0600); err != nil {
+		t.Fatalf("Failed to write netrc: %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "netrc")
+
+	tests := []struct {
+		name       string
+		useDefault bool
+		file       string
+		envNetrc   string
+		want       string
+	}{
+		{name: "disabled", envNetrc: existing, want: ""},
+		{name: "explicit file", file: missing, want: missing},
+		{name: "default file", useDefault: true, envNetrc: existing, want: existing},
+		{name: "missing default file", useDefault: true, envNetrc: missing, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NETRC", tt.envNetrc)
+
+			got, err := resolveNetrcPath(tt.useDefault, tt.file)
+			if err != nil {
+				t.Fatalf("resolveNetrcPath() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveNetrcPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveHashAlgorithm(t *testing.T) {
+	md5Digest := strings.Repeat("a", 32)
+	sha256Digest := strings.Repeat("b", 64)
+
+	tests := []struct {
+		name       string
+		algorithm  string
+		verifyHash string
+		explicit   bool
+		want       string
+	}{
+		{name: "no digest keeps the default", algorithm: "sha256", want: "sha256"},
+		{name: "32-char digest selects md5", algorithm: "sha256", verifyHash: md5Digest, want: "md5"},
+		{name: "40-char digest selects sha1", algorithm: "sha256", verifyHash: strings.Repeat("c", 40), want: "sha1"},
+		{name: "64-char digest stays sha256", algorithm: "sha256", verifyHash: sha256Digest, want: "sha256"},
+		{name: "128-char digest selects sha512", algorithm: "sha256", verifyHash: strings.Repeat("d", 128), want: "sha512"},
+		{name: "unknown length keeps the default", algorithm: "sha256", verifyHash: "abc123", want: "sha256"},
+		{name: "explicit algorithm wins", algorithm: "sha256", verifyHash: md5Digest, explicit: true, want: "sha256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveHashAlgorithm(tt.algorithm, tt.verifyHash, tt.explicit); got != tt.want {
+				t.Errorf("resolveHashAlgorithm(%q, %q, %v) = %q, want %q", tt.algorithm, tt.verifyHash, tt.explicit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDefaults_Precedence(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	config := "output-dir: /from/file\nmax-connections: 4\nchunk-size: 2MB\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	flags := flag.NewFlagSet("cloudget", flag.ContinueOnError)
+	outputDir := flags.String("output-dir", ".", "")
+	maxConnections := flags.Int("max-connections", 8, "")
+	chunkSize := flags.String("chunk-size", "1MB", "")
+	verbose := flags.Bool("verbose", false, "")
+
+	environ := []string{
+		"CLOUDGET_MAX_CONNECTIONS=12",
+		"CLOUDGET_CHUNK_SIZE=3MB",
+		"CLOUDGET_UNKNOWN_OPTION=ignored",
+		"CLOUDGET_CONFIG=" + configPath,
+		"PATH=/usr/bin",
+	}
+	if err := loadDefaults(flags, configPath, environ); err != nil {
+		t.Fatalf("loadDefaults() error = %v", err)
+	}
+	if err := flags.Parse([]string{"-chunk-size", "5MB"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"file over built-in", *outputDir, "/from/file"},
+		{"env over file", *maxConnections, 12},
+		{"flag over env", *chunkSize, "5MB"},
+		{"built-in when unset", *verbose, false},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadDefaults_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		environ []string
+		wantErr string
+	}{
+		{name: "unknown option in file", config: "max-conections: 4\n", wantErr: `unknown option "max-conections"`},
+		{name: "invalid value in file", config: "max-connections: many\n", wantErr: "invalid value"},
+		{name: "invalid value in env", environ: []string{"CLOUDGET_MAX_CONNECTIONS=many"}, wantErr: "in environment"},
+		{name: "malformed file", config: "max-connections: [\n", wantErr: "invalid config file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if tt.config != "" {
+				if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+					t.Fatalf("Failed to write config file: %v", err)
+				}
+			}
+
+			flags := flag.NewFlagSet("cloudget", flag.ContinueOnError)
+			flags.Int("max-connections", 8, "")
+
+			err := loadDefaults(flags, configPath, tt.environ)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadDefaults() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadDefaults_MissingFile(t *testing.T) {
+	flags := flag.NewFlagSet("cloudget", flag.ContinueOnError)
+	outputDir := flags.String("output-dir", ".", "")
+
+	if err := loadDefaults(flags, filepath.Join(t.TempDir(), "missing.yaml"), nil); err != nil {
+		t.Fatalf("loadDefaults() error = %v", err)
+	}
+	if *outputDir != "." {
+		t.Errorf("output-dir = %q, want the built-in default", *outputDir)
+	}
+}
+
+func TestRunBatch_TotalTimeout(t *testing.T) {
+	// Slow files hold their GET open until the client gives up
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content := "served right away"
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		if strings.HasPrefix(r.URL.Path, "/slow") && r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		if r.Method != http.MethodHead {
+			io.WriteString(w, content)
+		}
+	}))
+	defer server.Close()
+
+	newTestManager := func(outputDir string) *downloader.Manager {
+		manager := downloader.NewManager(&downloader.ManagerOptions{
+			ChunkSize: 1024 * 1024,
+			Timeout:   30 * time.Second,
+			OutputDir: outputDir,
+		})
+		manager.RegisterService(&testService{serverURL: server.URL})
+		return manager
+	}
+
+	newRequests := func(paths ...string) []*interfaces.DownloadRequest {
+		var requests []*interfaces.DownloadRequest
+		for _, path := range paths {
+			requests = append(requests, &interfaces.DownloadRequest{URL: "https://test.com/" + path})
+		}
+		return requests
+	}
+
+	logger, _ := logtest.NewNullLogger()
+
+	t.Run("expired budget cancels the download in flight and skips the rest", func(t *testing.T) {
+		manager := newTestManager(t.TempDir())
+		defer manager.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		summary := runBatch(ctx, manager, newRequests("fast.txt", "slow1.txt", "slow2.txt", "slow3.txt"), logger, "sha256")
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("batch took %v, want it stopped by the total timeout", elapsed)
+		}
+
+		if summary.successCount != 1 || summary.failCount != 1 {
+			t.Errorf("successful = %d, failed = %d, want 1 and 1", summary.successCount, summary.failCount)
+		}
+		wantSkipped := []string{"https://test.com/slow2.txt", "https://test.com/slow3.txt"}
+		if strings.Join(summary.skipped, ",") != strings.Join(wantSkipped, ",") {
+			t.Errorf("skipped = %v, want %v", summary.skipped, wantSkipped)
+		}
+		if len(summary.downloadedFiles) != 1 || filepath.Base(summary.downloadedFiles[0]) != "fast.txt" {
+			t.Errorf("downloaded files = %v, want only fast.txt", summary.downloadedFiles)
+		}
+	})
+
+	t.Run("batch within the budget runs every download", func(t *testing.T) {
+		manager := newTestManager(t.TempDir())
+		defer manager.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		summary := runBatch(ctx, manager, newRequests("a.txt", "b.txt", "c.txt"), logger, "sha256")
+		if summary.successCount != 3 || summary.failCount != 0 || len(summary.skipped) != 0 {
+			t.Errorf("successful = %d, failed = %d, skipped = %v, want all 3 successful", summary.successCount, summary.failCount, summary.skipped)
+		}
+		if summary.totalBytes != 3*int64(len("served right away")) {
+			t.Errorf("total bytes = %d, want %d", summary.totalBytes, 3*len("served right away"))
+		}
+	})
+}
+
+func TestParseDNSOverrides(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: "cdn.example.com=203.0.113.7", want: map[string]string{"cdn.example.com": "203.0.113.7"}},
+		{
+			value: "a.example.com=127.0.0.1:8443, b.example.com = ::1",
+			want:  map[string]string{"a.example.com": "127.0.0.1:8443", "b.example.com": "::1"},
+		},
+		{value: "cdn.example.com", wantErr: true},
+		{value: "=203.0.113.7", wantErr: true},
+		{value: "cdn.example.com=203.0.113.7,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDNSOverrides(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseDNSOverrides(%q) succeeded, want an error", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseDNSOverrides(%q) error = %v", tt.value, err)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseDNSOverrides(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// ConflictAction is what a download does when a different file already
+// exists at its output path
+type ConflictAction int
+
+const (
+	// ConflictOverwrite replaces the existing file, the default
+	ConflictOverwrite ConflictAction = iota
+	// ConflictSkip keeps the existing file and reports it as the result
+	ConflictSkip
+	// ConflictRename writes the download to the path the resolver returned
+	ConflictRename
+)
+
+// ConflictResolver decides what to do about the file at existingPath, which
+// differs in size from the file described by info. The returned path is only
+// used with ConflictRename.
+type ConflictResolver func(existingPath string, info *interfaces.FileInfo) (newPath string, action ConflictAction)
+
+// resolveConflict consults ManagerOptions.ConflictResolver about an existing
+// file at outputPath and returns the path to download to, or skip if the
+// existing file should be kept. A partial file that's about to be resumed in
+// place isn't a conflict.
+func (m *Manager) resolveConflict(ctx context.Context, outputPath string, fileInfo *interfaces.FileInfo, resume bool) (path string, skip bool, err error) {
+	if m.options.ConflictResolver == nil || (resume && !m.options.UseTempFile) {
+		return outputPath, false, nil
+	}
+
+	existing, err := os.Stat(outputPath)
+	if err != nil || existing.Size() == fileInfo.Size {
+		return outputPath, false, nil
+	}
+
+	newPath, action := m.options.ConflictResolver(outputPath, fileInfo)
+	logger := utils.LoggerFromContext(ctx, m.logger)
+
+	switch action {
+	case ConflictOverwrite:
+		return outputPath, false, nil
+	case ConflictSkip:
+		logger.Infof("Keeping existing file: %s", outputPath)
+		return outputPath, true, nil
+	case ConflictRename:
+		if newPath == "" {
+			return "", false, fmt.Errorf("conflict resolver chose to rename %s without giving a new path", outputPath)
+		}
+		if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+			return "", false, fmt.Errorf("failed to create directory for %s: %w", newPath, err)
+		}
+		logger.Infof("%s already exists, downloading to %s instead", outputPath, newPath)
+		return newPath, false, nil
+	default:
+		return "", false, fmt.Errorf("unknown conflict action %d", action)
+	}
+}
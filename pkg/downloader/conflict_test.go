@@ -0,0 +1,136 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_Download_ConflictResolver(t *testing.T) {
+	content := "fresh content"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	stamp := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	timestamped := func(existingPath string, info *interfaces.FileInfo) (string, ConflictAction) {
+		ext := filepath.Ext(existingPath)
+		return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(existingPath, ext), stamp.Format("20060102-150405"), ext), ConflictRename
+	}
+
+	tests := []struct {
+		name     string
+		resolver ConflictResolver
+		wantPath string // Relative to the output directory
+		wantOld  string // Content left in the existing file
+	}{
+		{
+			name:     "rename to timestamped path",
+			resolver: timestamped,
+			wantPath: "report-20240501-123000.txt",
+			wantOld:  "old",
+		},
+		{
+			name: "skip keeps existing file",
+			resolver: func(string, *interfaces.FileInfo) (string, ConflictAction) {
+				return "", ConflictSkip
+			},
+			wantPath: "report.txt",
+			wantOld:  "old",
+		},
+		{
+			name:     "nil resolver overwrites",
+			wantPath: "report.txt",
+			wantOld:  content,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			existing := filepath.Join(tmpDir, "report.txt")
+			if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+				t.Fatalf("Failed to create existing file: %v", err)
+			}
+
+			manager := NewManager(&ManagerOptions{
+				ChunkSize:        1024,
+				Timeout:          10 * time.Second,
+				OutputDir:        tmpDir,
+				Resume:           true,
+				UseTempFile:      true,
+				ConflictResolver: tt.resolver,
+			})
+			manager.RegisterService(&mockService{
+				name:        "Test Service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "report.txt", Size: int64(len(content))}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/report"})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			wantPath := filepath.Join(tmpDir, tt.wantPath)
+			if result.FilePath != wantPath {
+				t.Errorf("FilePath = %q, want %q", result.FilePath, wantPath)
+			}
+			if wantPath != existing {
+				if data, err := os.ReadFile(wantPath); err != nil || string(data) != content {
+					t.Errorf("renamed file = %q, %v, want %q", data, err, content)
+				}
+			}
+			if data, _ := os.ReadFile(existing); string(data) != tt.wantOld {
+				t.Errorf("existing file = %q, want %q", data, tt.wantOld)
+			}
+		})
+	}
+}
+
+func TestManager_Download_ConflictResolverNotCalledForCompleteFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	existing := filepath.Join(tmpDir, "report.txt")
+	if err := os.WriteFile(existing, []byte("same"), 0644); err != nil {
+		t.Fatalf("Failed to create existing file: %v", err)
+	}
+
+	called := false
+	manager := NewManager(&ManagerOptions{
+		OutputDir:   tmpDir,
+		Resume:      true,
+		UseTempFile: true,
+		ConflictResolver: func(string, *interfaces.FileInfo) (string, ConflictAction) {
+			called = true
+			return "", ConflictOverwrite
+		},
+	})
+	manager.RegisterService(&mockService{
+		name:        "Test Service",
+		supportedFn: func(url string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "report.txt", Size: 4}, nil
+		},
+	})
+
+	if _, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/report"}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if called {
+		t.Error("resolver was consulted for a file that's already complete")
+	}
+}
@@ -0,0 +1,79 @@
+package downloader
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+// checkContentType refuses a file whose Content-Type is blocked or missing
+// from the allow-list. With an allow-list set, a file without a reported
+// Content-Type is refused too, since nothing says it's one of the allowed types.
+func (m *Manager) checkContentType(url, contentType string) error {
+	if len(m.options.AllowedContentTypes) == 0 && len(m.options.BlockedContentTypes) == 0 {
+		return nil
+	}
+
+	mediaType := normalizeMediaType(contentType)
+
+	for _, pattern := range m.options.BlockedContentTypes {
+		if matchContentType(pattern, mediaType) {
+			return &interfaces.DownloadError{
+				Type:    interfaces.ErrContentTypeRefused.Type,
+				Message: fmt.Sprintf("content type %s is blocked by %q", mediaType, pattern),
+				URL:     url,
+			}
+		}
+	}
+
+	if len(m.options.AllowedContentTypes) == 0 {
+		return nil
+	}
+
+	for _, pattern := range m.options.AllowedContentTypes {
+		if matchContentType(pattern, mediaType) {
+			return nil
+		}
+	}
+
+	message := fmt.Sprintf("content type %s is not in the allowed list %v", mediaType, m.options.AllowedContentTypes)
+	if mediaType == "" {
+		message = "server did not report a content type and an allowed list is set"
+	}
+	return &interfaces.DownloadError{
+		Type:    interfaces.ErrContentTypeRefused.Type,
+		Message: message,
+		URL:     url,
+	}
+}
+
+// normalizeMediaType strips parameters such as charset and lower-cases the type
+func normalizeMediaType(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// matchContentType reports whether mediaType matches pattern, which is either
+// an exact media type, "type/*", or "*" / "*/*" for anything
+func matchContentType(pattern, mediaType string) bool {
+	if mediaType == "" {
+		return false
+	}
+
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "*" || pattern == "*/*" {
+		return true
+	}
+
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		major, _, _ := strings.Cut(mediaType, "/")
+		return major == prefix
+	}
+
+	return pattern == normalizeMediaType(mediaType)
+}
@@ -0,0 +1,86 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_checkContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowed     []string
+		blocked     []string
+		contentType string
+		wantErr     bool
+	}{
+		{name: "no lists allows anything", contentType: "text/html", wantErr: false},
+		{name: "allow list exact match", allowed: []string{"application/pdf"}, contentType: "application/pdf", wantErr: false},
+		{name: "allow list ignores parameters and case", allowed: []string{"application/pdf"}, contentType: "Application/PDF; qs=0.9", wantErr: false},
+		{name: "allow list wildcard match", allowed: []string{"video/*"}, contentType: "video/mp4", wantErr: false},
+		{name: "not in allow list", allowed: []string{"application/pdf", "video/*"}, contentType: "text/html; charset=utf-8", wantErr: true},
+		{name: "allow list refuses unknown type", allowed: []string{"application/pdf"}, contentType: "", wantErr: true},
+		{name: "block list exact match", blocked: []string{"text/html"}, contentType: "text/html; charset=utf-8", wantErr: true},
+		{name: "block list wildcard match", blocked: []string{"text/*"}, contentType: "text/plain", wantErr: true},
+		{name: "block list wildcard miss", blocked: []string{"text/*"}, contentType: "application/zip", wantErr: false},
+		{name: "block list allows unknown type", blocked: []string{"text/*"}, contentType: "", wantErr: false},
+		{name: "block list wins over allow list", allowed: []string{"*/*"}, blocked: []string{"text/html"}, contentType: "text/html", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(&ManagerOptions{
+				OutputDir:           t.TempDir(),
+				AllowedContentTypes: tt.allowed,
+				BlockedContentTypes: tt.blocked,
+			})
+
+			err := manager.checkContentType("https://test.com/file", tt.contentType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkContentType(%q) error = %v, wantErr %v", tt.contentType, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, interfaces.ErrContentTypeRefused) {
+				t.Errorf("error = %v, want it to match ErrContentTypeRefused", err)
+			}
+		})
+	}
+}
+
+func TestManager_Download_BlockedContentType(t *testing.T) {
+	tmpDir := t.TempDir()
+	manager := NewManager(&ManagerOptions{
+		ChunkSize:           1024,
+		Timeout:             10 * time.Second,
+		OutputDir:           tmpDir,
+		BlockedContentTypes: []string{"text/html"},
+	})
+
+	prepared := false
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(url string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "report.pdf", Size: 2048, ContentType: "text/html; charset=utf-8"}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			prepared = true
+			return url, nil
+		},
+	})
+
+	_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file/123"})
+	if !errors.Is(err, ErrContentTypeRefused) {
+		t.Fatalf("Download() error = %v, want ErrContentTypeRefused", err)
+	}
+	if prepared {
+		t.Error("PrepareDownload was called for a refused file")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "report.pdf")); !os.IsNotExist(err) {
+		t.Errorf("refused file was written: %v", err)
+	}
+}
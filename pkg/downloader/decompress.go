@@ -0,0 +1,229 @@
+package downloader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// gzipMagic starts every gzip file
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isGzipFile reports whether the file at path starts with the gzip magic number
+func isGzipFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, len(gzipMagic))
+	if _, err := io.ReadFull(file, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(header, gzipMagic), nil
+}
+
+// decompressedName returns the name of the file a gzip file named name
+// holds: ".gz" is dropped and ".tgz" becomes ".tar". Other names are kept.
+func decompressedName(name string) string {
+	ext := filepath.Ext(name)
+	switch strings.ToLower(ext) {
+	case ".gz":
+		if trimmed := strings.TrimSuffix(name, ext); trimmed != "" {
+			return trimmed
+		}
+	case ".tgz":
+		return strings.TrimSuffix(name, ext) + ".tar"
+	}
+	return name
+}
+
+// decompressDownload replaces the finished download at writePath, bound for
+// outputPath, with its decompressed contents when it's gzip. The contents
+// go to a temporary file next to the decompressed output path, which the
+// caller verifies and moves into place like any download. It returns the new
+// write and output paths, which are the old ones when the file isn't gzip
+// or a file already at the decompressed name is kept.
+func (m *Manager) decompressDownload(ctx context.Context, req *interfaces.DownloadRequest, writePath, outputPath string, fileInfo *interfaces.FileInfo) (string, string, error) {
+	logger := utils.LoggerFromContext(ctx, m.logger)
+
+	gz, err := isGzipFile(writePath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to check for gzip: %w", err)
+	}
+	if !gz {
+		logger.Infof("Not decompressing %s, it isn't gzip", filepath.Base(outputPath))
+		return writePath, outputPath, nil
+	}
+
+	newPath := filepath.Join(filepath.Dir(outputPath), decompressedName(filepath.Base(outputPath)))
+	if newPath != outputPath {
+		if err := m.checkSymlinks(newPath, false); err != nil {
+			return "", "", err
+		}
+		decompressed := *fileInfo
+		decompressed.Filename = filepath.Base(newPath)
+		decompressed.Size = 0
+		decompressed.SizeKnown = false
+		var skip bool
+		newPath, skip, err = m.resolveConflict(ctx, newPath, &decompressed, false)
+		if err != nil {
+			return "", "", err
+		}
+		if skip {
+			logger.Infof("Keeping %s compressed, %s already exists", filepath.Base(outputPath), filepath.Base(newPath))
+			return writePath, outputPath, nil
+		}
+	}
+
+	tempPath, err := gunzipFile(writePath, newPath)
+	if err != nil {
+		return "", "", &interfaces.DownloadError{
+			Type:    interfaces.ErrInvalidResponse.Type,
+			Message: fmt.Sprintf("failed to decompress %s: %v", filepath.Base(outputPath), err),
+			URL:     req.URL,
+			Err:     err,
+		}
+	}
+
+	if err := os.Remove(writePath); err != nil {
+		logger.Warnf("Failed to remove compressed download: %v", err)
+	}
+	logger.Infof("Decompressed %s to %s", filepath.Base(outputPath), filepath.Base(newPath))
+	return tempPath, newPath, nil
+}
+
+// gunzipFile decompresses the gzip file at src into a new temporary file
+// in the directory of dst and returns its path
+func gunzipFile(src, dst string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	reader, err := gzip.NewReader(in)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*"+partFileSuffix)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// gunzipWriter decompresses what's written to it into dst when it starts
+// with the gzip magic number, and passes it through unchanged otherwise
+type gunzipWriter struct {
+	dst     io.Writer
+	header  []byte // Held back until there's enough to check for the magic number
+	decided bool
+	pipe    *io.PipeWriter
+	done    chan error
+	written int64 // Bytes that reached dst, known once finish returns
+}
+
+func newGunzipWriter(dst io.Writer) *gunzipWriter {
+	return &gunzipWriter{dst: dst}
+}
+
+func (g *gunzipWriter) Write(p []byte) (int, error) {
+	if g.decided {
+		return g.forward(p)
+	}
+
+	g.header = append(g.header, p...)
+	if len(g.header) < len(gzipMagic) {
+		return len(p), nil
+	}
+	if err := g.decide(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// decide starts decompressing or passing through, then forwards the bytes
+// held back so far
+func (g *gunzipWriter) decide() error {
+	g.decided = true
+	if bytes.HasPrefix(g.header, gzipMagic) {
+		pr, pw := io.Pipe()
+		g.pipe = pw
+		g.done = make(chan error, 1)
+		go func() {
+			n, err := gunzipStream(pr, g.dst)
+			g.written = n
+			// Unblocks the writer if decompression stopped early
+			pr.CloseWithError(err)
+			g.done <- err
+		}()
+	}
+
+	header := g.header
+	g.header = nil
+	_, err := g.forward(header)
+	return err
+}
+
+func (g *gunzipWriter) forward(p []byte) (int, error) {
+	if g.pipe != nil {
+		return g.pipe.Write(p)
+	}
+	n, err := g.dst.Write(p)
+	g.written += int64(n)
+	return n, err
+}
+
+// finish ends the stream, failing it with streamErr if that's non-nil, and
+// waits for the decompressed data to reach dst
+func (g *gunzipWriter) finish(streamErr error) error {
+	if !g.decided {
+		if streamErr != nil {
+			return streamErr
+		}
+		if err := g.decide(); err != nil {
+			return err
+		}
+	}
+	if g.pipe == nil {
+		return streamErr
+	}
+	g.pipe.CloseWithError(streamErr)
+	return <-g.done
+}
+
+// gunzipStream copies the decompressed contents of the gzip stream r to w
+// and returns how many bytes it wrote
+func gunzipStream(r io.Reader, w io.Writer) (int64, error) {
+	reader, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	return io.Copy(w, reader)
+}
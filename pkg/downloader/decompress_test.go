@@ -0,0 +1,205 @@
+package downloader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+// gzipped compresses data the way a server hosting a .gz file would have
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// newDecompressTestManager returns a manager whose only service serves
+// content under filename
+func newDecompressTestManager(t *testing.T, outputDir, filename string, content []byte, useTempFile bool) *Manager {
+	t.Helper()
+
+	server := newRangeServer(content)
+	t.Cleanup(server.Close)
+
+	manager := NewManager(&ManagerOptions{
+		MaxConnections: 2,
+		ChunkSize:      1024,
+		Timeout:        10 * time.Second,
+		OutputDir:      outputDir,
+		VerifyHash:     true,
+		HashAlgorithm:  "sha256",
+		UseTempFile:    useTempFile,
+	})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: filename, Size: int64(len(content)), URL: url, SupportsRange: true}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+	return manager
+}
+
+func TestManager_Download_Decompress(t *testing.T) {
+	original := []byte(strings.Repeat("decompressed after download ", 400))
+	compressed := gzipped(t, original)
+	originalSum := sha256.Sum256(original)
+	compressedSum := sha256.Sum256(compressed)
+	corrupt := append(append([]byte{}, compressed[:20]...), bytes.Repeat([]byte{0xff}, 200)...)
+
+	tests := []struct {
+		name        string
+		filename    string
+		content     []byte
+		useTempFile bool
+		verifyHash  string
+		wantFile    string
+		wantData    []byte
+		wantErr     error
+	}{
+		{name: "gz suffix is dropped", filename: "data.txt.gz", content: compressed, wantFile: "data.txt", wantData: original},
+		{name: "through a temp file", filename: "data.txt.gz", content: compressed, useTempFile: true, wantFile: "data.txt", wantData: original},
+		{name: "tgz becomes tar", filename: "archive.tgz", content: compressed, wantFile: "archive.tar", wantData: original},
+		{name: "gzip without the suffix keeps its name", filename: "data.bin", content: compressed, wantFile: "data.bin", wantData: original},
+		{name: "hash checks the decompressed file", filename: "data.txt.gz", content: compressed, verifyHash: hex.EncodeToString(originalSum[:]), wantFile: "data.txt", wantData: original},
+		{name: "hash of the compressed file doesn't match", filename: "data.txt.gz", content: compressed, verifyHash: hex.EncodeToString(compressedSum[:]), wantErr: ErrHashMismatch},
+		{name: "plain file is left alone", filename: "notes.txt", content: original, wantFile: "notes.txt", wantData: original},
+		{name: "corrupt gzip fails", filename: "broken.gz", content: corrupt, wantErr: ErrInvalidResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			manager := newDecompressTestManager(t, outputDir, tt.filename, tt.content, tt.useTempFile)
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{
+				URL:        "https://test.com/" + tt.filename,
+				VerifyHash: tt.verifyHash,
+				Decompress: true,
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Download() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			wantPath := filepath.Join(outputDir, tt.wantFile)
+			if result.FilePath != wantPath {
+				t.Errorf("FilePath = %s, want %s", result.FilePath, wantPath)
+			}
+			if result.Size != int64(len(tt.wantData)) {
+				t.Errorf("Size = %d, want %d", result.Size, len(tt.wantData))
+			}
+			data, err := os.ReadFile(wantPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if !bytes.Equal(data, tt.wantData) {
+				t.Error("Output doesn't match the original contents")
+			}
+
+			entries, err := os.ReadDir(outputDir)
+			if err != nil {
+				t.Fatalf("Failed to read output directory: %v", err)
+			}
+			if len(entries) != 1 {
+				var names []string
+				for _, entry := range entries {
+					names = append(names, entry.Name())
+				}
+				t.Errorf("Output directory holds %v, want only %s", names, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestManager_DownloadToWriter_Decompress(t *testing.T) {
+	original := []byte(strings.Repeat("decompressed while streaming ", 400))
+	compressed := gzipped(t, original)
+	originalSum := sha256.Sum256(original)
+
+	tests := []struct {
+		name       string
+		content    []byte
+		verifyHash string
+		wantErr    error
+	}{
+		{name: "gzip stream", content: compressed},
+		{name: "hash checks the decompressed stream", content: compressed, verifyHash: hex.EncodeToString(originalSum[:])},
+		{name: "plain stream passes through", content: original},
+		{name: "corrupt gzip stream fails", content: append(append([]byte{}, compressed[:20]...), bytes.Repeat([]byte{0xff}, 200)...), wantErr: ErrInvalidResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newDecompressTestManager(t, t.TempDir(), "stream.gz", tt.content, false)
+
+			var buf bytes.Buffer
+			result, err := manager.DownloadToWriter(context.Background(), &interfaces.DownloadRequest{
+				URL:        "https://test.com/stream.gz",
+				VerifyHash: tt.verifyHash,
+				Decompress: true,
+			}, &buf)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DownloadToWriter() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadToWriter failed: %v", err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), original) {
+				t.Error("Streamed content doesn't match the original contents")
+			}
+			if result.Size != int64(len(original)) {
+				t.Errorf("Size = %d, want %d", result.Size, len(original))
+			}
+		})
+	}
+}
+
+func TestDecompressedName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"data.txt.gz", "data.txt"},
+		{"DATA.TXT.GZ", "DATA.TXT"},
+		{"archive.tgz", "archive.tar"},
+		{"plain.txt", "plain.txt"},
+		{".gz", ".gz"},
+	}
+
+	for _, tt := range tests {
+		if got := decompressedName(tt.name); got != tt.want {
+			t.Errorf("decompressedName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// errFreeSpaceUnsupported is returned by diskFreeSpace on platforms where
+// free space can't be queried, the space check is skipped there
+var errFreeSpaceUnsupported = errors.New("free space can't be determined on this platform")
+
+// checkFreeSpace refuses a download of size bytes into writePath when the
+// filesystem doesn't have room for it plus ManagerOptions.MinFreeSpace.
+// Bytes already in a partial file that will be resumed don't count again.
+// Downloads of unknown size can't be checked and always pass.
+func (m *Manager) checkFreeSpace(ctx context.Context, writePath string, size int64, resume bool) error {
+	if size <= 0 {
+		return nil
+	}
+
+	needed := size
+	if resume {
+		if info, err := os.Stat(writePath); err == nil && info.Mode().IsRegular() {
+			needed -= min(info.Size(), size)
+		}
+	}
+
+	dir := filepath.Dir(writePath)
+	free, err := m.freeSpace(dir)
+	if err != nil {
+		if !errors.Is(err, errFreeSpaceUnsupported) {
+			utils.LoggerFromContext(ctx, m.logger).Warnf("Could not determine free space in %s: %v", dir, err)
+		}
+		return nil
+	}
+
+	reserve := max(m.options.MinFreeSpace, 0)
+	if free-needed >= reserve {
+		return nil
+	}
+
+	message := fmt.Sprintf("need %s in %s but only %s is free", utils.FormatBytes(needed), dir, utils.FormatBytes(free))
+	if reserve > 0 {
+		message = fmt.Sprintf("need %s in %s plus %s kept free, but only %s is free",
+			utils.FormatBytes(needed), dir, utils.FormatBytes(reserve), utils.FormatBytes(free))
+	}
+	return &interfaces.DownloadError{
+		Type:    interfaces.ErrInsufficientSpace.Type,
+		Message: message,
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package downloader
+
+// diskFreeSpace can't query free space here, so the space check is skipped
+func diskFreeSpace(dir string) (int64, error) {
+	return 0, errFreeSpaceUnsupported
+}
@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_Download_MinFreeSpace(t *testing.T) {
+	content := []byte(strings.Repeat("x", 1000))
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		free         int64
+		minFreeSpace int64
+		wantErr      bool
+	}{
+		{name: "fits with room to spare", free: 5000, minFreeSpace: 1000},
+		{name: "fits but eats into the reserve", free: 1500, minFreeSpace: 1000, wantErr: true},
+		{name: "fits exactly without a reserve", free: 1000},
+		{name: "doesn't fit", free: 999, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			tmpDir := t.TempDir()
+			manager := NewManager(&ManagerOptions{
+				ChunkSize:    1024,
+				Timeout:      10 * time.Second,
+				OutputDir:    tmpDir,
+				MinFreeSpace: tt.minFreeSpace,
+			})
+			manager.freeSpace = func(dir string) (int64, error) {
+				return tt.free, nil
+			}
+			manager.RegisterService(&mockService{
+				name:        "Test Service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "big.bin", Size: int64(len(content))}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/big.bin"})
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Download() error = %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, interfaces.ErrInsufficientSpace) {
+				t.Fatalf("Download() error = %v, want ErrInsufficientSpace", err)
+			}
+			if requests != 0 {
+				t.Errorf("server got %d requests, want none for a refused download", requests)
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, "big.bin")); !os.IsNotExist(err) {
+				t.Errorf("output file exists after a refused download: %v", err)
+			}
+		})
+	}
+}
+
+func TestManager_checkFreeSpace_Resume(t *testing.T) {
+	partial := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(partial, make([]byte, 600), 0644); err != nil {
+		t.Fatalf("Failed to create partial file: %v", err)
+	}
+
+	manager := &Manager{
+		options:   &ManagerOptions{MinFreeSpace: 100},
+		logger:    NewManager(nil).logger,
+		freeSpace: func(string) (int64, error) { return 500, nil },
+	}
+
+	// 400 bytes are left to fetch, which leaves the reserve intact
+	if err := manager.checkFreeSpace(context.Background(), partial, 1000, true); err != nil {
+		t.Errorf("checkFreeSpace() resuming = %v, want nil", err)
+	}
+	if err := manager.checkFreeSpace(context.Background(), partial, 1000, false); !errors.Is(err, interfaces.ErrInsufficientSpace) {
+		t.Errorf("checkFreeSpace() from scratch = %v, want ErrInsufficientSpace", err)
+	}
+}
+
+func TestDiskFreeSpace(t *testing.T) {
+	free, err := diskFreeSpace(t.TempDir())
+	if errors.Is(err, errFreeSpaceUnsupported) {
+		t.Skip("free space isn't available on this platform")
+	}
+	if err != nil {
+		t.Fatalf("diskFreeSpace() error = %v", err)
+	}
+	if free <= 0 {
+		t.Errorf("diskFreeSpace() = %d, want > 0", free)
+	}
+}
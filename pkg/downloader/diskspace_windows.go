@@ -0,0 +1,20 @@
+//go:build windows
+
+package downloader
+
+import "golang.org/x/sys/windows"
+
+// diskFreeSpace returns the bytes available to the current user on the
+// volume holding dir
+func diskFreeSpace(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(available), nil
+}
@@ -0,0 +1,48 @@
+package downloader
+
+import (
+	"context"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/services/direct"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// openSmallFile describes a plain link from the headers of a GET instead of
+// a HEAD when ManagerOptions.SmallFileFastPath is set. The GET is returned
+// still open when the file will be fetched with a single request anyway, so
+// its body can be written out directly. A file that will be chunked gets its
+// GET closed. A nil file info means the fast path doesn't apply and the
+// service should be asked.
+func (m *Manager) openSmallFile(ctx context.Context, service interfaces.CloudService, req *interfaces.DownloadRequest) (*interfaces.FileInfo, *utils.OpenedDownload, error) {
+	if !m.options.SmallFileFastPath || service.GetServiceName() != direct.ServiceName || req.Range != nil {
+		return nil, nil, nil
+	}
+
+	opened, err := m.httpClient.OpenDownload(ctx, req.URL, &utils.DownloadOptions{MaxRedirects: m.options.MaxRedirects})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := opened.Info
+	fileInfo := &interfaces.FileInfo{
+		URL:           info.URL,
+		Filename:      info.Filename,
+		Size:          info.Size,
+		SizeKnown:     info.SizeKnown,
+		SupportsRange: info.SupportsRangeRequests,
+		ContentType:   info.ContentType,
+		ETag:          info.ETag,
+	}
+	if info.LastModified != nil {
+		fileInfo.LastModified = *info.LastModified
+	}
+
+	chunked := info.Size > 0 && info.SupportsRangeRequests && info.Size >= m.options.MinChunkedSize && !m.options.ForceSimpleDownload
+	if chunked {
+		opened.Close()
+		return fileInfo, nil, nil
+	}
+
+	return fileInfo, opened, nil
+}
@@ -0,0 +1,155 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+// countingServer serves content and counts HEAD and GET requests
+func countingServer(content []byte, filename string, heads, gets *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+		} else {
+			gets.Add(1)
+		}
+		if filename != "" {
+			w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+}
+
+func TestManager_Download_SmallFileFastPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  []byte
+		wantGets int32 // Including the GET the file info came from
+	}{
+		{name: "small file uses one request", content: []byte("id,total\n1,42\n"), wantGets: 1},
+		{name: "large file is chunked without a HEAD", content: []byte(strings.Repeat("large file ", 400)), wantGets: 1 + 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var heads, gets atomic.Int32
+			server := countingServer(tt.content, "report.csv", &heads, &gets)
+			defer server.Close()
+
+			tmpDir := t.TempDir()
+			manager := NewManager(&ManagerOptions{
+				MaxConnections:    1,
+				ChunkSize:         1024,
+				MinChunkedSize:    1024,
+				Timeout:           10 * time.Second,
+				OutputDir:         tmpDir,
+				SmallFileFastPath: true,
+			})
+			manager.RegisterDirectService()
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: server.URL + "/export?id=7"})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			// Filename and size come from the GET's headers
+			wantPath := filepath.Join(tmpDir, "report.csv")
+			if result.FilePath != wantPath {
+				t.Errorf("FilePath = %q, want %q", result.FilePath, wantPath)
+			}
+			if result.Size != int64(len(tt.content)) {
+				t.Errorf("Size = %d, want %d", result.Size, len(tt.content))
+			}
+			data, err := os.ReadFile(wantPath)
+			if err != nil || !bytes.Equal(data, tt.content) {
+				t.Errorf("downloaded content = %q, %v, want %q", data, err, tt.content)
+			}
+
+			if n := heads.Load(); n != 0 {
+				t.Errorf("server got %d HEAD requests, want none", n)
+			}
+			if n := gets.Load(); n != tt.wantGets {
+				t.Errorf("server got %d GET requests, want %d", n, tt.wantGets)
+			}
+		})
+	}
+}
+
+func TestManager_Download_SmallFileFastPath_OnlyDirectLinks(t *testing.T) {
+	var heads, gets atomic.Int32
+	server := countingServer([]byte("content"), "", &heads, &gets)
+	defer server.Close()
+
+	var infoCalls int
+	manager := NewManager(&ManagerOptions{
+		ChunkSize:         1024,
+		Timeout:           10 * time.Second,
+		OutputDir:         t.TempDir(),
+		SmallFileFastPath: true,
+	})
+	manager.RegisterService(&mockService{
+		name:        "Test Service",
+		supportedFn: func(url string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			infoCalls++
+			return &interfaces.FileInfo{Filename: "content.txt", Size: 7}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	if _, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/content"}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if infoCalls != 1 {
+		t.Errorf("service GetFileInfo called %d times, want 1", infoCalls)
+	}
+}
+
+func BenchmarkManager_Download_SmallFiles(b *testing.B) {
+	content := []byte(strings.Repeat("tiny", 64))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	for _, bench := range []struct {
+		name     string
+		fastPath bool
+	}{
+		{name: "HEAD then GET", fastPath: false},
+		{name: "single GET", fastPath: true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			manager := NewManager(&ManagerOptions{
+				ChunkSize:         1024,
+				MinChunkedSize:    1024,
+				Timeout:           10 * time.Second,
+				OutputDir:         b.TempDir(),
+				SmallFileFastPath: bench.fastPath,
+			})
+			manager.RegisterDirectService()
+			manager.logger.SetOutput(io.Discard)
+			req := &interfaces.DownloadRequest{URL: server.URL + "/tiny.txt"}
+
+			b.SetBytes(int64(len(content)))
+			for i := 0; i < b.N; i++ {
+				if _, err := manager.Download(context.Background(), req); err != nil {
+					b.Fatalf("Download() error = %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package downloader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// checkHashAlgorithms rejects expected hashes for algorithms the hash
+// calculator doesn't know, before anything is downloaded
+func checkHashAlgorithms(expected map[string]string) error {
+	supported := utils.NewHashCalculator().GetSupportedAlgorithms()
+
+	var unknown []string
+	for algorithm := range expected {
+		known := false
+		for _, s := range supported {
+			if strings.EqualFold(algorithm, s) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, algorithm)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+	return fmt.Errorf("unsupported hash algorithm: %s (supported: %s)", strings.Join(unknown, ", "), strings.Join(supported, ", "))
+}
+
+// verifyHashes hashes filePath once with every algorithm in expected and
+// fails with ErrHashMismatch naming each digest that didn't match
+func verifyHashes(url, filePath string, expected map[string]string) error {
+	algorithms := make([]string, 0, len(expected))
+	for algorithm := range expected {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+
+	hashes, err := utils.NewHashCalculator().CalculateHashes(filePath, algorithms)
+	if err != nil {
+		return fmt.Errorf("failed to calculate hashes: %w", err)
+	}
+
+	var mismatches []string
+	for _, algorithm := range algorithms {
+		if got := hashes[algorithm]; !strings.EqualFold(got, expected[algorithm]) {
+			mismatches = append(mismatches, fmt.Sprintf("%s expected %s, got %s", algorithm, expected[algorithm], got))
+		}
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	return &interfaces.DownloadError{
+		Type:    interfaces.ErrHashMismatch.Type,
+		Message: "hash verification failed: " + strings.Join(mismatches, "; "),
+		URL:     url,
+	}
+}
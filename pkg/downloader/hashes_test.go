@@ -0,0 +1,110 @@
+package downloader
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_Download_ExpectedHashes(t *testing.T) {
+	content := []byte(strings.Repeat("checked by every digest ", 200))
+	md5Sum := md5.Sum(content)
+	sha256Sum := sha256.Sum256(content)
+	server := newRangeServer(content)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		expected   map[string]string
+		wantErr    error
+		wantInErr  []string
+		wantNoFile bool
+		wantNoGET  bool
+	}{
+		{
+			name: "all match",
+			expected: map[string]string{
+				"md5":    hex.EncodeToString(md5Sum[:]),
+				"SHA256": strings.ToUpper(hex.EncodeToString(sha256Sum[:])),
+			},
+		},
+		{
+			name: "one mismatch",
+			expected: map[string]string{
+				"md5":    hex.EncodeToString(md5Sum[:]),
+				"sha256": strings.Repeat("0", 64),
+			},
+			wantErr:   ErrHashMismatch,
+			wantInErr: []string{"sha256 expected " + strings.Repeat("0", 64)},
+		},
+		{
+			name: "unknown algorithm",
+			expected: map[string]string{
+				"md5":   hex.EncodeToString(md5Sum[:]),
+				"crc64": "deadbeef",
+			},
+			wantInErr:  []string{"unsupported hash algorithm: crc64"},
+			wantNoFile: true,
+			wantNoGET:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			prepared := false
+			manager := NewManager(&ManagerOptions{
+				ChunkSize: 1024,
+				Timeout:   10 * time.Second,
+				OutputDir: tmpDir,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "digests.txt", Size: int64(len(content))}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					prepared = true
+					return server.URL, nil
+				},
+			})
+
+			_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{
+				URL:            "https://test.com/file",
+				ExpectedHashes: tt.expected,
+			})
+
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Download() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(tt.wantInErr) == 0 && err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			for _, want := range tt.wantInErr {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Download() error = %v, want it to mention %q", err, want)
+				}
+			}
+			if errors.Is(err, ErrHashMismatch) && strings.Contains(err.Error(), "md5") {
+				t.Errorf("Download() error = %v, lists md5 which matched", err)
+			}
+
+			if _, statErr := os.Stat(filepath.Join(tmpDir, "digests.txt")); tt.wantNoFile && statErr == nil {
+				t.Error("file was created despite an unknown algorithm")
+			}
+			if tt.wantNoGET && prepared {
+				t.Error("download was prepared despite an unknown algorithm")
+			}
+		})
+	}
+}
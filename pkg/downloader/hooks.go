@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"sync"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/sirupsen/logrus"
+)
+
+// EventHook receives lifecycle events of a manager's downloads, for metrics
+// or notifications. Events are delivered in order on a goroutine of their
+// own, so a slow hook never holds up a download. Hooks are best-effort: when
+// they fall too far behind, events are dropped, and a hook that panics is
+// logged and skipped.
+type EventHook interface {
+	// OnStart is called once an attempt at a download has the file's details
+	OnStart(info *interfaces.FileInfo)
+	// OnChunkComplete is called as each chunk or segment of a parallel
+	// download is written, with its index in the file
+	OnChunkComplete(id int)
+	// OnComplete is called when a download succeeds
+	OnComplete(result *interfaces.DownloadResult)
+	// OnError is called when a download fails for good
+	OnError(err error)
+}
+
+// hookQueueSize is how many events may wait for slow hooks before new ones
+// are dropped
+const hookQueueSize = 1024
+
+// hookDispatcher delivers events to the registered hooks. The zero value has
+// no hooks and drops every event.
+type hookDispatcher struct {
+	mu     sync.RWMutex
+	hooks  []EventHook
+	queue  chan func(EventHook)
+	done   chan struct{}
+	closed bool
+	logger *logrus.Logger
+}
+
+// AddHook registers hook for the events of every later download
+func (m *Manager) AddHook(hook EventHook) {
+	d := &m.hooks
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return
+	}
+	if d.queue == nil {
+		d.queue = make(chan func(EventHook), hookQueueSize)
+		d.done = make(chan struct{})
+		d.logger = m.logger
+		go d.run()
+	}
+	d.hooks = append(d.hooks, hook)
+}
+
+// emit queues event for every hook without waiting for them
+func (d *hookDispatcher) emit(event func(EventHook)) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.queue == nil || d.closed {
+		return
+	}
+	select {
+	case d.queue <- event:
+	default:
+		d.logger.Debug("Event hooks are falling behind, dropping an event")
+	}
+}
+
+// run delivers queued events until the dispatcher is closed
+func (d *hookDispatcher) run() {
+	defer close(d.done)
+	for event := range d.queue {
+		d.mu.RLock()
+		hooks := d.hooks
+		d.mu.RUnlock()
+
+		for _, hook := range hooks {
+			d.deliver(hook, event)
+		}
+	}
+}
+
+// deliver passes event to hook, keeping a panic in the hook from taking
+// the dispatcher down with it
+func (d *hookDispatcher) deliver(hook EventHook, event func(EventHook)) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.logger.Warnf("Event hook panicked: %v", r)
+		}
+	}()
+	event(hook)
+}
+
+// close delivers the events already queued and stops the dispatcher
+func (d *hookDispatcher) close() {
+	d.mu.Lock()
+	if d.closed || d.queue == nil {
+		d.closed = true
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+
+	<-d.done
+}
+
+// emitStart reports that an attempt at a download has its file info. The
+// hooks get a copy, the download may still change its own.
+func (m *Manager) emitStart(info *interfaces.FileInfo) {
+	snapshot := *info
+	m.hooks.emit(func(hook EventHook) { hook.OnStart(&snapshot) })
+}
+
+// emitChunkComplete reports that chunk id of a download was written
+func (m *Manager) emitChunkComplete(id int) {
+	m.hooks.emit(func(hook EventHook) { hook.OnChunkComplete(id) })
+}
+
+// emitResult reports how a download ended
+func (m *Manager) emitResult(result *interfaces.DownloadResult, err error) {
+	if err != nil {
+		m.hooks.emit(func(hook EventHook) { hook.OnError(err) })
+		return
+	}
+	m.hooks.emit(func(hook EventHook) { hook.OnComplete(result) })
+}
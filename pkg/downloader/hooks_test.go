@@ -0,0 +1,162 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+// recordingHook records the events it receives as short strings
+type recordingHook struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *recordingHook) record(event string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, event)
+}
+
+func (h *recordingHook) OnStart(info *interfaces.FileInfo) { h.record("start " + info.Filename) }
+func (h *recordingHook) OnChunkComplete(id int)            { h.record(fmt.Sprintf("chunk %d", id)) }
+func (h *recordingHook) OnComplete(result *interfaces.DownloadResult) {
+	h.record(fmt.Sprintf("complete %d", result.Size))
+}
+func (h *recordingHook) OnError(err error) { h.record("error") }
+
+// panickingHook panics on every event
+type panickingHook struct{}
+
+func (panickingHook) OnStart(*interfaces.FileInfo)          { panic("start") }
+func (panickingHook) OnChunkComplete(int)                   { panic("chunk") }
+func (panickingHook) OnComplete(*interfaces.DownloadResult) { panic("complete") }
+func (panickingHook) OnError(error)                         { panic("error") }
+
+func TestManager_AddHook(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 64*4)) // 4KB, 4 chunks of 1KB
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(content)))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantErr    bool
+		wantEvents []string
+	}{
+		{
+			name:       "successful download",
+			path:       "/file",
+			wantEvents: []string{"start hooked.bin", "chunk 0", "chunk 1", "chunk 2", "chunk 3", "complete 4096"},
+		},
+		{
+			name:       "failed download",
+			path:       "/missing",
+			wantErr:    true,
+			wantEvents: []string{"start hooked.bin", "error"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(&ManagerOptions{
+				MaxConnections: 1,
+				ChunkSize:      1024,
+				Timeout:        10 * time.Second,
+				OutputDir:      t.TempDir(),
+				MaxRetries:     1,
+				RetryDelay:     time.Millisecond,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "hooked.bin", Size: int64(len(content)), SupportsRange: true}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL + tt.path, nil
+				},
+			})
+
+			hook := &recordingHook{}
+			manager.AddHook(panickingHook{})
+			manager.AddHook(hook)
+
+			_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com" + tt.path})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// Close delivers everything still queued
+			manager.Close()
+
+			if !reflect.DeepEqual(hook.events, tt.wantEvents) {
+				t.Errorf("events = %q, want %q", hook.events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestManager_AddHook_DoesNotBlockDownloads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{OutputDir: t.TempDir()})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(url string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "slow.txt", Size: 7}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	release := make(chan struct{})
+	manager.AddHook(&blockingHook{release: release})
+
+	finished := make(chan error, 1)
+	go func() {
+		_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/slow"})
+		finished <- err
+	}()
+
+	select {
+	case err := <-finished:
+		if err != nil {
+			t.Errorf("Download() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Download() waited for a blocked hook")
+	}
+
+	close(release)
+	manager.Close()
+}
+
+// blockingHook blocks in every event until release is closed
+type blockingHook struct {
+	release chan struct{}
+}
+
+func (h *blockingHook) OnStart(*interfaces.FileInfo)          { <-h.release }
+func (h *blockingHook) OnChunkComplete(int)                   { <-h.release }
+func (h *blockingHook) OnComplete(*interfaces.DownloadResult) { <-h.release }
+func (h *blockingHook) OnError(error)                         { <-h.release }
@@ -1,7 +1,10 @@
 package downloader
 
 import (
+	"context"
+
 	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
 )
 
 // Type aliases for backward compatibility
@@ -20,11 +23,24 @@ type DownloadError = interfaces.DownloadError
 
 // Re-export common error types
 var (
-	ErrUnsupportedURL    = interfaces.ErrUnsupportedURL
-	ErrFileNotFound      = interfaces.ErrFileNotFound
-	ErrNetworkError      = interfaces.ErrNetworkError
-	ErrInvalidResponse   = interfaces.ErrInvalidResponse
-	ErrHashMismatch      = interfaces.ErrHashMismatch
-	ErrInsufficientSpace = interfaces.ErrInsufficientSpace
-	ErrPermissionDenied  = interfaces.ErrPermissionDenied
+	ErrUnsupportedURL     = interfaces.ErrUnsupportedURL
+	ErrFileNotFound       = interfaces.ErrFileNotFound
+	ErrNetworkError       = interfaces.ErrNetworkError
+	ErrInvalidResponse    = interfaces.ErrInvalidResponse
+	ErrHashMismatch       = interfaces.ErrHashMismatch
+	ErrInsufficientSpace  = interfaces.ErrInsufficientSpace
+	ErrPermissionDenied   = interfaces.ErrPermissionDenied
+	ErrContentTypeRefused = interfaces.ErrContentTypeRefused
+	ErrFileTooLarge       = interfaces.ErrFileTooLarge
 )
+
+// WithRequestID returns a copy of ctx whose downloads log the given
+// correlation ID in a request_id field
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return utils.WithRequestID(ctx, id)
+}
+
+// RequestIDFromContext returns the correlation ID set with WithRequestID
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	return utils.RequestIDFromContext(ctx)
+}
@@ -0,0 +1,50 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// isLandingPage reports whether fileInfo describes an HTML page that should
+// be followed to the file it redirects to
+func (m *Manager) isLandingPage(fileInfo *interfaces.FileInfo) bool {
+	return m.options.FollowHTMLRedirects && normalizeMediaType(fileInfo.ContentType) == "text/html"
+}
+
+// followLandingPage follows the meta refresh or script redirects of the page
+// at downloadURL and returns the URL and file info of where they lead. A page
+// that doesn't redirect is returned unchanged.
+func (m *Manager) followLandingPage(ctx context.Context, downloadURL string, fileInfo *interfaces.FileInfo) (string, *interfaces.FileInfo, error) {
+	target, err := m.httpClient.ResolveHTMLRedirects(ctx, downloadURL, &utils.DownloadOptions{MaxRedirects: m.options.MaxRedirects})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to follow landing page: %w", err)
+	}
+	if target == downloadURL {
+		return downloadURL, fileInfo, nil
+	}
+
+	utils.LoggerFromContext(ctx, m.logger).Infof("Landing page redirects to %s", target)
+
+	probed, err := m.httpClient.GetFileInfo(ctx, target, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get file info: %w", classifyNetworkError(target, err))
+	}
+
+	followed := &interfaces.FileInfo{
+		URL:           target,
+		Filename:      probed.Filename,
+		Size:          probed.Size,
+		SizeKnown:     probed.SizeKnown,
+		SupportsRange: probed.SupportsRangeRequests,
+		ContentType:   probed.ContentType,
+		ETag:          probed.ETag,
+	}
+	if probed.LastModified != nil {
+		followed.LastModified = *probed.LastModified
+	}
+
+	return target, followed, nil
+}
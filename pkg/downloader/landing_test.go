@@ -0,0 +1,86 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_Download_FollowHTMLRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/share", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, `<html><head><meta http-equiv="refresh" content="0; url=/files/report.pdf"></head></html>`)
+	})
+	mux.HandleFunc("/files/report.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", "11")
+		if r.Method == http.MethodGet {
+			io.WriteString(w, "%PDF-report")
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		follow   bool
+		wantFile string
+		want     string
+	}{
+		{name: "follows landing page", follow: true, wantFile: "report.pdf", want: "%PDF-report"},
+		{name: "disabled by default", follow: false, wantFile: "share.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			manager := NewManager(&ManagerOptions{
+				ChunkSize:           1024,
+				Timeout:             10 * time.Second,
+				OutputDir:           tmpDir,
+				FollowHTMLRedirects: tt.follow,
+				AllowedContentTypes: []string{"application/pdf", "text/html"},
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "share.html", ContentType: "text/html; charset=utf-8"}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL + "/share", nil
+				},
+			})
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/share"})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			if want := filepath.Join(tmpDir, tt.wantFile); result.FilePath != want {
+				t.Errorf("FilePath = %q, want %q", result.FilePath, want)
+			}
+			if tt.want == "" {
+				return
+			}
+			data, err := os.ReadFile(result.FilePath)
+			if err != nil {
+				t.Fatalf("Failed to read downloaded file: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("downloaded %q, want %q", data, tt.want)
+			}
+			if result.FinalURL != server.URL+"/files/report.pdf" {
+				t.Errorf("FinalURL = %q, want the page's redirect target", result.FinalURL)
+			}
+		})
+	}
+}
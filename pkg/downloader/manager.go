@@ -2,13 +2,20 @@ package downloader
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/progress"
+	"github.com/milindmadhukar/cloudget/pkg/services/direct"
 	"github.com/milindmadhukar/cloudget/pkg/services/dropbox"
 	"github.com/milindmadhukar/cloudget/pkg/services/gdrive"
 	"github.com/milindmadhukar/cloudget/pkg/services/wetransfer"
@@ -17,43 +24,263 @@ import (
 )
 
 type Manager struct {
-	services   []interfaces.CloudService
-	httpClient *utils.HTTPClient
-	logger     *logrus.Logger
-	options    *ManagerOptions
+	services      []interfaces.CloudService
+	httpClient    *utils.HTTPClient
+	resumeManager resumeStore
+	tracker       *progress.Tracker
+	logger        *logrus.Logger
+	options       *ManagerOptions
+	normalizeURL  func(string) string
+	freeSpace     func(dir string) (int64, error)
+
+	// mu guards the in-flight download bookkeeping used by Cancel and Close
+	mu       sync.Mutex
+	closed   bool
+	nextID   uint64
+	cancels  map[uint64]context.CancelFunc
+	inFlight sync.WaitGroup
+
+	stats managerStats
+	hooks hookDispatcher
+}
+
+// ErrManagerClosed is returned by downloads started after Manager.Close
+var ErrManagerClosed = errors.New("download manager is closed")
+
+// resumeStore is the part of utils.ResumeManager the manager relies on
+type resumeStore interface {
+	interfaces.ResumeManager
+	IsResumable(url string, outputPath string) (bool, *interfaces.ResumeData, error)
 }
 
+// spotCheckSamples is how many byte ranges are re-read when ManagerOptions.SpotCheck is set
+const spotCheckSamples = 4
+
 type ManagerOptions struct {
 	MaxConnections int
 	ChunkSize      int64
 	Timeout        time.Duration
 	OutputDir      string
 	Resume         bool
+	ResumeDir      string // Defaults to a cloudget-resume directory under os.TempDir()
 	VerifyHash     bool
 	HashAlgorithm  string
+	SpotCheck      bool // Re-read a few random ranges after download to catch silent corruption
+	// SizeTolerance accepts a finished download whose size differs from the
+	// expected one by at most this many bytes, with a warning, for servers
+	// whose Content-Length is slightly off. Zero requires an exact match.
+	SizeTolerance  int64
+	PreservePath   bool  // Mirror the URL path under OutputDir for direct downloads
+	MinChunkedSize int64 // Files smaller than this skip chunking, zero disables the minimum
+	// AdaptiveConcurrency starts each download on one connection and adds
+	// more, up to MaxConnections, while throughput keeps improving
+	AdaptiveConcurrency bool
+	InsecureSkipVerify  bool   // Skip TLS certificate verification, e.g. for self-signed endpoints
+	CACertFile          string // PEM file with additional root CAs to trust
+	// UseTempFile writes downloads to <path>.cloudget.part and renames them
+	// into place only once they're complete and verified
+	UseTempFile bool
+	// AllowedContentTypes, when set, refuses files whose Content-Type matches
+	// none of the entries. BlockedContentTypes refuses files matching any
+	// entry. Entries are media types such as "application/pdf" or wildcards
+	// such as "text/*".
+	AllowedContentTypes []string
+	BlockedContentTypes []string
+	// ResumeSaveInterval is how often resume progress is saved while a
+	// download runs, so a later Download can pick up a partial file left by
+	// a process that was killed. Zero saves it only when the download starts
+	// and fails. The default options use DefaultResumeSaveInterval.
+	ResumeSaveInterval time.Duration
+	MaxRedirects       int // Redirects followed per request, zero uses utils.DefaultMaxRedirects
+	// RotateUserAgent makes services that pose as a browser send a different
+	// browser User-Agent with each request instead of always the same one
+	RotateUserAgent bool
+	// Segments splits each download into this many contiguous ranges, each
+	// streamed over one connection, instead of many small chunks. Zero or one
+	// keeps chunked downloads.
+	Segments int
+	// FollowHTMLRedirects follows HTML landing pages that redirect with a
+	// meta refresh or a window.location assignment instead of a 3xx status.
+	// Each hop counts against MaxRedirects.
+	FollowHTMLRedirects bool
+	// HTTPVersion picks the protocol spoken to servers, "" negotiates it.
+	// Over HTTP/2 the chunk requests to a host are streams multiplexed on a
+	// single connection, so MaxConnections bounds streams, not connections.
+	HTTPVersion utils.HTTPVersion
+	// MaxIdleConnsPerHost is how many keep-alive connections are kept per
+	// host so chunk workers can reuse them. Defaults to MaxConnections.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps the connections open to one host, zero leaves it unlimited
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an unused keep-alive connection is kept open
+	IdleConnTimeout time.Duration
+	// DialTimeout, TLSHandshakeTimeout and ResponseHeaderTimeout fail a
+	// request that stalls before its body starts, well ahead of Timeout.
+	// Zero keeps the client defaults.
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// Journal syncs every chunk of a resumable download to disk and records
+	// it in a journal next to the partial file. A resume after a crash then
+	// re-fetches everything the journal doesn't list.
+	Journal bool
+	// MaxRetries is how often each chunk is retried and RetryDelay the wait
+	// before its first retry. Zero uses the service's RetryProfile, or 3
+	// retries 2 seconds apart for services without one.
+	MaxRetries int
+	RetryDelay time.Duration
+	// TotalRetryBudget caps the retries of all chunks of one download put
+	// together, so a server that fails every request can't cost MaxRetries
+	// for each of thousands of chunks. Zero allows MaxRetries per chunk.
+	TotalRetryBudget int
+	// WriteBufferSize holds up to this many bytes of finished chunks in
+	// memory and writes contiguous runs of them at once, for filesystems
+	// where many small writes are slow. Zero writes each chunk as it
+	// finishes. It has no effect with Journal or Segments.
+	WriteBufferSize int64
+	// UseMmap preallocates each chunked download's file and has chunk
+	// workers copy into a memory mapping of it instead of writing, for very
+	// large files on fast disks. Where the file can't be mapped chunks are
+	// written as usual. It needs Journal, without one a download killed part
+	// way would leave a full size file with no record of its gaps.
+	UseMmap bool
+	// MaxMemoryBytes is the largest file DownloadToMemory accepts. Zero
+	// uses defaultMaxMemoryBytes.
+	MaxMemoryBytes int64
+	// RecordThroughput keeps the speed of every second of a download in
+	// DownloadResult.Throughput, to see when and how a server throttled it.
+	// The peak speed is reported either way.
+	RecordThroughput bool
+	// ExportFormat downloads Google Docs, Sheets and Slides editor links as
+	// exports in this format, such as "pdf", "docx" or "xlsx". Without one
+	// such links are refused, since they lead to the editor and not a file.
+	ExportFormat string
+	// MaxDownloadAttempts is how many times Download runs the whole pipeline,
+	// from resolving the service to writing the file, when an attempt fails
+	// with a transient error. Zero or one makes a single attempt.
+	MaxDownloadAttempts int
+	// DownloadRetryDelay is the wait before the second attempt, doubling for
+	// each one after it. Zero uses defaultDownloadRetryDelay.
+	DownloadRetryDelay time.Duration
+	// GroupByService places each file in a subdirectory of OutputDir named
+	// after the service it came from, such as "Dropbox" or "Google Drive"
+	GroupByService bool
+	// DisallowSymlinks refuses downloads whose output path, once symlinks
+	// are resolved, lies outside OutputDir, so a link planted in the output
+	// directory can't redirect a download onto an unrelated file. An
+	// explicit OutputPath may not lead through a symlink at all.
+	DisallowSymlinks bool
+	// UseResponseFilename renames a finished download to the
+	// Content-Disposition filename of its GET responses when that differs
+	// from the name it was saved under, for servers that only name the file
+	// there and not in the response to HEAD. Requests with an OutputPath or
+	// CustomFilename keep their name.
+	UseResponseFilename bool
+	// DebugHTTP logs the headers of every request and response at debug
+	// level, with credentials redacted, to see what a service exchanged
+	DebugHTTP bool
+	// ForceSimpleDownload fetches every file with a single plain request,
+	// whatever its size and range support. It's an escape hatch for hosts
+	// where chunked downloads come out corrupted.
+	ForceSimpleDownload bool
+	// ProgressMode shows the progress of each download on standard error as
+	// live bars or periodic lines. Empty is the same as progress.ModeNone.
+	ProgressMode progress.Mode
+	// ConflictResolver is asked what to do when a file of a different size
+	// already exists at the output path. Nil overwrites it.
+	ConflictResolver ConflictResolver
+	// MinFreeSpace is how many bytes must stay free on the output filesystem
+	// once a download completes. Downloads that would eat into it are refused
+	// with ErrInsufficientSpace before they start.
+	MinFreeSpace int64
+	// SmallFileFastPath describes plain links from the headers of the GET
+	// that downloads them instead of sending a HEAD first, saving a round
+	// trip per file in batches of many small files. Files large enough to
+	// be chunked still are, without the HEAD.
+	SmallFileFastPath bool
+	// NetrcFile is a netrc file whose credentials are sent as Basic auth to
+	// the hosts it lists. It only applies to the client NewManager creates.
+	NetrcFile string
+	// DNSOverride connects to the IP given for a host, optionally with a
+	// port, instead of resolving it, to test against a staging server or pin
+	// a CDN PoP. Requests and TLS still use the host. DNSServer resolves the
+	// other hosts with the DNS server at this IP instead of the system
+	// resolver. Both only apply to the client NewManager creates.
+	DNSOverride map[string]string
+	DNSServer   string
 }
 
 func NewManager(options *ManagerOptions) *Manager {
+	return NewManagerWithClient(options, nil)
+}
+
+// NewManagerWithClient creates a manager that uses the given HTTP client for
+// downloads and for the built-in services. A nil client uses the default one.
+func NewManagerWithClient(options *ManagerOptions, client *utils.HTTPClient) *Manager {
 	if options == nil {
 		options = &ManagerOptions{
-			MaxConnections: 8,
-			ChunkSize:      2 * 1024 * 1024, // 2MB
-			Timeout:        300 * time.Second,
-			OutputDir:      ".",
-			Resume:         true,
-			VerifyHash:     false,
-			HashAlgorithm:  "sha256",
+			MaxConnections:     8,
+			ChunkSize:          2 * 1024 * 1024, // 2MB
+			Timeout:            300 * time.Second,
+			OutputDir:          ".",
+			Resume:             true,
+			VerifyHash:         false,
+			HashAlgorithm:      "sha256",
+			MinChunkedSize:     1024 * 1024, // 1MB
+			UseTempFile:        true,
+			ResumeSaveInterval: DefaultResumeSaveInterval,
 		}
 	}
 
 	logger := logrus.New()
 	logger.SetLevel(logrus.InfoLevel)
 
+	if client == nil {
+		// Chunk workers each hold a connection, keep that many alive between chunks
+		maxIdlePerHost := options.MaxIdleConnsPerHost
+		if maxIdlePerHost == 0 {
+			maxIdlePerHost = options.MaxConnections
+		}
+
+		var err error
+		client, err = utils.NewHTTPClientWithConfig(&utils.ClientConfig{
+			InsecureSkipVerify:    options.InsecureSkipVerify,
+			CACertFile:            options.CACertFile,
+			MaxIdleConnsPerHost:   maxIdlePerHost,
+			MaxConnsPerHost:       options.MaxConnsPerHost,
+			IdleConnTimeout:       options.IdleConnTimeout,
+			DialTimeout:           options.DialTimeout,
+			TLSHandshakeTimeout:   options.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: options.ResponseHeaderTimeout,
+			NetrcFile:             options.NetrcFile,
+			HTTPVersion:           options.HTTPVersion,
+			DNSOverride:           options.DNSOverride,
+			DNSServer:             options.DNSServer,
+		})
+		if err != nil {
+			logger.Errorf("Failed to apply client options, using default client: %v", err)
+			client = utils.NewHTTPClient()
+		}
+	}
+
+	if options.DebugHTTP {
+		client.SetDebugHTTP(true)
+	}
+
+	if options.InsecureSkipVerify {
+		logger.Warn("TLS certificate verification is disabled, downloads are open to interception")
+	}
+
 	manager := &Manager{
-		services:   make([]interfaces.CloudService, 0),
-		httpClient: utils.NewHTTPClient(),
-		logger:     logger,
-		options:    options,
+		services:      make([]interfaces.CloudService, 0),
+		httpClient:    client,
+		resumeManager: utils.NewResumeManager(options.ResumeDir),
+		tracker:       progress.NewTrackerWithMode(logger, os.Stderr, options.ProgressMode),
+		logger:        logger,
+		options:       options,
+		normalizeURL:  NormalizeURL,
+		freeSpace:     diskFreeSpace,
+		cancels:       make(map[uint64]context.CancelFunc),
 	}
 
 	manager.httpClient.SetLogger(logger)
@@ -66,20 +293,29 @@ func NewManager(options *ManagerOptions) *Manager {
 
 func (m *Manager) RegisterAllServices() {
 	// Register Dropbox service
-	dropboxService := dropbox.New(m.logger)
+	dropboxService := dropbox.New(m.logger, dropbox.WithHTTPClient(m.httpClient))
 	m.RegisterService(dropboxService)
 
+	// Browser-like services share one User-Agent pool
+	userAgents := utils.NewUserAgentPool(m.options.RotateUserAgent)
+
 	// Register Google Drive service
-	gdriveService := gdrive.New()
+	gdriveService := gdrive.New(gdrive.WithHTTPClient(m.httpClient), gdrive.WithUserAgentPool(userAgents), gdrive.WithExportFormat(m.options.ExportFormat))
 	m.RegisterService(gdriveService)
 
 	// Register WeTransfer service
-	wetransferService := wetransfer.New()
+	wetransferService := wetransfer.New(wetransfer.WithHTTPClient(m.httpClient), wetransfer.WithUserAgentPool(userAgents))
 	m.RegisterService(wetransferService)
 
 	m.logger.Infof("Registered %d services", len(m.services))
 }
 
+// RegisterDirectService registers the generic HTTP(S) service as a fallback
+// for URLs no other service claims. Register it after all other services.
+func (m *Manager) RegisterDirectService() {
+	m.RegisterService(direct.New(m.logger, direct.WithHTTPClient(m.httpClient)))
+}
+
 func (m *Manager) RegisterService(service interfaces.CloudService) {
 	m.services = append(m.services, service)
 	m.logger.Debugf("Registered service: %s", service.GetServiceName())
@@ -88,9 +324,11 @@ func (m *Manager) RegisterService(service interfaces.CloudService) {
 func (m *Manager) SetLogger(logger *logrus.Logger) {
 	m.logger = logger
 	m.httpClient.SetLogger(logger)
+	m.tracker.SetLogger(logger)
 }
 
 func (m *Manager) FindService(url string) interfaces.CloudService {
+	url = m.normalize(url)
 	for _, service := range m.services {
 		if service.IsSupported(url) {
 			return service
@@ -99,39 +337,141 @@ func (m *Manager) FindService(url string) interfaces.CloudService {
 	return nil
 }
 
-func (m *Manager) Download(ctx context.Context, req *interfaces.DownloadRequest) (*interfaces.DownloadResult, error) {
+// ChunkDownloader returns a chunk downloader for fetching single byte ranges
+// directly, through the manager's HTTP client and with its redirect limit
+func (m *Manager) ChunkDownloader() interfaces.ChunkDownloader {
+	return utils.NewChunkDownloaderClient(m.httpClient, &utils.DownloadOptions{
+		MaxRedirects: m.options.MaxRedirects,
+	})
+}
+
+// StdoutPath as a request's OutputPath streams the download to standard output
+const StdoutPath = "-"
+
+// partFileSuffix is appended to the output path while a download is in progress
+const partFileSuffix = ".cloudget.part"
+
+func (m *Manager) Download(ctx context.Context, req *interfaces.DownloadRequest) (result *interfaces.DownloadResult, err error) {
+	if req.OutputPath == StdoutPath {
+		return m.DownloadToWriter(ctx, req, os.Stdout)
+	}
+	if req.OutputPath != "" && isNamedPipe(req.OutputPath) {
+		return m.downloadToPipe(ctx, req)
+	}
+
+	ctx, done, err := m.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	defer func() {
+		m.stats.record(result, err)
+		m.emitResult(result, err)
+	}()
+
+	ctx, cancel := withRequestDeadline(ctx, req, m.options.Timeout)
+	defer cancel()
+
+	req = m.normalizeRequest(req)
+	ctx = utils.WithSelectedFile(ctx, req.SelectFile)
+	ctx = utils.WithLinkPassword(ctx, req.Password)
+
+	return m.withRetries(ctx, func() (*interfaces.DownloadResult, error) {
+		return m.download(ctx, req)
+	})
+}
+
+// download runs one attempt of Download, from resolving the service to
+// moving the finished file into place
+func (m *Manager) download(ctx context.Context, req *interfaces.DownloadRequest) (*interfaces.DownloadResult, error) {
 	startTime := time.Now()
+	logger := utils.LoggerFromContext(ctx, m.logger)
+
+	if err := checkHashAlgorithms(req.ExpectedHashes); err != nil {
+		return nil, err
+	}
 
 	// Find appropriate service for the URL
 	service := m.FindService(req.URL)
 	if service == nil {
-		return nil, fmt.Errorf("no service found for URL: %s", req.URL)
+		return nil, unsupportedURLError(req.URL)
 	}
 
-	m.logger.Infof("Using service: %s", service.GetServiceName())
+	logger.Infof("Using service: %s", service.GetServiceName())
 
 	// Get file information
-	fileInfo, err := service.GetFileInfo(ctx, req.URL)
+	fileInfo, opened, err := m.openSmallFile(ctx, service, req)
+	if err == nil && fileInfo == nil {
+		fileInfo, err = service.GetFileInfo(ctx, req.URL)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %w", err)
+		return nil, fmt.Errorf("failed to get file info: %w", classifyNetworkError(req.URL, err))
+	}
+	if opened != nil {
+		defer opened.Close()
+	}
+
+	// A landing page is judged by the file it leads to, not by itself
+	landingPage := m.isLandingPage(fileInfo)
+	if !landingPage {
+		if err := m.checkContentType(req.URL, fileInfo.ContentType); err != nil {
+			return nil, err
+		}
 	}
 
 	// Prepare download URL
 	downloadURL, err := service.PrepareDownload(ctx, req.URL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to prepare download: %w", err)
+		return nil, fmt.Errorf("failed to prepare download: %w", classifyNetworkError(req.URL, err))
 	}
 
+	if landingPage {
+		downloadURL, fileInfo, err = m.followLandingPage(ctx, downloadURL, fileInfo)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.checkContentType(req.URL, fileInfo.ContentType); err != nil {
+			return nil, err
+		}
+	}
+
+	if needsFilenameSniff(req, fileInfo) {
+		fileInfo = m.sniffFilename(ctx, downloadURL, fileInfo)
+	}
+	m.emitStart(fileInfo)
+
 	// Determine output path
-	outputPath, err := m.determineOutputPath(req, fileInfo.Filename)
+	outputPath, err := m.outputPathFor(req, service, fileInfo)
 	if err != nil {
 		return nil, fmt.Errorf("failed to determine output path: %w", err)
 	}
+	if err := prepareOutputDir(outputPath); err != nil {
+		return nil, fmt.Errorf("failed to determine output path: %w", err)
+	}
+
+	resume := m.options.Resume && !req.NoResume
+
+	// A byte range is a one-off partial copy, it's never resumed or skipped
+	// because a complete file already exists
+	expectedSize := fileInfo.Size
+	var rangeStart, rangeEnd int64
+	if req.Range != nil {
+		rangeStart, rangeEnd, err = clampRange(req.Range, fileInfo.Size)
+		if err != nil {
+			return nil, err
+		}
+		resume = false
+		expectedSize = -1
+		if rangeEnd >= 0 {
+			expectedSize = rangeEnd - rangeStart + 1
+		}
+	}
 
-	// Check if file already exists and is complete
-	if m.options.Resume {
+	// Check if file already exists and is complete. Without a size from
+	// the server an existing empty file says nothing about completeness.
+	if resume && (fileInfo.Size > 0 || fileInfo.SizeKnown) {
 		if existingSize, exists := m.checkExistingFile(outputPath, fileInfo.Size); exists {
-			m.logger.Infof("File already exists and is complete: %s", outputPath)
+			logger.Infof("File already exists and is complete: %s", outputPath)
 
 			duration := time.Since(startTime)
 			return &interfaces.DownloadResult{
@@ -145,84 +485,543 @@ func (m *Manager) Download(ctx context.Context, req *interfaces.DownloadRequest)
 		}
 	}
 
-	m.logger.Infof("Starting download: %s -> %s", fileInfo.Filename, outputPath)
+	outputPath, skip, err := m.resolveConflict(ctx, outputPath, fileInfo, resume)
+	if err != nil {
+		return nil, err
+	}
+	if skip {
+		existing, err := os.Stat(outputPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat existing file: %w", err)
+		}
+		return &interfaces.DownloadResult{
+			FilePath: outputPath,
+			Size:     existing.Size(),
+			Duration: time.Since(startTime),
+		}, nil
+	}
+
+	// Write somewhere other than the final name until the file is verified
+	writePath := outputPath
+	if m.options.UseTempFile {
+		writePath = outputPath + partFileSuffix
+	}
+
+	verifyHash := m.options.VerifyHash && req.VerifyHash != ""
+
+	if resume && req.Range == nil {
+		m.discardStalePartial(ctx, req.URL, writePath, fileInfo)
+	}
+
+	// A partial file that already has every byte, say because the rename
+	// failed last time, only needs moving into place
+	var stats *utils.DownloadStats
+	if resume && writePath != outputPath && req.Range == nil {
+		stats = m.completePartFile(ctx, req, downloadURL, writePath, fileInfo, verifyHash)
+	}
+
+	// An empty file has nothing to fetch, chunk or show progress for
+	if stats == nil && req.Range == nil && fileInfo.Size == 0 && fileInfo.SizeKnown {
+		logger.Infof("File is empty, creating it without downloading: %s", outputPath)
+		if err := os.WriteFile(writePath, nil, 0644); err != nil {
+			return nil, fmt.Errorf("failed to create empty file: %w", err)
+		}
+		stats = &utils.DownloadStats{}
+	}
+
+	throughput := newThroughputMeter(m.options.RecordThroughput)
+	if stats == nil {
+		stats, err = m.fetch(ctx, req, service, fileInfo, opened, downloadURL, writePath, outputPath, rangeStart, rangeEnd, expectedSize, resume, verifyHash, throughput)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resume {
+		if err := m.resumeManager.ClearProgress(req.URL, writePath); err != nil {
+			logger.Warnf("Failed to clear resume data: %v", err)
+		}
+	}
+
+	// Verify file size
+	finalFileInfo, err := os.Stat(writePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat downloaded file: %w", err)
+	}
+
+	switch {
+	case req.Range == nil && expectedSize <= 0 && !fileInfo.SizeKnown:
+		// Chunked responses carry no Content-Length, so the size is unknown,
+		// reported as zero or -1, and the most that can be checked is that
+		// something arrived
+		if finalFileInfo.Size() == 0 {
+			m.discardTempFile(ctx, writePath, outputPath)
+			return nil, fmt.Errorf("downloaded file is empty")
+		}
+	case expectedSize > 0 && !m.sizeAccepted(ctx, expectedSize, finalFileInfo.Size()):
+		m.discardTempFile(ctx, writePath, outputPath)
+		return nil, fmt.Errorf("file size mismatch: expected %d, got %d", expectedSize, finalFileInfo.Size())
+	}
+	size := finalFileInfo.Size()
+
+	if req.Decompress {
+		if req.Range != nil {
+			logger.Warn("Not decompressing a byte range of a file")
+		} else {
+			decompressedPath, newOutputPath, err := m.decompressDownload(ctx, req, writePath, outputPath, fileInfo)
+			if err != nil {
+				m.discardTempFile(ctx, writePath, outputPath)
+				return nil, err
+			}
+			if decompressedPath != writePath {
+				writePath, outputPath = decompressedPath, newOutputPath
+				decompressedInfo, err := os.Stat(writePath)
+				if err != nil {
+					return nil, fmt.Errorf("failed to stat decompressed file: %w", err)
+				}
+				size = decompressedInfo.Size()
+			}
+		}
+	}
+
+	// Hash verification if requested
+	var hash string
+	if verifyHash {
+		logger.Info("Verifying file hash...")
+		// Single-request downloads were hashed as they streamed in
+		calculatedHash := stats.Hash
+		if calculatedHash == "" {
+			hashCalculator := utils.NewHashCalculator()
+			calculatedHash, err = hashCalculator.CalculateHash(writePath, m.options.HashAlgorithm)
+			if err != nil {
+				return nil, fmt.Errorf("failed to calculate hash: %w", err)
+			}
+		}
+
+		if !strings.EqualFold(calculatedHash, req.VerifyHash) {
+			m.discardTempFile(ctx, writePath, outputPath)
+			return nil, &interfaces.DownloadError{
+				Type:    interfaces.ErrHashMismatch.Type,
+				Message: fmt.Sprintf("hash verification failed: expected %s, got %s", req.VerifyHash, calculatedHash),
+				URL:     req.URL,
+			}
+		}
+
+		hash = calculatedHash
+		logger.Info("Hash verification passed")
+	}
+
+	if len(req.ExpectedHashes) > 0 {
+		logger.Infof("Verifying %d file hashes...", len(req.ExpectedHashes))
+		if err := verifyHashes(req.URL, writePath, req.ExpectedHashes); err != nil {
+			m.discardTempFile(ctx, writePath, outputPath)
+			return nil, err
+		}
+		logger.Info("Hash verification passed")
+	}
+
+	if writePath != outputPath {
+		if err := os.Rename(writePath, outputPath); err != nil {
+			return nil, fmt.Errorf("failed to move download into place: %w", err)
+		}
+	}
+
+	if m.options.UseResponseFilename && req.OutputPath == "" && req.CustomFilename == "" && req.Range == nil {
+		outputPath = m.renameToResponseFilename(ctx, outputPath, stats.Filename, fileInfo, size)
+	}
+
+	finalURL := stats.FinalURL
+	if finalURL == "" {
+		finalURL = downloadURL
+	}
+
+	duration := time.Since(startTime)
+	speed := float64(size) / duration.Seconds() / 1024 / 1024 // MB/s
+	if stats.ChunksUsed == 0 {
+		speed = 0 // No actual download occurred
+	}
+
+	logger.Infof("Download completed successfully!")
+	logger.Infof("File: %s", outputPath)
+	logger.Infof("Size: %s", utils.FormatBytes(size))
+	logger.Infof("Time: %.1f seconds", duration.Seconds())
+	peak, samples := throughput.report(speed)
+	logger.Infof("Speed: %.1f MB/s (peak %.1f MB/s)", speed, peak)
+
+	return &interfaces.DownloadResult{
+		FilePath:   outputPath,
+		Size:       size,
+		Duration:   duration,
+		Speed:      speed,
+		Hash:       hash,
+		Resumed:    stats.Resumed,
+		ChunksUsed: stats.ChunksUsed,
+		Retries:    stats.Retries,
+		FinalURL:   finalURL,
+		PeakSpeed:  peak,
+		Throughput: samples,
+	}, nil
+}
+
+// fetch downloads the bytes download still needs into writePath, or the
+// requested range of them, tracking its progress while it runs
+func (m *Manager) fetch(ctx context.Context, req *interfaces.DownloadRequest, service interfaces.CloudService, fileInfo *interfaces.FileInfo, opened *utils.OpenedDownload, downloadURL, writePath, outputPath string, rangeStart, rangeEnd, expectedSize int64, resume, verifyHash bool, throughput *throughputMeter) (*utils.DownloadStats, error) {
+	logger := utils.LoggerFromContext(ctx, m.logger)
+
+	if err := m.checkFreeSpace(ctx, writePath, expectedSize, resume); err != nil {
+		return nil, err
+	}
+
+	// Fail early with a readable error when the download host can't be
+	// reached. A response that's already open shows that it can.
+	if opened == nil {
+		if err := checkReachable(ctx, m.httpClient, downloadURL); err != nil {
+			return nil, fmt.Errorf("download host unreachable: %w", err)
+		}
+	}
+
+	logger.Infof("Starting download: %s -> %s", fileInfo.Filename, outputPath)
+
+	// Downloads are tracked by their URL and output path so callers can
+	// poll GetProgressByID, even for one URL downloaded to several files
+	progressID := ProgressID(req.URL, outputPath)
+	m.tracker.StartDownload(progressID, fileInfo.Filename, max(expectedSize, 0))
+	defer m.tracker.RemoveDownload(progressID)
+
+	// Progress is saved from the progress callback, at most once per interval
+	lastResumeSave := time.Now()
 
 	// Prepare download options
 	downloadOptions := &utils.DownloadOptions{
-		ChunkSize:  m.options.ChunkSize,
-		MaxRetries: 3,
-		RetryDelay: 2 * time.Second,
-		Headers:    make(map[string]string),
-		UserAgent:  "Go-Cloud-Downloader/1.0",
-		Timeout:    m.options.Timeout,
-		ProgressFunc: func(downloaded, total int64) {
+		ChunkSize:           m.options.ChunkSize,
+		MaxRetries:          3,
+		RetryDelay:          2 * time.Second,
+		Headers:             make(map[string]string),
+		UserAgent:           "Go-Cloud-Downloader/1.0",
+		Timeout:             m.options.Timeout,
+		Resume:              resume,
+		MinChunkedSize:      m.options.MinChunkedSize,
+		Concurrency:         m.options.MaxConnections,
+		AdaptiveConcurrency: m.options.AdaptiveConcurrency,
+		MaxRedirects:        m.options.MaxRedirects,
+		Segments:            m.options.Segments,
+		Journal:             resume && m.options.Journal,
+		ForceSimple:         m.options.ForceSimpleDownload,
+		TotalRetryBudget:    m.options.TotalRetryBudget,
+		ChunkFunc:           m.emitChunkComplete,
+		ChunkStateFunc:      m.trackChunks(progressID),
+		WriteBufferSize:     m.options.WriteBufferSize,
+		UseMmap:             m.options.UseMmap,
+		ProgressFunc: fanOutProgress(func(downloaded, total int64) {
+			m.tracker.UpdateProgress(progressID, downloaded)
+			throughput.add(downloaded)
+
+			if resume && m.options.ResumeSaveInterval > 0 && time.Since(lastResumeSave) >= m.options.ResumeSaveInterval {
+				lastResumeSave = time.Now()
+				m.saveResumeState(ctx, req.URL, writePath, fileInfo.Size, fileInfo.ETag)
+			}
+
 			percentage := float64(downloaded) / float64(total) * 100
-			m.logger.Debugf("Progress: %.1f%% (%s / %s)",
+			logger.Debugf("Progress: %.1f%% (%s / %s)",
 				percentage,
 				utils.FormatBytes(downloaded),
 				utils.FormatBytes(total))
-		},
+		}, req.ProgressCallback),
+	}
+
+	if resume {
+		if fileInfo.Size == 0 {
+			// Without a size the partial file can only be continued if the
+			// server confirms it still serves the version it came from
+			downloadOptions.IfRange = m.resumeETag(req.URL, writePath)
+		}
+		m.saveResumeState(ctx, req.URL, writePath, fileInfo.Size, fileInfo.ETag)
+	}
+
+	m.applyRetryProfile(downloadOptions, service)
+
+	if m.options.SpotCheck {
+		downloadOptions.SpotChecks = spotCheckSamples
+	}
+
+	// A file that's decompressed is hashed afterwards, as the file it becomes
+	if verifyHash && !req.Decompress {
+		downloadOptions.HashAlgorithm = m.options.HashAlgorithm
+	}
+
+	// Reuse the service's file info so the HTTP client doesn't probe the URL a
+	// second time. Without a known size we let it probe for itself.
+	var knownInfo *utils.FileInfo
+	if fileInfo.Size > 0 {
+		knownInfo = &utils.FileInfo{
+			URL:                   downloadURL,
+			Filename:              fileInfo.Filename,
+			Size:                  fileInfo.Size,
+			SupportsRangeRequests: fileInfo.SupportsRange,
+		}
 	}
 
 	// Perform the download
-	err = m.httpClient.DownloadToFile(ctx, downloadURL, outputPath, downloadOptions)
+	var stats *utils.DownloadStats
+	var err error
+	if req.Range != nil {
+		stats, err = m.httpClient.DownloadRange(ctx, downloadURL, writePath, rangeStart, rangeEnd, downloadOptions)
+	} else if opened != nil && downloadURL == opened.Info.URL && downloadOptions.IfRange == "" {
+		// The GET that described the file is still open, its body is the file
+		stats, err = m.httpClient.DownloadOpened(ctx, opened, writePath, downloadOptions)
+	} else {
+		stats, err = m.httpClient.DownloadToFileWithInfo(ctx, downloadURL, writePath, knownInfo, downloadOptions)
+	}
 	if err != nil {
-		// Clean up partial file on error
-		if _, statErr := os.Stat(outputPath); statErr == nil {
-			os.Remove(outputPath)
+		if resume {
+			// Keep the partial file and record how far we got so it can be resumed
+			m.saveResumeState(ctx, req.URL, writePath, fileInfo.Size, fileInfo.ETag)
+		} else if _, statErr := os.Stat(writePath); statErr == nil {
+			// Clean up partial file on error
+			os.Remove(writePath)
 		}
-		return nil, fmt.Errorf("download failed: %w", err)
+		m.tracker.FailDownload(progressID, err)
+		return nil, fmt.Errorf("download failed: %w", classifyNetworkError(downloadURL, err))
 	}
+	m.tracker.CompleteDownload(progressID)
+	return stats, nil
+}
 
-	// Verify file size
-	finalFileInfo, err := os.Stat(outputPath)
+// DownloadToWriter streams the file for req into w instead of writing it to
+// disk. The body is read in a single request, so chunking and resume don't
+// apply. A requested hash is checked as the data streams, but since w has
+// already received everything by then, a mismatch only fails the result.
+func (m *Manager) DownloadToWriter(ctx context.Context, req *interfaces.DownloadRequest, w io.Writer) (*interfaces.DownloadResult, error) {
+	return m.downloadToWriter(ctx, req, w, StdoutPath)
+}
+
+// downloadToWriter is DownloadToWriter with the FilePath to report for w
+func (m *Manager) downloadToWriter(ctx context.Context, req *interfaces.DownloadRequest, w io.Writer, path string) (result *interfaces.DownloadResult, err error) {
+	ctx, done, err := m.begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to stat downloaded file: %w", err)
+		return nil, err
 	}
+	defer done()
+	defer func() {
+		m.stats.record(result, err)
+		m.emitResult(result, err)
+	}()
 
-	if finalFileInfo.Size() != fileInfo.Size {
-		return nil, fmt.Errorf("file size mismatch: expected %d, got %d", fileInfo.Size, finalFileInfo.Size())
+	result, _, err = m.stream(ctx, req, w, 0)
+	if err != nil {
+		return nil, err
 	}
+	result.FilePath = path
+	return result, nil
+}
 
-	// Hash verification if requested
-	var hash string
-	if m.options.VerifyHash && req.VerifyHash != "" {
-		m.logger.Info("Verifying file hash...")
-		hashCalculator := utils.NewHashCalculator()
-		calculatedHash, err := hashCalculator.CalculateHash(outputPath, m.options.HashAlgorithm)
+// stream writes the file for req to w with a single request, for
+// DownloadToWriter and DownloadToMemory. A file the service reports as
+// larger than maxBytes is refused before it's requested, zero allows any
+// size. The caller sets the result's FilePath.
+func (m *Manager) stream(ctx context.Context, req *interfaces.DownloadRequest, w io.Writer, maxBytes int64) (*interfaces.DownloadResult, *interfaces.FileInfo, error) {
+	ctx, cancel := withRequestDeadline(ctx, req, m.options.Timeout)
+	defer cancel()
+
+	req = m.normalizeRequest(req)
+	ctx = utils.WithSelectedFile(ctx, req.SelectFile)
+	ctx = utils.WithLinkPassword(ctx, req.Password)
+	startTime := time.Now()
+	logger := utils.LoggerFromContext(ctx, m.logger)
+
+	service := m.FindService(req.URL)
+	if service == nil {
+		return nil, nil, unsupportedURLError(req.URL)
+	}
+
+	logger.Infof("Using service: %s", service.GetServiceName())
+
+	fileInfo, err := service.GetFileInfo(ctx, req.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get file info: %w", classifyNetworkError(req.URL, err))
+	}
+
+	landingPage := m.isLandingPage(fileInfo)
+	if !landingPage {
+		if err := m.checkContentType(req.URL, fileInfo.ContentType); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	downloadURL, err := service.PrepareDownload(ctx, req.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prepare download: %w", classifyNetworkError(req.URL, err))
+	}
+
+	if landingPage {
+		downloadURL, fileInfo, err = m.followLandingPage(ctx, downloadURL, fileInfo)
 		if err != nil {
-			return nil, fmt.Errorf("failed to calculate hash: %w", err)
+			return nil, nil, err
+		}
+		if err := m.checkContentType(req.URL, fileInfo.ContentType); err != nil {
+			return nil, nil, err
 		}
+	}
 
-		if !strings.EqualFold(calculatedHash, req.VerifyHash) {
-			return nil, fmt.Errorf("hash verification failed: expected %s, got %s", req.VerifyHash, calculatedHash)
+	if maxBytes > 0 && fileInfo.Size > maxBytes {
+		return nil, nil, fileTooLargeError(req.URL, fileInfo.Size, maxBytes)
+	}
+
+	if err := checkReachable(ctx, m.httpClient, downloadURL); err != nil {
+		return nil, nil, fmt.Errorf("download host unreachable: %w", err)
+	}
+	m.emitStart(fileInfo)
+
+	// The stream is hashed on its way to w, so a mismatch can only be
+	// reported once every byte has been written
+	verifyHash := m.options.VerifyHash && req.VerifyHash != ""
+	var finishHash func(streamErr error) (string, error)
+	if verifyHash {
+		w, finishHash = teeHash(w, m.options.HashAlgorithm)
+	}
+	// Decompressing in front of the hash checks the data w ends up with
+	var gunzip *gunzipWriter
+	if req.Decompress {
+		gunzip = newGunzipWriter(w)
+		w = gunzip
+	}
+	if len(req.ExpectedHashes) > 0 {
+		logger.Warn("Expected hashes are only checked for downloads to a file, ignoring them while streaming")
+	}
+
+	logger.Infof("Streaming download: %s", fileInfo.Filename)
+
+	progressID := ProgressID(req.URL, req.OutputPath)
+	m.tracker.StartDownload(progressID, fileInfo.Filename, fileInfo.Size)
+	defer m.tracker.RemoveDownload(progressID)
+
+	throughput := newThroughputMeter(m.options.RecordThroughput)
+	written, err := m.httpClient.DownloadStream(ctx, downloadURL, w, &utils.DownloadOptions{
+		Headers:      make(map[string]string),
+		MaxRedirects: m.options.MaxRedirects,
+		ProgressFunc: fanOutProgress(func(downloaded, total int64) {
+			m.tracker.UpdateProgress(progressID, downloaded)
+			throughput.add(downloaded)
+		}, req.ProgressCallback),
+	})
+	if gunzip != nil {
+		if gunzipErr := gunzip.finish(err); err == nil && gunzipErr != nil {
+			err = &interfaces.DownloadError{
+				Type:    interfaces.ErrInvalidResponse.Type,
+				Message: fmt.Sprintf("failed to decompress %s: %v", fileInfo.Filename, gunzipErr),
+				URL:     req.URL,
+				Err:     gunzipErr,
+			}
 		}
+	}
+	if err != nil {
+		if finishHash != nil {
+			finishHash(err)
+		}
+		m.tracker.FailDownload(progressID, err)
+		return nil, nil, fmt.Errorf("download failed: %w", classifyNetworkError(downloadURL, err))
+	}
+	m.tracker.CompleteDownload(progressID)
 
+	if fileInfo.Size > 0 && !m.sizeAccepted(ctx, fileInfo.Size, written) {
+		if finishHash != nil {
+			finishHash(nil)
+		}
+		return nil, nil, fmt.Errorf("file size mismatch: expected %d, got %d", fileInfo.Size, written)
+	}
+
+	var hash string
+	if verifyHash {
+		calculatedHash, err := finishHash(nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to calculate hash: %w", err)
+		}
+		if !strings.EqualFold(calculatedHash, req.VerifyHash) {
+			return nil, nil, &interfaces.DownloadError{
+				Type:    interfaces.ErrHashMismatch.Type,
+				Message: fmt.Sprintf("hash verification failed after streaming: expected %s, got %s", req.VerifyHash, calculatedHash),
+				URL:     req.URL,
+			}
+		}
 		hash = calculatedHash
-		m.logger.Info("Hash verification passed")
+		logger.Info("Hash verification passed")
 	}
 
 	duration := time.Since(startTime)
-	speed := float64(fileInfo.Size) / duration.Seconds() / 1024 / 1024 // MB/s
+	speed := float64(written) / duration.Seconds() / 1024 / 1024 // MB/s
 
-	m.logger.Infof("Download completed successfully!")
-	m.logger.Infof("File: %s", outputPath)
-	m.logger.Infof("Size: %s", utils.FormatBytes(fileInfo.Size))
-	m.logger.Infof("Time: %.1f seconds", duration.Seconds())
-	m.logger.Infof("Speed: %.1f MB/s", speed)
+	size := written
+	if gunzip != nil {
+		size = gunzip.written
+	}
 
+	peak, samples := throughput.report(speed)
 	return &interfaces.DownloadResult{
-		FilePath:   outputPath,
-		Size:       fileInfo.Size,
+		Size:       size,
 		Duration:   duration,
 		Speed:      speed,
 		Hash:       hash,
-		Resumed:    false, // TODO: Implement resume detection
-		ChunksUsed: 0,     // TODO: Track chunks used
-	}, nil
+		ChunksUsed: 1,
+		FinalURL:   downloadURL,
+		PeakSpeed:  peak,
+		Throughput: samples,
+	}, fileInfo, nil
+}
+
+// ResolveOutputPath returns the path Download would write req to, looking up
+// the file's name with its service when the request doesn't fix the path.
+// Unlike Download it doesn't create the output directory or write anything.
+func (m *Manager) ResolveOutputPath(ctx context.Context, req *interfaces.DownloadRequest) (string, error) {
+	if req.OutputPath == StdoutPath {
+		return StdoutPath, nil
+	}
+
+	req = m.normalizeRequest(req)
+	ctx = utils.WithSelectedFile(ctx, req.SelectFile)
+	ctx = utils.WithLinkPassword(ctx, req.Password)
+	service := m.FindService(req.URL)
+	if service == nil {
+		return "", unsupportedURLError(req.URL)
+	}
+
+	fileInfo, err := service.GetFileInfo(ctx, req.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to get file info: %w", classifyNetworkError(req.URL, err))
+	}
+
+	landingPage := m.isLandingPage(fileInfo)
+	if landingPage || needsFilenameSniff(req, fileInfo) {
+		downloadURL, err := service.PrepareDownload(ctx, req.URL)
+		if err != nil {
+			return "", fmt.Errorf("failed to prepare download: %w", classifyNetworkError(req.URL, err))
+		}
+		if landingPage {
+			if downloadURL, fileInfo, err = m.followLandingPage(ctx, downloadURL, fileInfo); err != nil {
+				return "", err
+			}
+		}
+		if needsFilenameSniff(req, fileInfo) {
+			fileInfo = m.sniffFilename(ctx, downloadURL, fileInfo)
+		}
+	}
+
+	return m.outputPathFor(req, service, fileInfo)
 }
 
-func (m *Manager) determineOutputPath(req *interfaces.DownloadRequest, detectedFilename string) (string, error) {
+// outputPathFor resolves the output path for a request handled by service
+func (m *Manager) outputPathFor(req *interfaces.DownloadRequest, service interfaces.CloudService, fileInfo *interfaces.FileInfo) (string, error) {
+	var subDir string
+	if m.options.PreservePath && service.GetServiceName() == direct.ServiceName {
+		subDir = urlSubdirectory(req.URL)
+	}
+
+	return m.determineOutputPath(req, service.GetServiceName(), fileInfo.Filename, subDir)
+}
+
+// determineOutputPath works out where a download is written. subDir is placed
+// between the output directory and the filename, after the service's own
+// directory when GroupByService is set. Both are ignored for explicit output paths.
+func (m *Manager) determineOutputPath(req *interfaces.DownloadRequest, serviceName, detectedFilename, subDir string) (string, error) {
 	var outputPath string
 
 	if req.OutputPath != "" {
@@ -234,6 +1033,10 @@ func (m *Manager) determineOutputPath(req *interfaces.DownloadRequest, detectedF
 		if filename == "" {
 			filename = detectedFilename
 		}
+		if filename == "" {
+			filename = utils.QueryFilename(req.URL)
+		}
+		filename = sanitizeFilename(filename)
 		if filename == "" {
 			filename = "download"
 		}
@@ -244,16 +1047,269 @@ func (m *Manager) determineOutputPath(req *interfaces.DownloadRequest, detectedF
 			outputDir = filepath.Dir(req.OutputPath)
 		}
 
-		outputPath = filepath.Join(outputDir, filename)
+		var serviceDir string
+		if m.options.GroupByService {
+			serviceDir = serviceDirectory(serviceName)
+		}
+
+		outputPath = filepath.Join(outputDir, serviceDir, subDir, filename)
+	}
+
+	// Checked before prepareOutputDir creates directories, which would
+	// follow the links too
+	if err := m.checkSymlinks(outputPath, req.OutputPath != ""); err != nil {
+		return "", err
 	}
 
-	// Create output directory if it doesn't exist
+	return outputPath, nil
+}
+
+// prepareOutputDir creates the directory outputPath is written to if it
+// doesn't exist and checks that files can be created in it
+func prepareOutputDir(outputPath string) error {
 	outputDir := filepath.Dir(outputPath)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create output directory: %w", err)
+		return fmt.Errorf("failed to create output directory: %w", classifyWriteError(outputDir, err))
 	}
 
-	return outputPath, nil
+	return checkWritable(outputDir)
+}
+
+// urlSubdirectory returns the sanitized directory part of a URL's path, e.g.
+// "a/b" for https://host/a/b/file.txt. Segments that could escape the output
+// directory are dropped.
+func urlSubdirectory(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	segments := strings.Split(parsedURL.EscapedPath(), "/")
+	if len(segments) == 0 {
+		return ""
+	}
+
+	var dirs []string
+	for _, segment := range segments[:len(segments)-1] {
+		if decoded, err := url.PathUnescape(segment); err == nil {
+			segment = decoded
+		}
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		dirs = append(dirs, sanitizePathSegment(segment))
+	}
+
+	return filepath.Join(dirs...)
+}
+
+// serviceDirectory returns the directory name used for a service's files
+// with GroupByService, e.g. "Google Drive"
+func serviceDirectory(serviceName string) string {
+	name := strings.TrimSpace(sanitizePathSegment(serviceName))
+	if name == "" || name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// sanitizePathSegment replaces characters that aren't valid in a path segment on common filesystems
+func sanitizePathSegment(segment string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, segment)
+}
+
+// maxFilenameLength is the longest basename, in bytes, that common
+// filesystems accept
+const maxFilenameLength = 255
+
+// reservedFilenames are device names Windows won't create as files, with or
+// without an extension
+var reservedFilenames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeFilename makes a filename safe to create on every platform: only
+// its last path element is kept, so a name from a server can't lead out of
+// the output directory, a reserved device name such as "nul.txt" becomes
+// "nul_.txt", and a basename longer than maxFilenameLength is cut short,
+// keeping its extension. It returns "" when nothing usable is left.
+func sanitizeFilename(filename string) string {
+	// Backslashes separate paths on Windows, wherever the name came from
+	filename = filepath.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if filename == "." || filename == ".." || filename == "/" {
+		return ""
+	}
+
+	ext := filepath.Ext(filename)
+	if len(ext) > maxFilenameLength/2 {
+		// Anything this long isn't a real extension
+		ext = ""
+	}
+	base := strings.TrimSuffix(filename, ext)
+
+	// Windows matches reserved names on everything before the first dot
+	stem, rest, _ := strings.Cut(base, ".")
+	if reservedFilenames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		base = stem + "_"
+		if rest != "" {
+			base += "." + rest
+		}
+	}
+
+	if len(base)+len(ext) > maxFilenameLength {
+		base = truncateUTF8(base, maxFilenameLength-len(ext))
+	}
+
+	return base + ext
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// saveResumeState records the current size of the partial file so the download can be resumed later
+func (m *Manager) saveResumeState(ctx context.Context, url, outputPath string, totalSize int64, etag string) {
+	var downloaded int64
+	if info, err := os.Stat(outputPath); err == nil {
+		downloaded = info.Size()
+	}
+
+	err := m.resumeManager.SaveProgress(url, &interfaces.ResumeData{
+		URL:          url,
+		FilePath:     outputPath,
+		TotalSize:    totalSize,
+		Downloaded:   downloaded,
+		ChunkSize:    m.options.ChunkSize,
+		LastModified: time.Now(),
+		ETag:         etag,
+	})
+	if err != nil {
+		utils.LoggerFromContext(ctx, m.logger).Warnf("Failed to save resume data: %v", err)
+	}
+}
+
+// resumeETag returns the ETag saved with the partial file at outputPath, or
+// "" if there's no usable partial file for url
+func (m *Manager) resumeETag(url, outputPath string) string {
+	resumable, progress, err := m.resumeManager.IsResumable(url, outputPath)
+	if err != nil || !resumable || progress.Downloaded == 0 {
+		return ""
+	}
+	return progress.ETag
+}
+
+// discardTempFile removes a temp file whose contents failed verification so
+// the next attempt starts over instead of resuming corrupt data. Without temp
+// files the output is left alone, as before.
+func (m *Manager) discardTempFile(ctx context.Context, writePath, outputPath string) {
+	if writePath == outputPath {
+		return
+	}
+	if err := os.Remove(writePath); err != nil && !os.IsNotExist(err) {
+		utils.LoggerFromContext(ctx, m.logger).Warnf("Failed to remove temp file: %v", err)
+	}
+	if err := utils.RemoveJournal(writePath); err != nil {
+		utils.LoggerFromContext(ctx, m.logger).Warnf("Failed to remove journal: %v", err)
+	}
+}
+
+// completePartFile returns the stats of a download that's already finished
+// when the partial file at writePath holds every byte of the file, and nil
+// when it has to be downloaded. A full size alone proves nothing, a file can
+// be preallocated or a crash can leave holes, so the bytes have to be vouched
+// for by a journal covering all of them, the requested hash or a spot check.
+func (m *Manager) completePartFile(ctx context.Context, req *interfaces.DownloadRequest, downloadURL, writePath string, fileInfo *interfaces.FileInfo, verifyHash bool) *utils.DownloadStats {
+	logger := utils.LoggerFromContext(ctx, m.logger)
+
+	size := fileInfo.Size
+	if size <= 0 {
+		return nil
+	}
+	info, err := os.Stat(writePath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		return nil
+	}
+
+	// A journal lists every chunk that made it to disk, nothing else counts
+	if _, err := os.Stat(utils.JournalPath(writePath)); err == nil {
+		journal, err := utils.OpenJournal(utils.JournalPath(writePath))
+		if err != nil {
+			return nil
+		}
+		covered := journal.Covers(0, size-1)
+		journal.Close()
+		if !covered {
+			return nil
+		}
+		logger.Infof("Journal shows the partial file is complete, promoting it: %s", writePath)
+		if err := utils.RemoveJournal(writePath); err != nil {
+			logger.Warnf("Failed to remove journal: %v", err)
+		}
+		return &utils.DownloadStats{Resumed: true}
+	}
+
+	// Hashes are of the file a download decompresses to, not the partial file
+	if !req.Decompress && (verifyHash || len(req.ExpectedHashes) > 0) {
+		stats := &utils.DownloadStats{Resumed: true}
+		if verifyHash {
+			stats.Hash, err = utils.NewHashCalculator().CalculateHash(writePath, m.options.HashAlgorithm)
+			if err != nil || !strings.EqualFold(stats.Hash, req.VerifyHash) {
+				logger.Infof("Partial file has the full size but not the expected hash, downloading again: %s", writePath)
+				return nil
+			}
+		}
+		if len(req.ExpectedHashes) > 0 && verifyHashes(req.URL, writePath, req.ExpectedHashes) != nil {
+			logger.Infof("Partial file has the full size but not the expected hashes, downloading again: %s", writePath)
+			return nil
+		}
+		logger.Infof("Partial file is already complete and its hash matches, promoting it: %s", writePath)
+		return stats
+	}
+
+	if m.options.SpotCheck && fileInfo.SupportsRange {
+		if err := m.httpClient.SpotCheck(ctx, downloadURL, writePath, &utils.FileInfo{Size: size}, spotCheckSamples, nil); err != nil {
+			logger.Infof("Partial file has the full size but failed a spot check, downloading again: %v", err)
+			return nil
+		}
+		logger.Infof("Partial file is already complete and passed a spot check, promoting it: %s", writePath)
+		return &utils.DownloadStats{Resumed: true}
+	}
+
+	logger.Debugf("Partial file has the full size but nothing shows its content is, downloading again: %s", writePath)
+	return nil
+}
+
+// sizeAccepted reports whether a download of actual bytes passes for one of
+// expected bytes, warning when it only passes thanks to SizeTolerance
+func (m *Manager) sizeAccepted(ctx context.Context, expected, actual int64) bool {
+	if actual == expected {
+		return true
+	}
+	diff := actual - expected
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > m.options.SizeTolerance {
+		return false
+	}
+	utils.LoggerFromContext(ctx, m.logger).Warnf("File size %d differs from the expected %d, within the tolerance of %d bytes", actual, expected, m.options.SizeTolerance)
+	return true
 }
 
 func (m *Manager) checkExistingFile(outputPath string, expectedSize int64) (int64, bool) {
@@ -266,6 +1322,12 @@ func (m *Manager) checkExistingFile(outputPath string, expectedSize int64) (int6
 		return 0, false
 	}
 
+	// A journaled partial file can reach full size with gaps still in it
+	if _, err := os.Stat(utils.JournalPath(outputPath)); err == nil {
+		m.logger.Infof("Existing file has an unfinished journal, will resume it")
+		return fileInfo.Size(), false
+	}
+
 	actualSize := fileInfo.Size()
 	if actualSize == expectedSize {
 		return actualSize, true
@@ -275,19 +1337,199 @@ func (m *Manager) checkExistingFile(outputPath string, expectedSize int64) (int6
 	return actualSize, false
 }
 
+// teeHash returns a writer that copies everything to w while the hash
+// calculator reads the same bytes, and a function that ends the stream,
+// failing it with streamErr if that's non-nil, and returns the sum
+func teeHash(w io.Writer, algorithm string) (io.Writer, func(streamErr error) (string, error)) {
+	type outcome struct {
+		sum string
+		err error
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan outcome, 1)
+	go func() {
+		sum, err := utils.NewHashCalculator().CalculateHashReader(pr, algorithm)
+		// Unblocks the writer if hashing stopped early
+		pr.CloseWithError(err)
+		done <- outcome{sum, err}
+	}()
+
+	return io.MultiWriter(w, pw), func(streamErr error) (string, error) {
+		pw.CloseWithError(streamErr)
+		result := <-done
+		return result.sum, result.err
+	}
+}
+
+// withRequestDeadline bounds ctx by req.Deadline and by the request's
+// timeout, req.Timeout or else timeout, whichever ends first. Zero values
+// set no bound. The returned cancel function must always be called.
+func withRequestDeadline(ctx context.Context, req *interfaces.DownloadRequest, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if req.Timeout > 0 {
+		timeout = req.Timeout
+	}
+
+	deadline := req.Deadline
+	if timeout > 0 {
+		if end := time.Now().Add(timeout); deadline.IsZero() || end.Before(deadline) {
+			deadline = end
+		}
+	}
+	if deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, deadline)
+}
+
+// fanOutProgress returns a progress callback that calls each non-nil
+// callback in turn, the way io.MultiWriter fans out writes
+func fanOutProgress(callbacks ...func(downloaded, total int64)) func(downloaded, total int64) {
+	var active []func(downloaded, total int64)
+	for _, callback := range callbacks {
+		if callback != nil {
+			active = append(active, callback)
+		}
+	}
+
+	return func(downloaded, total int64) {
+		for _, callback := range active {
+			callback(downloaded, total)
+		}
+	}
+}
+
+// clampRange resolves r against a file of the given size, trimming an End
+// past the last byte. An unknown size (zero) leaves the range as requested.
+func clampRange(r *interfaces.ByteRange, size int64) (start, end int64, err error) {
+	start, end = r.Start, r.End
+	if start < 0 || (end >= 0 && end < start) {
+		return 0, 0, fmt.Errorf("invalid byte range %d-%d", r.Start, r.End)
+	}
+	if size <= 0 {
+		return start, end, nil
+	}
+	if start >= size {
+		return 0, 0, fmt.Errorf("byte range starts at %d, past the end of the %d byte file", start, size)
+	}
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+	return start, end, nil
+}
+
 func (m *Manager) Resume(ctx context.Context, req *interfaces.DownloadRequest) (*interfaces.DownloadResult, error) {
 	// TODO: Implement proper resume functionality using utils/resume.go
 	m.logger.Warn("Resume functionality not yet implemented, performing full download")
 	return m.Download(ctx, req)
 }
 
+// Cancel stops all downloads currently in flight. They fail with a context
+// error and keep their partial files for resuming.
 func (m *Manager) Cancel() error {
-	// TODO: Implement cancellation
-	m.logger.Warn("Cancel functionality not yet implemented")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, cancel := range m.cancels {
+		cancel()
+	}
 	return nil
 }
 
+// Close cancels in-flight downloads, waits for them to save their resume
+// state, delivers the events already queued for hooks and closes idle
+// connections. The manager must not be used after
+// Close, later downloads fail with ErrManagerClosed.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	for _, cancel := range m.cancels {
+		cancel()
+	}
+	m.mu.Unlock()
+
+	m.inFlight.Wait()
+	m.hooks.close()
+	m.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// begin registers a download so Cancel and Close can stop it. The returned
+// function must be called once the download has finished.
+func (m *Manager) begin(ctx context.Context) (context.Context, func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, nil, ErrManagerClosed
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	id := m.nextID
+	m.nextID++
+	m.cancels[id] = cancel
+	m.inFlight.Add(1)
+	m.stats.started.Add(1)
+
+	return ctx, func() {
+		m.mu.Lock()
+		delete(m.cancels, id)
+		m.mu.Unlock()
+		cancel()
+		m.inFlight.Done()
+	}, nil
+}
+
+// GetProgress returns the combined progress of all downloads currently in flight
 func (m *Manager) GetProgress() (downloaded, total int64) {
-	// TODO: Implement progress retrieval from progress manager
-	return 0, 0
+	return m.tracker.ActiveTotals()
+}
+
+// ProgressID returns the ID GetProgressByID and GetChunkStates know the
+// download of url to outputPath by. Downloads to a file are tracked under
+// the path the file is finally written to, ResolveOutputPath gives it for
+// requests without an explicit OutputPath. Streams are tracked under the
+// request's OutputPath, which is "" for DownloadToWriter and
+// DownloadToMemory.
+func ProgressID(url, outputPath string) string {
+	if outputPath == "" {
+		return url
+	}
+	return url + " -> " + outputPath
+}
+
+// GetProgressByID returns a snapshot of the progress of an in-flight
+// download, safe to read while the download goes on. Downloads are
+// identified by ProgressID.
+func (m *Manager) GetProgressByID(id string) (*progress.DownloadProgress, bool) {
+	return m.tracker.GetProgress(id)
+}
+
+// GetChunkStates returns the chunks of an in-flight download with whether
+// each is pending, downloading, completed or failed, for showing a chunk
+// grid. Downloads are identified by ProgressID, and those fetched without
+// chunks have none.
+func (m *Manager) GetChunkStates(id string) []progress.ChunkProgress {
+	return m.tracker.GetChunkStates(id)
+}
+
+// trackChunks returns the callback that mirrors the chunks of download id
+// in the tracker as the HTTP client plans and fetches them
+func (m *Manager) trackChunks(id string) func(index int, chunk utils.ChunkInfo, state utils.ChunkState) {
+	return func(index int, chunk utils.ChunkInfo, state utils.ChunkState) {
+		switch state {
+		case utils.ChunkPending:
+			m.tracker.AddChunk(id, index, chunk.Start, chunk.End)
+		case utils.ChunkDownloading:
+			m.tracker.SetChunkStatus(id, index, progress.ChunkDownloading)
+		case utils.ChunkCompleted:
+			m.tracker.UpdateChunkProgress(id, index, chunk.Size)
+		case utils.ChunkFailed:
+			m.tracker.SetChunkStatus(id, index, progress.ChunkFailed)
+		}
+	}
 }
@@ -1,18 +1,30 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/progress"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 )
 
 type mockService struct {
@@ -273,6 +285,8 @@ func TestManager_determineOutputPath(t *testing.T) {
 		outputDir        string
 		req              *interfaces.DownloadRequest
 		detectedFilename string
+		subDir           string
+		groupByService   bool
 		expected         string
 		shouldFail       bool
 	}{
@@ -308,15 +322,68 @@ func TestManager_determineOutputPath(t *testing.T) {
 			detectedFilename: "",
 			expected:         filepath.Join(tmpDir, "download"),
 		},
+		{
+			name:      "filename from signed URL query",
+			outputDir: tmpDir,
+			req: &interfaces.DownloadRequest{
+				URL: "https://bucket.s3.amazonaws.com/8f2c1d?X-Amz-Signature=abc&response-content-disposition=attachment%3B%20filename%3D%22file.pdf%22",
+			},
+			detectedFilename: "",
+			expected:         filepath.Join(tmpDir, "file.pdf"),
+		},
+		{
+			name:             "with subdirectory",
+			outputDir:        tmpDir,
+			req:              &interfaces.DownloadRequest{},
+			detectedFilename: "file.txt",
+			subDir:           filepath.Join("a", "b"),
+			expected:         filepath.Join(tmpDir, "a", "b", "file.txt"),
+		},
+		{
+			name:      "explicit output path ignores subdirectory",
+			outputDir: tmpDir,
+			req: &interfaces.DownloadRequest{
+				OutputPath: filepath.Join(tmpDir, "explicit.txt"),
+			},
+			detectedFilename: "file.txt",
+			subDir:           "a",
+			expected:         filepath.Join(tmpDir, "explicit.txt"),
+		},
+		{
+			name:             "grouped by service",
+			outputDir:        tmpDir,
+			req:              &interfaces.DownloadRequest{},
+			detectedFilename: "file.txt",
+			subDir:           "a",
+			groupByService:   true,
+			expected:         filepath.Join(tmpDir, "Test Service", "a", "file.txt"),
+		},
+		{
+			name:             "reserved detected filename",
+			outputDir:        tmpDir,
+			req:              &interfaces.DownloadRequest{},
+			detectedFilename: "CON.txt",
+			expected:         filepath.Join(tmpDir, "CON_.txt"),
+		},
+		{
+			name:      "explicit output path ignores service",
+			outputDir: tmpDir,
+			req: &interfaces.DownloadRequest{
+				OutputPath: filepath.Join(tmpDir, "explicit.txt"),
+			},
+			detectedFilename: "file.txt",
+			groupByService:   true,
+			expected:         filepath.Join(tmpDir, "explicit.txt"),
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			manager := &Manager{
-				options: &ManagerOptions{OutputDir: tt.outputDir},
+				options: &ManagerOptions{OutputDir: tt.outputDir, GroupByService: tt.groupByService},
 			}
 
-			result, err := manager.determineOutputPath(tt.req, tt.detectedFilename)
+			result, err := manager.determineOutputPath(tt.req, "Test Service", tt.detectedFilename, tt.subDir)
 
 			if tt.shouldFail {
 				if err == nil {
@@ -737,6 +804,70 @@ func TestManager_Download_WithContext(t *testing.T) {
 	}
 }
 
+func TestManager_Download_Deadline(t *testing.T) {
+	content := []byte("slow content")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		deadline       time.Duration
+		timeout        time.Duration // DownloadRequest.Timeout
+		managerTimeout time.Duration
+		wantErr        bool
+	}{
+		{name: "near deadline cancels", deadline: 100 * time.Millisecond, wantErr: true},
+		{name: "distant deadline completes", deadline: time.Minute, wantErr: false},
+		{name: "earlier request timeout cancels", deadline: time.Minute, timeout: 100 * time.Millisecond, wantErr: true},
+		{name: "earlier manager timeout cancels", deadline: time.Minute, managerTimeout: 100 * time.Millisecond, wantErr: true},
+		{name: "request timeout overrides manager timeout", deadline: time.Minute, timeout: time.Minute, managerTimeout: 100 * time.Millisecond, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			managerTimeout := tt.managerTimeout
+			if managerTimeout == 0 {
+				managerTimeout = 10 * time.Second
+			}
+			manager := NewManager(&ManagerOptions{
+				ChunkSize: 1024,
+				Timeout:   managerTimeout,
+				OutputDir: t.TempDir(),
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "slow.txt", Size: int64(len(content))}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			start := time.Now()
+			_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{
+				URL:      "https://test.com/slow",
+				Deadline: start.Add(tt.deadline),
+				Timeout:  tt.timeout,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && time.Since(start) >= 500*time.Millisecond {
+				t.Errorf("Download() took %s, want it stopped at the deadline", time.Since(start))
+			}
+		})
+	}
+}
+
 func TestManager_Download_WithHashVerification(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -816,3 +947,2055 @@ func TestManager_Cancel(t *testing.T) {
 		t.Errorf("Cancel should not return error for unimplemented functionality, got: %v", err)
 	}
 }
+
+func newRangeServer(content []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(content)))
+	}))
+}
+
+func TestManager_Download_ChunkMetrics(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 640)) // 10KB
+	server := newRangeServer(content)
+	defer server.Close()
+
+	newTestManager := func(outputDir string) *Manager {
+		manager := NewManager(&ManagerOptions{
+			MaxConnections: 4,
+			ChunkSize:      1024,
+			Timeout:        30 * time.Second,
+			OutputDir:      outputDir,
+			Resume:         true,
+			HashAlgorithm:  "sha256",
+		})
+		manager.RegisterService(&mockService{
+			name: "test-service",
+			supportedFn: func(url string) bool {
+				return strings.Contains(url, "test.com")
+			},
+			getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+				return &interfaces.FileInfo{
+					Filename:      "chunked.bin",
+					Size:          int64(len(content)),
+					URL:           url,
+					SupportsRange: true,
+				}, nil
+			},
+			prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+				return server.URL, nil
+			},
+		})
+		return manager
+	}
+
+	t.Run("fresh download", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		manager := newTestManager(tmpDir)
+
+		result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+
+		if result.ChunksUsed != 10 {
+			t.Errorf("ChunksUsed = %d, want 10", result.ChunksUsed)
+		}
+		if result.Resumed {
+			t.Error("Expected Resumed to be false for a fresh download")
+		}
+		if result.Retries != 0 {
+			t.Errorf("Retries = %d, want 0", result.Retries)
+		}
+	})
+
+	t.Run("resume from partial file", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		manager := newTestManager(tmpDir)
+
+		partialPath := filepath.Join(tmpDir, "chunked.bin")
+		if err := os.WriteFile(partialPath, content[:4096], 0644); err != nil {
+			t.Fatalf("Failed to create partial file: %v", err)
+		}
+
+		result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+
+		if !result.Resumed {
+			t.Error("Expected Resumed to be true after a partial file")
+		}
+		if result.ChunksUsed != 6 {
+			t.Errorf("ChunksUsed = %d, want 6", result.ChunksUsed)
+		}
+
+		downloaded, err := os.ReadFile(partialPath)
+		if err != nil {
+			t.Fatalf("Failed to read downloaded file: %v", err)
+		}
+		if string(downloaded) != string(content) {
+			t.Error("Resumed file content does not match original")
+		}
+	})
+}
+
+func TestManager_Download_ForceSimpleDownload(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 640)) // 10KB
+	var mu sync.Mutex
+	var requests int
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+			ranges = append(ranges, rangeHeader)
+		}
+		mu.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		MaxConnections:      4,
+		ChunkSize:           1024,
+		Timeout:             30 * time.Second,
+		OutputDir:           t.TempDir(),
+		Resume:              true,
+		SpotCheck:           true,
+		ForceSimpleDownload: true,
+	})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(url string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "large.bin", Size: int64(len(content)), SupportsRange: true}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/large"})
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if len(ranges) != 0 {
+		t.Errorf("sent Range headers %v, want none", ranges)
+	}
+	if requests != 1 || result.ChunksUsed != 1 {
+		t.Errorf("made %d requests in %d chunks, want a single request", requests, result.ChunksUsed)
+	}
+	if data, err := os.ReadFile(result.FilePath); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("downloaded file doesn't match the server's content: %v", err)
+	}
+}
+
+func TestManager_Download_ResumeDir(t *testing.T) {
+	content := "resumable content"
+
+	tests := []struct {
+		name          string
+		noResume      bool
+		expectRecords bool
+	}{
+		{
+			name:          "resume data lands in configured directory",
+			noResume:      false,
+			expectRecords: true,
+		},
+		{
+			name:          "NoResume skips resume data",
+			noResume:      true,
+			expectRecords: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resumeDir := t.TempDir()
+			var recordsDuringDownload int
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					entries, _ := os.ReadDir(resumeDir)
+					recordsDuringDownload = len(entries)
+				}
+				w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+				io.WriteString(w, content)
+			}))
+			defer server.Close()
+
+			manager := NewManager(&ManagerOptions{
+				MaxConnections: 8,
+				ChunkSize:      2 * 1024 * 1024,
+				Timeout:        30 * time.Second,
+				OutputDir:      t.TempDir(),
+				Resume:         true,
+				ResumeDir:      resumeDir,
+				HashAlgorithm:  "sha256",
+			})
+
+			manager.RegisterService(&mockService{
+				name: "test-service",
+				supportedFn: func(url string) bool {
+					return strings.Contains(url, "test.com")
+				},
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{
+						Filename: "resume.txt",
+						Size:     int64(len(content)),
+						URL:      url,
+					}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			req := &interfaces.DownloadRequest{
+				URL:      "https://test.com/file/resume",
+				NoResume: tt.noResume,
+			}
+
+			if _, err := manager.Download(context.Background(), req); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			if tt.expectRecords && recordsDuringDownload == 0 {
+				t.Error("Expected resume data in the configured directory during download")
+			}
+			if !tt.expectRecords && recordsDuringDownload != 0 {
+				t.Errorf("Expected no resume data with NoResume, found %d files", recordsDuringDownload)
+			}
+
+			entries, err := os.ReadDir(resumeDir)
+			if err != nil {
+				t.Fatalf("Failed to read resume directory: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Expected resume data to be cleared after success, found %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestManager_Download_SingleHeadRequest(t *testing.T) {
+	content := []byte(strings.Repeat("x", 4096))
+	var headRequests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			headRequests.Add(1)
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(content)))
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		MaxConnections: 4,
+		ChunkSize:      1024,
+		Timeout:        30 * time.Second,
+		OutputDir:      t.TempDir(),
+		HashAlgorithm:  "sha256",
+	})
+
+	manager.RegisterService(&mockService{
+		name: "test-service",
+		supportedFn: func(url string) bool {
+			return strings.Contains(url, "test.com")
+		},
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			// Probe the server the way the real services do
+			resp, err := http.Head(server.URL)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+
+			return &interfaces.FileInfo{
+				Filename:      "probed.bin",
+				Size:          resp.ContentLength,
+				URL:           url,
+				SupportsRange: resp.Header.Get("Accept-Ranges") == "bytes",
+			}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	if _, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"}); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if got := headRequests.Load(); got != 1 {
+		t.Errorf("Expected exactly 1 HEAD request, got %d", got)
+	}
+}
+
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewManagerWithClient(t *testing.T) {
+	content := "injected client content"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		io.WriteString(w, content)
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	client := utils.NewHTTPClient()
+	client.SetTransport(transport)
+
+	manager := NewManagerWithClient(&ManagerOptions{
+		MaxConnections: 4,
+		ChunkSize:      1024 * 1024,
+		Timeout:        30 * time.Second,
+		OutputDir:      t.TempDir(),
+		HashAlgorithm:  "sha256",
+	}, client)
+
+	if manager.httpClient != client {
+		t.Fatal("Expected manager to use the injected client")
+	}
+
+	manager.RegisterService(&mockService{
+		name: "test-service",
+		supportedFn: func(url string) bool {
+			return strings.Contains(url, "test.com")
+		},
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{
+				Filename: "injected.txt",
+				Size:     int64(len(content)),
+				URL:      url,
+			}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if transport.requests.Load() == 0 {
+		t.Error("Expected the download to go through the injected client's transport")
+	}
+
+	data, err := os.ReadFile(result.FilePath)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("Downloaded content = %q, want %q", string(data), content)
+	}
+}
+
+func TestNewManagerWithClient_NilClient(t *testing.T) {
+	manager := NewManagerWithClient(nil, nil)
+	if manager.httpClient == nil {
+		t.Fatal("Expected a default HTTP client when none is injected")
+	}
+}
+
+func TestManager_Download_PreservePath(t *testing.T) {
+	content := "nested file content"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		io.WriteString(w, content)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		preservePath bool
+		expected     []string
+	}{
+		{
+			name:         "preserve path",
+			preservePath: true,
+			expected:     []string{"a", "b", "file.txt"},
+		},
+		{
+			name:         "flat",
+			preservePath: false,
+			expected:     []string{"file.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			manager := NewManager(&ManagerOptions{
+				MaxConnections: 4,
+				ChunkSize:      1024 * 1024,
+				Timeout:        30 * time.Second,
+				OutputDir:      tmpDir,
+				HashAlgorithm:  "sha256",
+				PreservePath:   tt.preservePath,
+			})
+			manager.RegisterDirectService()
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: server.URL + "/a/b/file.txt"})
+			if err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			expectedPath := filepath.Join(append([]string{tmpDir}, tt.expected...)...)
+			if result.FilePath != expectedPath {
+				t.Errorf("Expected path %q, got %q", expectedPath, result.FilePath)
+			}
+			if _, err := os.Stat(expectedPath); err != nil {
+				t.Errorf("Downloaded file missing at %s: %v", expectedPath, err)
+			}
+		})
+	}
+}
+
+func TestURLSubdirectory(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://host/a/b/file.txt", filepath.Join("a", "b")},
+		{"https://host/file.txt", ""},
+		{"https://host/", ""},
+		{"https://host/../../etc/passwd", "etc"},
+		{"https://host/a/./b//c/file.txt", filepath.Join("a", "b", "c")},
+		{"https://host/my%20dir/file.txt", "my dir"},
+		{"https://host/a%2F..%2Fb/file.txt", "a_.._b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := urlSubdirectory(tt.url); got != tt.expected {
+				t.Errorf("urlSubdirectory(%s) = %q, want %q", tt.url, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestManager_GetProgress_Live(t *testing.T) {
+	content := []byte(strings.Repeat("p", 10*1024))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			time.Sleep(20 * time.Millisecond)
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(content)))
+	}))
+	defer server.Close()
+
+	outputDir := t.TempDir()
+	manager := NewManager(&ManagerOptions{
+		MaxConnections: 1,
+		ChunkSize:      1024,
+		Timeout:        30 * time.Second,
+		OutputDir:      outputDir,
+		HashAlgorithm:  "sha256",
+	})
+
+	manager.RegisterService(&mockService{
+		name: "test-service",
+		supportedFn: func(url string) bool {
+			return strings.Contains(url, "test.com")
+		},
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{
+				Filename:      "slow.bin",
+				Size:          int64(len(content)),
+				URL:           url,
+				SupportsRange: true,
+			}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	const requestURL = "https://test.com/slow"
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: requestURL})
+		done <- err
+	}()
+
+	var samples []int64
+	var sawByID bool
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+
+poll:
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+			break poll
+		case <-ticker.C:
+			downloaded, total := manager.GetProgress()
+			if total > 0 {
+				samples = append(samples, downloaded)
+				if total != int64(len(content)) {
+					t.Errorf("GetProgress total = %d, want %d", total, len(content))
+				}
+			}
+			if p, ok := manager.GetProgressByID(ProgressID(requestURL, filepath.Join(outputDir, "slow.bin"))); ok && p.Filename == "slow.bin" {
+				sawByID = true
+			}
+		}
+	}
+
+	if len(samples) < 2 {
+		t.Fatalf("Expected several progress samples during the download, got %d", len(samples))
+	}
+	for i := 1; i < len(samples); i++ {
+		if samples[i] < samples[i-1] {
+			t.Errorf("Progress went backwards: %d -> %d", samples[i-1], samples[i])
+		}
+	}
+	if samples[len(samples)-1] <= samples[0] {
+		t.Errorf("Expected progress to increase, got first=%d last=%d", samples[0], samples[len(samples)-1])
+	}
+	if !sawByID {
+		t.Error("Expected GetProgressByID to find the in-flight download")
+	}
+
+	if downloaded, total := manager.GetProgress(); downloaded != 0 || total != 0 {
+		t.Errorf("Expected no active progress after completion, got (%d, %d)", downloaded, total)
+	}
+}
+
+func TestManager_GetProgressByID_SameURL(t *testing.T) {
+	content := []byte(strings.Repeat("same url ", 100))
+
+	// The first download is served straight away, the second waits until
+	// the test has checked its progress outlived the first
+	release := make(chan struct{})
+	var gets atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && gets.Add(1) > 1 {
+			<-release
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	dir := t.TempDir()
+	manager := NewManager(&ManagerOptions{
+		ChunkSize:      1024,
+		MinChunkedSize: int64(len(content)) + 1,
+		Timeout:        10 * time.Second,
+		OutputDir:      dir,
+	})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "same.bin", Size: int64(len(content)), SupportsRange: true}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	const requestURL = "https://test.com/same"
+	paths := []string{filepath.Join(dir, "first.bin"), filepath.Join(dir, "second.bin")}
+	done := make(chan string, len(paths))
+	for _, path := range paths {
+		go func() {
+			if _, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: requestURL, OutputPath: path}); err != nil {
+				t.Errorf("Download(%s) error = %v", path, err)
+			}
+			done <- path
+		}()
+	}
+
+	var finished string
+	select {
+	case finished = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("neither download finished")
+	}
+
+	other := paths[0]
+	if other == finished {
+		other = paths[1]
+	}
+	if _, ok := manager.GetProgressByID(ProgressID(requestURL, finished)); ok {
+		t.Errorf("progress of the finished download to %s is still tracked", finished)
+	}
+	if p, ok := manager.GetProgressByID(ProgressID(requestURL, other)); !ok || p.Status != progress.StatusRunning {
+		t.Errorf("progress of the running download to %s = %v, %v, want it still running", other, p, ok)
+	}
+
+	close(release)
+	<-done
+}
+
+func TestManager_Download_InsecureSkipVerify(t *testing.T) {
+	content := []byte("served over a self-signed certificate")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(content)))
+	}))
+	defer server.Close()
+
+	newTestManager := func(insecure bool) *Manager {
+		manager := NewManager(&ManagerOptions{
+			ChunkSize:          1024,
+			Timeout:            10 * time.Second,
+			OutputDir:          t.TempDir(),
+			InsecureSkipVerify: insecure,
+		})
+		manager.RegisterService(&mockService{
+			name:        "test-service",
+			supportedFn: func(string) bool { return true },
+			getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+				return &interfaces.FileInfo{Filename: "tls.txt", Size: int64(len(content)), URL: url}, nil
+			},
+			prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+				return server.URL, nil
+			},
+		})
+		return manager
+	}
+
+	t.Run("fails without InsecureSkipVerify", func(t *testing.T) {
+		_, err := newTestManager(false).Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+		if !errors.Is(err, interfaces.ErrNetworkError) || !strings.Contains(err.Error(), "TLS") {
+			t.Errorf("Download() error = %v, want a TLS network error", err)
+		}
+	})
+
+	t.Run("succeeds with InsecureSkipVerify", func(t *testing.T) {
+		result, err := newTestManager(true).Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+
+		data, err := os.ReadFile(result.FilePath)
+		if err != nil {
+			t.Fatalf("Failed to read downloaded file: %v", err)
+		}
+		if string(data) != string(content) {
+			t.Errorf("Downloaded content = %q, want %q", data, content)
+		}
+	})
+}
+
+func TestManager_DownloadToWriter(t *testing.T) {
+	content := []byte(strings.Repeat("streamed to a writer ", 200))
+	server := newRangeServer(content)
+	defer server.Close()
+
+	outputDir := t.TempDir()
+	manager := NewManager(&ManagerOptions{
+		ChunkSize: 1024,
+		Timeout:   10 * time.Second,
+		OutputDir: outputDir,
+		Resume:    true,
+	})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "stream.txt", Size: int64(len(content)), URL: url, SupportsRange: true}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	var buf strings.Builder
+	result, err := manager.DownloadToWriter(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"}, &buf)
+	if err != nil {
+		t.Fatalf("DownloadToWriter failed: %v", err)
+	}
+
+	if buf.String() != string(content) {
+		t.Error("Streamed content does not match")
+	}
+	if result.FilePath != StdoutPath || result.Size != int64(len(content)) {
+		t.Errorf("result = {%q, %d}, want {%q, %d}", result.FilePath, result.Size, StdoutPath, len(content))
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("Failed to read output directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("output directory has %d entries, want none", len(entries))
+	}
+}
+
+func TestManager_Download_UseTempFile(t *testing.T) {
+	content := []byte(strings.Repeat("temp file content ", 600))
+
+	newTestManager := func(outputDir string, serverURL string, resume bool) *Manager {
+		manager := NewManager(&ManagerOptions{
+			MaxConnections: 2,
+			ChunkSize:      1024,
+			Timeout:        10 * time.Second,
+			OutputDir:      outputDir,
+			ResumeDir:      t.TempDir(),
+			Resume:         resume,
+			UseTempFile:    true,
+		})
+		manager.RegisterService(&mockService{
+			name:        "test-service",
+			supportedFn: func(string) bool { return true },
+			getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+				return &interfaces.FileInfo{Filename: "final.bin", Size: int64(len(content)), URL: url, SupportsRange: true}, nil
+			},
+			prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+				return serverURL, nil
+			},
+		})
+		return manager
+	}
+
+	t.Run("final name appears only after success", func(t *testing.T) {
+		outputDir := t.TempDir()
+		finalPath := filepath.Join(outputDir, "final.bin")
+
+		var finalSeenEarly atomic.Bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := os.Stat(finalPath); err == nil {
+				finalSeenEarly.Store(true)
+			}
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(content)))
+		}))
+		defer server.Close()
+
+		result, err := newTestManager(outputDir, server.URL, true).Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+
+		if finalSeenEarly.Load() {
+			t.Error("final file existed while the download was still in progress")
+		}
+		if result.FilePath != finalPath {
+			t.Errorf("FilePath = %s, want %s", result.FilePath, finalPath)
+		}
+		data, err := os.ReadFile(finalPath)
+		if err != nil {
+			t.Fatalf("Failed to read final file: %v", err)
+		}
+		if string(data) != string(content) {
+			t.Error("Downloaded content does not match")
+		}
+		if _, err := os.Stat(finalPath + partFileSuffix); !os.IsNotExist(err) {
+			t.Errorf("temp file still exists after success: %v", err)
+		}
+	})
+
+	t.Run("failed download leaves no final-named file", func(t *testing.T) {
+		outputDir := t.TempDir()
+		finalPath := filepath.Join(outputDir, "final.bin")
+
+		// Serve the first chunk, then fail everything else
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "bytes=0-1023" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(content)))
+		}))
+		defer server.Close()
+
+		manager := newTestManager(outputDir, server.URL, true)
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		if _, err := manager.Download(ctx, &interfaces.DownloadRequest{URL: "https://test.com/file"}); err == nil {
+			t.Fatal("Expected download to fail")
+		}
+
+		if _, err := os.Stat(finalPath); !os.IsNotExist(err) {
+			t.Errorf("final file exists after a failed download: %v", err)
+		}
+
+		// With resume enabled the partial data stays in the temp file
+		info, err := os.Stat(finalPath + partFileSuffix)
+		if err != nil {
+			t.Fatalf("Expected temp file to be kept for resume: %v", err)
+		}
+		if info.Size() != 1024 {
+			t.Errorf("temp file size = %d, want the 1024 byte completed prefix", info.Size())
+		}
+	})
+
+	t.Run("resume continues the temp file", func(t *testing.T) {
+		outputDir := t.TempDir()
+		finalPath := filepath.Join(outputDir, "final.bin")
+		if err := os.WriteFile(finalPath+partFileSuffix, content[:4096], 0644); err != nil {
+			t.Fatalf("Failed to write partial temp file: %v", err)
+		}
+
+		server := newRangeServer(content)
+		defer server.Close()
+
+		result, err := newTestManager(outputDir, server.URL, true).Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+		if !result.Resumed {
+			t.Error("Expected download to resume from the temp file")
+		}
+
+		data, err := os.ReadFile(finalPath)
+		if err != nil {
+			t.Fatalf("Failed to read final file: %v", err)
+		}
+		if string(data) != string(content) {
+			t.Error("Resumed content does not match")
+		}
+	})
+}
+
+func TestManager_Download_UseTempFile_VerifiesBeforeRename(t *testing.T) {
+	content := []byte(strings.Repeat("verified before rename ", 200))
+	sum := sha256.Sum256(content)
+	goodHash := hex.EncodeToString(sum[:])
+	badHash := strings.Repeat("0", len(goodHash))
+
+	tests := []struct {
+		name           string
+		verifyHash     string
+		expectedHashes map[string]string
+		wantErr        bool
+	}{
+		{name: "matching hash", verifyHash: goodHash},
+		{name: "hash mismatch", verifyHash: badHash, wantErr: true},
+		{name: "expected hashes mismatch", expectedHashes: map[string]string{"sha256": badHash}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			finalPath := filepath.Join(outputDir, "verified.bin")
+			partPath := finalPath + partFileSuffix
+
+			// A previous good copy must survive a corrupt download
+			if err := os.WriteFile(finalPath, []byte("previous version"), 0644); err != nil {
+				t.Fatalf("Failed to create existing file: %v", err)
+			}
+
+			var finalTouched atomic.Bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if data, _ := os.ReadFile(finalPath); string(data) != "previous version" {
+					finalTouched.Store(true)
+				}
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+			}))
+			defer server.Close()
+
+			manager := NewManager(&ManagerOptions{
+				ChunkSize:     1024,
+				Timeout:       10 * time.Second,
+				OutputDir:     outputDir,
+				ResumeDir:     t.TempDir(),
+				Resume:        true,
+				UseTempFile:   true,
+				VerifyHash:    true,
+				HashAlgorithm: "sha256",
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "verified.bin", Size: int64(len(content)), SupportsRange: true}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{
+				URL:            "https://test.com/verified",
+				VerifyHash:     tt.verifyHash,
+				ExpectedHashes: tt.expectedHashes,
+			})
+			if finalTouched.Load() {
+				t.Error("final file changed while the download was in progress")
+			}
+
+			data, readErr := os.ReadFile(finalPath)
+			if readErr != nil {
+				t.Fatalf("Failed to read final file: %v", readErr)
+			}
+			if _, statErr := os.Stat(partPath); !os.IsNotExist(statErr) {
+				t.Errorf("part file left behind: %v", statErr)
+			}
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Download() error = %v", err)
+				}
+				if !bytes.Equal(data, content) {
+					t.Error("verified download wasn't moved into place")
+				}
+				return
+			}
+
+			if !errors.Is(err, interfaces.ErrHashMismatch) {
+				t.Fatalf("Download() error = %v, want ErrHashMismatch", err)
+			}
+			if string(data) != "previous version" {
+				t.Errorf("final file = %q after a failed verification, want the previous version", data)
+			}
+		})
+	}
+}
+
+func TestManager_Download_CompletePartFile(t *testing.T) {
+	content := []byte(strings.Repeat("complete part ", 100))
+	corrupt := bytes.Repeat([]byte("x"), len(content))
+	sum := sha256.Sum256(content)
+
+	tests := []struct {
+		name         string
+		part         []byte
+		journal      *utils.ChunkInfo // Range recorded in a journal next to the part file
+		hash         string
+		spotCheck    bool
+		wantPromoted bool
+	}{
+		{name: "full size alone is downloaded again", part: corrupt},
+		{name: "promoted when the journal covers every byte", part: content, journal: &utils.ChunkInfo{Start: 0, End: int64(len(content)) - 1}, wantPromoted: true},
+		{name: "resumed when the journal has gaps", part: corrupt, journal: &utils.ChunkInfo{Start: 0, End: 9}},
+		{name: "promoted after hash check", part: content, hash: hex.EncodeToString(sum[:]), wantPromoted: true},
+		{name: "hash mismatch is downloaded again", part: corrupt, hash: hex.EncodeToString(sum[:])},
+		{name: "promoted after spot check", part: content, spotCheck: true, wantPromoted: true},
+		{name: "failed spot check is downloaded again", part: corrupt, spotCheck: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+			}))
+			defer server.Close()
+
+			tmpDir := t.TempDir()
+			finalPath := filepath.Join(tmpDir, "done.bin")
+			partPath := finalPath + partFileSuffix
+			if err := os.WriteFile(partPath, tt.part, 0644); err != nil {
+				t.Fatalf("Failed to create part file: %v", err)
+			}
+			if tt.journal != nil {
+				journal, err := utils.OpenJournal(utils.JournalPath(partPath))
+				if err != nil {
+					t.Fatalf("OpenJournal() error = %v", err)
+				}
+				if err := journal.Record(tt.journal.Start, tt.journal.End); err != nil {
+					t.Fatalf("Record() error = %v", err)
+				}
+				journal.Close()
+			}
+
+			manager := NewManager(&ManagerOptions{
+				ChunkSize:     1024,
+				Timeout:       10 * time.Second,
+				OutputDir:     tmpDir,
+				Resume:        true,
+				UseTempFile:   true,
+				Journal:       tt.journal != nil,
+				VerifyHash:    tt.hash != "",
+				HashAlgorithm: "sha256",
+				SpotCheck:     tt.spotCheck,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "done.bin", Size: int64(len(content)), SupportsRange: true}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/done", VerifyHash: tt.hash})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			data, err := os.ReadFile(finalPath)
+			if err != nil || !bytes.Equal(data, content) {
+				t.Errorf("final file = %q, %v, want the server's content", data, err)
+			}
+			if _, err := os.Stat(partPath); !os.IsNotExist(err) {
+				t.Error("part file is still there after the download")
+			}
+			if _, err := os.Stat(utils.JournalPath(partPath)); !os.IsNotExist(err) {
+				t.Error("journal is still there after the download")
+			}
+
+			if tt.wantPromoted {
+				if !result.Resumed || result.ChunksUsed != 0 {
+					t.Errorf("Resumed = %v, ChunksUsed = %d, want a resume with no chunks", result.Resumed, result.ChunksUsed)
+				}
+				if n := requests.Load(); !tt.spotCheck && n != 0 {
+					t.Errorf("server got %d requests, want none", n)
+				}
+			} else if result.ChunksUsed == 0 {
+				t.Error("ChunksUsed = 0, want the part file downloaded again")
+			}
+		})
+	}
+}
+
+func TestManager_Download_RequestID(t *testing.T) {
+	content := []byte(strings.Repeat("correlated ", 100))
+	server := newRangeServer(content)
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		ChunkSize:      1024,
+		Timeout:        10 * time.Second,
+		OutputDir:      t.TempDir(),
+		MinChunkedSize: 1024 * 1024,
+	})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "correlated.txt", Size: int64(len(content)), URL: url, SupportsRange: true}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	manager.SetLogger(logger)
+
+	ctx := WithRequestID(context.Background(), "req-42")
+	if _, err := manager.Download(ctx, &interfaces.DownloadRequest{URL: "https://test.com/file"}); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) == 0 {
+		t.Fatal("Expected log entries for the download")
+	}
+
+	var sawClientEntry bool
+	for _, entry := range entries {
+		if entry.Data[utils.RequestIDField] != "req-42" {
+			t.Errorf("log entry %q has request_id %v, want req-42", entry.Message, entry.Data[utils.RequestIDField])
+		}
+		if strings.HasPrefix(entry.Message, "File is smaller than") {
+			sawClientEntry = true
+		}
+	}
+	if !sawClientEntry {
+		t.Error("Expected the HTTP client's log lines to carry the request ID too")
+	}
+
+	if id, ok := RequestIDFromContext(ctx); !ok || id != "req-42" {
+		t.Errorf("RequestIDFromContext() = %q, %v, want req-42, true", id, ok)
+	}
+	if _, ok := RequestIDFromContext(context.Background()); ok {
+		t.Error("RequestIDFromContext() found an ID in a plain context")
+	}
+}
+
+// countingResumeStore records how often progress is saved
+type countingResumeStore struct {
+	resumeStore
+	saves atomic.Int32
+}
+
+func (s *countingResumeStore) SaveProgress(url string, progress *interfaces.ResumeData) error {
+	s.saves.Add(1)
+	return s.resumeStore.SaveProgress(url, progress)
+}
+
+func TestManager_Download_ResumeSaveInterval(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 64*20)) // 20KB, 20 chunks of 1KB
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			time.Sleep(20 * time.Millisecond)
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(content)))
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		MaxConnections:     1,
+		ChunkSize:          1024,
+		Timeout:            30 * time.Second,
+		OutputDir:          t.TempDir(),
+		Resume:             true,
+		ResumeDir:          t.TempDir(),
+		ResumeSaveInterval: 50 * time.Millisecond,
+	})
+	store := &countingResumeStore{resumeStore: manager.resumeManager}
+	manager.resumeManager = store
+
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(url string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "throttled.bin", Size: int64(len(content)), SupportsRange: true}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	if _, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"}); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	// One save at the start plus one every 50ms of a roughly 400ms download,
+	// far fewer than the 20 progress updates
+	saves := store.saves.Load()
+	if saves < 3 {
+		t.Errorf("SaveProgress called %d times, want periodic saves during the download", saves)
+	}
+	if saves > 12 {
+		t.Errorf("SaveProgress called %d times, want saves debounced to the interval", saves)
+	}
+}
+
+func TestManager_Download_FinalURL(t *testing.T) {
+	content := []byte(strings.Repeat("shared from dropbox ", 200)) // 4000 bytes
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Like Dropbox, the dl=1 share link redirects to a content host
+		if r.URL.Path == "/s/abc123/report.pdf" && r.URL.Query().Get("dl") == "1" && r.URL.Query().Get("redirect") != "" {
+			http.Redirect(w, r, "/content/abc123/report.pdf", http.StatusFound)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(content)))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		downloadURL  string
+		wantFinalURL string
+	}{
+		{
+			name:         "converted URL without redirects",
+			downloadURL:  server.URL + "/s/abc123/report.pdf?dl=1",
+			wantFinalURL: server.URL + "/s/abc123/report.pdf?dl=1",
+		},
+		{
+			name:         "redirect to content host",
+			downloadURL:  server.URL + "/s/abc123/report.pdf?dl=1&redirect=1",
+			wantFinalURL: server.URL + "/content/abc123/report.pdf",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(&ManagerOptions{
+				MaxConnections: 2,
+				ChunkSize:      1024,
+				Timeout:        10 * time.Second,
+				OutputDir:      t.TempDir(),
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "report.pdf", Size: int64(len(content)), SupportsRange: true}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return tt.downloadURL, nil
+				},
+			})
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/s/abc123/report.pdf?dl=0"})
+			if err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+			if result.FinalURL != tt.wantFinalURL {
+				t.Errorf("FinalURL = %q, want %q", result.FinalURL, tt.wantFinalURL)
+			}
+		})
+	}
+}
+
+func TestManager_Close(t *testing.T) {
+	newTestManager := func(serverURL string) *Manager {
+		manager := NewManager(&ManagerOptions{
+			MaxConnections: 1,
+			ChunkSize:      1024,
+			Timeout:        10 * time.Second,
+			OutputDir:      t.TempDir(),
+			Resume:         true,
+			ResumeDir:      t.TempDir(),
+		})
+		manager.RegisterService(&mockService{
+			name:        "test-service",
+			supportedFn: func(url string) bool { return true },
+			getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+				return &interfaces.FileInfo{Filename: "file.bin", Size: 8192, SupportsRange: true}, nil
+			},
+			prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+				return serverURL, nil
+			},
+		})
+		return manager
+	}
+
+	t.Run("download after close fails", func(t *testing.T) {
+		content := []byte(strings.Repeat("x", 8192))
+		server := newRangeServer(content)
+		defer server.Close()
+
+		manager := newTestManager(server.URL)
+		if err := manager.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if err := manager.Close(); err != nil {
+			t.Errorf("second Close() error = %v, want nil", err)
+		}
+
+		_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+		if !errors.Is(err, ErrManagerClosed) {
+			t.Errorf("Download() error = %v, want %v", err, ErrManagerClosed)
+		}
+		_, err = manager.DownloadToWriter(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"}, io.Discard)
+		if !errors.Is(err, ErrManagerClosed) {
+			t.Errorf("DownloadToWriter() error = %v, want %v", err, ErrManagerClosed)
+		}
+	})
+
+	t.Run("close cancels in-flight downloads", func(t *testing.T) {
+		started := make(chan struct{}, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer server.Close()
+
+		manager := newTestManager(server.URL)
+		errc := make(chan error, 1)
+		go func() {
+			_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+			errc <- err
+		}()
+
+		<-started
+		start := time.Now()
+		if err := manager.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Close took %v, want the download cancelled promptly", elapsed)
+		}
+
+		select {
+		case err := <-errc:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Download() error = %v, want context.Canceled", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Download did not return after Close")
+		}
+	})
+}
+
+func TestClampRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		r         interfaces.ByteRange
+		size      int64
+		wantStart int64
+		wantEnd   int64
+		wantErr   bool
+	}{
+		{name: "inside file", r: interfaces.ByteRange{Start: 100, End: 199}, size: 1000, wantStart: 100, wantEnd: 199},
+		{name: "end past file", r: interfaces.ByteRange{Start: 900, End: 5000}, size: 1000, wantStart: 900, wantEnd: 999},
+		{name: "open end", r: interfaces.ByteRange{Start: 10, End: -1}, size: 1000, wantStart: 10, wantEnd: 999},
+		{name: "unknown size", r: interfaces.ByteRange{Start: 10, End: -1}, size: 0, wantStart: 10, wantEnd: -1},
+		{name: "start past file", r: interfaces.ByteRange{Start: 1000, End: 1100}, size: 1000, wantErr: true},
+		{name: "end before start", r: interfaces.ByteRange{Start: 50, End: 10}, size: 1000, wantErr: true},
+		{name: "negative start", r: interfaces.ByteRange{Start: -1, End: 10}, size: 1000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := clampRange(&tt.r, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clampRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (start != tt.wantStart || end != tt.wantEnd) {
+				t.Errorf("clampRange() = %d-%d, want %d-%d", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestManager_Download_Range(t *testing.T) {
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			ranges = append(ranges, r.Header.Get("Range"))
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		r         interfaces.ByteRange
+		wantRange string
+		want      []byte
+	}{
+		{name: "bytes 100-199", r: interfaces.ByteRange{Start: 100, End: 199}, wantRange: "bytes=100-199", want: content[100:200]},
+		{name: "clamped to file size", r: interfaces.ByteRange{Start: 950, End: 4096}, wantRange: "bytes=950-999", want: content[950:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges = nil
+			tmpDir := t.TempDir()
+			manager := NewManager(&ManagerOptions{
+				ChunkSize: 64,
+				Timeout:   10 * time.Second,
+				OutputDir: tmpDir,
+				Resume:    true,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "part.bin", Size: int64(len(content)), SupportsRange: true}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			r := tt.r
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file/123", Range: &r})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			if len(ranges) != 1 || ranges[0] != tt.wantRange {
+				t.Errorf("GET Range headers = %v, want [%s]", ranges, tt.wantRange)
+			}
+			if result.Size != int64(len(tt.want)) {
+				t.Errorf("result.Size = %d, want %d", result.Size, len(tt.want))
+			}
+
+			data, err := os.ReadFile(filepath.Join(tmpDir, "part.bin"))
+			if err != nil {
+				t.Fatalf("Failed to read downloaded file: %v", err)
+			}
+			if !bytes.Equal(data, tt.want) {
+				t.Errorf("downloaded %d bytes, want exactly the requested %d", len(data), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestManager_Download_ChunkedEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		parts   []string
+		size    int64 // What the service reports for the missing Content-Length
+		wantErr bool
+	}{
+		{name: "streamed body", parts: []string{"first part, ", "second part, ", "last part"}, size: -1},
+		{name: "streamed body reported as zero", parts: []string{"first part, ", "second part, ", "last part"}},
+		{name: "empty body", parts: nil, size: -1, wantErr: true},
+		{name: "empty body reported as zero", parts: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sawChunked atomic.Bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Flushing before the handler returns makes net/http fall
+				// back to chunked encoding with no Content-Length
+				w.Header().Set("Content-Type", "application/octet-stream")
+				w.WriteHeader(http.StatusOK)
+				for _, part := range tt.parts {
+					io.WriteString(w, part)
+					w.(http.Flusher).Flush()
+				}
+			}))
+			defer server.Close()
+
+			tmpDir := t.TempDir()
+			manager := NewManager(&ManagerOptions{
+				ChunkSize: 1024,
+				Timeout:   10 * time.Second,
+				OutputDir: tmpDir,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					resp, err := http.Get(server.URL)
+					if err != nil {
+						return nil, err
+					}
+					defer resp.Body.Close()
+					io.Copy(io.Discard, resp.Body)
+					sawChunked.Store(resp.ContentLength == -1 && len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked")
+					return &interfaces.FileInfo{Filename: "stream.bin", Size: tt.size}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/stream"})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Download() error = nil, want an error for an empty body")
+				}
+				if !strings.Contains(err.Error(), "downloaded file is empty") {
+					t.Errorf("Download() error = %v, want an empty file error", err)
+				}
+				return
+			}
+			if !sawChunked.Load() {
+				t.Fatal("test server did not use chunked transfer encoding")
+			}
+			if err != nil {
+				t.Fatalf("Download() error = %v, want nil", err)
+			}
+
+			want := strings.Join(tt.parts, "")
+			if result.Size != int64(len(want)) {
+				t.Errorf("result.Size = %d, want %d", result.Size, len(want))
+			}
+			data, err := os.ReadFile(filepath.Join(tmpDir, "stream.bin"))
+			if err != nil {
+				t.Fatalf("Failed to read downloaded file: %v", err)
+			}
+			if string(data) != want {
+				t.Errorf("downloaded %q, want %q", data, want)
+			}
+		})
+	}
+}
+
+func TestManager_Download_EmptyFile(t *testing.T) {
+	var gets atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		http.ServeContent(w, r, "empty.txt", time.Time{}, bytes.NewReader(nil))
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	manager := NewManager(&ManagerOptions{
+		ChunkSize:   1024,
+		Timeout:     10 * time.Second,
+		OutputDir:   tmpDir,
+		Resume:      true,
+		UseTempFile: true,
+	})
+	manager.RegisterDirectService()
+
+	var progressCalls int
+	req := &interfaces.DownloadRequest{
+		URL:              server.URL + "/empty.txt",
+		ProgressCallback: func(downloaded, total int64) { progressCalls++ },
+	}
+
+	// The second run finds the empty file already in place
+	for run := 1; run <= 2; run++ {
+		result, err := manager.Download(context.Background(), req)
+		if err != nil {
+			t.Fatalf("run %d: Download() error = %v", run, err)
+		}
+
+		wantPath := filepath.Join(tmpDir, "empty.txt")
+		if result.FilePath != wantPath || result.Size != 0 || result.Speed != 0 {
+			t.Errorf("run %d: result = %+v, want an empty file at %s", run, result, wantPath)
+		}
+		info, err := os.Stat(wantPath)
+		if err != nil {
+			t.Fatalf("run %d: empty file wasn't created: %v", run, err)
+		}
+		if info.Size() != 0 {
+			t.Errorf("run %d: file size = %d, want 0", run, info.Size())
+		}
+	}
+
+	if n := gets.Load(); n != 0 {
+		t.Errorf("server got %d GET requests, want none for an empty file", n)
+	}
+	if progressCalls != 0 {
+		t.Errorf("progress callback called %d times, want none", progressCalls)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "empty.txt"+partFileSuffix)); !os.IsNotExist(err) {
+		t.Errorf("part file left behind: %v", err)
+	}
+}
+
+func TestManager_Download_DNSOverride(t *testing.T) {
+	content := []byte(strings.Repeat("served by staging ", 300))
+	var hosts sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts.Store(r.Host, true)
+		http.ServeContent(w, r, "staging.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	manager := NewManager(&ManagerOptions{
+		MaxConnections: 2,
+		ChunkSize:      1024,
+		Timeout:        10 * time.Second,
+		OutputDir:      tmpDir,
+		DNSOverride:    map[string]string{"files.staging.cloudget.test": server.Listener.Addr().String()},
+	})
+	manager.RegisterDirectService()
+
+	result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{
+		URL: "http://files.staging.cloudget.test/staging.bin",
+	})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	data, err := os.ReadFile(result.FilePath)
+	if err != nil {
+		t.Fatalf("Failed to read download: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("Downloaded content doesn't match the server's")
+	}
+	hosts.Range(func(host, _ any) bool {
+		if host != "files.staging.cloudget.test" {
+			t.Errorf("server saw Host %q, want the overridden hostname", host)
+		}
+		return true
+	})
+}
+
+func TestManager_Download_ProgressCallback(t *testing.T) {
+	content := []byte(strings.Repeat("progress reported to the caller ", 400))
+	server := newRangeServer(content)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		download func(manager *Manager, req *interfaces.DownloadRequest) error
+	}{
+		{
+			name: "to file",
+			download: func(manager *Manager, req *interfaces.DownloadRequest) error {
+				_, err := manager.Download(context.Background(), req)
+				return err
+			},
+		},
+		{
+			name: "to writer",
+			download: func(manager *Manager, req *interfaces.DownloadRequest) error {
+				_, err := manager.DownloadToWriter(context.Background(), req, io.Discard)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(&ManagerOptions{
+				ChunkSize:      1024,
+				MaxConnections: 4,
+				Timeout:        10 * time.Second,
+				OutputDir:      t.TempDir(),
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "progress.txt", Size: int64(len(content)), SupportsRange: true}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			var mu sync.Mutex
+			var counts []int64
+			req := &interfaces.DownloadRequest{
+				URL: "https://test.com/file",
+				ProgressCallback: func(downloaded, total int64) {
+					mu.Lock()
+					defer mu.Unlock()
+					counts = append(counts, downloaded)
+				},
+			}
+			if err := tt.download(manager, req); err != nil {
+				t.Fatalf("download failed: %v", err)
+			}
+
+			if len(counts) == 0 {
+				t.Fatal("ProgressCallback was never called")
+			}
+			for i := 1; i < len(counts); i++ {
+				if counts[i] < counts[i-1] {
+					t.Fatalf("downloaded went from %d to %d", counts[i-1], counts[i])
+				}
+			}
+			if last := counts[len(counts)-1]; last != int64(len(content)) {
+				t.Errorf("last downloaded = %d, want %d", last, len(content))
+			}
+		})
+	}
+}
+
+func TestManager_Download_ChunkStates(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 320)) // 5 chunks of 1KB
+	const chunkCount = 5
+	outputDir := t.TempDir()
+	id := ProgressID("https://test.com/file", filepath.Join(outputDir, "chunks.bin"))
+
+	// Each chunk request takes a snapshot of the chunk states: the chunk it
+	// asks for must be downloading and none may have gone backwards
+	var manager *Manager
+	var mu sync.Mutex
+	var firstSnapshot []progress.ChunkProgress
+	highest := make(map[int]progress.ChunkStatus)
+	order := map[progress.ChunkStatus]int{progress.ChunkPending: 0, progress.ChunkDownloading: 1, progress.ChunkCompleted: 2}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int64
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			states := manager.GetChunkStates(id)
+
+			mu.Lock()
+			if firstSnapshot == nil {
+				firstSnapshot = states
+			}
+			if len(states) != chunkCount {
+				t.Errorf("%d chunk states while chunk %d is requested, want %d", len(states), start/1024, chunkCount)
+			}
+			completed := 0
+			for _, state := range states {
+				if state.Status == progress.ChunkCompleted {
+					completed++
+				}
+				if state.ID == int(start/1024) && state.Status != progress.ChunkDownloading {
+					t.Errorf("chunk %d is %v while it's requested, want downloading", state.ID, state.Status)
+				}
+				if order[state.Status] < order[highest[state.ID]] {
+					t.Errorf("chunk %d went from %v back to %v", state.ID, highest[state.ID], state.Status)
+				} else {
+					highest[state.ID] = state.Status
+				}
+			}
+			// With two connections, a third chunk only starts once one is done
+			if start/1024 >= 2 && completed == 0 {
+				t.Errorf("no chunk is completed while chunk %d is requested", start/1024)
+			}
+			mu.Unlock()
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	manager = NewManager(&ManagerOptions{
+		ChunkSize:      1024,
+		MaxConnections: 2,
+		Timeout:        10 * time.Second,
+		OutputDir:      outputDir,
+	})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "chunks.bin", Size: int64(len(content)), SupportsRange: true}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	if _, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"}); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(firstSnapshot) != chunkCount {
+		t.Fatalf("first request saw %d chunks, want %d", len(firstSnapshot), chunkCount)
+	}
+	// Two connections leave the last chunks waiting when the first starts
+	if last := firstSnapshot[chunkCount-1]; last.Status != progress.ChunkPending {
+		t.Errorf("last chunk is %v at the first request, want pending", last.Status)
+	}
+	if states := manager.GetChunkStates(id); states != nil {
+		t.Errorf("GetChunkStates() after the download = %v, want none", states)
+	}
+}
+
+func TestManager_Download_SelectFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "selected")
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		ChunkSize: 1024,
+		Timeout:   10 * time.Second,
+		OutputDir: t.TempDir(),
+	})
+
+	var infoSelected, prepareSelected string
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			infoSelected, _ = utils.SelectedFileFromContext(ctx)
+			return &interfaces.FileInfo{Filename: "b.txt", Size: 8}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			prepareSelected, _ = utils.SelectedFileFromContext(ctx)
+			return server.URL, nil
+		},
+	})
+
+	if _, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/transfer", SelectFile: "b.txt"}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if infoSelected != "b.txt" || prepareSelected != "b.txt" {
+		t.Errorf("services saw selected file %q and %q, want b.txt", infoSelected, prepareSelected)
+	}
+}
+
+func TestManager_DownloadToWriter_VerifyHash(t *testing.T) {
+	content := []byte(strings.Repeat("verified while streaming ", 300))
+	sum := sha256.Sum256(content)
+	server := newRangeServer(content)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		expected string
+		wantErr  error
+	}{
+		{name: "matching hash", expected: hex.EncodeToString(sum[:])},
+		{name: "uppercase hash", expected: strings.ToUpper(hex.EncodeToString(sum[:]))},
+		{name: "mismatched hash", expected: strings.Repeat("0", 64), wantErr: ErrHashMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(&ManagerOptions{
+				Timeout:       10 * time.Second,
+				OutputDir:     t.TempDir(),
+				VerifyHash:    true,
+				HashAlgorithm: "sha256",
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "stream.txt", Size: int64(len(content))}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			var buf bytes.Buffer
+			result, err := manager.DownloadToWriter(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file", VerifyHash: tt.expected}, &buf)
+			if !bytes.Equal(buf.Bytes(), content) {
+				t.Error("streamed content does not match")
+			}
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DownloadToWriter() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadToWriter() error = %v", err)
+			}
+			if result.Hash != hex.EncodeToString(sum[:]) {
+				t.Errorf("result.Hash = %s, want %x", result.Hash, sum)
+			}
+		})
+	}
+}
+
+func TestServiceDirectory(t *testing.T) {
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{service: "Dropbox", want: "Dropbox"},
+		{service: "Google Drive", want: "Google Drive"},
+		{service: "Cloud/Storage: EU", want: "Cloud_Storage_ EU"},
+		{service: "..", want: ""},
+		{service: "  ", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := serviceDirectory(tt.service); got != tt.want {
+			t.Errorf("serviceDirectory(%q) = %q, want %q", tt.service, got, tt.want)
+		}
+	}
+}
+
+func TestManager_Download_FilenameTraversal(t *testing.T) {
+	content := []byte("stays in the output directory")
+
+	tests := []struct {
+		name        string
+		disposition string
+		query       string
+		want        string
+	}{
+		{name: "encoded separators", disposition: `attachment; filename*=UTF-8''..%2F..%2Fescaped.txt`, want: "escaped.txt"},
+		{name: "plain separators", disposition: `attachment; filename="../../escaped.txt"`, want: "escaped.txt"},
+		{name: "query parameter", query: "?response-content-disposition=" + url.QueryEscape(`attachment; filename="../../escaped.txt"`), want: "escaped.txt"},
+		{name: "parent directory alone", disposition: `attachment; filename=".."`, want: "download"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.disposition != "" {
+					w.Header().Set("Content-Disposition", tt.disposition)
+				}
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+			}))
+			defer server.Close()
+
+			root := t.TempDir()
+			outputDir := filepath.Join(root, "a", "b")
+			manager := NewManager(&ManagerOptions{
+				ChunkSize: 1024,
+				Timeout:   10 * time.Second,
+				OutputDir: outputDir,
+			})
+			manager.RegisterDirectService()
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: server.URL + "/" + tt.query})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			if want := filepath.Join(outputDir, tt.want); result.FilePath != want {
+				t.Errorf("FilePath = %s, want %s", result.FilePath, want)
+			}
+			if _, err := os.Stat(filepath.Join(root, "escaped.txt")); !os.IsNotExist(err) {
+				t.Errorf("file was written outside the output directory: %v", err)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	long := strings.Repeat("a", 300)
+
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{name: "ordinary name", filename: "report.pdf", want: "report.pdf"},
+		{name: "long name keeps extension", filename: long + ".pdf", want: strings.Repeat("a", maxFilenameLength-len(".pdf")) + ".pdf"},
+		{name: "long name without extension", filename: long, want: strings.Repeat("a", maxFilenameLength)},
+		{name: "long multibyte name", filename: strings.Repeat("é", 200) + ".txt", want: strings.Repeat("é", (maxFilenameLength-len(".txt"))/2) + ".txt"},
+		{name: "reserved name with extension", filename: "nul.txt", want: "nul_.txt"},
+		{name: "reserved name with two extensions", filename: "aux.tar.gz", want: "aux_.tar.gz"},
+		{name: "reserved name as prefix", filename: "console.log", want: "console.log"},
+		{name: "parent directories", filename: "../../escaped.txt", want: "escaped.txt"},
+		{name: "windows parent directories", filename: `..\..\escaped.txt`, want: "escaped.txt"},
+		{name: "absolute path", filename: "/etc/passwd", want: "passwd"},
+		{name: "parent directory alone", filename: "..", want: ""},
+		{name: "current directory", filename: ".", want: ""},
+		{name: "empty", filename: "", want: ""},
+	}
+	reserved := []string{"CON", "PRN", "AUX", "NUL"}
+	for i := 1; i <= 9; i++ {
+		reserved = append(reserved, fmt.Sprintf("COM%d", i), fmt.Sprintf("LPT%d", i))
+	}
+	for _, name := range reserved {
+		tests = append(tests,
+			struct{ name, filename, want string }{name: name, filename: name, want: name + "_"},
+			struct{ name, filename, want string }{name: strings.ToLower(name) + ".txt", filename: strings.ToLower(name) + ".txt", want: strings.ToLower(name) + "_.txt"},
+		)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeFilename(tt.filename)
+			if got != tt.want {
+				t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+			if len(got) > maxFilenameLength {
+				t.Errorf("sanitizeFilename(%q) is %d bytes, want at most %d", tt.filename, len(got), maxFilenameLength)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("sanitizeFilename(%q) = %q, not valid UTF-8", tt.filename, got)
+			}
+		})
+	}
+}
+
+func TestManager_Download_GroupByService(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "grouped")
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	manager := NewManager(&ManagerOptions{
+		ChunkSize:      1024,
+		Timeout:        10 * time.Second,
+		OutputDir:      tmpDir,
+		GroupByService: true,
+	})
+	for _, name := range []string{"Dropbox", "Google Drive"} {
+		host := strings.ToLower(strings.ReplaceAll(name, " ", ""))
+		manager.RegisterService(&mockService{
+			name:        name,
+			supportedFn: func(url string) bool { return strings.Contains(url, host) },
+			getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+				return &interfaces.FileInfo{Filename: "report.txt", Size: 7}, nil
+			},
+			prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+				return server.URL, nil
+			},
+		})
+	}
+
+	for url, want := range map[string]string{
+		"https://test.com/dropbox/report":     filepath.Join(tmpDir, "Dropbox", "report.txt"),
+		"https://test.com/googledrive/report": filepath.Join(tmpDir, "Google Drive", "report.txt"),
+	} {
+		result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: url})
+		if err != nil {
+			t.Fatalf("Download(%s) error = %v", url, err)
+		}
+		if result.FilePath != want {
+			t.Errorf("Download(%s) wrote %q, want %q", url, result.FilePath, want)
+		}
+		if _, err := os.Stat(want); err != nil {
+			t.Errorf("expected file at %s: %v", want, err)
+		}
+	}
+}
+
+func TestManager_Download_SizeTolerance(t *testing.T) {
+	content := []byte(strings.Repeat("slightly off ", 10))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		reported    int64
+		tolerance   int64
+		wantErr     bool
+		wantWarning bool
+	}{
+		{name: "exact size", reported: int64(len(content))},
+		{name: "off with no tolerance", reported: int64(len(content)) + 3, wantErr: true},
+		{name: "larger within tolerance", reported: int64(len(content)) + 3, tolerance: 3, wantWarning: true},
+		{name: "smaller within tolerance", reported: int64(len(content)) - 2, tolerance: 3, wantWarning: true},
+		{name: "beyond tolerance", reported: int64(len(content)) + 4, tolerance: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(&ManagerOptions{
+				ChunkSize:     1024,
+				Timeout:       10 * time.Second,
+				OutputDir:     t.TempDir(),
+				SizeTolerance: tt.tolerance,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "off.txt", Size: tt.reported}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+			logger, hook := logtest.NewNullLogger()
+			manager.SetLogger(logger)
+
+			_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "size mismatch") {
+				t.Errorf("Download() error = %v, want a size mismatch", err)
+			}
+
+			var warned bool
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "within the tolerance") {
+					warned = true
+				}
+			}
+			if warned != tt.wantWarning {
+				t.Errorf("size tolerance warning logged = %v, want %v", warned, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestManager_ChunkDownloader(t *testing.T) {
+	content := []byte(strings.Repeat("fetched one range at a time ", 50))
+	server := newRangeServer(content)
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{Timeout: 10 * time.Second})
+	data, err := manager.ChunkDownloader().DownloadChunk(context.Background(), server.URL, 100, 199)
+	if err != nil {
+		t.Fatalf("DownloadChunk failed: %v", err)
+	}
+	if string(data) != string(content[100:200]) {
+		t.Errorf("DownloadChunk = %q, want %q", data, content[100:200])
+	}
+}
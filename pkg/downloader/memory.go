@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// defaultMaxMemoryBytes caps DownloadToMemory when ManagerOptions.MaxMemoryBytes is zero
+const defaultMaxMemoryBytes = 64 * 1024 * 1024 // 64MB
+
+// DownloadToMemory downloads the file for req into memory instead of to
+// disk, for small files that are processed or uploaded again right away.
+// Files larger than ManagerOptions.MaxMemoryBytes are refused with
+// ErrFileTooLarge, before the download starts when the service reports
+// their size and as soon as they pass the limit otherwise. Cancellation,
+// progress callbacks and hash verification work as with DownloadToWriter.
+func (m *Manager) DownloadToMemory(ctx context.Context, req *interfaces.DownloadRequest) (data []byte, info *interfaces.FileInfo, err error) {
+	ctx, done, err := m.begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer done()
+	var result *interfaces.DownloadResult
+	defer func() {
+		m.stats.record(result, err)
+		m.emitResult(result, err)
+	}()
+
+	limit := m.options.MaxMemoryBytes
+	if limit <= 0 {
+		limit = defaultMaxMemoryBytes
+	}
+
+	buf := &boundedBuffer{limit: limit, url: req.URL}
+	result, info, err = m.stream(ctx, req, buf, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf.data.Bytes(), info, nil
+}
+
+// boundedBuffer collects a download in memory and fails the write that
+// would take it past limit bytes, which ends the download there
+type boundedBuffer struct {
+	data  bytes.Buffer // Not embedded, its ReadFrom would bypass the limit
+	limit int64
+	url   string
+}
+
+func (b *boundedBuffer) Write(p []byte) (int, error) {
+	if int64(b.data.Len()+len(p)) > b.limit {
+		return 0, fileTooLargeError(b.url, 0, b.limit)
+	}
+	return b.data.Write(p)
+}
+
+// fileTooLargeError reports that the file at url doesn't fit in limit
+// bytes. A size of zero means the file's full size isn't known.
+func fileTooLargeError(url string, size, limit int64) error {
+	message := fmt.Sprintf("file is larger than the in-memory limit of %s", utils.FormatBytes(limit))
+	if size > 0 {
+		message = fmt.Sprintf("file is %s, over the in-memory limit of %s", utils.FormatBytes(size), utils.FormatBytes(limit))
+	}
+	return &interfaces.DownloadError{
+		Type:    interfaces.ErrFileTooLarge.Type,
+		Message: message,
+		URL:     url,
+	}
+}
@@ -0,0 +1,135 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_DownloadToMemory(t *testing.T) {
+	small := []byte(strings.Repeat("kept in memory ", 100)) // 1500 bytes
+	sum := sha256.Sum256(small)
+	large := []byte(strings.Repeat("x", 64*1024))
+
+	var gets atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		content := small
+		if r.URL.Path == "/large" {
+			content = large
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		size       int64 // Size the service reports, zero for unknown
+		verifyHash string
+		wantData   []byte
+		wantErr    *interfaces.DownloadError
+		wantGets   int32
+	}{
+		{name: "small file", path: "/small", size: int64(len(small)), wantData: small, wantGets: 1},
+		{name: "small file of unknown size", path: "/small", wantData: small, wantGets: 1},
+		{name: "verified hash", path: "/small", size: int64(len(small)), verifyHash: hex.EncodeToString(sum[:]), wantData: small, wantGets: 1},
+		{name: "hash mismatch", path: "/small", size: int64(len(small)), verifyHash: strings.Repeat("0", 64), wantErr: ErrHashMismatch, wantGets: 1},
+		{name: "reported size over the cap is never requested", path: "/large", size: int64(len(large)), wantErr: ErrFileTooLarge},
+		{name: "unknown size over the cap stops at the cap", path: "/large", wantErr: ErrFileTooLarge, wantGets: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gets.Store(0)
+			manager := NewManager(&ManagerOptions{
+				Timeout:        10 * time.Second,
+				OutputDir:      t.TempDir(),
+				VerifyHash:     true,
+				HashAlgorithm:  "sha256",
+				MaxMemoryBytes: 16 * 1024,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "memory.bin", Size: tt.size}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL + tt.path, nil
+				},
+			})
+
+			var lastProgress atomic.Int64
+			data, info, err := manager.DownloadToMemory(context.Background(), &interfaces.DownloadRequest{
+				URL:        "https://test.com" + tt.path,
+				VerifyHash: tt.verifyHash,
+				ProgressCallback: func(downloaded, total int64) {
+					lastProgress.Store(downloaded)
+				},
+			})
+
+			if got := gets.Load(); got != tt.wantGets {
+				t.Errorf("server saw %d GETs, want %d", got, tt.wantGets)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DownloadToMemory() error = %v, want %v", err, tt.wantErr)
+				}
+				if data != nil {
+					t.Errorf("DownloadToMemory() returned %d bytes along with an error", len(data))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadToMemory() error = %v", err)
+			}
+
+			if string(data) != string(tt.wantData) {
+				t.Errorf("DownloadToMemory() returned %d bytes, want the %d served", len(data), len(tt.wantData))
+			}
+			if info == nil || info.Filename != "memory.bin" {
+				t.Errorf("DownloadToMemory() info = %+v, want the service's file info", info)
+			}
+			if got := lastProgress.Load(); got != int64(len(tt.wantData)) {
+				t.Errorf("last progress callback reported %d bytes, want %d", got, len(tt.wantData))
+			}
+		})
+	}
+}
+
+func TestManager_DownloadToMemory_Cancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("too late"))
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{Timeout: 10 * time.Second, OutputDir: t.TempDir()})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "cancelled.bin", Size: 8}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if data, _, err := manager.DownloadToMemory(ctx, &interfaces.DownloadRequest{URL: "https://test.com/file"}); err == nil {
+		t.Errorf("DownloadToMemory() = %q with a cancelled context, want an error", data)
+	}
+}
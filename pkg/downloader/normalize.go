@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+// trackingParams are query parameters added by share buttons and analytics
+// that never change which file a URL points to
+var trackingParams = map[string]bool{
+	"usp":    true,
+	"fbclid": true,
+	"gclid":  true,
+}
+
+// httpsHosts are the hosts of the built-in services, which all serve over
+// HTTPS, so a pasted http:// link to them can safely be upgraded
+var httpsHosts = []string{
+	"dropbox.com",
+	"db.tt",
+	"drive.google.com",
+	"docs.google.com",
+	"wetransfer.com",
+	"we.tl",
+}
+
+// NormalizeURL is the default URL normalizer. It trims surrounding space,
+// strips tracking parameters (utm_*, usp, fbclid, gclid) and upgrades http to
+// https for the built-in services. The remaining query keeps its order.
+func NormalizeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+
+	if parsed.Scheme == "http" && isHTTPSHost(parsed.Hostname()) {
+		parsed.Scheme = "https"
+	}
+
+	if parsed.RawQuery != "" {
+		var kept []string
+		for _, pair := range strings.Split(parsed.RawQuery, "&") {
+			key, _, _ := strings.Cut(pair, "=")
+			if key, err := url.QueryUnescape(key); err == nil && isTrackingParam(key) {
+				continue
+			}
+			kept = append(kept, pair)
+		}
+		parsed.RawQuery = strings.Join(kept, "&")
+	}
+
+	return parsed.String()
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasPrefix(key, "utm_") || trackingParams[key]
+}
+
+func isHTTPSHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, known := range httpsHosts {
+		if host == known || strings.HasSuffix(host, "."+known) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetURLNormalizer replaces the function applied to every request URL before
+// a service is picked for it. Passing nil disables normalization.
+func (m *Manager) SetURLNormalizer(normalize func(string) string) {
+	m.normalizeURL = normalize
+}
+
+// normalize returns url rewritten by the manager's normalizer
+func (m *Manager) normalize(url string) string {
+	if m.normalizeURL == nil {
+		return url
+	}
+	return m.normalizeURL(url)
+}
+
+// normalizeRequest returns req with its URL normalized, copying it rather
+// than changing the caller's request
+func (m *Manager) normalizeRequest(req *interfaces.DownloadRequest) *interfaces.DownloadRequest {
+	normalized := m.normalize(req.URL)
+	if normalized == req.URL {
+		return req
+	}
+
+	m.logger.Debugf("Normalized URL %s to %s", req.URL, normalized)
+	copied := *req
+	copied.URL = normalized
+	return &copied
+}
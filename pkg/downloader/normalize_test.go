@@ -0,0 +1,141 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "strips share and utm parameters",
+			url:  "https://drive.google.com/file/d/abc123/view?usp=sharing&utm_source=chat&utm_medium=link",
+			want: "https://drive.google.com/file/d/abc123/view",
+		},
+		{
+			name: "keeps other parameters in order",
+			url:  "https://www.dropbox.com/s/abc/file.zip?utm_campaign=x&dl=0&rlkey=key",
+			want: "https://www.dropbox.com/s/abc/file.zip?dl=0&rlkey=key",
+		},
+		{
+			name: "strips click identifiers",
+			url:  "https://example.com/file.bin?fbclid=abc&gclid=def",
+			want: "https://example.com/file.bin",
+		},
+		{
+			name: "upgrades known service to https",
+			url:  "http://www.dropbox.com/s/abc/file.zip?dl=0",
+			want: "https://www.dropbox.com/s/abc/file.zip?dl=0",
+		},
+		{
+			name: "leaves unknown http host alone",
+			url:  "http://example.com/file.bin",
+			want: "http://example.com/file.bin",
+		},
+		{
+			name: "trims whitespace",
+			url:  "  https://we.tl/t-abc123\n",
+			want: "https://we.tl/t-abc123",
+		},
+		{
+			name: "leaves non-URLs alone",
+			url:  "not a url",
+			want: "not a url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeURL(tt.url); got != tt.want {
+				t.Errorf("NormalizeURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+// strictService only claims one exact URL, like services whose patterns
+// don't allow a query string
+func strictService(name, url string) *mockService {
+	return &mockService{
+		name:        name,
+		supportedFn: func(u string) bool { return u == url },
+	}
+}
+
+func TestManager_FindService_NormalizesURL(t *testing.T) {
+	manager := NewManager(&ManagerOptions{OutputDir: t.TempDir()})
+	manager.RegisterService(strictService("strict", "https://test.com/file/123"))
+
+	tracked := "http://test.com/file/123?usp=sharing&utm_source=email"
+
+	// http isn't upgraded for test.com, only the tracking parameters go
+	if service := manager.FindService(tracked); service != nil {
+		t.Fatalf("FindService(%q) = %s, want nil for the http URL", tracked, service.GetServiceName())
+	}
+
+	tracked = "https://test.com/file/123?usp=sharing&utm_source=email"
+	service := manager.FindService(tracked)
+	if service == nil || service.GetServiceName() != "strict" {
+		t.Fatalf("FindService(%q) = %v, want the strict service", tracked, service)
+	}
+
+	manager.SetURLNormalizer(nil)
+	if service := manager.FindService(tracked); service != nil {
+		t.Errorf("FindService(%q) with normalization disabled = %s, want nil", tracked, service.GetServiceName())
+	}
+
+	manager.SetURLNormalizer(func(url string) string {
+		return strings.Replace(url, "mobile.test.com", "test.com", 1)
+	})
+	if service := manager.FindService("https://mobile.test.com/file/123"); service == nil {
+		t.Error("FindService() with a custom normalizer = nil, want the strict service")
+	}
+}
+
+func TestManager_Download_NormalizesURL(t *testing.T) {
+	content := "normalized content"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, content)
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		ChunkSize: 1024,
+		Timeout:   10 * time.Second,
+		OutputDir: t.TempDir(),
+	})
+
+	var gotURL string
+	service := strictService("strict", "https://test.com/file/123")
+	service.getInfoFn = func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+		gotURL = url
+		return &interfaces.FileInfo{Filename: "normalized.txt", Size: int64(len(content))}, nil
+	}
+	service.prepareDownloadFn = func(ctx context.Context, url string) (string, error) {
+		return server.URL, nil
+	}
+	manager.RegisterService(service)
+
+	req := &interfaces.DownloadRequest{URL: "https://test.com/file/123?utm_source=newsletter&usp=sharing"}
+	if _, err := manager.Download(context.Background(), req); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	if gotURL != "https://test.com/file/123" {
+		t.Errorf("service got URL %q, want the normalized URL", gotURL)
+	}
+	if req.URL != "https://test.com/file/123?utm_source=newsletter&usp=sharing" {
+		t.Errorf("request URL was changed to %q", req.URL)
+	}
+}
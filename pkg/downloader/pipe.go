@@ -0,0 +1,29 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+// isNamedPipe reports whether path is an existing named pipe (FIFO)
+func isNamedPipe(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// downloadToPipe streams the download into the named pipe at
+// req.OutputPath. A pipe can't be preallocated, written at offsets, resumed
+// or renamed into, so it takes the single-request path of DownloadToWriter.
+// Opening the pipe waits until something opens it for reading, or ctx ends.
+func (m *Manager) downloadToPipe(ctx context.Context, req *interfaces.DownloadRequest) (*interfaces.DownloadResult, error) {
+	pipe, err := openPipe(ctx, req.OutputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pipe: %w", err)
+	}
+	defer pipe.Close()
+
+	return m.downloadToWriter(ctx, req, pipe, req.OutputPath)
+}
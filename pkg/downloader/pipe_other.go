@@ -0,0 +1,35 @@
+//go:build !unix
+
+package downloader
+
+import (
+	"context"
+	"os"
+)
+
+// openPipe opens the named pipe at path for writing, which blocks until
+// something opens it for reading. The open runs on its own so ctx can end
+// the wait, a pipe it opens after that is closed straight away.
+func openPipe(ctx context.Context, path string) (*os.File, error) {
+	type result struct {
+		pipe *os.File
+		err  error
+	}
+	opened := make(chan result, 1)
+	go func() {
+		pipe, err := os.OpenFile(path, os.O_WRONLY, 0)
+		opened <- result{pipe, err}
+	}()
+
+	select {
+	case r := <-opened:
+		return r.pipe, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-opened; r.pipe != nil {
+				r.pipe.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
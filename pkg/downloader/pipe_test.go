@@ -0,0 +1,121 @@
+//go:build unix
+
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"golang.org/x/sys/unix"
+)
+
+func TestManager_Download_NamedPipe(t *testing.T) {
+	content := []byte(strings.Repeat("through a fifo ", 20000)) // 300KB, more than a pipe buffers
+	server := newRangeServer(content)
+	defer server.Close()
+
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "out.fifo")
+	if err := unix.Mkfifo(fifo, 0600); err != nil {
+		t.Skipf("named pipes unsupported: %v", err)
+	}
+
+	manager := NewManager(&ManagerOptions{
+		MaxConnections: 4,
+		ChunkSize:      16 * 1024,
+		MinChunkedSize: 1024,
+		Timeout:        10 * time.Second,
+		OutputDir:      dir,
+		Resume:         true,
+		UseTempFile:    true,
+	})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "piped.txt", Size: int64(len(content)), SupportsRange: true}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	received := make(chan []byte, 1)
+	go func() {
+		reader, err := os.Open(fifo)
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer reader.Close()
+		data, _ := io.ReadAll(reader)
+		received <- data
+	}()
+
+	result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file", OutputPath: fifo})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	select {
+	case data := <-received:
+		if string(data) != string(content) {
+			t.Errorf("reader got %d bytes, want the %d served", len(data), len(content))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("reader never finished")
+	}
+
+	if result.FilePath != fifo || result.Size != int64(len(content)) {
+		t.Errorf("result = {%q, %d}, want {%q, %d}", result.FilePath, result.Size, fifo, len(content))
+	}
+	if info, err := os.Stat(fifo); err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		t.Errorf("output is no longer a named pipe: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("output directory has %d entries, want only the pipe", len(entries))
+	}
+}
+
+func TestManager_Download_NamedPipeWithoutReader(t *testing.T) {
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "out.fifo")
+	if err := unix.Mkfifo(fifo, 0600); err != nil {
+		t.Skipf("named pipes unsupported: %v", err)
+	}
+
+	manager := NewManager(&ManagerOptions{Timeout: 10 * time.Second, OutputDir: dir})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.Download(ctx, &interfaces.DownloadRequest{URL: "https://test.com/file", OutputPath: fifo})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Download() error = %v, want the context's deadline", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Download() kept waiting for a reader after the context ended")
+	}
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// pipeOpenInterval is how often openPipe retries while the pipe has no reader
+const pipeOpenInterval = 50 * time.Millisecond
+
+// openPipe opens the named pipe at path for writing once something has it
+// open for reading. A non-blocking open fails with ENXIO until then, so it's
+// retried until it succeeds or ctx ends.
+func openPipe(ctx context.Context, path string) (*os.File, error) {
+	ticker := time.NewTicker(pipeOpenInterval)
+	defer ticker.Stop()
+
+	for {
+		pipe, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if !errors.Is(err, syscall.ENXIO) {
+			return pipe, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
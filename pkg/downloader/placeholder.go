@@ -0,0 +1,49 @@
+package downloader
+
+import (
+	"context"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// placeholderFilenames are the names services fall back to when a share
+// page doesn't reveal the real one
+var placeholderFilenames = map[string]bool{
+	"google_drive_file": true,
+	"wetransfer_file":   true,
+	"download":          true,
+}
+
+// isPlaceholderFilename reports whether name is a generic fallback rather
+// than the file's real name
+func isPlaceholderFilename(name string) bool {
+	return name == "" || placeholderFilenames[name]
+}
+
+// needsFilenameSniff reports whether the real filename should be looked up
+// at the download URL before picking an output path
+func needsFilenameSniff(req *interfaces.DownloadRequest, fileInfo *interfaces.FileInfo) bool {
+	return req.OutputPath == "" && req.CustomFilename == "" && isPlaceholderFilename(fileInfo.Filename)
+}
+
+// sniffFilename replaces a placeholder filename with the one the final
+// response for downloadURL reports, from its Content-Disposition or its
+// redirected URL. fileInfo is returned unchanged if nothing better is found.
+func (m *Manager) sniffFilename(ctx context.Context, downloadURL string, fileInfo *interfaces.FileInfo) *interfaces.FileInfo {
+	logger := utils.LoggerFromContext(ctx, m.logger)
+
+	filename, err := m.httpClient.SniffFilename(ctx, downloadURL, &utils.DownloadOptions{MaxRedirects: m.options.MaxRedirects})
+	if err != nil {
+		logger.Debugf("Could not look up the real filename: %v", err)
+		return fileInfo
+	}
+	if isPlaceholderFilename(filename) {
+		return fileInfo
+	}
+
+	logger.Infof("Using filename %s instead of %s", filename, fileInfo.Filename)
+	sniffed := *fileInfo
+	sniffed.Filename = filename
+	return &sniffed
+}
@@ -0,0 +1,91 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_Download_ReplacesPlaceholderFilename(t *testing.T) {
+	content := "real file content"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/uc", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/content/7d1e9a", http.StatusFound)
+	})
+	mux.HandleFunc("/content/7d1e9a", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Disposition", `attachment; filename="holiday-photos.zip"`)
+		}
+		io.WriteString(w, content)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		placeholder    string
+		customFilename string
+		want           string
+	}{
+		{name: "google drive placeholder", placeholder: "google_drive_file", want: "holiday-photos.zip"},
+		{name: "wetransfer placeholder", placeholder: "wetransfer_file", want: "holiday-photos.zip"},
+		{name: "generic placeholder", placeholder: "download", want: "holiday-photos.zip"},
+		{name: "real filename is kept", placeholder: "notes.txt", want: "notes.txt"},
+		{name: "custom filename wins", placeholder: "google_drive_file", customFilename: "mine.zip", want: "mine.zip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			manager := NewManager(&ManagerOptions{
+				ChunkSize: 1024,
+				Timeout:   10 * time.Second,
+				OutputDir: tmpDir,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: tt.placeholder, Size: int64(len(content))}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL + "/uc", nil
+				},
+			})
+
+			req := &interfaces.DownloadRequest{URL: "https://test.com/file/123", CustomFilename: tt.customFilename}
+
+			resolved, err := manager.ResolveOutputPath(context.Background(), req)
+			if err != nil {
+				t.Fatalf("ResolveOutputPath() error = %v", err)
+			}
+
+			result, err := manager.Download(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			want := filepath.Join(tmpDir, tt.want)
+			if result.FilePath != want {
+				t.Errorf("FilePath = %q, want %q", result.FilePath, want)
+			}
+			if resolved != want {
+				t.Errorf("ResolveOutputPath() = %q, want %q", resolved, want)
+			}
+			data, err := os.ReadFile(want)
+			if err != nil {
+				t.Fatalf("failed to read downloaded file: %v", err)
+			}
+			if string(data) != content {
+				t.Errorf("content = %q, want %q", data, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package downloader
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// preflightTimeout bounds how long the reachability check waits for a TCP connection
+const preflightTimeout = 10 * time.Second
+
+// checkReachable dials the host of rawURL through client so DNS failures and
+// refused connections surface before any output file is created. Hosts
+// reached through a proxy are skipped since the proxy decides reachability.
+func checkReachable(ctx context.Context, client *utils.HTTPClient, rawURL string) error {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Host == "" {
+		return nil
+	}
+
+	port := parsedURL.Port()
+	switch parsedURL.Scheme {
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return nil
+	}
+
+	if proxyURL, err := http.ProxyFromEnvironment(&http.Request{URL: parsedURL}); err == nil && proxyURL != nil {
+		return nil
+	}
+
+	conn, err := client.Dial(ctx, "tcp", net.JoinHostPort(parsedURL.Hostname(), port), preflightTimeout)
+	if err != nil {
+		return classifyNetworkError(rawURL, err)
+	}
+	conn.Close()
+
+	return nil
+}
+
+// classifyNetworkError converts low-level connection errors into an
+// ErrNetworkError with a readable message. Errors that are not
+// connection failures are returned unchanged.
+func classifyNetworkError(rawURL string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var downloadErr *interfaces.DownloadError
+	if errors.As(err, &downloadErr) {
+		return err
+	}
+
+	host := rawURL
+	if parsedURL, parseErr := url.Parse(rawURL); parseErr == nil && parsedURL.Host != "" {
+		host = parsedURL.Hostname()
+	}
+
+	var message string
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCertErr x509.CertificateInvalidError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		message = fmt.Sprintf("could not resolve host %s", host)
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &unknownAuthErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidCertErr):
+		message = fmt.Sprintf("TLS handshake with %s failed", host)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		message = fmt.Sprintf("connection refused by %s", host)
+	case errors.As(err, &opErr) && opErr.Timeout():
+		message = fmt.Sprintf("timed out connecting to %s", host)
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		message = fmt.Sprintf("could not connect to %s", host)
+	default:
+		return err
+	}
+
+	return &interfaces.DownloadError{
+		Type:    interfaces.ErrNetworkError.Type,
+		Message: message,
+		URL:     rawURL,
+		Err:     err,
+	}
+}
+
+// checkWritable creates and removes a small file in dir, so a directory that
+// can't be written to or a filesystem out of space or inodes fails the
+// download before anything is fetched
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".cloudget-write-check-*")
+	if err != nil {
+		return classifyWriteError(dir, err)
+	}
+
+	name := file.Name()
+	file.Close()
+	os.Remove(name)
+
+	return nil
+}
+
+// classifyWriteError converts a failure to write in dir into ErrPermissionDenied
+// or ErrInsufficientSpace where it is one. Other errors are wrapped unchanged.
+func classifyWriteError(dir string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, syscall.EROFS):
+		return &interfaces.DownloadError{
+			Type:    interfaces.ErrPermissionDenied.Type,
+			Message: fmt.Sprintf("output directory %s is not writable", dir),
+			Err:     err,
+		}
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		return &interfaces.DownloadError{
+			Type:    interfaces.ErrInsufficientSpace.Type,
+			Message: fmt.Sprintf("no space or inodes left for output directory %s", dir),
+			Err:     err,
+		}
+	default:
+		return fmt.Errorf("output directory %s is not writable: %w", dir, err)
+	}
+}
@@ -0,0 +1,211 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// closedPortURL returns an http URL on a loopback port nothing listens on
+func closedPortURL(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	return "http://" + addr + "/file.bin"
+}
+
+func TestCheckReachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		url         string
+		dnsOverride map[string]string
+		wantErr     bool
+		wantMessage string
+	}{
+		{name: "reachable host", url: server.URL + "/file.bin"},
+		{name: "closed port", url: closedPortURL(t), wantErr: true, wantMessage: "connection refused"},
+		{name: "invalid host", url: "http://cloudget-preflight.invalid/file.bin", wantErr: true, wantMessage: "could not resolve host"},
+		{name: "non-http scheme is skipped", url: "ftp://cloudget-preflight.invalid/file.bin"},
+		{
+			name:        "overridden host",
+			url:         "http://cloudget-preflight.invalid/file.bin",
+			dnsOverride: map[string]string{"cloudget-preflight.invalid": server.Listener.Addr().String()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := utils.NewHTTPClientWithConfig(&utils.ClientConfig{DNSOverride: tt.dnsOverride})
+			if err != nil {
+				t.Fatalf("NewHTTPClientWithConfig() error = %v", err)
+			}
+
+			err = checkReachable(context.Background(), client, tt.url)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("checkReachable() error = %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, interfaces.ErrNetworkError) {
+				t.Fatalf("checkReachable() error = %v, want ErrNetworkError", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantMessage) {
+				t.Errorf("checkReachable() error = %v, want message containing %q", err, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestClassifyNetworkError(t *testing.T) {
+	t.Run("TLS failure", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		client := &http.Client{Timeout: 5 * time.Second}
+		_, reqErr := client.Get(server.URL)
+		if reqErr == nil {
+			t.Fatal("Expected certificate error from untrusted test server")
+		}
+
+		err := classifyNetworkError(server.URL, reqErr)
+		if !errors.Is(err, interfaces.ErrNetworkError) {
+			t.Fatalf("classifyNetworkError() = %v, want ErrNetworkError", err)
+		}
+		if !strings.Contains(err.Error(), "TLS handshake") {
+			t.Errorf("classifyNetworkError() = %v, want TLS message", err)
+		}
+	})
+
+	t.Run("other errors are unchanged", func(t *testing.T) {
+		original := fmt.Errorf("unexpected status code: 404")
+		if err := classifyNetworkError("https://example.com", original); err != original {
+			t.Errorf("classifyNetworkError() = %v, want original error", err)
+		}
+	})
+}
+
+func TestManager_Download_UnreachableHost(t *testing.T) {
+	tests := []struct {
+		name        string
+		downloadURL string
+	}{
+		{name: "connection refused", downloadURL: closedPortURL(t)},
+		{name: "DNS failure", downloadURL: "http://cloudget-preflight.invalid/file.bin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(&ManagerOptions{
+				ChunkSize: 1024,
+				Timeout:   10 * time.Second,
+				OutputDir: t.TempDir(),
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(string) bool { return true },
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return tt.downloadURL, nil
+				},
+			})
+
+			_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+
+			var downloadErr *interfaces.DownloadError
+			if !errors.As(err, &downloadErr) || downloadErr.Type != interfaces.ErrNetworkError.Type {
+				t.Errorf("Download() error = %v, want ErrNetworkError", err)
+			}
+		})
+	}
+}
+
+func TestClassifyWriteError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "permission denied", err: &os.PathError{Op: "open", Path: "/x", Err: syscall.EACCES}, want: interfaces.ErrPermissionDenied},
+		{name: "read-only filesystem", err: &os.PathError{Op: "open", Path: "/x", Err: syscall.EROFS}, want: interfaces.ErrPermissionDenied},
+		{name: "out of space or inodes", err: &os.PathError{Op: "open", Path: "/x", Err: syscall.ENOSPC}, want: interfaces.ErrInsufficientSpace},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyWriteError("/downloads", tt.err)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("classifyWriteError() = %v, want %v", err, tt.want)
+			}
+			if !strings.Contains(err.Error(), "/downloads") {
+				t.Errorf("classifyWriteError() = %v, want the directory in the message", err)
+			}
+		})
+	}
+
+	if err := classifyWriteError("/downloads", errors.New("boom")); errors.Is(err, interfaces.ErrPermissionDenied) {
+		t.Errorf("classifyWriteError() = %v, want other errors left unclassified", err)
+	}
+}
+
+func TestManager_Download_ReadOnlyOutputDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+
+	outputDir := t.TempDir()
+	if err := os.Chmod(outputDir, 0555); err != nil {
+		t.Fatalf("Failed to make directory read-only: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(outputDir, 0755) })
+
+	downloaded := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloaded = true
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		ChunkSize: 1024,
+		Timeout:   10 * time.Second,
+		OutputDir: outputDir,
+	})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+	if !errors.Is(err, interfaces.ErrPermissionDenied) {
+		t.Fatalf("Download() error = %v, want ErrPermissionDenied", err)
+	}
+	if !strings.Contains(err.Error(), outputDir) {
+		t.Errorf("Download() error = %v, want it to name %s", err, outputDir)
+	}
+	if downloaded {
+		t.Error("the file was requested before the output directory was checked")
+	}
+}
@@ -0,0 +1,40 @@
+package downloader
+
+import (
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// RetryProfile is implemented by services whose hosts call for their own
+// retry and backoff settings, such as a rate-limited API that should be
+// retried less or a flaky CDN that should be retried more. Only MaxRetries,
+// RetryDelay and MaxRetryAfter of the returned options are used, zero
+// fields keep the manager's values.
+type RetryProfile interface {
+	DefaultDownloadOptions() *utils.DownloadOptions
+}
+
+// applyRetryProfile tunes options to service's RetryProfile, if it has one.
+// Retry settings given in ManagerOptions take precedence over the profile.
+func (m *Manager) applyRetryProfile(options *utils.DownloadOptions, service interfaces.CloudService) {
+	if provider, ok := service.(RetryProfile); ok {
+		if profile := provider.DefaultDownloadOptions(); profile != nil {
+			if profile.MaxRetries > 0 {
+				options.MaxRetries = profile.MaxRetries
+			}
+			if profile.RetryDelay > 0 {
+				options.RetryDelay = profile.RetryDelay
+			}
+			if profile.MaxRetryAfter > 0 {
+				options.MaxRetryAfter = profile.MaxRetryAfter
+			}
+		}
+	}
+
+	if m.options.MaxRetries > 0 {
+		options.MaxRetries = m.options.MaxRetries
+	}
+	if m.options.RetryDelay > 0 {
+		options.RetryDelay = m.options.RetryDelay
+	}
+}
@@ -0,0 +1,124 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/services/direct"
+	"github.com/milindmadhukar/cloudget/pkg/services/gdrive"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// profiledService is a mockService with a RetryProfile
+type profiledService struct {
+	*mockService
+	profile *utils.DownloadOptions
+}
+
+func (s *profiledService) DefaultDownloadOptions() *utils.DownloadOptions {
+	return s.profile
+}
+
+func TestManager_applyRetryProfile(t *testing.T) {
+	tests := []struct {
+		name           string
+		service        interfaces.CloudService
+		options        ManagerOptions
+		wantRetries    int
+		wantDelay      time.Duration
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:        "service without a profile keeps the defaults",
+			service:     &mockService{name: "plain"},
+			wantRetries: 3,
+			wantDelay:   2 * time.Second,
+		},
+		{
+			name:           "google drive is conservative",
+			service:        gdrive.New(),
+			wantRetries:    2,
+			wantDelay:      5 * time.Second,
+			wantRetryAfter: 5 * time.Minute,
+		},
+		{
+			name:           "direct links are aggressive",
+			service:        direct.New(nil),
+			wantRetries:    6,
+			wantDelay:      time.Second,
+			wantRetryAfter: 30 * time.Second,
+		},
+		{
+			name:           "manager options override the profile",
+			service:        gdrive.New(),
+			options:        ManagerOptions{MaxRetries: 10, RetryDelay: time.Millisecond},
+			wantRetries:    10,
+			wantDelay:      time.Millisecond,
+			wantRetryAfter: 5 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := &Manager{options: &tt.options}
+			options := &utils.DownloadOptions{MaxRetries: 3, RetryDelay: 2 * time.Second}
+
+			manager.applyRetryProfile(options, tt.service)
+
+			if options.MaxRetries != tt.wantRetries || options.RetryDelay != tt.wantDelay || options.MaxRetryAfter != tt.wantRetryAfter {
+				t.Errorf("got retries %d, delay %s, max Retry-After %s, want %d, %s, %s",
+					options.MaxRetries, options.RetryDelay, options.MaxRetryAfter,
+					tt.wantRetries, tt.wantDelay, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestManager_Download_UsesRetryProfile(t *testing.T) {
+	content := []byte(strings.Repeat("profiled ", 256)) // 2304 bytes, 3 chunks
+	var failures atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// More failures than the default 3 retries can get through
+		if failures.Add(1) <= 5 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		MaxConnections: 1,
+		ChunkSize:      1024,
+		Timeout:        10 * time.Second,
+		OutputDir:      t.TempDir(),
+	})
+	manager.RegisterService(&profiledService{
+		mockService: &mockService{
+			name:        "profiled",
+			supportedFn: func(url string) bool { return true },
+			getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+				return &interfaces.FileInfo{Filename: "profiled.bin", Size: int64(len(content)), SupportsRange: true}, nil
+			},
+			prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+				return server.URL, nil
+			},
+		},
+		profile: &utils.DownloadOptions{MaxRetries: 8, RetryDelay: time.Millisecond},
+	})
+
+	result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/profiled"})
+	if err != nil {
+		t.Fatalf("Download failed with the service's retry profile: %v", err)
+	}
+	if result.Retries != 5 {
+		t.Errorf("Retries = %d, want 5", result.Retries)
+	}
+}
@@ -0,0 +1,52 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// renameToResponseFilename moves the finished download at outputPath to the
+// Content-Disposition filename its GET responses gave, when that differs
+// from the name picked before the download started. A file already at the
+// new name goes through the conflict resolver like any output path. The
+// download already succeeded, so a rename that fails only leaves the file
+// where it is. It returns the path the file ends up at.
+func (m *Manager) renameToResponseFilename(ctx context.Context, outputPath, responseFilename string, fileInfo *interfaces.FileInfo, size int64) string {
+	if responseFilename == "" {
+		return outputPath
+	}
+	filename := sanitizeFilename(responseFilename)
+	if filename == "" || filename == filepath.Base(outputPath) {
+		return outputPath
+	}
+
+	logger := utils.LoggerFromContext(ctx, m.logger)
+	newPath := filepath.Join(filepath.Dir(outputPath), filename)
+	if err := m.checkSymlinks(newPath, false); err != nil {
+		logger.Warnf("Keeping %s: %v", outputPath, err)
+		return outputPath
+	}
+
+	renamed := *fileInfo
+	renamed.Filename = filename
+	renamed.Size = size
+	newPath, skip, err := m.resolveConflict(ctx, newPath, &renamed, false)
+	if err != nil {
+		logger.Warnf("Keeping %s: %v", outputPath, err)
+		return outputPath
+	}
+	if skip {
+		return outputPath
+	}
+
+	if err := os.Rename(outputPath, newPath); err != nil {
+		logger.Warnf("Failed to rename %s to %s: %v", outputPath, newPath, err)
+		return outputPath
+	}
+	logger.Infof("Renamed %s to %s, the filename the server sent", filepath.Base(outputPath), filepath.Base(newPath))
+	return newPath
+}
@@ -0,0 +1,122 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_Download_UseResponseFilename(t *testing.T) {
+	content := strings.Repeat("named by the server ", 200) // 4000 bytes
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the GET names the file, the way some servers answer HEAD
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Disposition", `attachment; filename="report.txt"`)
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		rename         bool
+		chunked        bool
+		customFilename string
+		existing       string // Content of a file already at report.txt
+		resolver       ConflictResolver
+		want           string
+	}{
+		{name: "simple download", rename: true, want: "report.txt"},
+		{name: "chunked download", rename: true, chunked: true, want: "report.txt"},
+		{name: "option off keeps the early guess", want: "download-42"},
+		{name: "custom filename is kept", rename: true, customFilename: "mine.txt", want: "mine.txt"},
+		{
+			name:     "existing file goes through the conflict resolver",
+			rename:   true,
+			existing: "older",
+			resolver: func(existingPath string, info *interfaces.FileInfo) (string, ConflictAction) {
+				return filepath.Join(filepath.Dir(existingPath), "report (1).txt"), ConflictRename
+			},
+			want: "report (1).txt",
+		},
+		{
+			name:     "conflict resolver can keep the early guess",
+			rename:   true,
+			existing: "older",
+			resolver: func(existingPath string, info *interfaces.FileInfo) (string, ConflictAction) {
+				return "", ConflictSkip
+			},
+			want: "download-42",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			if tt.existing != "" {
+				if err := os.WriteFile(filepath.Join(outputDir, "report.txt"), []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			minChunked := int64(1024 * 1024)
+			if tt.chunked {
+				minChunked = 1024
+			}
+			manager := NewManager(&ManagerOptions{
+				MaxConnections:      2,
+				ChunkSize:           1024,
+				MinChunkedSize:      minChunked,
+				Timeout:             10 * time.Second,
+				OutputDir:           outputDir,
+				UseTempFile:         true,
+				ConflictResolver:    tt.resolver,
+				UseResponseFilename: tt.rename,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "download-42", Size: int64(len(content)), SupportsRange: true}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{
+				URL:            "https://test.com/download/42",
+				CustomFilename: tt.customFilename,
+			})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			want := filepath.Join(outputDir, tt.want)
+			if result.FilePath != want {
+				t.Errorf("Download() FilePath = %q, want %q", result.FilePath, want)
+			}
+			data, err := os.ReadFile(want)
+			if err != nil || string(data) != content {
+				t.Fatalf("downloaded file at %s is wrong: %v", want, err)
+			}
+			if want != filepath.Join(outputDir, "download-42") {
+				if _, err := os.Stat(filepath.Join(outputDir, "download-42")); !os.IsNotExist(err) {
+					t.Errorf("file under the early name still exists: %v", err)
+				}
+			}
+			if tt.existing != "" {
+				if data, _ := os.ReadFile(filepath.Join(outputDir, "report.txt")); string(data) != tt.existing {
+					t.Errorf("existing report.txt was overwritten")
+				}
+			}
+		})
+	}
+}
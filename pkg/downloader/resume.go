@@ -0,0 +1,47 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// DefaultResumeSaveInterval is the ResumeSaveInterval of the default
+// manager options, and the one the CLI uses
+const DefaultResumeSaveInterval = 5 * time.Second
+
+// discardStalePartial removes the partial file at writePath if the resume
+// data saved with it, by this process or one that was killed, describes a
+// different version of the file than the server has now. Without resume
+// data the partial file is kept and its tail checked against the server.
+func (m *Manager) discardStalePartial(ctx context.Context, url, writePath string, fileInfo *interfaces.FileInfo) {
+	if _, err := os.Stat(writePath); err != nil {
+		return
+	}
+
+	progress, err := m.resumeManager.LoadProgress(url, writePath)
+	if err != nil || progress == nil || progress.FilePath != writePath {
+		return
+	}
+
+	changedETag := progress.ETag != "" && fileInfo.ETag != "" && progress.ETag != fileInfo.ETag
+	changedSize := progress.TotalSize > 0 && fileInfo.Size > 0 && progress.TotalSize != fileInfo.Size
+	if !changedETag && !changedSize {
+		return
+	}
+
+	logger := utils.LoggerFromContext(ctx, m.logger)
+	logger.Infof("File changed on the server since the partial download, restarting: %s", writePath)
+	if err := os.Remove(writePath); err != nil {
+		logger.Warnf("Failed to remove stale partial file: %v", err)
+	}
+	if err := utils.RemoveJournal(writePath); err != nil {
+		logger.Warnf("Failed to remove journal: %v", err)
+	}
+	if err := m.resumeManager.ClearProgress(url, writePath); err != nil {
+		logger.Warnf("Failed to clear resume data: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+func TestManager_Download_ResumesAfterRestart(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 64*20)) // 20KB, 20 chunks of 1KB
+	var ranged atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			ranged.Add(1)
+			time.Sleep(5 * time.Millisecond)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	outputDir, resumeDir := t.TempDir(), t.TempDir()
+	newTestManager := func() *Manager {
+		manager := NewManager(&ManagerOptions{
+			MaxConnections:     1,
+			ChunkSize:          1024,
+			Timeout:            30 * time.Second,
+			OutputDir:          outputDir,
+			Resume:             true,
+			ResumeDir:          resumeDir,
+			UseTempFile:        true,
+			ResumeSaveInterval: 10 * time.Millisecond,
+		})
+		manager.RegisterService(&mockService{
+			name:        "test-service",
+			supportedFn: func(url string) bool { return true },
+			getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+				return &interfaces.FileInfo{Filename: "restart.bin", Size: int64(len(content)), SupportsRange: true, ETag: "v1"}, nil
+			},
+			prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+				return server.URL, nil
+			},
+		})
+		return manager
+	}
+
+	// The first process dies partway through, leaving its .part file behind
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := newTestManager().Download(ctx, &interfaces.DownloadRequest{
+		URL: "https://test.com/restart",
+		ProgressCallback: func(downloaded, total int64) {
+			if downloaded >= 8*1024 {
+				cancel()
+			}
+		},
+	})
+	if err == nil {
+		t.Fatal("first Download() succeeded, want it cancelled")
+	}
+
+	outputPath := filepath.Join(outputDir, "restart.bin")
+	partial, err := os.Stat(outputPath + partFileSuffix)
+	if err != nil || partial.Size() == 0 {
+		t.Fatalf("no partial file left behind: %v", err)
+	}
+	saved, err := utils.NewResumeManager(resumeDir).LoadProgress("https://test.com/restart", outputPath+partFileSuffix)
+	if err != nil || saved == nil || saved.Downloaded == 0 {
+		t.Fatalf("resume data = %+v, %v, want progress saved while downloading", saved, err)
+	}
+
+	// A fresh manager, as in a new process, picks up where the first one stopped
+	ranged.Store(0)
+	result, err := newTestManager().Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/restart"})
+	if err != nil {
+		t.Fatalf("second Download() error = %v", err)
+	}
+
+	if !result.Resumed {
+		t.Error("Resumed = false, want the partial file continued")
+	}
+	if result.ChunksUsed >= 20 {
+		t.Errorf("ChunksUsed = %d, want fewer than the 20 of a full download", result.ChunksUsed)
+	}
+	if got := ranged.Load(); got >= 20 {
+		t.Errorf("server saw %d GETs, want fewer than a full download", got)
+	}
+	if data, err := os.ReadFile(outputPath); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("resumed file doesn't match the server's content: %v", err)
+	}
+}
+
+func TestManager_Download_DiscardsStalePartial(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 64*4)) // 4KB
+	server := newRangeServer(content)
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		savedETag   string
+		wantResumed bool
+	}{
+		{name: "same version resumes", savedETag: "v2", wantResumed: true},
+		{name: "changed version restarts", savedETag: "v1", wantResumed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir, resumeDir := t.TempDir(), t.TempDir()
+			writePath := filepath.Join(outputDir, "stale.bin") + partFileSuffix
+
+			// The partial file holds the right bytes either way, only the
+			// resume data tells the versions apart
+			if err := os.WriteFile(writePath, content[:1024], 0644); err != nil {
+				t.Fatalf("Failed to create partial file: %v", err)
+			}
+			err := utils.NewResumeManager(resumeDir).SaveProgress("https://test.com/stale", &interfaces.ResumeData{
+				URL:          "https://test.com/stale",
+				FilePath:     writePath,
+				TotalSize:    int64(len(content)),
+				Downloaded:   1024,
+				LastModified: time.Now(),
+				ETag:         tt.savedETag,
+			})
+			if err != nil {
+				t.Fatalf("Failed to save resume data: %v", err)
+			}
+
+			manager := NewManager(&ManagerOptions{
+				MaxConnections: 1,
+				ChunkSize:      1024,
+				Timeout:        30 * time.Second,
+				OutputDir:      outputDir,
+				Resume:         true,
+				ResumeDir:      resumeDir,
+				UseTempFile:    true,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "stale.bin", Size: int64(len(content)), SupportsRange: true, ETag: "v2"}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/stale"})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if result.Resumed != tt.wantResumed {
+				t.Errorf("Resumed = %v, want %v", result.Resumed, tt.wantResumed)
+			}
+			if data, err := os.ReadFile(result.FilePath); err != nil || !bytes.Equal(data, content) {
+				t.Errorf("downloaded file doesn't match the server's content: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewManager_DefaultResumeSaveInterval(t *testing.T) {
+	manager := NewManager(nil)
+	if got := manager.options.ResumeSaveInterval; got != DefaultResumeSaveInterval {
+		t.Errorf("default ResumeSaveInterval = %v, want %v", got, DefaultResumeSaveInterval)
+	}
+}
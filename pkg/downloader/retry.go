@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// defaultDownloadRetryDelay is the wait before retrying a failed download
+// when ManagerOptions.DownloadRetryDelay is unset
+const defaultDownloadRetryDelay = 2 * time.Second
+
+// statusCodePattern finds the HTTP status in errors such as "unexpected status code: 503"
+var statusCodePattern = regexp.MustCompile(`status code: (\d{3})`)
+
+// permanentErrors are failures that another attempt can't fix
+var permanentErrors = []error{
+	interfaces.ErrUnsupportedURL,
+	interfaces.ErrHashMismatch,
+	interfaces.ErrFileNotFound,
+	interfaces.ErrPermissionDenied,
+	interfaces.ErrInsufficientSpace,
+	interfaces.ErrContentTypeRefused,
+	interfaces.ErrFileTooLarge,
+	utils.ErrRetryBudgetExhausted,
+}
+
+// unsupportedURLError reports that no registered service handles url
+func unsupportedURLError(url string) error {
+	return &interfaces.DownloadError{
+		Type:    interfaces.ErrUnsupportedURL.Type,
+		Message: "no service found for URL",
+		URL:     url,
+	}
+}
+
+// withRetries runs attempt up to ManagerOptions.MaxDownloadAttempts times,
+// backing off between attempts, for as long as it fails with transient errors
+func (m *Manager) withRetries(ctx context.Context, attempt func() (*interfaces.DownloadResult, error)) (*interfaces.DownloadResult, error) {
+	maxAttempts := max(m.options.MaxDownloadAttempts, 1)
+	delay := m.options.DownloadRetryDelay
+	if delay <= 0 {
+		delay = defaultDownloadRetryDelay
+	}
+
+	for n := 1; ; n++ {
+		result, err := attempt()
+		if err == nil || n >= maxAttempts || !isTransient(err) || ctx.Err() != nil {
+			return result, err
+		}
+
+		m.stats.retries.Add(1)
+		utils.LoggerFromContext(ctx, m.logger).Warnf("Download attempt %d/%d failed, retrying in %s: %v", n, maxAttempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// isTransient reports whether a failed download may succeed when retried
+// from the start: network failures, dropped connections and 5xx or 429
+// responses. Cancellation and the permanent download errors never are.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	for _, permanent := range permanentErrors {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, interfaces.ErrNetworkError):
+		return true
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+
+	if match := statusCodePattern.FindStringSubmatch(err.Error()); match != nil {
+		code, _ := strconv.Atoi(match[1])
+		return code >= 500 || code == 429
+	}
+
+	return false
+}
@@ -0,0 +1,152 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "network error", err: &interfaces.DownloadError{Type: interfaces.ErrNetworkError.Type, Message: "connection refused"}, want: true},
+		{name: "server error", err: fmt.Errorf("failed to prepare download: unexpected status code: 503"), want: true},
+		{name: "rate limited", err: fmt.Errorf("unexpected status code: 429"), want: true},
+		{name: "dropped connection", err: fmt.Errorf("download failed: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "not found", err: fmt.Errorf("unexpected status code: 404"), want: false},
+		{name: "unsupported URL", err: unsupportedURLError("https://example.com"), want: false},
+		{name: "hash mismatch", err: &interfaces.DownloadError{Type: interfaces.ErrHashMismatch.Type, Message: "hash verification failed"}, want: false},
+		{name: "retry budget exhausted", err: fmt.Errorf("failed to download chunk 0-1023: %w after 4 attempts of this chunk: %w", utils.ErrRetryBudgetExhausted, errors.New("unexpected status code: 500")), want: false},
+		{name: "canceled", err: fmt.Errorf("download failed: %w", context.Canceled), want: false},
+		{name: "other error", err: errors.New("failed to parse transfer data"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// flakyService fails PrepareDownload with a server error the first failures
+// times it is called and counts how often each step runs
+func flakyService(serverURL string, size int64, failures int, infoCalls, prepareCalls *int) *mockService {
+	return &mockService{
+		name:        "flaky-service",
+		supportedFn: func(string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			*infoCalls++
+			return &interfaces.FileInfo{Filename: "flaky.txt", Size: size}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			*prepareCalls++
+			if *prepareCalls <= failures {
+				return "", fmt.Errorf("unexpected status code: %d", http.StatusInternalServerError)
+			}
+			return serverURL, nil
+		},
+	}
+}
+
+func TestManager_Download_RetriesTransientFailures(t *testing.T) {
+	content := "eventually consistent"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, content)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		attempts    int
+		failures    int
+		wantErr     bool
+		wantPrepare int
+	}{
+		{name: "succeeds on the third attempt", attempts: 3, failures: 2, wantPrepare: 3},
+		{name: "gives up after the last attempt", attempts: 2, failures: 2, wantErr: true, wantPrepare: 2},
+		{name: "single attempt by default", attempts: 0, failures: 1, wantErr: true, wantPrepare: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			manager := NewManager(&ManagerOptions{
+				ChunkSize:           1024,
+				Timeout:             10 * time.Second,
+				OutputDir:           tmpDir,
+				MaxDownloadAttempts: tt.attempts,
+				DownloadRetryDelay:  time.Millisecond,
+			})
+
+			var infoCalls, prepareCalls int
+			manager.RegisterService(flakyService(server.URL, int64(len(content)), tt.failures, &infoCalls, &prepareCalls))
+
+			result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if prepareCalls != tt.wantPrepare {
+				t.Errorf("PrepareDownload called %d times, want %d", prepareCalls, tt.wantPrepare)
+			}
+			// Every attempt resolves the file from scratch
+			if infoCalls != prepareCalls {
+				t.Errorf("GetFileInfo called %d times, want %d", infoCalls, prepareCalls)
+			}
+
+			if tt.wantErr {
+				return
+			}
+			data, err := os.ReadFile(result.FilePath)
+			if err != nil || string(data) != content {
+				t.Errorf("downloaded %q (%v), want %q", data, err, content)
+			}
+		})
+	}
+}
+
+func TestManager_Download_DoesNotRetryPermanentFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "content")
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		ChunkSize:           1024,
+		Timeout:             10 * time.Second,
+		OutputDir:           t.TempDir(),
+		VerifyHash:          true,
+		HashAlgorithm:       "sha256",
+		MaxDownloadAttempts: 3,
+		DownloadRetryDelay:  time.Millisecond,
+	})
+
+	_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+	if !errors.Is(err, ErrUnsupportedURL) {
+		t.Errorf("Download() without services error = %v, want ErrUnsupportedURL", err)
+	}
+
+	var infoCalls, prepareCalls int
+	manager.RegisterService(flakyService(server.URL, 7, 0, &infoCalls, &prepareCalls))
+
+	_, err = manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file", VerifyHash: "0000"})
+	if !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("Download() error = %v, want ErrHashMismatch", err)
+	}
+	if prepareCalls != 1 {
+		t.Errorf("PrepareDownload called %d times after a hash mismatch, want 1", prepareCalls)
+	}
+}
@@ -0,0 +1,95 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// ResolveFunc turns a share URL into the URL the file is downloaded from.
+// It may return nil info, in which case the direct URL is probed for it.
+type ResolveFunc func(ctx context.Context, url string) (directURL string, info *FileInfo, err error)
+
+// simpleService adapts a match and resolve function pair to CloudService
+type simpleService struct {
+	name       string
+	match      func(string) bool
+	resolve    ResolveFunc
+	httpClient *utils.HTTPClient
+}
+
+// RegisterSimpleService adds a service for a custom host without implementing
+// the full CloudService interface. match decides which URLs it handles and
+// resolve returns the direct download URL. Simple services are checked before
+// the built-in ones so they can take over URLs those would otherwise claim.
+func (m *Manager) RegisterSimpleService(name string, match func(string) bool, resolve ResolveFunc) {
+	service := &simpleService{
+		name:       name,
+		match:      match,
+		resolve:    resolve,
+		httpClient: m.httpClient,
+	}
+
+	m.services = append([]interfaces.CloudService{service}, m.services...)
+	m.logger.Debugf("Registered simple service: %s", name)
+}
+
+func (s *simpleService) GetServiceName() string {
+	return s.name
+}
+
+func (s *simpleService) IsSupported(url string) bool {
+	return s.match != nil && s.match(url)
+}
+
+func (s *simpleService) ConvertURL(url string) (string, error) {
+	directURL, _, err := s.resolve(context.Background(), url)
+	if err != nil {
+		return "", err
+	}
+	return directURL, nil
+}
+
+func (s *simpleService) GetFileInfo(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+	directURL, info, err := s.resolve(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", url, err)
+	}
+
+	if info != nil {
+		if info.URL == "" {
+			info.URL = directURL
+		}
+		return info, nil
+	}
+
+	httpFileInfo, err := s.httpClient.GetFileInfo(ctx, directURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	fileInfo := &interfaces.FileInfo{
+		URL:           httpFileInfo.URL,
+		Filename:      httpFileInfo.Filename,
+		Size:          httpFileInfo.Size,
+		SupportsRange: httpFileInfo.SupportsRangeRequests,
+		ETag:          httpFileInfo.ETag,
+		ContentType:   httpFileInfo.ContentType,
+	}
+
+	if httpFileInfo.LastModified != nil {
+		fileInfo.LastModified = *httpFileInfo.LastModified
+	}
+
+	return fileInfo, nil
+}
+
+func (s *simpleService) PrepareDownload(ctx context.Context, url string) (string, error) {
+	directURL, _, err := s.resolve(ctx, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", url, err)
+	}
+	return directURL, nil
+}
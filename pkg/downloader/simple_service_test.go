@@ -0,0 +1,105 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_RegisterSimpleService(t *testing.T) {
+	content := []byte(strings.Repeat("resolved through a simple service ", 50))
+	server := newRangeServer(content)
+	defer server.Close()
+
+	newTestManager := func() *Manager {
+		return NewManager(&ManagerOptions{
+			ChunkSize: 1024,
+			Timeout:   10 * time.Second,
+			OutputDir: t.TempDir(),
+		})
+	}
+	isCustomHost := func(url string) bool {
+		return strings.HasPrefix(url, "https://files.example.internal/")
+	}
+
+	t.Run("download with resolver provided info", func(t *testing.T) {
+		manager := newTestManager()
+		var resolvedURL string
+		manager.RegisterSimpleService("Custom Host", isCustomHost, func(ctx context.Context, url string) (string, *FileInfo, error) {
+			resolvedURL = url
+			return server.URL + "/blob", &FileInfo{Filename: "custom.txt", Size: int64(len(content))}, nil
+		})
+
+		service := manager.FindService("https://files.example.internal/share/42")
+		if service == nil || service.GetServiceName() != "Custom Host" {
+			t.Fatalf("FindService() = %v, want the simple service", service)
+		}
+
+		result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://files.example.internal/share/42"})
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+
+		if resolvedURL != "https://files.example.internal/share/42" {
+			t.Errorf("resolver got %q, want the share URL", resolvedURL)
+		}
+		if !strings.HasSuffix(result.FilePath, "custom.txt") {
+			t.Errorf("FilePath = %s, want it to end in custom.txt", result.FilePath)
+		}
+		data, err := os.ReadFile(result.FilePath)
+		if err != nil {
+			t.Fatalf("Failed to read downloaded file: %v", err)
+		}
+		if string(data) != string(content) {
+			t.Error("Downloaded content does not match")
+		}
+	})
+
+	t.Run("nil info probes the direct URL", func(t *testing.T) {
+		manager := newTestManager()
+		manager.RegisterSimpleService("Custom Host", isCustomHost, func(ctx context.Context, url string) (string, *FileInfo, error) {
+			return server.URL + "/probed.bin", nil, nil
+		})
+
+		result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://files.example.internal/share/43"})
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+		if result.Size != int64(len(content)) {
+			t.Errorf("Size = %d, want %d", result.Size, len(content))
+		}
+		if !strings.HasSuffix(result.FilePath, "probed.bin") {
+			t.Errorf("FilePath = %s, want it to end in probed.bin", result.FilePath)
+		}
+	})
+
+	t.Run("resolver error is returned", func(t *testing.T) {
+		manager := newTestManager()
+		errExpired := errors.New("share link expired")
+		manager.RegisterSimpleService("Custom Host", isCustomHost, func(ctx context.Context, url string) (string, *FileInfo, error) {
+			return "", nil, errExpired
+		})
+
+		_, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://files.example.internal/share/44"})
+		if !errors.Is(err, errExpired) {
+			t.Errorf("Download() error = %v, want %v", err, errExpired)
+		}
+	})
+
+	t.Run("takes precedence over the direct service", func(t *testing.T) {
+		manager := newTestManager()
+		manager.RegisterDirectService()
+		manager.RegisterSimpleService("Custom Host", isCustomHost, func(ctx context.Context, url string) (string, *FileInfo, error) {
+			return url, nil, nil
+		})
+
+		if service := manager.FindService("https://files.example.internal/share/45"); service.GetServiceName() != "Custom Host" {
+			t.Errorf("FindService() = %s, want Custom Host", service.GetServiceName())
+		}
+	})
+}
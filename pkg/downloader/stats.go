@@ -0,0 +1,68 @@
+package downloader
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+// ManagerStats is a snapshot of everything a manager has downloaded since it
+// was created
+type ManagerStats struct {
+	Started         int64 // Downloads begun, including ones still in flight
+	Completed       int64
+	Failed          int64
+	BytesDownloaded int64   // Bytes written by completed downloads
+	Retries         int64   // Chunk retries plus whole-download re-attempts
+	AverageSpeed    float64 // MB/s across completed downloads
+}
+
+// managerStats holds the counters behind ManagerStats. They're updated from
+// concurrent downloads, so every field is atomic.
+type managerStats struct {
+	started   atomic.Int64
+	completed atomic.Int64
+	failed    atomic.Int64
+	bytes     atomic.Int64
+	retries   atomic.Int64
+	elapsed   atomic.Int64 // Nanoseconds spent on completed downloads
+}
+
+// record counts the outcome of a download that was started earlier
+func (s *managerStats) record(result *interfaces.DownloadResult, err error) {
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+	s.completed.Add(1)
+	s.retries.Add(int64(result.Retries))
+
+	// A file that was already complete on disk took no transfer
+	if result.ChunksUsed == 0 {
+		return
+	}
+	s.bytes.Add(result.Size)
+	s.elapsed.Add(int64(result.Duration))
+}
+
+// snapshot returns the current counters
+func (s *managerStats) snapshot() ManagerStats {
+	stats := ManagerStats{
+		Started:         s.started.Load(),
+		Completed:       s.completed.Load(),
+		Failed:          s.failed.Load(),
+		BytesDownloaded: s.bytes.Load(),
+		Retries:         s.retries.Load(),
+	}
+	if elapsed := time.Duration(s.elapsed.Load()); elapsed > 0 {
+		stats.AverageSpeed = float64(stats.BytesDownloaded) / elapsed.Seconds() / 1024 / 1024
+	}
+	return stats
+}
+
+// Stats returns counters for every download this manager has run, for
+// services that embed it and want to report on it
+func (m *Manager) Stats() ManagerStats {
+	return m.stats.snapshot()
+}
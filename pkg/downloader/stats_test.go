@@ -0,0 +1,112 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_Stats(t *testing.T) {
+	content := []byte("stats content")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		ChunkSize: 1024,
+		Timeout:   10 * time.Second,
+		OutputDir: t.TempDir(),
+	})
+	manager.RegisterService(&mockService{
+		name:        "Test Service",
+		supportedFn: func(url string) bool { return strings.HasPrefix(url, "https://test.com/") },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			if strings.Contains(url, "missing") {
+				return nil, errors.New("not found")
+			}
+			return &interfaces.FileInfo{Filename: url[len("https://test.com/"):], Size: int64(len(content))}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	if stats := manager.Stats(); stats != (ManagerStats{}) {
+		t.Fatalf("Stats() before any download = %+v, want zero", stats)
+	}
+
+	for _, url := range []string{"https://test.com/a.txt", "https://test.com/missing", "https://test.com/b.txt", "https://test.com/missing-too"} {
+		manager.Download(context.Background(), &interfaces.DownloadRequest{URL: url})
+	}
+	// No service claims this URL, which still counts as a failed download
+	manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://other.com/c.txt"})
+
+	stats := manager.Stats()
+	if stats.Started != 5 {
+		t.Errorf("Started = %d, want 5", stats.Started)
+	}
+	if stats.Completed != 2 {
+		t.Errorf("Completed = %d, want 2", stats.Completed)
+	}
+	if stats.Failed != 3 {
+		t.Errorf("Failed = %d, want 3", stats.Failed)
+	}
+	if want := int64(2 * len(content)); stats.BytesDownloaded != want {
+		t.Errorf("BytesDownloaded = %d, want %d", stats.BytesDownloaded, want)
+	}
+	if stats.Retries != 0 {
+		t.Errorf("Retries = %d, want 0", stats.Retries)
+	}
+	if stats.AverageSpeed <= 0 {
+		t.Errorf("AverageSpeed = %f, want > 0", stats.AverageSpeed)
+	}
+}
+
+func TestManager_Stats_CountsRetries(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("retried"))
+	}))
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{
+		ChunkSize:           1024,
+		Timeout:             10 * time.Second,
+		OutputDir:           t.TempDir(),
+		MaxDownloadAttempts: 3,
+		DownloadRetryDelay:  time.Millisecond,
+	})
+	manager.RegisterService(&mockService{
+		name:        "Test Service",
+		supportedFn: func(url string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			requests++
+			if requests == 1 {
+				return nil, interfaces.ErrNetworkError
+			}
+			return &interfaces.FileInfo{Filename: "retried.txt", Size: 7}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	if _, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/retried.txt"}); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	stats := manager.Stats()
+	if stats.Started != 1 || stats.Completed != 1 || stats.Failed != 0 {
+		t.Errorf("Stats() = %+v, want one completed download", stats)
+	}
+	if stats.Retries != 1 {
+		t.Errorf("Retries = %d, want 1", stats.Retries)
+	}
+}
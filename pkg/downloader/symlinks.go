@@ -0,0 +1,103 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+// checkSymlinks refuses an output path that symlinks lead out of the output
+// directory when ManagerOptions.DisallowSymlinks is set. A derived path must
+// really lie under OutputDir, whatever its directories link to. An explicit
+// output path was chosen by the caller, so it's taken as written: a symlink
+// at any of its directories, at the file itself or at its partial file that
+// leads somewhere else is refused.
+func (m *Manager) checkSymlinks(outputPath string, explicit bool) error {
+	if !m.options.DisallowSymlinks {
+		return nil
+	}
+
+	dir := filepath.Dir(outputPath)
+	var realRoot string
+	var err error
+	if explicit {
+		realRoot, err = filepath.Abs(dir)
+	} else {
+		realRoot, err = resolveExisting(m.options.OutputDir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+	realDir, err := resolveExisting(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+	if !within(realRoot, realDir) {
+		return symlinkEscapeError(outputPath, realDir)
+	}
+
+	for _, path := range []string{outputPath, outputPath + partFileSuffix} {
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			// A dangling link would still be followed when the file is created
+			return symlinkEscapeError(path, "a missing target")
+		}
+		if !within(realRoot, target) {
+			return symlinkEscapeError(path, target)
+		}
+	}
+
+	return nil
+}
+
+// symlinkEscapeError reports that path resolves to target outside the output directory
+func symlinkEscapeError(path, target string) error {
+	return &interfaces.DownloadError{
+		Type:    interfaces.ErrPermissionDenied.Type,
+		Message: fmt.Sprintf("output path %s resolves through a symlink to %s, outside the output directory", path, target),
+	}
+}
+
+// resolveExisting returns the absolute path with every symlink resolved.
+// Trailing components that don't exist yet, so can't be links, are kept as
+// they are.
+func resolveExisting(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// within reports whether path is root or lies under it. Both must be clean
+// absolute paths.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,152 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestManager_Download_DisallowSymlinks(t *testing.T) {
+	content := []byte("symlinked output content")
+	server := newRangeServer(content)
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		disallow         bool
+		groupByService   bool
+		setup            func(t *testing.T, outputDir, outside string) string // Returns the OutputDir to use
+		output           func(outputDir string) string                        // Explicit output path, "" derives it
+		wantRefused      bool
+		wantOutsideWrite bool
+	}{
+		{
+			name:     "plain output directory",
+			disallow: true,
+			setup:    func(t *testing.T, outputDir, outside string) string { return outputDir },
+		},
+		{
+			name:     "output directory itself is a symlink",
+			disallow: true,
+			setup: func(t *testing.T, outputDir, outside string) string {
+				link := filepath.Join(t.TempDir(), "downloads")
+				symlink(t, outputDir, link)
+				return link
+			},
+		},
+		{
+			name:           "service directory links outside",
+			disallow:       true,
+			groupByService: true,
+			setup: func(t *testing.T, outputDir, outside string) string {
+				symlink(t, outside, filepath.Join(outputDir, "test-service"))
+				return outputDir
+			},
+			wantRefused: true,
+		},
+		{
+			name:           "service directory links outside with the option off",
+			groupByService: true,
+			setup: func(t *testing.T, outputDir, outside string) string {
+				symlink(t, outside, filepath.Join(outputDir, "test-service"))
+				return outputDir
+			},
+			wantOutsideWrite: true,
+		},
+		{
+			name:     "output file links outside",
+			disallow: true,
+			setup: func(t *testing.T, outputDir, outside string) string {
+				symlink(t, filepath.Join(outside, "file.bin"), filepath.Join(outputDir, "file.bin"))
+				return outputDir
+			},
+			wantRefused: true,
+		},
+		{
+			name:     "partial file links outside",
+			disallow: true,
+			setup: func(t *testing.T, outputDir, outside string) string {
+				symlink(t, filepath.Join(outside, "file.bin"), filepath.Join(outputDir, "file.bin"+partFileSuffix))
+				return outputDir
+			},
+			wantRefused: true,
+		},
+		{
+			name:     "explicit output path in a linked directory",
+			disallow: true,
+			setup: func(t *testing.T, outputDir, outside string) string {
+				symlink(t, outside, filepath.Join(outputDir, "elsewhere"))
+				return outputDir
+			},
+			output:      func(outputDir string) string { return filepath.Join(outputDir, "elsewhere", "file.bin") },
+			wantRefused: true,
+		},
+		{
+			name:     "explicit output path in a plain directory",
+			disallow: true,
+			setup:    func(t *testing.T, outputDir, outside string) string { return outputDir },
+			output:   func(outputDir string) string { return filepath.Join(outputDir, "file.bin") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outside := t.TempDir()
+			outputDir := tt.setup(t, t.TempDir(), outside)
+
+			manager := NewManager(&ManagerOptions{
+				MaxConnections:   2,
+				ChunkSize:        8,
+				Timeout:          10 * time.Second,
+				OutputDir:        outputDir,
+				UseTempFile:      true,
+				GroupByService:   tt.groupByService,
+				DisallowSymlinks: tt.disallow,
+			})
+			manager.RegisterService(&mockService{
+				name:        "test-service",
+				supportedFn: func(url string) bool { return true },
+				getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+					return &interfaces.FileInfo{Filename: "file.bin", Size: int64(len(content)), SupportsRange: true}, nil
+				},
+				prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+					return server.URL, nil
+				},
+			})
+
+			req := &interfaces.DownloadRequest{URL: "https://test.com/file"}
+			if tt.output != nil {
+				req.OutputPath = tt.output(outputDir)
+			}
+			_, err := manager.Download(context.Background(), req)
+
+			if tt.wantRefused {
+				var downloadErr *interfaces.DownloadError
+				if !errors.As(err, &downloadErr) || downloadErr.Type != interfaces.ErrPermissionDenied.Type {
+					t.Fatalf("Download() error = %v, want a permission denied error", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			_, statErr := os.Stat(filepath.Join(outside, "file.bin"))
+			if wrote := statErr == nil; wrote != tt.wantOutsideWrite {
+				t.Errorf("file written outside the output directory = %v, want %v", wrote, tt.wantOutsideWrite)
+			}
+		})
+	}
+}
+
+// symlink creates link pointing at target, skipping the test where symlinks
+// can't be created
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+}
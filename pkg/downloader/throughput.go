@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+// throughputInterval is the window speeds are sampled over
+const throughputInterval = time.Second
+
+// bytesPerMB converts bytes per second to the MB/s of DownloadResult
+const bytesPerMB = 1024 * 1024
+
+// throughputMeter turns the byte counts of a download's progress callback
+// into per-interval speeds, to report the peak speed and, when asked, the
+// whole series. The first count is the baseline, so bytes already on disk
+// from a resumed download don't count as a burst.
+type throughputMeter struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	record  bool // Keep every sample, not just the peak
+	started bool
+	start   time.Time // When the baseline was taken
+
+	windowStart time.Time
+	windowBytes int64 // Downloaded count at windowStart
+	last        int64 // Downloaded count of the latest call
+	peak        float64
+	samples     []interfaces.ThroughputSample
+}
+
+func newThroughputMeter(record bool) *throughputMeter {
+	return &throughputMeter{now: time.Now, record: record}
+}
+
+// add notes that downloaded bytes have arrived so far, closing the current
+// window once it's throughputInterval long
+func (t *throughputMeter) add(downloaded int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	restarted := downloaded < t.last
+	t.last = downloaded
+	if !t.started || restarted {
+		// A restarted download counts from zero again
+		t.started = true
+		if t.start.IsZero() {
+			t.start = now
+		}
+		t.windowStart, t.windowBytes = now, downloaded
+		return
+	}
+
+	elapsed := now.Sub(t.windowStart)
+	if elapsed < throughputInterval {
+		return
+	}
+
+	speed := float64(downloaded-t.windowBytes) / elapsed.Seconds() / bytesPerMB
+	t.peak = max(t.peak, speed)
+	if t.record {
+		t.samples = append(t.samples, interfaces.ThroughputSample{Elapsed: now.Sub(t.start), Speed: speed})
+	}
+	t.windowStart, t.windowBytes = now, downloaded
+}
+
+// report returns the peak speed and the samples taken. A download too short
+// to fill one window peaks at its average speed.
+func (t *throughputMeter) report(average float64) (float64, []interfaces.ThroughputSample) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.peak == 0 {
+		return average, t.samples
+	}
+	return t.peak, t.samples
+}
@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestThroughputMeter(t *testing.T) {
+	const mb = 1024 * 1024
+
+	type point struct {
+		at         time.Duration
+		downloaded int64
+	}
+	tests := []struct {
+		name        string
+		points      []point
+		record      bool
+		average     float64
+		wantPeak    float64
+		wantSamples []interfaces.ThroughputSample
+	}{
+		{
+			name: "peak of the fastest window",
+			points: []point{
+				{0, 0},
+				{time.Second, 1 * mb},
+				{2 * time.Second, 3 * mb},           // 2 MB/s
+				{2500 * time.Millisecond, 3.5 * mb}, // Window still open
+				{4 * time.Second, 4 * mb},           // 1 MB over 2s
+			},
+			record:   true,
+			average:  1,
+			wantPeak: 2,
+			wantSamples: []interfaces.ThroughputSample{
+				{Elapsed: time.Second, Speed: 1},
+				{Elapsed: 2 * time.Second, Speed: 2},
+				{Elapsed: 4 * time.Second, Speed: 0.5},
+			},
+		},
+		{
+			name: "samples are only kept when recording",
+			points: []point{
+				{0, 0},
+				{time.Second, 3 * mb},
+				{2 * time.Second, 4 * mb},
+			},
+			average:  2,
+			wantPeak: 3,
+		},
+		{
+			name: "resumed bytes are the baseline",
+			points: []point{
+				{0, 100 * mb},
+				{time.Second, 101 * mb},
+			},
+			average:  1,
+			wantPeak: 1,
+		},
+		{
+			name: "restart counts from zero again",
+			points: []point{
+				{0, 0},
+				{500 * time.Millisecond, 2 * mb},
+				{600 * time.Millisecond, 0}, // Download restarted
+				{1600 * time.Millisecond, 1 * mb},
+			},
+			average:  1.5,
+			wantPeak: 1,
+		},
+		{
+			name: "shorter than a window peaks at the average",
+			points: []point{
+				{0, 0},
+				{200 * time.Millisecond, 1 * mb},
+			},
+			record:   true,
+			average:  5,
+			wantPeak: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Unix(0, 0)
+			now := start
+			meter := newThroughputMeter(tt.record)
+			meter.now = func() time.Time { return now }
+
+			for _, p := range tt.points {
+				now = start.Add(p.at)
+				meter.add(p.downloaded)
+			}
+
+			peak, samples := meter.report(tt.average)
+			if math.Abs(peak-tt.wantPeak) > 1e-9 {
+				t.Errorf("peak = %v, want %v", peak, tt.wantPeak)
+			}
+			if len(samples) != len(tt.wantSamples) {
+				t.Fatalf("samples = %v, want %v", samples, tt.wantSamples)
+			}
+			for i, sample := range samples {
+				want := tt.wantSamples[i]
+				if sample.Elapsed != want.Elapsed || math.Abs(sample.Speed-want.Speed) > 1e-9 {
+					t.Errorf("sample %d = %+v, want %+v", i, sample, want)
+				}
+			}
+		})
+	}
+}
+
+func TestManager_Download_PeakSpeed(t *testing.T) {
+	content := []byte("measured")
+	server := newRangeServer(content)
+	defer server.Close()
+
+	manager := NewManager(&ManagerOptions{ChunkSize: 1024, Timeout: 10 * time.Second, OutputDir: t.TempDir()})
+	manager.RegisterService(&mockService{
+		name:        "test-service",
+		supportedFn: func(string) bool { return true },
+		getInfoFn: func(ctx context.Context, url string) (*interfaces.FileInfo, error) {
+			return &interfaces.FileInfo{Filename: "measured.txt", Size: int64(len(content))}, nil
+		},
+		prepareDownloadFn: func(ctx context.Context, url string) (string, error) {
+			return server.URL, nil
+		},
+	})
+
+	result, err := manager.Download(context.Background(), &interfaces.DownloadRequest{URL: "https://test.com/file"})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	// Far too quick to fill a window, so the peak is the average
+	if result.PeakSpeed != result.Speed || result.Speed <= 0 {
+		t.Errorf("PeakSpeed = %v, Speed = %v, want equal and positive", result.PeakSpeed, result.Speed)
+	}
+	if result.Throughput != nil {
+		t.Errorf("Throughput = %v without RecordThroughput, want none", result.Throughput)
+	}
+}
@@ -3,6 +3,7 @@ package interfaces
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 )
@@ -12,8 +13,10 @@ type FileInfo struct {
 	URL           string
 	Filename      string
 	Size          int64
+	SizeKnown     bool // Size came from the server, so zero means an empty file rather than an unknown size
 	SupportsRange bool
 	ContentType   string
+	ETag          string
 	LastModified  time.Time
 }
 
@@ -26,8 +29,25 @@ type DownloadRequest struct {
 	ChunkSize        int64
 	Timeout          time.Duration
 	Resume           bool
+	NoResume         bool // Disables resume for this request even when the manager has it enabled
 	VerifyHash       string
 	ProgressCallback func(downloaded, total int64)
+	Range            *ByteRange        // Downloads only this part of the file when set
+	SelectFile       string            // Picks one file by name from links that share several, such as WeTransfer transfers
+	Password         string            // Unlocks password-protected share links, such as Dropbox links
+	Decompress       bool              // Replaces a gzip download with its decompressed contents, dropping the .gz from its name
+	ExpectedHashes   map[string]string // Digests keyed by algorithm that must all match, checked even without ManagerOptions.VerifyHash
+	// Deadline, when set, is the time by which the download must finish.
+	// Timeout, or else the manager's timeout, and a deadline or timeout
+	// already on the caller's context still apply if they come first.
+	Deadline time.Time
+}
+
+// ByteRange selects bytes Start through End of a file, both inclusive. A
+// negative End reads through to the end of the file.
+type ByteRange struct {
+	Start int64
+	End   int64
 }
 
 // DownloadResult contains the results of a download operation
@@ -39,6 +59,16 @@ type DownloadResult struct {
 	Hash       string
 	Resumed    bool
 	ChunksUsed int
+	Retries    int
+	FinalURL   string             // URL the content came from after service conversion and redirects
+	PeakSpeed  float64            // MB/s over the fastest second of the download
+	Throughput []ThroughputSample // Speed of each second, only kept when the manager records throughput
+}
+
+// ThroughputSample is the speed of a download over one interval
+type ThroughputSample struct {
+	Elapsed time.Duration // Since the download started, at the end of the interval
+	Speed   float64       // MB/s
 }
 
 // CloudService interface defines the contract for cloud service providers
@@ -49,7 +79,10 @@ type CloudService interface {
 	// GetServiceName returns the name of the service
 	GetServiceName() string
 
-	// ConvertURL converts a share URL to a direct download URL
+	// ConvertURL converts a share URL to a direct download URL. It makes no
+	// requests, so links that only resolve over the network, such as Dropbox
+	// db.tt short links, are refused and have to go through PrepareDownload,
+	// which has the caller's context.
 	ConvertURL(url string) (string, error)
 
 	// GetFileInfo retrieves metadata about the file
@@ -100,20 +133,24 @@ type HashVerifier interface {
 	// CalculateHash calculates the hash of a file
 	CalculateHash(filePath string, algorithm string) (string, error)
 
+	// CalculateHashReader calculates the hash of everything read from r
+	CalculateHashReader(r io.Reader, algorithm string) (string, error)
+
 	// VerifyHash verifies a file against an expected hash
 	VerifyHash(filePath string, expectedHash string, algorithm string) error
 }
 
 // ResumeManager interface for handling download resumption
 type ResumeManager interface {
-	// SaveProgress saves download progress for resumption
+	// SaveProgress saves download progress for resumption, keyed by the
+	// URL and progress.FilePath
 	SaveProgress(url string, progress *ResumeData) error
 
-	// LoadProgress loads saved download progress
-	LoadProgress(url string) (*ResumeData, error)
+	// LoadProgress loads saved progress of downloading url to outputPath
+	LoadProgress(url string, outputPath string) (*ResumeData, error)
 
-	// ClearProgress removes saved progress data
-	ClearProgress(url string) error
+	// ClearProgress removes saved progress of downloading url to outputPath
+	ClearProgress(url string, outputPath string) error
 }
 
 // ResumeData contains information needed to resume a download
@@ -125,6 +162,7 @@ type ResumeData struct {
 	ChunkSize    int64     `json:"chunk_size"`
 	LastModified time.Time `json:"last_modified"`
 	Hash         string    `json:"hash,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
 }
 
 // HTTPClient interface for making HTTP requests
@@ -164,13 +202,22 @@ func (e *DownloadError) Unwrap() error {
 	return e.Err
 }
 
+// Is matches download errors by type so errors.Is(err, ErrNetworkError)
+// holds for any network error regardless of its message
+func (e *DownloadError) Is(target error) bool {
+	t, ok := target.(*DownloadError)
+	return ok && t.Type == e.Type
+}
+
 // Common error types
 var (
-	ErrUnsupportedURL    = &DownloadError{Type: "UnsupportedURL", Message: "URL not supported by any service"}
-	ErrFileNotFound      = &DownloadError{Type: "FileNotFound", Message: "File not found"}
-	ErrNetworkError      = &DownloadError{Type: "NetworkError", Message: "Network error occurred"}
-	ErrInvalidResponse   = &DownloadError{Type: "InvalidResponse", Message: "Invalid response from server"}
-	ErrHashMismatch      = &DownloadError{Type: "HashMismatch", Message: "File hash verification failed"}
-	ErrInsufficientSpace = &DownloadError{Type: "InsufficientSpace", Message: "Insufficient disk space"}
-	ErrPermissionDenied  = &DownloadError{Type: "PermissionDenied", Message: "Permission denied"}
+	ErrUnsupportedURL     = &DownloadError{Type: "UnsupportedURL", Message: "URL not supported by any service"}
+	ErrFileNotFound       = &DownloadError{Type: "FileNotFound", Message: "File not found"}
+	ErrNetworkError       = &DownloadError{Type: "NetworkError", Message: "Network error occurred"}
+	ErrInvalidResponse    = &DownloadError{Type: "InvalidResponse", Message: "Invalid response from server"}
+	ErrHashMismatch       = &DownloadError{Type: "HashMismatch", Message: "File hash verification failed"}
+	ErrInsufficientSpace  = &DownloadError{Type: "InsufficientSpace", Message: "Insufficient disk space"}
+	ErrPermissionDenied   = &DownloadError{Type: "PermissionDenied", Message: "Permission denied"}
+	ErrContentTypeRefused = &DownloadError{Type: "ContentTypeRefused", Message: "Content type not allowed"}
+	ErrFileTooLarge       = &DownloadError{Type: "FileTooLarge", Message: "File exceeds the size limit"}
 )
@@ -4,18 +4,29 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
 )
 
+// DefaultLineInterval is how often a percentage line is written for non-TTY writers
+const DefaultLineInterval = 5 * time.Second
+
 type Tracker struct {
 	mu           sync.RWMutex
 	downloads    map[string]*DownloadProgress
 	logger       *logrus.Logger
 	showProgress bool
+	writer       io.Writer
+	isTTY        bool
+	lineInterval time.Duration
+	renderer     *lineRenderer
 }
 
 type DownloadProgress struct {
@@ -33,6 +44,14 @@ type DownloadProgress struct {
 	ProgressBar *progressbar.ProgressBar
 	chunks      map[int]*ChunkProgress
 	chunksMu    sync.RWMutex
+	lastLine    time.Time
+	spinner     int // Spinner frame shown next for a download of unknown size
+}
+
+// Indeterminate reports whether the download's size is unknown, so its
+// progress is shown as a spinner with a byte count instead of a percentage
+func (p *DownloadProgress) Indeterminate() bool {
+	return p.TotalBytes <= 0
 }
 
 type ChunkProgress struct {
@@ -82,6 +101,21 @@ func (s DownloadStatus) String() string {
 	}
 }
 
+func (s ChunkStatus) String() string {
+	switch s {
+	case ChunkPending:
+		return "Pending"
+	case ChunkDownloading:
+		return "Downloading"
+	case ChunkCompleted:
+		return "Completed"
+	case ChunkFailed:
+		return "Failed"
+	default:
+		return "Unknown"
+	}
+}
+
 func NewTracker(logger *logrus.Logger, showProgress bool) *Tracker {
 	if logger == nil {
 		logger = logrus.New()
@@ -92,19 +126,118 @@ func NewTracker(logger *logrus.Logger, showProgress bool) *Tracker {
 		downloads:    make(map[string]*DownloadProgress),
 		logger:       logger,
 		showProgress: showProgress,
+		writer:       io.Discard,
+		lineInterval: DefaultLineInterval,
+	}
+}
+
+// NewTrackerWithWriter creates a tracker that renders progress to writer.
+// Terminals get one live bar per download, redrawn together so concurrent
+// downloads don't interleave. Anything else (pipes, files, buffers) gets a
+// percentage line every DefaultLineInterval instead.
+func NewTrackerWithWriter(logger *logrus.Logger, writer io.Writer) *Tracker {
+	tracker := NewTracker(logger, true)
+	if writer != nil {
+		tracker.writer = writer
+		tracker.isTTY = isTerminal(writer)
+	}
+	if tracker.isTTY {
+		tracker.renderer = newLineRenderer(tracker.writer, renderThrottle)
+		tracker.routeLogs()
+	}
+	return tracker
+}
+
+// Mode selects how a tracker shows progress
+type Mode string
+
+const (
+	// ModeBar draws live bars on a terminal and falls back to percentage
+	// lines for anything else
+	ModeBar Mode = "bar"
+	// ModePlain writes a percentage line with speed and ETA every line
+	// interval, even on a terminal, for CI and log files
+	ModePlain Mode = "plain"
+	// ModeNone shows no progress
+	ModeNone Mode = "none"
+)
+
+// ParseMode parses a progress mode name as given on the command line
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case ModeBar, ModePlain, ModeNone:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown progress mode %q, want bar, plain or none", name)
+	}
+}
+
+// NewTrackerWithMode creates a tracker that shows progress on writer the way
+// mode asks for. ModeNone, or a nil writer, shows nothing.
+func NewTrackerWithMode(logger *logrus.Logger, writer io.Writer, mode Mode) *Tracker {
+	if writer == nil {
+		mode = ModeNone
+	}
+
+	switch mode {
+	case ModeBar:
+		return NewTrackerWithWriter(logger, writer)
+	case ModePlain:
+		tracker := NewTracker(logger, true)
+		tracker.writer = writer
+		return tracker
+	default:
+		return NewTracker(logger, false)
+	}
+}
+
+// SetLogger replaces the logger start and completion messages go to
+func (t *Tracker) SetLogger(logger *logrus.Logger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logger = logger
+	t.routeLogs()
+}
+
+// routeLogs points the logger at the renderer when it logs to the terminal
+// the bars are drawn on, so its lines are printed above the bars instead of
+// in the middle of them. The caller must hold t.mu, unless t isn't shared yet.
+func (t *Tracker) routeLogs() {
+	if t.renderer == nil || t.logger == nil {
+		return
+	}
+	if out, ok := t.logger.Out.(*os.File); ok && out == t.writer {
+		t.logger.SetOutput(t.renderer)
 	}
 }
 
+// SetLineInterval sets how often percentage lines are written for non-TTY writers
+func (t *Tracker) SetLineInterval(interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lineInterval = interval
+}
+
+func isTerminal(writer io.Writer) bool {
+	file, ok := writer.(*os.File)
+	return ok && term.IsTerminal(int(file.Fd()))
+}
+
 func (t *Tracker) StartDownload(id, filename string, totalBytes int64) *DownloadProgress {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	var progressBar *progressbar.ProgressBar
-	if t.showProgress {
+	if t.showProgress && t.renderer == nil && t.writer == io.Discard {
+		// A max of -1 makes the bar a spinner with a byte count and speed
+		barMax := totalBytes
+		if barMax <= 0 {
+			barMax = -1
+		}
 		progressBar = progressbar.NewOptions64(
-			totalBytes,
+			barMax,
 			progressbar.OptionSetDescription(filename),
-			progressbar.OptionSetWriter(io.Discard), // We'll handle output ourselves
+			progressbar.OptionSetWriter(t.writer),
 			progressbar.OptionShowBytes(true),
 			progressbar.OptionSetWidth(50),
 			progressbar.OptionThrottle(65*time.Millisecond),
@@ -128,6 +261,11 @@ func (t *Tracker) StartDownload(id, filename string, totalBytes int64) *Download
 
 	t.downloads[id] = progress
 
+	if t.renderer != nil {
+		t.renderer.setHeader(t.headerLine())
+		t.renderer.add(id, formatBar(progress))
+	}
+
 	if t.showProgress {
 		t.logger.Infof("Started downloading: %s (%s)", filename, formatBytes(totalBytes))
 	}
@@ -138,6 +276,7 @@ func (t *Tracker) StartDownload(id, filename string, totalBytes int64) *Download
 func (t *Tracker) UpdateProgress(id string, downloaded int64) {
 	t.mu.RLock()
 	progress, exists := t.downloads[id]
+	interval := t.lineInterval
 	t.mu.RUnlock()
 
 	if !exists {
@@ -145,7 +284,13 @@ func (t *Tracker) UpdateProgress(id string, downloaded int64) {
 	}
 
 	progress.mu.Lock()
-	defer progress.mu.Unlock()
+
+	// Chunked downloads report each finished chunk both through its chunk
+	// and as a total, the repeat would only zero the speed
+	if downloaded == progress.Downloaded && downloaded > 0 {
+		progress.mu.Unlock()
+		return
+	}
 
 	now := time.Now()
 	timeDiff := now.Sub(progress.LastUpdate).Seconds()
@@ -158,14 +303,59 @@ func (t *Tracker) UpdateProgress(id string, downloaded int64) {
 	progress.Downloaded = downloaded
 	progress.LastUpdate = now
 
-	if progress.TotalBytes > 0 && progress.Speed > 0 {
+	if progress.Indeterminate() {
+		progress.spinner++
+	} else if progress.Speed > 0 {
 		remaining := progress.TotalBytes - progress.Downloaded
 		progress.ETA = time.Duration(float64(remaining)/progress.Speed) * time.Second
 	}
 
-	if progress.ProgressBar != nil {
-		progress.ProgressBar.Set64(downloaded)
+	if t.renderer == nil {
+		if progress.ProgressBar != nil {
+			progress.ProgressBar.Set64(downloaded)
+		} else if t.showProgress && now.Sub(progress.lastLine) >= interval {
+			progress.lastLine = now
+			t.writeLine(progress)
+		}
+		progress.mu.Unlock()
+		return
+	}
+
+	// The header sums up every download, so it's built once this one's
+	// lock is released
+	line := formatBar(progress)
+	progress.mu.Unlock()
+
+	t.mu.RLock()
+	header := t.headerLine()
+	t.mu.RUnlock()
+
+	t.renderer.setHeader(header)
+	t.renderer.update(id, line)
+}
+
+// writeLine writes a single percentage line for non-TTY writers, with the
+// speed and ETA while the download is running.
+// The caller must hold progress.mu.
+func (t *Tracker) writeLine(progress *DownloadProgress) {
+	line := fmt.Sprintf("%s: %s", progress.Filename, formatBytes(progress.Downloaded))
+	if progress.TotalBytes > 0 {
+		percentage := float64(progress.Downloaded) / float64(progress.TotalBytes) * 100
+		line = fmt.Sprintf("%s: %.1f%% (%s / %s)",
+			progress.Filename,
+			percentage,
+			formatBytes(progress.Downloaded),
+			formatBytes(progress.TotalBytes))
+	}
+
+	if progress.Status == StatusRunning && progress.Speed > 0 {
+		line += fmt.Sprintf(", %s/s", formatBytes(int64(progress.Speed)))
+		if progress.TotalBytes > 0 {
+			line += fmt.Sprintf(", ETA %s", progress.ETA.Round(time.Second))
+		}
 	}
+
+	fmt.Fprintln(t.writer, line)
 }
 
 func (t *Tracker) UpdateChunkProgress(downloadID string, chunkID int, downloaded int64) {
@@ -244,18 +434,33 @@ func (t *Tracker) CompleteDownload(id string) {
 	}
 
 	progress.Status = StatusCompleted
-	progress.Downloaded = progress.TotalBytes
+	if !progress.Indeterminate() {
+		progress.Downloaded = progress.TotalBytes
+	}
 
-	if progress.ProgressBar != nil {
+	if t.renderer != nil {
+		t.renderer.setHeader(t.headerLine())
+		progress.mu.Lock()
+		t.renderer.finish(id, formatBar(progress))
+		progress.mu.Unlock()
+	} else if progress.ProgressBar != nil {
 		progress.ProgressBar.Finish()
+	} else if t.showProgress {
+		progress.mu.Lock()
+		t.writeLine(progress)
+		progress.mu.Unlock()
+	}
+
+	if !t.showProgress {
+		return
 	}
 
 	duration := time.Since(progress.StartTime)
-	avgSpeed := float64(progress.TotalBytes) / duration.Seconds()
+	avgSpeed := float64(progress.Downloaded) / duration.Seconds()
 
 	t.logger.Infof("Completed: %s (%s in %v, avg speed: %s/s)",
 		progress.Filename,
-		formatBytes(progress.TotalBytes),
+		formatBytes(progress.Downloaded),
 		duration.Round(time.Second),
 		formatBytes(int64(avgSpeed)))
 }
@@ -272,28 +477,162 @@ func (t *Tracker) FailDownload(id string, err error) {
 	progress.Status = StatusFailed
 	progress.Error = err
 
-	if progress.ProgressBar != nil {
+	if t.renderer != nil {
+		t.renderer.setHeader(t.headerLine())
+		progress.mu.Lock()
+		t.renderer.finish(id, formatBar(progress)+" failed")
+		progress.mu.Unlock()
+	} else if progress.ProgressBar != nil {
 		progress.ProgressBar.Finish()
 	}
 
-	t.logger.Errorf("Failed: %s - %v", progress.Filename, err)
+	if t.showProgress {
+		t.logger.Errorf("Failed: %s - %v", progress.Filename, err)
+	}
 }
 
+// GetProgress returns a snapshot of download id, which the download's
+// later updates don't change, so it can be read without locking
 func (t *Tracker) GetProgress(id string) (*DownloadProgress, bool) {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
 	progress, exists := t.downloads[id]
-	return progress, exists
+	if !exists {
+		return nil, false
+	}
+	return progress.snapshot(), true
+}
+
+// snapshot copies the exported fields of p under its lock. Chunks aren't
+// copied, GetChunkStates returns those.
+func (p *DownloadProgress) snapshot() *DownloadProgress {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return &DownloadProgress{
+		ID:          p.ID,
+		Filename:    p.Filename,
+		TotalBytes:  p.TotalBytes,
+		Downloaded:  p.Downloaded,
+		StartTime:   p.StartTime,
+		LastUpdate:  p.LastUpdate,
+		Speed:       p.Speed,
+		ETA:         p.ETA,
+		Status:      p.Status,
+		Error:       p.Error,
+		ProgressBar: p.ProgressBar,
+	}
+}
+
+// GetChunkStates returns a copy of the chunks of download id ordered by
+// chunk ID, for showing which are pending, downloading or complete. It's
+// empty for unknown downloads and downloads that aren't split into chunks.
+func (t *Tracker) GetChunkStates(id string) []ChunkProgress {
+	t.mu.RLock()
+	progress, exists := t.downloads[id]
+	t.mu.RUnlock()
+
+	if !exists {
+		return nil
+	}
+
+	progress.chunksMu.RLock()
+	defer progress.chunksMu.RUnlock()
+
+	states := make([]ChunkProgress, 0, len(progress.chunks))
+	for _, chunk := range progress.chunks {
+		states = append(states, *chunk)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].ID < states[j].ID
+	})
+	return states
+}
+
+// ActiveTotals sums downloaded and total bytes across all running downloads
+func (t *Tracker) ActiveTotals() (downloaded, total int64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, progress := range t.downloads {
+		progress.mu.RLock()
+		if progress.Status == StatusRunning {
+			downloaded += progress.Downloaded
+			total += progress.TotalBytes
+		}
+		progress.mu.RUnlock()
+	}
+
+	return downloaded, total
+}
+
+// AggregateStatus sums up the running downloads as if they were one:
+// downloaded and total bytes, combined speed in bytes per second, and the
+// time left at that speed. Downloads of unknown size add to downloaded and
+// speed but not to total, and the ETA covers only the bytes known to remain.
+func (t *Tracker) AggregateStatus() (downloaded, total int64, speed float64, eta time.Duration) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	status := t.aggregate()
+	return status.downloaded, status.total, status.speed, status.eta
+}
+
+// aggregateStatus is what AggregateStatus reports, plus how many downloads
+// it covers
+type aggregateStatus struct {
+	running    int
+	downloaded int64
+	total      int64
+	speed      float64
+	eta        time.Duration
 }
 
+// aggregate sums up the running downloads. The caller must hold t.mu but
+// none of the downloads' locks.
+func (t *Tracker) aggregate() aggregateStatus {
+	var status aggregateStatus
+	var remaining int64
+	for _, progress := range t.downloads {
+		progress.mu.RLock()
+		if progress.Status == StatusRunning {
+			status.running++
+			status.downloaded += progress.Downloaded
+			status.speed += progress.Speed
+			if !progress.Indeterminate() {
+				status.total += progress.TotalBytes
+				remaining += max(progress.TotalBytes-progress.Downloaded, 0)
+			}
+		}
+		progress.mu.RUnlock()
+	}
+
+	if status.speed > 0 {
+		status.eta = time.Duration(float64(remaining) / status.speed * float64(time.Second))
+	}
+	return status
+}
+
+// headerLine renders the aggregate of the running downloads for the top of
+// the bars, or "" when fewer than two are running. The caller must hold
+// t.mu but none of the downloads' locks.
+func (t *Tracker) headerLine() string {
+	status := t.aggregate()
+	if status.running < 2 {
+		return ""
+	}
+	return formatHeader(status)
+}
+
+// GetAllProgress returns a snapshot of every tracked download, like GetProgress
 func (t *Tracker) GetAllProgress() map[string]*DownloadProgress {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
 	result := make(map[string]*DownloadProgress)
 	for id, progress := range t.downloads {
-		result[id] = progress
+		result[id] = progress.snapshot()
 	}
 	return result
 }
@@ -303,10 +642,14 @@ func (t *Tracker) RemoveDownload(id string) {
 	defer t.mu.Unlock()
 
 	if progress, exists := t.downloads[id]; exists {
+		delete(t.downloads, id)
+		if t.renderer != nil {
+			t.renderer.setHeader(t.headerLine())
+			t.renderer.remove(id)
+		}
 		if progress.ProgressBar != nil {
 			progress.ProgressBar.Finish()
 		}
-		delete(t.downloads, id)
 	}
 }
 
@@ -0,0 +1,523 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNewTrackerWithWriter(t *testing.T) {
+	var buf bytes.Buffer
+	tracker := NewTrackerWithWriter(logrus.New(), &buf)
+
+	if tracker.writer != &buf {
+		t.Error("Expected tracker to render to the supplied writer")
+	}
+	if tracker.isTTY {
+		t.Error("Expected a bytes.Buffer not to be detected as a TTY")
+	}
+}
+
+func TestTracker_WriterProgressLines(t *testing.T) {
+	var buf bytes.Buffer
+	tracker := NewTrackerWithWriter(logrus.New(), &buf)
+	tracker.SetLineInterval(0)
+
+	progress := tracker.StartDownload("dl-1", "file.bin", 1000)
+	if progress.ProgressBar != nil {
+		t.Error("Expected no progress bar for a non-TTY writer")
+	}
+
+	tracker.UpdateProgress("dl-1", 500)
+	tracker.CompleteDownload("dl-1")
+
+	output := buf.String()
+	if !strings.Contains(output, "file.bin: 50.0%") {
+		t.Errorf("Expected a 50%% progress line, got: %q", output)
+	}
+	if !strings.Contains(output, "file.bin: 100.0%") {
+		t.Errorf("Expected a 100%% progress line, got: %q", output)
+	}
+}
+
+func TestTracker_WriterLinesAreThrottled(t *testing.T) {
+	var buf bytes.Buffer
+	tracker := NewTrackerWithWriter(logrus.New(), &buf)
+
+	tracker.StartDownload("dl-1", "file.bin", 1000)
+	for i := int64(1); i <= 100; i++ {
+		tracker.UpdateProgress("dl-1", i*10)
+	}
+
+	lines := strings.Count(buf.String(), "\n")
+	if lines > 1 {
+		t.Errorf("Expected at most one line within the default interval, got %d", lines)
+	}
+}
+
+// screen is a minimal terminal that understands the cursor movement the
+// line renderer emits, so tests can check what a user would actually see
+type screen struct {
+	lines []string
+	row   int
+}
+
+func (s *screen) Write(p []byte) (int, error) {
+	data := string(p)
+	for len(data) > 0 {
+		switch {
+		case strings.HasPrefix(data, "\x1b[2K"):
+			s.set("")
+			data = data[len("\x1b[2K"):]
+		case strings.HasPrefix(data, "\x1b["):
+			end := strings.IndexByte(data, 'A')
+			n, err := strconv.Atoi(data[2:end])
+			if err != nil {
+				return 0, err
+			}
+			s.row -= n
+			data = data[end+1:]
+		case data[0] == '\r':
+			data = data[1:]
+		case data[0] == '\n':
+			s.row++
+			data = data[1:]
+		default:
+			end := strings.IndexAny(data, "\r\n\x1b")
+			if end < 0 {
+				end = len(data)
+			}
+			s.set(s.get() + data[:end])
+			data = data[end:]
+		}
+	}
+	return len(p), nil
+}
+
+func (s *screen) get() string {
+	if s.row < len(s.lines) {
+		return s.lines[s.row]
+	}
+	return ""
+}
+
+func (s *screen) set(line string) {
+	for len(s.lines) <= s.row {
+		s.lines = append(s.lines, "")
+	}
+	s.lines[s.row] = line
+}
+
+func TestTracker_MultiBarRenderer(t *testing.T) {
+	var term screen
+	var writes []string
+	writer := writerFunc(func(p []byte) (int, error) {
+		writes = append(writes, string(p))
+		return term.Write(p)
+	})
+
+	tracker := NewTracker(logrus.New(), false)
+	tracker.writer = writer
+	tracker.isTTY = true
+	tracker.renderer = newLineRenderer(writer, 0)
+
+	files := []string{"alpha.bin", "beta.bin", "gamma.bin"}
+	for i, name := range files {
+		tracker.StartDownload(fmt.Sprintf("dl-%d", i), name, 1000)
+	}
+
+	var wg sync.WaitGroup
+	for i := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprintf("dl-%d", i)
+			for downloaded := int64(100); downloaded <= 1000; downloaded += 100 {
+				tracker.UpdateProgress(id, downloaded)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Mid-download a header sums up the batch and every bar owns exactly
+	// one line below it, in start order
+	if len(term.lines) != len(files)+1 {
+		t.Fatalf("screen has %d lines, want %d: %q", len(term.lines), len(files)+1, term.lines)
+	}
+	if !strings.HasPrefix(term.lines[0], "3 downloads: 100.0%") {
+		t.Errorf("line 0 = %q, want the header for 3 downloads", term.lines[0])
+	}
+	for i, name := range files {
+		line := term.lines[i+1]
+		if !strings.HasPrefix(line, name+" [") {
+			t.Errorf("line %d = %q, want the bar for %s", i+1, line, name)
+		}
+		if !strings.Contains(line, "100.0%") {
+			t.Errorf("line %d = %q, want it at 100%%", i+1, line)
+		}
+	}
+
+	tracker.CompleteDownload("dl-1")
+	tracker.FailDownload("dl-2", fmt.Errorf("boom"))
+	tracker.RemoveDownload("dl-0")
+
+	// Finished bars stay on screen where they were printed, nothing is left
+	// over, and the header goes once a single download is left
+	want := []string{"beta.bin [", "gamma.bin [", "", ""}
+	if len(term.lines) != len(want) {
+		t.Fatalf("screen has %d lines, want %d: %q", len(term.lines), len(want), term.lines)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(term.lines[i], prefix) || (prefix == "" && term.lines[i] != "") {
+			t.Errorf("line %d = %q, want prefix %q", i, term.lines[i], prefix)
+		}
+	}
+	if !strings.HasSuffix(term.lines[1], " failed") {
+		t.Errorf("line 1 = %q, want it marked as failed", term.lines[1])
+	}
+
+	// Each frame is written in one piece and redraws from the top
+	for _, w := range writes[1:] {
+		if !strings.HasPrefix(w, "\x1b[") {
+			t.Errorf("frame %q does not start by moving the cursor", w)
+		}
+	}
+}
+
+func TestTracker_LogLinesBetweenFrames(t *testing.T) {
+	var term screen
+	writer := writerFunc(term.Write)
+
+	logger := logrus.New()
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true, DisableColors: true})
+	tracker := NewTracker(logger, false)
+	tracker.writer = writer
+	tracker.isTTY = true
+	tracker.renderer = newLineRenderer(writer, 0)
+	logger.SetOutput(tracker.renderer)
+
+	tracker.StartDownload("dl-0", "alpha.bin", 1000)
+	tracker.StartDownload("dl-1", "beta.bin", 1000)
+	tracker.UpdateProgress("dl-0", 100)
+	logger.Warn("retrying chunk")
+	tracker.UpdateProgress("dl-1", 200)
+
+	// The log line stays above the frame, which still redraws over itself
+	want := []string{"level=warning msg=\"retrying chunk\"", "2 downloads:", "alpha.bin [", "beta.bin ["}
+	if len(term.lines) != len(want) {
+		t.Fatalf("screen has %d lines, want %d: %q", len(term.lines), len(want), term.lines)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(term.lines[i], prefix) {
+			t.Errorf("line %d = %q, want prefix %q", i, term.lines[i], prefix)
+		}
+	}
+
+	// A logger writing to the terminal with the bars is routed through the renderer
+	file, err := os.CreateTemp(t.TempDir(), "tty")
+	if err != nil {
+		t.Fatalf("CreateTemp() error = %v", err)
+	}
+	defer file.Close()
+	tracker = NewTracker(logrus.New(), false)
+	tracker.writer = file
+	tracker.renderer = newLineRenderer(file, 0)
+
+	routed := logrus.New()
+	routed.SetOutput(file)
+	tracker.SetLogger(routed)
+	if routed.Out != tracker.renderer {
+		t.Error("logger writing to the bars' terminal was not routed through the renderer")
+	}
+}
+
+func TestTracker_NonTTYHasNoRenderer(t *testing.T) {
+	var buf bytes.Buffer
+	tracker := NewTrackerWithWriter(logrus.New(), &buf)
+	tracker.SetLineInterval(0)
+
+	tracker.StartDownload("dl-1", "a.bin", 100)
+	tracker.StartDownload("dl-2", "b.bin", 100)
+	tracker.UpdateProgress("dl-1", 50)
+	tracker.UpdateProgress("dl-2", 50)
+
+	if tracker.renderer != nil {
+		t.Fatal("Expected no multi-bar renderer for a non-TTY writer")
+	}
+	if strings.Contains(buf.String(), "\x1b[") {
+		t.Errorf("Expected plain log lines without cursor movement, got: %q", buf.String())
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 {
+		t.Errorf("Expected one line per update, got %d: %q", lines, buf.String())
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Mode
+		wantErr bool
+	}{
+		{name: "bar", want: ModeBar},
+		{name: "Plain", want: ModePlain},
+		{name: " none ", want: ModeNone},
+		{name: "fancy", wantErr: true},
+		{name: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMode(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMode(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMode(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTrackerWithMode(t *testing.T) {
+	// simulate feeds a download through the tracker over a few line intervals
+	simulate := func(tracker *Tracker) {
+		tracker.SetLineInterval(20 * time.Millisecond)
+		tracker.StartDownload("dl-1", "file.bin", 1000)
+		for downloaded := int64(100); downloaded < 1000; downloaded += 100 {
+			time.Sleep(10 * time.Millisecond)
+			tracker.UpdateProgress("dl-1", downloaded)
+		}
+		tracker.CompleteDownload("dl-1")
+	}
+
+	t.Run("plain writes periodic lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		simulate(NewTrackerWithMode(logrus.New(), &buf, ModePlain))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) < 3 {
+			t.Fatalf("got %d lines, want several periodic ones: %q", len(lines), buf.String())
+		}
+		for _, line := range lines[:len(lines)-1] {
+			if !strings.HasPrefix(line, "file.bin: ") || !strings.Contains(line, "/s, ETA ") {
+				t.Errorf("line %q, want percentage, speed and ETA", line)
+			}
+		}
+		if last := lines[len(lines)-1]; last != "file.bin: 100.0% (1000 B / 1000 B)" {
+			t.Errorf("last line = %q, want the completed download", last)
+		}
+		if strings.Contains(buf.String(), "\x1b[") {
+			t.Errorf("plain mode moved the cursor: %q", buf.String())
+		}
+	})
+
+	t.Run("none writes nothing", func(t *testing.T) {
+		var buf bytes.Buffer
+		simulate(NewTrackerWithMode(logrus.New(), &buf, ModeNone))
+
+		if buf.Len() != 0 {
+			t.Errorf("none mode wrote %q, want nothing", buf.String())
+		}
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestTracker_IndeterminateProgress(t *testing.T) {
+	tests := []struct {
+		name              string
+		totalBytes        int64
+		wantIndeterminate bool
+		wantBarMax        int64
+	}{
+		{name: "unknown size", totalBytes: 0, wantIndeterminate: true, wantBarMax: -1},
+		{name: "known size", totalBytes: 4096, wantIndeterminate: false, wantBarMax: 4096},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(logrus.New(), true)
+			progress := tracker.StartDownload("dl", "file.bin", tt.totalBytes)
+			defer tracker.RemoveDownload("dl")
+
+			if progress.Indeterminate() != tt.wantIndeterminate {
+				t.Errorf("Indeterminate() = %v, want %v", progress.Indeterminate(), tt.wantIndeterminate)
+			}
+			if got := progress.ProgressBar.State().Max; got != tt.wantBarMax {
+				t.Errorf("progress bar max = %d, want %d", got, tt.wantBarMax)
+			}
+
+			tracker.UpdateProgress("dl", 2048)
+			line := formatBar(progress)
+			if tt.wantIndeterminate {
+				if strings.Contains(line, "%") || strings.Contains(line, "[") {
+					t.Errorf("formatBar() = %q, want a counter without a percentage bar", line)
+				}
+				if !strings.Contains(line, "2.0 KB") || !strings.ContainsAny(line, strings.Join(spinnerFrames, "")) {
+					t.Errorf("formatBar() = %q, want a spinner and the bytes so far", line)
+				}
+			} else if !strings.Contains(line, "50.0%") {
+				t.Errorf("formatBar() = %q, want a percentage", line)
+			}
+		})
+	}
+}
+
+func TestTracker_IndeterminateSpinnerAdvances(t *testing.T) {
+	tracker := NewTracker(logrus.New(), false)
+	progress := tracker.StartDownload("dl", "stream.bin", 0)
+
+	frames := make(map[string]bool)
+	for downloaded := int64(1); downloaded <= int64(len(spinnerFrames)); downloaded++ {
+		tracker.UpdateProgress("dl", downloaded*1024)
+		frames[formatBar(progress)[:len("stream.bin ")+1]] = true
+	}
+	if len(frames) != len(spinnerFrames) {
+		t.Errorf("saw %d spinner frames over %d updates, want one per update", len(frames), len(spinnerFrames))
+	}
+
+	// Finishing keeps the byte count instead of resetting it to the unknown total
+	tracker.CompleteDownload("dl")
+	if progress.Downloaded != 4*1024 {
+		t.Errorf("Downloaded after completion = %d, want %d", progress.Downloaded, 4*1024)
+	}
+	if line := formatBar(progress); !strings.HasPrefix(line, "stream.bin 4.0 KB ") {
+		t.Errorf("formatBar() after completion = %q, want the final count without a spinner", line)
+	}
+}
+
+func TestTracker_AggregateStatus(t *testing.T) {
+	tracker := NewTracker(logrus.New(), false)
+	tracker.downloads = map[string]*DownloadProgress{
+		"a":      {TotalBytes: 1000, Downloaded: 400, Speed: 100, Status: StatusRunning},
+		"b":      {TotalBytes: 3000, Downloaded: 1000, Speed: 200, Status: StatusRunning},
+		"stream": {TotalBytes: 0, Downloaded: 500, Speed: 100, Status: StatusRunning},
+		"done":   {TotalBytes: 5000, Downloaded: 5000, Speed: 900, Status: StatusCompleted},
+		"failed": {TotalBytes: 5000, Downloaded: 10, Speed: 50, Status: StatusFailed},
+	}
+
+	downloaded, total, speed, eta := tracker.AggregateStatus()
+
+	// Only running downloads count, the stream has no size to add
+	if downloaded != 1900 {
+		t.Errorf("downloaded = %d, want 1900", downloaded)
+	}
+	if total != 4000 {
+		t.Errorf("total = %d, want 4000", total)
+	}
+	if speed != 400 {
+		t.Errorf("speed = %v, want 400", speed)
+	}
+	// 600 + 2000 bytes left at 400 B/s
+	if want := 6500 * time.Millisecond; eta != want {
+		t.Errorf("eta = %v, want %v", eta, want)
+	}
+
+	wantHeader := "3 downloads:  47.5% 1.9 KB / 3.9 KB 400 B/s, ETA 7s"
+	tracker.mu.RLock()
+	header := tracker.headerLine()
+	tracker.mu.RUnlock()
+	if header != wantHeader {
+		t.Errorf("headerLine() = %q, want %q", header, wantHeader)
+	}
+}
+
+func TestTracker_AggregateStatus_Stalled(t *testing.T) {
+	tracker := NewTracker(logrus.New(), false)
+	tracker.downloads = map[string]*DownloadProgress{
+		"a": {TotalBytes: 1000, Downloaded: 400, Status: StatusRunning},
+	}
+
+	if _, _, speed, eta := tracker.AggregateStatus(); speed != 0 || eta != 0 {
+		t.Errorf("speed, eta = %v, %v, want no ETA without any speed", speed, eta)
+	}
+
+	tracker.mu.RLock()
+	defer tracker.mu.RUnlock()
+	if header := tracker.headerLine(); header != "" {
+		t.Errorf("headerLine() = %q, want no header for a single download", header)
+	}
+}
+
+func TestTracker_GetChunkStates(t *testing.T) {
+	tracker := NewTracker(logrus.New(), false)
+	tracker.StartDownload("file", "file.bin", 3000)
+	for id := 2; id >= 0; id-- {
+		tracker.AddChunk("file", id, int64(id)*1000, int64(id)*1000+999)
+	}
+	tracker.SetChunkStatus("file", 1, ChunkDownloading)
+	tracker.UpdateChunkProgress("file", 0, 1000)
+
+	states := tracker.GetChunkStates("file")
+	want := []ChunkStatus{ChunkCompleted, ChunkDownloading, ChunkPending}
+	if len(states) != len(want) {
+		t.Fatalf("got %d chunk states, want %d", len(states), len(want))
+	}
+	for i, state := range states {
+		if state.ID != i || state.Status != want[i] {
+			t.Errorf("states[%d] = chunk %d %v, want chunk %d %v", i, state.ID, state.Status, i, want[i])
+		}
+	}
+
+	// The states are copies, changing them leaves the tracker alone
+	states[2].Status = ChunkFailed
+	if again := tracker.GetChunkStates("file"); again[2].Status != ChunkPending {
+		t.Errorf("chunk 2 is %v after changing a copy, want Pending", again[2].Status)
+	}
+
+	if states := tracker.GetChunkStates("unknown"); states != nil {
+		t.Errorf("GetChunkStates() of an unknown download = %v, want none", states)
+	}
+}
+
+func TestTracker_GetProgressSnapshot(t *testing.T) {
+	tracker := NewTrackerWithWriter(logrus.New(), &bytes.Buffer{})
+	tracker.StartDownload("dl-1", "file.bin", 1000)
+	tracker.UpdateProgress("dl-1", 100)
+
+	snapshot, ok := tracker.GetProgress("dl-1")
+	if !ok {
+		t.Fatal("GetProgress() found nothing for a running download")
+	}
+
+	// Readers of a snapshot don't race with the download's updates
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := int64(1); i <= 100; i++ {
+			tracker.UpdateProgress("dl-1", 100+i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if p, ok := tracker.GetProgress("dl-1"); ok {
+				_ = p.Downloaded + int64(p.Status) + int64(p.Speed)
+			}
+			for _, p := range tracker.GetAllProgress() {
+				_ = p.Downloaded
+			}
+		}
+	}()
+	wg.Wait()
+
+	if snapshot.Downloaded != 100 || snapshot.Status != StatusRunning {
+		t.Errorf("snapshot = {%d, %v}, want it unchanged by later updates", snapshot.Downloaded, snapshot.Status)
+	}
+	if current, _ := tracker.GetProgress("dl-1"); current.Downloaded != 200 {
+		t.Errorf("GetProgress() Downloaded = %d, want the latest 200", current.Downloaded)
+	}
+	if _, ok := tracker.GetProgress("missing"); ok {
+		t.Error("GetProgress() found an unknown download")
+	}
+}
@@ -0,0 +1,205 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// renderThrottle is the minimum time between two redraws of the bars
+const renderThrottle = 65 * time.Millisecond
+
+// barWidth is the number of cells in each rendered bar
+const barWidth = 30
+
+// spinnerFrames animate the line of a download of unknown size, one frame per update
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// lineRenderer keeps one terminal line per running download and redraws all
+// of them together, so concurrent downloads never write over each other.
+// Finished downloads are printed once above the running ones and left there.
+type lineRenderer struct {
+	mu       sync.Mutex
+	writer   io.Writer
+	throttle time.Duration
+	header   string // Shown above the running lines when set
+	order    []string
+	lines    map[string]string
+	drawn    int
+	lastDraw time.Time
+}
+
+func newLineRenderer(writer io.Writer, throttle time.Duration) *lineRenderer {
+	return &lineRenderer{
+		writer:   writer,
+		throttle: throttle,
+		lines:    make(map[string]string),
+	}
+}
+
+// add reserves a line for id below the ones already shown
+func (r *lineRenderer) add(id, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.lines[id]; !exists {
+		r.order = append(r.order, id)
+	}
+	r.lines[id] = line
+	r.draw(nil)
+}
+
+// setHeader replaces the line shown above the running ones, "" hides it.
+// It's drawn with the next frame.
+func (r *lineRenderer) setHeader(header string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.header = header
+}
+
+// update replaces the line for id, redrawing at most once per throttle interval
+func (r *lineRenderer) update(id, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.lines[id]; !exists {
+		return
+	}
+	r.lines[id] = line
+	if time.Since(r.lastDraw) < r.throttle {
+		return
+	}
+	r.draw(nil)
+}
+
+// finish prints the final line for id above the running bars and releases its line
+func (r *lineRenderer) finish(id, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.release(id) {
+		return
+	}
+	r.draw([]string{line})
+}
+
+// remove releases the line for id without printing anything for it
+func (r *lineRenderer) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.release(id) {
+		return
+	}
+	r.draw(nil)
+}
+
+// Write prints p above the running lines like a finished download, so log
+// output that shares the terminal doesn't throw off the cursor movements of
+// the next frame. Without running lines p is written through as is.
+func (r *lineRenderer) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.drawn == 0 {
+		return r.writer.Write(p)
+	}
+	r.draw(strings.Split(strings.TrimSuffix(string(p), "\n"), "\n"))
+	return len(p), nil
+}
+
+// release drops id from the running lines. The caller must hold r.mu.
+func (r *lineRenderer) release(id string) bool {
+	if _, exists := r.lines[id]; !exists {
+		return false
+	}
+	delete(r.lines, id)
+	for i, existing := range r.order {
+		if existing == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// draw moves the cursor back over the previous frame, writes the permanent
+// lines followed by every running line, and clears whatever is left of the
+// old frame. The whole frame goes out in a single Write. The caller must
+// hold r.mu.
+func (r *lineRenderer) draw(permanent []string) {
+	var frame bytes.Buffer
+	if r.drawn > 0 {
+		fmt.Fprintf(&frame, "\x1b[%dA", r.drawn)
+	}
+
+	for _, line := range permanent {
+		fmt.Fprintf(&frame, "\r\x1b[2K%s\n", line)
+	}
+	running := len(r.order)
+	if r.header != "" && running > 0 {
+		fmt.Fprintf(&frame, "\r\x1b[2K%s\n", r.header)
+		running++
+	}
+	for _, id := range r.order {
+		fmt.Fprintf(&frame, "\r\x1b[2K%s\n", r.lines[id])
+	}
+
+	written := len(permanent) + running
+	if leftover := r.drawn - written; leftover > 0 {
+		frame.WriteString(strings.Repeat("\r\x1b[2K\n", leftover))
+		fmt.Fprintf(&frame, "\x1b[%dA", leftover)
+	}
+
+	r.writer.Write(frame.Bytes())
+	r.drawn = running
+	r.lastDraw = time.Now()
+}
+
+// formatBar renders one download as a single line. The caller must hold progress.mu.
+func formatBar(progress *DownloadProgress) string {
+	if progress.Indeterminate() {
+		counter := fmt.Sprintf("%s %s/s", formatBytes(progress.Downloaded), formatBytes(int64(progress.Speed)))
+		if progress.Status == StatusRunning {
+			counter = spinnerFrames[progress.spinner%len(spinnerFrames)] + " " + counter
+		}
+		return progress.Filename + " " + counter
+	}
+
+	fraction := float64(progress.Downloaded) / float64(progress.TotalBytes)
+	if fraction > 1 {
+		fraction = 1
+	}
+	filled := int(fraction * barWidth)
+
+	return fmt.Sprintf("%s [%s%s] %5.1f%% %s / %s %s/s",
+		progress.Filename,
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", barWidth-filled),
+		fraction*100,
+		formatBytes(progress.Downloaded),
+		formatBytes(progress.TotalBytes),
+		formatBytes(int64(progress.Speed)))
+}
+
+// formatHeader renders the aggregate of several running downloads as a
+// single line
+func formatHeader(status aggregateStatus) string {
+	line := fmt.Sprintf("%d downloads: %s", status.running, formatBytes(status.downloaded))
+	if status.total > 0 {
+		line = fmt.Sprintf("%d downloads: %5.1f%% %s / %s",
+			status.running,
+			min(float64(status.downloaded)/float64(status.total), 1)*100,
+			formatBytes(status.downloaded),
+			formatBytes(status.total))
+	}
+
+	line += fmt.Sprintf(" %s/s", formatBytes(int64(status.speed)))
+	if status.eta > 0 {
+		line += fmt.Sprintf(", ETA %s", status.eta.Round(time.Second))
+	}
+	return line
+}
@@ -0,0 +1,118 @@
+package direct
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// ServiceName is the name reported by the direct download service
+const ServiceName = "Direct"
+
+// Service downloads plain HTTP(S) links that no cloud provider service claims.
+// It accepts any http or https URL, so it should be registered last.
+type Service struct {
+	httpClient *utils.HTTPClient
+	logger     *logrus.Logger
+}
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithHTTPClient makes the service use the given HTTP client instead of its own
+func WithHTTPClient(client *utils.HTTPClient) Option {
+	return func(s *Service) {
+		if client != nil {
+			s.httpClient = client
+		}
+	}
+}
+
+func New(logger *logrus.Logger, opts ...Option) *Service {
+	if logger == nil {
+		logger = logrus.New()
+		logger.SetLevel(logrus.InfoLevel)
+	}
+
+	service := &Service{
+		httpClient: utils.NewHTTPClient(),
+		logger:     logger,
+	}
+
+	for _, opt := range opts {
+		opt(service)
+	}
+
+	return service
+}
+
+func (s *Service) IsSupported(rawURL string) bool {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	scheme := strings.ToLower(parsedURL.Scheme)
+	return (scheme == "http" || scheme == "https") && parsedURL.Host != ""
+}
+
+func (s *Service) GetServiceName() string {
+	return ServiceName
+}
+
+func (s *Service) ConvertURL(rawURL string) (string, error) {
+	if !s.IsSupported(rawURL) {
+		return "", fmt.Errorf("not a valid HTTP(S) URL: %s", rawURL)
+	}
+
+	// Direct links are already download links
+	return rawURL, nil
+}
+
+func (s *Service) GetFileInfo(ctx context.Context, rawURL string) (*interfaces.FileInfo, error) {
+	downloadURL, err := s.ConvertURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	httpFileInfo, err := s.httpClient.GetFileInfo(ctx, downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	fileInfo := &interfaces.FileInfo{
+		URL:           httpFileInfo.URL,
+		Filename:      httpFileInfo.Filename,
+		Size:          httpFileInfo.Size,
+		SizeKnown:     httpFileInfo.SizeKnown,
+		SupportsRange: httpFileInfo.SupportsRangeRequests,
+		ETag:          httpFileInfo.ETag,
+		ContentType:   httpFileInfo.ContentType,
+	}
+
+	if httpFileInfo.LastModified != nil {
+		fileInfo.LastModified = *httpFileInfo.LastModified
+	}
+
+	return fileInfo, nil
+}
+
+func (s *Service) PrepareDownload(ctx context.Context, rawURL string) (string, error) {
+	return s.ConvertURL(rawURL)
+}
+
+// DefaultDownloadOptions retries often and soon, plain links are mostly
+// served by CDNs where a dropped connection rarely means a lasting problem
+func (s *Service) DefaultDownloadOptions() *utils.DownloadOptions {
+	return &utils.DownloadOptions{
+		MaxRetries:    6,
+		RetryDelay:    time.Second,
+		MaxRetryAfter: 30 * time.Second,
+	}
+}
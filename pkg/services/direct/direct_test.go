@@ -0,0 +1,103 @@
+package direct
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+func TestNew(t *testing.T) {
+	service := New(nil)
+	if service == nil {
+		t.Fatal("New() returned nil")
+	}
+	if service.logger == nil {
+		t.Error("Service logger is nil")
+	}
+	if service.httpClient == nil {
+		t.Error("Service HTTP client is nil")
+	}
+
+	client := utils.NewHTTPClient()
+	service = New(nil, WithHTTPClient(client))
+	if service.httpClient != client {
+		t.Error("Expected service to use the injected HTTP client")
+	}
+}
+
+func TestService_GetServiceName(t *testing.T) {
+	service := New(nil)
+	if name := service.GetServiceName(); name != "Direct" {
+		t.Errorf("GetServiceName() = %s, want Direct", name)
+	}
+}
+
+func TestService_IsSupported(t *testing.T) {
+	service := New(nil)
+
+	tests := []struct {
+		name string
+		url  string
+		want bool
+	}{
+		{"https URL", "https://example.com/file.zip", true},
+		{"http URL", "http://example.com/a/b/file.txt", true},
+		{"uppercase scheme", "HTTPS://example.com/file.zip", true},
+		{"ftp URL", "ftp://example.com/file.zip", false},
+		{"no scheme", "example.com/file.zip", false},
+		{"no host", "https:///file.zip", false},
+		{"empty URL", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.IsSupported(tt.url); got != tt.want {
+				t.Errorf("IsSupported(%s) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_ConvertURL(t *testing.T) {
+	service := New(nil)
+
+	converted, err := service.ConvertURL("https://example.com/file.zip")
+	if err != nil {
+		t.Fatalf("ConvertURL failed: %v", err)
+	}
+	if converted != "https://example.com/file.zip" {
+		t.Errorf("ConvertURL() = %s, want the original URL", converted)
+	}
+
+	if _, err := service.ConvertURL("ftp://example.com/file.zip"); err == nil {
+		t.Error("Expected error for non-HTTP URL")
+	}
+}
+
+func TestService_GetFileInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4096")
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service := New(nil)
+	fileInfo, err := service.GetFileInfo(context.Background(), server.URL+"/files/archive.tar.gz")
+	if err != nil {
+		t.Fatalf("GetFileInfo failed: %v", err)
+	}
+
+	if fileInfo.Filename != "archive.tar.gz" {
+		t.Errorf("Filename = %s, want archive.tar.gz", fileInfo.Filename)
+	}
+	if fileInfo.Size != 4096 {
+		t.Errorf("Size = %d, want 4096", fileInfo.Size)
+	}
+	if !fileInfo.SupportsRange {
+		t.Error("Expected SupportsRange to be true")
+	}
+}
@@ -3,31 +3,90 @@ package dropbox
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 
 	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// maxRedirects bounds how many hops resolveRedirect follows
+const maxRedirects = 10
+
 type Service struct {
-	logger *logrus.Logger
+	httpClient *utils.HTTPClient
+	logger     *logrus.Logger
+	baseURL    string // Scheme and host dropbox.com share links are fetched from, empty for dropbox.com itself
+}
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithHTTPClient makes the service use the given HTTP client instead of its own
+func WithHTTPClient(client *utils.HTTPClient) Option {
+	return func(s *Service) {
+		if client != nil {
+			s.httpClient = client
+		}
+	}
 }
 
-func New(logger *logrus.Logger) *Service {
+// WithBaseURL fetches dropbox.com share links from baseURL instead, for
+// tests against a local server
+func WithBaseURL(baseURL string) Option {
+	return func(s *Service) {
+		s.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+func New(logger *logrus.Logger, opts ...Option) *Service {
 	if logger == nil {
 		logger = logrus.New()
 		logger.SetLevel(logrus.InfoLevel)
 	}
 
-	return &Service{
-		logger: logger,
+	service := &Service{
+		httpClient: utils.NewHTTPClient(),
+		logger:     logger,
+	}
+
+	for _, opt := range opts {
+		opt(service)
 	}
+
+	return service
 }
 
 func (s *Service) IsSupported(urlStr string) bool {
-	return strings.Contains(urlStr, "dropbox.com")
+	return strings.Contains(urlStr, "dropbox.com") || isShortLink(urlStr)
+}
+
+// isShortLink reports whether urlStr is a db.tt short link
+func isShortLink(urlStr string) bool {
+	parsed, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	return host == "db.tt" || host == "www.db.tt"
+}
+
+// isDropboxHost reports whether host is dropbox.com or one of its subdomains
+func isDropboxHost(host string) bool {
+	host = strings.ToLower(host)
+	return host == "dropbox.com" || strings.HasSuffix(host, ".dropbox.com")
+}
+
+// isDirectHost reports whether urlStr is on dl.dropbox.com, which serves files without a dl parameter
+func isDirectHost(urlStr string) bool {
+	parsed, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(parsed.Hostname(), "dl.dropbox.com")
 }
 
 func (s *Service) GetServiceName() string {
@@ -39,8 +98,20 @@ func (s *Service) ConvertURL(urlStr string) (string, error) {
 		return "", fmt.Errorf("not a valid Dropbox URL")
 	}
 
+	// Resolving a short link takes a request, which ConvertURLContext makes
+	// with the caller's context
+	if isShortLink(urlStr) {
+		return "", fmt.Errorf("db.tt short links have to be resolved before they can be converted, use ConvertURLContext")
+	}
+
+	// dl.dropbox.com links already point at the file
+	if isDirectHost(urlStr) && (strings.Contains(urlStr, "/s/") || strings.Contains(urlStr, "/scl/fi/")) {
+		return urlStr, nil
+	}
+
 	// Handle different Dropbox URL formats
 	if strings.Contains(urlStr, "/s/") || strings.Contains(urlStr, "/scl/fi/") {
+		urlStr = s.rebase(urlStr)
 		if strings.Contains(urlStr, "dl=0") {
 			return strings.Replace(urlStr, "dl=0", "dl=1", 1), nil
 		} else if strings.Contains(urlStr, "?") {
@@ -53,9 +124,31 @@ func (s *Service) ConvertURL(urlStr string) (string, error) {
 	return "", fmt.Errorf("unsupported Dropbox URL format")
 }
 
+// rebase moves a dropbox.com share link onto the base URL, if one is set
+func (s *Service) rebase(urlStr string) string {
+	if s.baseURL == "" {
+		return urlStr
+	}
+	parsed, err := url.Parse(urlStr)
+	if err != nil {
+		return urlStr
+	}
+	if host := strings.ToLower(parsed.Hostname()); host != "dropbox.com" && host != "www.dropbox.com" {
+		return urlStr
+	}
+	base, err := url.Parse(s.baseURL)
+	if err != nil {
+		return urlStr
+	}
+	parsed.Scheme, parsed.Host = base.Scheme, base.Host
+	return parsed.String()
+}
+
 func (s *Service) GetFileInfo(ctx context.Context, urlStr string) (*interfaces.FileInfo, error) {
-	// This would typically make an HTTP HEAD request to get file metadata
-	// For now, we'll return basic info - this should be implemented with actual HTTP calls
+	urlStr, err := s.canonicalURL(ctx, urlStr)
+	if err != nil {
+		return nil, err
+	}
 
 	downloadURL, err := s.ConvertURL(urlStr)
 	if err != nil {
@@ -63,23 +156,141 @@ func (s *Service) GetFileInfo(ctx context.Context, urlStr string) (*interfaces.F
 	}
 
 	filename := s.extractFilename(urlStr)
-	if filename == "" {
-		filename = "downloaded_file"
-	}
 
-	return &interfaces.FileInfo{
+	fileInfo := &interfaces.FileInfo{
 		URL:           downloadURL,
 		Filename:      filename,
-		Size:          0,    // Would be determined from HEAD request
+		Size:          0,    // Unknown until the final URL answers
 		SupportsRange: true, // Dropbox typically supports range requests
 		ContentType:   "application/octet-stream",
-	}, nil
+	}
+
+	// dl=1 links redirect to dl.dropboxusercontent.com, probe that URL directly
+	// so size and filename come from the host that actually serves the file
+	finalURL, err := s.resolveRedirect(ctx, downloadURL)
+	if err != nil {
+		utils.LoggerFromContext(ctx, s.logger).Warnf("Could not resolve Dropbox redirect: %v", err)
+		finalURL = downloadURL
+	} else if isPasswordPage(finalURL) {
+		// The unlock cookie lands in the shared jar, so the download that
+		// follows PrepareDownload is let through as well
+		finalURL, err = s.unlock(ctx, urlStr, downloadURL, finalURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	httpFileInfo, err := s.httpClient.GetFileInfo(ctx, finalURL, nil)
+	if err != nil {
+		utils.LoggerFromContext(ctx, s.logger).Warnf("Could not get Dropbox file info: %v", err)
+	} else {
+		fileInfo.Size = httpFileInfo.Size
+		fileInfo.SizeKnown = httpFileInfo.SizeKnown
+		fileInfo.SupportsRange = httpFileInfo.SupportsRangeRequests
+		fileInfo.ETag = httpFileInfo.ETag
+		if httpFileInfo.ContentType != "" {
+			fileInfo.ContentType = httpFileInfo.ContentType
+		}
+		if httpFileInfo.LastModified != nil {
+			fileInfo.LastModified = *httpFileInfo.LastModified
+		}
+		if fileInfo.Filename == "" {
+			fileInfo.Filename = httpFileInfo.Filename
+		}
+	}
+
+	if fileInfo.Filename == "" {
+		fileInfo.Filename = "downloaded_file"
+	}
+
+	return fileInfo, nil
+}
+
+// resolveRedirect follows the redirect chain of a Dropbox download URL and returns the final URL
+func (s *Service) resolveRedirect(ctx context.Context, downloadURL string) (string, error) {
+	currentURL := downloadURL
+	for i := 0; i < maxRedirects; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, currentURL, nil)
+		if err != nil {
+			return "", err
+		}
+
+		// Each hop is followed here, so the chain can be logged and checked
+		resp, err := s.httpClient.Do(req, false)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+			return currentURL, nil
+		}
+
+		location, err := resp.Location()
+		if err != nil {
+			return "", fmt.Errorf("redirect without a valid Location: %w", err)
+		}
+
+		utils.LoggerFromContext(ctx, s.logger).Debugf("Dropbox redirect: %s -> %s", currentURL, location)
+		currentURL = location.String()
+	}
+
+	return "", fmt.Errorf("stopped after %d redirects", maxRedirects)
 }
 
 func (s *Service) PrepareDownload(ctx context.Context, urlStr string) (string, error) {
+	return s.ConvertURLContext(ctx, urlStr)
+}
+
+// ConvertURLContext converts like ConvertURL, but first resolves db.tt short
+// links with a request made with ctx
+func (s *Service) ConvertURLContext(ctx context.Context, urlStr string) (string, error) {
+	urlStr, err := s.canonicalURL(ctx, urlStr)
+	if err != nil {
+		return "", err
+	}
 	return s.ConvertURL(urlStr)
 }
 
+// canonicalURL returns the dropbox.com share URL behind a db.tt short link,
+// other URLs are returned unchanged
+func (s *Service) canonicalURL(ctx context.Context, urlStr string) (string, error) {
+	if !isShortLink(urlStr) {
+		return urlStr, nil
+	}
+	return s.resolveShortLink(ctx, urlStr)
+}
+
+// resolveShortLink asks a short link where it redirects to without following
+// the redirect any further, and checks that it leads to a Dropbox share
+func (s *Service) resolveShortLink(ctx context.Context, shortURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, shortURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.httpClient.Do(req, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve Dropbox short link: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return "", fmt.Errorf("short link did not redirect (status %d)", resp.StatusCode)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("redirect without a valid Location: %w", err)
+	}
+	if !isDropboxHost(location.Hostname()) {
+		return "", fmt.Errorf("short link redirected to %s, not a Dropbox share", location.Host)
+	}
+
+	utils.LoggerFromContext(ctx, s.logger).Debugf("Dropbox short link: %s -> %s", shortURL, location)
+	return location.String(), nil
+}
+
 func (s *Service) extractFilename(urlStr string) string {
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
@@ -135,6 +346,7 @@ func (s *Service) ValidateURL(urlStr string) error {
 	validPatterns := []string{
 		`dropbox\.com/s/[a-zA-Z0-9]+/.*`,
 		`dropbox\.com/scl/fi/[a-zA-Z0-9]+/.*`,
+		`^https?://(www\.)?db\.tt/[a-zA-Z0-9]+$`,
 	}
 
 	urlString := strings.ToLower(urlStr)
@@ -2,8 +2,13 @@ package dropbox
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/milindmadhukar/cloudget/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
@@ -35,6 +40,19 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNew_WithHTTPClient(t *testing.T) {
+	client := utils.NewHTTPClient()
+	service := New(nil, WithHTTPClient(client))
+	if service.httpClient != client {
+		t.Error("Expected service to use the injected HTTP client")
+	}
+
+	service = New(nil)
+	if service.httpClient == nil {
+		t.Error("Expected a default HTTP client")
+	}
+}
+
 func TestService_GetServiceName(t *testing.T) {
 	service := New(nil)
 	name := service.GetServiceName()
@@ -66,11 +84,26 @@ func TestService_IsSupported(t *testing.T) {
 			url:  "https://dropbox.com/scl/fi/abc123/file.pdf?dl=0",
 			want: true,
 		},
+		{
+			name: "db.tt short link",
+			url:  "https://db.tt/AbCd1234",
+			want: true,
+		},
+		{
+			name: "dl.dropbox.com direct link",
+			url:  "https://dl.dropbox.com/s/abc123/file.pdf",
+			want: true,
+		},
 		{
 			name: "non-dropbox URL",
 			url:  "https://google.com/file.pdf",
 			want: false,
 		},
+		{
+			name: "db.tt in a path is not a short link",
+			url:  "https://example.com/db.tt/AbCd1234",
+			want: false,
+		},
 		{
 			name: "empty URL",
 			url:  "",
@@ -117,6 +150,16 @@ func TestService_ConvertURL(t *testing.T) {
 			url:      "https://dropbox.com/scl/fi/abc123/file.pdf?dl=0",
 			expected: "https://dropbox.com/scl/fi/abc123/file.pdf?dl=1",
 		},
+		{
+			name:     "dl.dropbox.com s link is already direct",
+			url:      "https://dl.dropbox.com/s/abc123/file.pdf",
+			expected: "https://dl.dropbox.com/s/abc123/file.pdf",
+		},
+		{
+			name:     "dl.dropbox.com scl link is already direct",
+			url:      "https://dl.dropbox.com/scl/fi/abc123/file.pdf?rlkey=xyz",
+			expected: "https://dl.dropbox.com/scl/fi/abc123/file.pdf?rlkey=xyz",
+		},
 		{
 			name:        "non-dropbox URL",
 			url:         "https://google.com/file.pdf",
@@ -202,7 +245,21 @@ func TestService_extractFilename(t *testing.T) {
 }
 
 func TestService_GetFileInfo(t *testing.T) {
-	service := New(nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/s/abc123/file.pdf":
+			http.Redirect(w, r, "/cd/0/get/file.pdf", http.StatusFound)
+		case "/cd/0/get/file.pdf":
+			w.Header().Set("Content-Length", "2048")
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	service := New(nil, WithBaseURL(server.URL))
 	ctx := context.Background()
 
 	tests := []struct {
@@ -251,6 +308,14 @@ func TestService_GetFileInfo(t *testing.T) {
 			if !fileInfo.SupportsRange {
 				t.Error("Expected SupportsRange to be true for Dropbox")
 			}
+
+			if !strings.HasPrefix(fileInfo.URL, server.URL+"/") {
+				t.Errorf("FileInfo.URL = %s, want it on the base URL", fileInfo.URL)
+			}
+
+			if fileInfo.Size != 2048 {
+				t.Errorf("FileInfo.Size = %d, want 2048 from the final URL", fileInfo.Size)
+			}
 		})
 	}
 }
@@ -292,6 +357,14 @@ func TestService_ValidateURL(t *testing.T) {
 			name: "valid dropbox URL with numbers",
 			url:  "https://dropbox.com/s/abc123def456/document.pdf?dl=0",
 		},
+		{
+			name: "valid db.tt short link",
+			url:  "https://db.tt/AbCd1234",
+		},
+		{
+			name: "valid dl.dropbox.com link",
+			url:  "https://dl.dropbox.com/s/abc123/file.pdf",
+		},
 		{
 			name:        "non-dropbox URL",
 			url:         "https://google.com/file.pdf",
@@ -336,3 +409,195 @@ func TestService_ValidateURL(t *testing.T) {
 		})
 	}
 }
+
+func TestService_resolveRedirect(t *testing.T) {
+	service := New(nil)
+	ctx := context.Background()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/s/abc123/file.pdf":
+			http.Redirect(w, r, "/redirect", http.StatusFound)
+		case "/redirect":
+			http.Redirect(w, r, server.URL+"/cd/0/get/file.pdf", http.StatusFound)
+		case "/cd/0/get/file.pdf":
+			w.Header().Set("Content-Length", "2048")
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.WriteHeader(http.StatusOK)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("follows chain to final URL", func(t *testing.T) {
+		finalURL, err := service.resolveRedirect(ctx, server.URL+"/s/abc123/file.pdf?dl=1")
+		if err != nil {
+			t.Fatalf("resolveRedirect failed: %v", err)
+		}
+
+		expected := server.URL + "/cd/0/get/file.pdf"
+		if finalURL != expected {
+			t.Errorf("resolveRedirect() = %s, want %s", finalURL, expected)
+		}
+
+		info, err := service.httpClient.GetFileInfo(ctx, finalURL, nil)
+		if err != nil {
+			t.Fatalf("GetFileInfo on final URL failed: %v", err)
+		}
+		if info.Size != 2048 {
+			t.Errorf("Expected size 2048 from final URL, got %d", info.Size)
+		}
+	})
+
+	t.Run("no redirect returns original URL", func(t *testing.T) {
+		finalURL, err := service.resolveRedirect(ctx, server.URL+"/cd/0/get/file.pdf")
+		if err != nil {
+			t.Fatalf("resolveRedirect failed: %v", err)
+		}
+		if finalURL != server.URL+"/cd/0/get/file.pdf" {
+			t.Errorf("Expected original URL, got %s", finalURL)
+		}
+	})
+
+	t.Run("goes through the injected client's transport", func(t *testing.T) {
+		client, err := utils.NewHTTPClientWithConfig(&utils.ClientConfig{
+			DNSOverride: map[string]string{"www.dropbox.com": server.Listener.Addr().String()},
+		})
+		if err != nil {
+			t.Fatalf("NewHTTPClientWithConfig failed: %v", err)
+		}
+		service := New(nil, WithHTTPClient(client))
+
+		finalURL, err := service.resolveRedirect(ctx, "http://www.dropbox.com/s/abc123/file.pdf?dl=1")
+		if err != nil {
+			t.Fatalf("resolveRedirect failed: %v", err)
+		}
+		if !strings.HasSuffix(finalURL, "/cd/0/get/file.pdf") {
+			t.Errorf("resolveRedirect() = %s, want the file URL behind the overridden host", finalURL)
+		}
+	})
+
+	t.Run("endless redirects give up", func(t *testing.T) {
+		if _, err := service.resolveRedirect(ctx, server.URL+"/loop"); err == nil {
+			t.Error("Expected error for endless redirects")
+		}
+	})
+}
+
+func TestService_resolveShortLink(t *testing.T) {
+	service := New(nil)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/AbCd1234":
+			http.Redirect(w, r, "https://www.dropbox.com/s/abc123/report.pdf?dl=0", http.StatusMovedPermanently)
+		case "/elsewhere":
+			http.Redirect(w, r, "https://example.com/phish", http.StatusFound)
+		case "/lookalike":
+			http.Redirect(w, r, "https://evildropbox.com/s/abc123/report.pdf", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("resolves to canonical share URL", func(t *testing.T) {
+		canonical, err := service.resolveShortLink(ctx, server.URL+"/AbCd1234")
+		if err != nil {
+			t.Fatalf("resolveShortLink failed: %v", err)
+		}
+
+		expected := "https://www.dropbox.com/s/abc123/report.pdf?dl=0"
+		if canonical != expected {
+			t.Errorf("resolveShortLink() = %s, want %s", canonical, expected)
+		}
+
+		converted, err := service.ConvertURL(canonical)
+		if err != nil {
+			t.Fatalf("ConvertURL on resolved link failed: %v", err)
+		}
+		if converted != "https://www.dropbox.com/s/abc123/report.pdf?dl=1" {
+			t.Errorf("ConvertURL() = %s, want the dl=1 share URL", converted)
+		}
+		if name := service.extractFilename(canonical); name != "report.pdf" {
+			t.Errorf("extractFilename() = %s, want report.pdf", name)
+		}
+	})
+
+	t.Run("redirect off Dropbox is rejected", func(t *testing.T) {
+		if _, err := service.resolveShortLink(ctx, server.URL+"/elsewhere"); err == nil {
+			t.Error("Expected error for a short link leaving Dropbox")
+		}
+	})
+
+	t.Run("redirect to a lookalike domain is rejected", func(t *testing.T) {
+		if _, err := service.resolveShortLink(ctx, server.URL+"/lookalike"); err == nil {
+			t.Error("Expected error for a short link leading to evildropbox.com")
+		}
+	})
+
+	t.Run("missing short link", func(t *testing.T) {
+		if _, err := service.resolveShortLink(ctx, server.URL+"/missing"); err == nil {
+			t.Error("Expected error for a short link that doesn't redirect")
+		}
+	})
+
+	t.Run("PrepareDownload resolves with the caller's context", func(t *testing.T) {
+		client, err := utils.NewHTTPClientWithConfig(&utils.ClientConfig{
+			DNSOverride: map[string]string{"db.tt": server.Listener.Addr().String()},
+		})
+		if err != nil {
+			t.Fatalf("NewHTTPClientWithConfig failed: %v", err)
+		}
+		service := New(nil, WithHTTPClient(client))
+
+		downloadURL, err := service.PrepareDownload(ctx, "http://db.tt/AbCd1234")
+		if err != nil {
+			t.Fatalf("PrepareDownload failed: %v", err)
+		}
+		if downloadURL != "https://www.dropbox.com/s/abc123/report.pdf?dl=1" {
+			t.Errorf("PrepareDownload() = %s, want the dl=1 share URL", downloadURL)
+		}
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := service.PrepareDownload(cancelled, "http://db.tt/AbCd1234"); !errors.Is(err, context.Canceled) {
+			t.Errorf("PrepareDownload() with a cancelled context error = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("ConvertURL doesn't resolve short links", func(t *testing.T) {
+		if _, err := service.ConvertURL("https://db.tt/AbCd1234"); err == nil {
+			t.Error("Expected error converting an unresolved short link")
+		}
+	})
+
+	t.Run("ConvertURLContext resolves short links", func(t *testing.T) {
+		client, err := utils.NewHTTPClientWithConfig(&utils.ClientConfig{
+			DNSOverride: map[string]string{"db.tt": server.Listener.Addr().String()},
+		})
+		if err != nil {
+			t.Fatalf("NewHTTPClientWithConfig failed: %v", err)
+		}
+		service := New(nil, WithHTTPClient(client))
+
+		// Every URL that IsSupported accepts converts with a context
+		for _, link := range []string{"http://db.tt/AbCd1234", "https://www.dropbox.com/s/abc123/report.pdf?dl=0"} {
+			if !service.IsSupported(link) {
+				t.Fatalf("IsSupported(%s) = false", link)
+			}
+			downloadURL, err := service.ConvertURLContext(ctx, link)
+			if err != nil {
+				t.Fatalf("ConvertURLContext(%s) failed: %v", link, err)
+			}
+			if downloadURL != "https://www.dropbox.com/s/abc123/report.pdf?dl=1" {
+				t.Errorf("ConvertURLContext(%s) = %s, want the dl=1 share URL", link, downloadURL)
+			}
+		}
+	})
+}
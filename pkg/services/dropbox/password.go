@@ -0,0 +1,120 @@
+package dropbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+const (
+	// passwordPagePath is where Dropbox sends visitors of a password-protected link
+	passwordPagePath = "/sm/password"
+	// unlockPath takes the password of a protected link and answers with a
+	// cookie that lets the link through
+	unlockPath = "/sm/auth"
+	// csrfCookie holds the token Dropbox expects back with the password form
+	csrfCookie = "t"
+)
+
+// isPasswordPage reports whether urlStr is the Dropbox page asking for a link's password
+func isPasswordPage(urlStr string) bool {
+	parsed, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(parsed.Path, passwordPagePath)
+}
+
+// unlock submits the password from ctx to the unlock form of the share link
+// that led to passwordPageURL, then resolves downloadURL again with the
+// cookie Dropbox answered with and returns where it leads
+func (s *Service) unlock(ctx context.Context, shareURL, downloadURL, passwordPageURL string) (string, error) {
+	password, ok := utils.LinkPasswordFromContext(ctx)
+	if !ok {
+		return "", passwordError(shareURL, "the link is password-protected, pass its password to download it")
+	}
+
+	page, err := url.Parse(passwordPageURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Dropbox password page: %w", err)
+	}
+	// The redirects that led here could have come from anywhere, only
+	// Dropbox itself gets the password
+	if !s.isUnlockHost(page) {
+		return "", passwordError(shareURL, fmt.Sprintf("the link asks for its password on %s://%s, which isn't Dropbox, so it wasn't sent", page.Scheme, page.Host))
+	}
+	authURL := &url.URL{Scheme: page.Scheme, Host: page.Host, Path: unlockPath}
+
+	jar := s.httpClient.CookieJar()
+	form := url.Values{
+		"url":      {shareURL},
+		"password": {password},
+	}
+	if jar != nil {
+		for _, cookie := range jar.Cookies(page) {
+			if cookie.Name == csrfCookie {
+				form.Set(csrfCookie, cookie.Value)
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, authURL.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to unlock Dropbox link: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		Status string `json:"status"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &answer) != nil || answer.Status != "authed" {
+		return "", passwordError(shareURL, "Dropbox rejected the link password")
+	}
+	utils.LoggerFromContext(ctx, s.logger).Debugf("Unlocked password-protected Dropbox link %s", shareURL)
+
+	finalURL, err := s.resolveRedirect(ctx, downloadURL)
+	if err != nil {
+		return "", err
+	}
+	if isPasswordPage(finalURL) {
+		return "", passwordError(shareURL, "Dropbox still asks for the link password after unlocking it")
+	}
+	return finalURL, nil
+}
+
+// isUnlockHost reports whether the password of a link may be sent to the
+// host of page: dropbox.com over https, or the base URL the service was
+// pointed at
+func (s *Service) isUnlockHost(page *url.URL) bool {
+	if page.Scheme == "https" && isDropboxHost(page.Hostname()) {
+		return true
+	}
+	if s.baseURL == "" {
+		return false
+	}
+	base, err := url.Parse(s.baseURL)
+	return err == nil && page.Scheme == base.Scheme && strings.EqualFold(page.Host, base.Host)
+}
+
+// passwordError reports a password-protected link that couldn't be opened
+func passwordError(shareURL, message string) error {
+	return &interfaces.DownloadError{
+		Type:    interfaces.ErrPermissionDenied.Type,
+		Message: message,
+		URL:     shareURL,
+	}
+}
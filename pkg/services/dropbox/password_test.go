@@ -0,0 +1,258 @@
+package dropbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
+)
+
+// newProtectedShareServer mimics a Dropbox share link protected by password:
+// the link sends visitors to the password page until the unlock form has set
+// the link cookie. With useTLS it serves https.
+func newProtectedShareServer(t *testing.T, password string, useTLS bool) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/s/abc123/file.pdf":
+			if cookie, err := r.Cookie("sm_auth"); err == nil && cookie.Value == "ok" {
+				http.Redirect(w, r, "/cd/0/get/file.pdf", http.StatusFound)
+				return
+			}
+			http.Redirect(w, r, passwordPagePath+"?cont="+r.URL.Path, http.StatusFound)
+		case passwordPagePath:
+			http.SetCookie(w, &http.Cookie{Name: csrfCookie, Value: "csrf-token", Path: "/"})
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html>This link is password protected</html>")
+		case unlockPath:
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			if err := r.ParseForm(); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if r.PostForm.Get(csrfCookie) != "csrf-token" || r.PostForm.Get("url") == "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if r.PostForm.Get("password") != password {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"status": "error"}`)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "sm_auth", Value: "ok", Path: "/"})
+			fmt.Fprint(w, `{"status": "authed"}`)
+		case "/cd/0/get/file.pdf":
+			w.Header().Set("Content-Length", "2048")
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	if useTLS {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestService_unlock(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		wantErr     bool
+		wantMessage string
+	}{
+		{
+			name:     "correct password",
+			password: "hunter2",
+		},
+		{
+			name:        "wrong password",
+			password:    "guess",
+			wantErr:     true,
+			wantMessage: "rejected",
+		},
+		{
+			name:        "no password",
+			wantErr:     true,
+			wantMessage: "password-protected",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newProtectedShareServer(t, "hunter2", false)
+			service := New(nil, WithHTTPClient(utils.NewHTTPClient()), WithBaseURL(server.URL))
+			ctx := utils.WithLinkPassword(context.Background(), tt.password)
+
+			shareURL := server.URL + "/s/abc123/file.pdf?dl=0"
+			downloadURL := server.URL + "/s/abc123/file.pdf?dl=1"
+
+			passwordPage, err := service.resolveRedirect(ctx, downloadURL)
+			if err != nil {
+				t.Fatalf("resolveRedirect failed: %v", err)
+			}
+			if !isPasswordPage(passwordPage) {
+				t.Fatalf("Expected the locked link to lead to the password page, got %s", passwordPage)
+			}
+
+			finalURL, err := service.unlock(ctx, shareURL, downloadURL, passwordPage)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				if !errors.Is(err, interfaces.ErrPermissionDenied) {
+					t.Errorf("Expected ErrPermissionDenied, got %v", err)
+				}
+				if !strings.Contains(err.Error(), tt.wantMessage) {
+					t.Errorf("Expected error to mention %q, got %v", tt.wantMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unlock failed: %v", err)
+			}
+
+			if finalURL != server.URL+"/cd/0/get/file.pdf" {
+				t.Errorf("unlock() = %s, want the file URL", finalURL)
+			}
+
+			// Downloads through the shared client carry the unlock cookie
+			info, err := service.httpClient.GetFileInfo(ctx, downloadURL, nil)
+			if err != nil {
+				t.Fatalf("GetFileInfo after unlocking failed: %v", err)
+			}
+			if info.Size != 2048 {
+				t.Errorf("Expected size 2048 after unlocking, got %d", info.Size)
+			}
+		})
+	}
+}
+
+func TestService_GetFileInfo_Password(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		wantErr     bool
+		wantMessage string
+	}{
+		{name: "correct password", password: "hunter2"},
+		{name: "wrong password", password: "guess", wantErr: true, wantMessage: "rejected"},
+		{name: "no password", wantErr: true, wantMessage: "password-protected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// www.dropbox.com is served by the test server, over https like the real one
+			server := newProtectedShareServer(t, "hunter2", true)
+			client, err := utils.NewHTTPClientWithConfig(&utils.ClientConfig{
+				InsecureSkipVerify: true,
+				DNSOverride:        map[string]string{"www.dropbox.com": server.Listener.Addr().String()},
+			})
+			if err != nil {
+				t.Fatalf("NewHTTPClientWithConfig failed: %v", err)
+			}
+			service := New(nil, WithHTTPClient(client))
+			ctx := utils.WithLinkPassword(context.Background(), tt.password)
+
+			info, err := service.GetFileInfo(ctx, "https://www.dropbox.com/s/abc123/file.pdf?dl=0")
+			if tt.wantErr {
+				if !errors.Is(err, interfaces.ErrPermissionDenied) {
+					t.Fatalf("GetFileInfo() error = %v, want ErrPermissionDenied", err)
+				}
+				if !strings.Contains(err.Error(), tt.wantMessage) {
+					t.Errorf("Expected error to mention %q, got %v", tt.wantMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetFileInfo failed: %v", err)
+			}
+			if info.Size != 2048 || info.Filename != "file.pdf" {
+				t.Errorf("GetFileInfo() = %s of %d bytes, want file.pdf of 2048 bytes", info.Filename, info.Size)
+			}
+		})
+	}
+}
+
+func TestService_GetFileInfo_PasswordPageOffDropbox(t *testing.T) {
+	var unlockAttempts atomic.Int32
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == unlockPath {
+			unlockAttempts.Add(1)
+		}
+		fmt.Fprint(w, `{"status": "authed"}`)
+	}))
+	defer elsewhere.Close()
+
+	share := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, elsewhere.URL+passwordPagePath, http.StatusFound)
+	}))
+	defer share.Close()
+
+	service := New(nil, WithHTTPClient(utils.NewHTTPClient()), WithBaseURL(share.URL))
+	ctx := utils.WithLinkPassword(context.Background(), "hunter2")
+
+	_, err := service.GetFileInfo(ctx, "https://www.dropbox.com/s/abc123/file.pdf?dl=0")
+	if !errors.Is(err, interfaces.ErrPermissionDenied) || !strings.Contains(err.Error(), "isn't Dropbox") {
+		t.Errorf("GetFileInfo() error = %v, want a refusal to send the password", err)
+	}
+	if n := unlockAttempts.Load(); n != 0 {
+		t.Errorf("the password was sent %d times to a host that isn't Dropbox", n)
+	}
+}
+
+func TestService_isUnlockHost(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		page    string
+		want    bool
+	}{
+		{page: "https://www.dropbox.com/sm/password", want: true},
+		{page: "https://dropbox.com/sm/password", want: true},
+		{page: "http://www.dropbox.com/sm/password", want: false},
+		{page: "https://evildropbox.com/sm/password", want: false},
+		{page: "https://dropbox.com.example.net/sm/password", want: false},
+		{baseURL: "http://127.0.0.1:8080", page: "http://127.0.0.1:8080/sm/password", want: true},
+		{baseURL: "http://127.0.0.1:8080", page: "http://127.0.0.1:9090/sm/password", want: false},
+	}
+
+	for _, tt := range tests {
+		service := New(nil, WithBaseURL(tt.baseURL))
+		page, _ := url.Parse(tt.page)
+		if got := service.isUnlockHost(page); got != tt.want {
+			t.Errorf("isUnlockHost(%q) with base URL %q = %v, want %v", tt.page, tt.baseURL, got, tt.want)
+		}
+	}
+}
+
+func TestIsPasswordPage(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://www.dropbox.com/sm/password?cont=/s/abc123/file.pdf", true},
+		{"https://www.dropbox.com/s/abc123/file.pdf?dl=1", false},
+		{"https://dl.dropboxusercontent.com/cd/0/get/file.pdf", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPasswordPage(tt.url); got != tt.want {
+			t.Errorf("isPasswordPage(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package gdrive
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+// editorURLRe matches the links of documents open in the Docs, Sheets and
+// Slides editors, which lead to the editor page rather than a file
+var editorURLRe = regexp.MustCompile(`^/(document|spreadsheets|presentation)/d/([a-zA-Z0-9_-]+)`)
+
+// exportFormats lists the formats each kind of editor document exports to
+var exportFormats = map[string][]string{
+	"document":     {"pdf", "docx", "odt", "rtf", "txt", "html", "epub"},
+	"spreadsheets": {"xlsx", "pdf", "ods", "csv", "tsv"},
+	"presentation": {"pdf", "pptx", "odp", "txt"},
+}
+
+// editorNames are how the error messages refer to each kind of document
+var editorNames = map[string]string{
+	"document":     "Google Docs document",
+	"spreadsheets": "Google Sheets spreadsheet",
+	"presentation": "Google Slides presentation",
+}
+
+// WithExportFormat exports Docs, Sheets and Slides editor links to format,
+// such as "pdf", "docx" or "xlsx", instead of refusing them
+func WithExportFormat(format string) Option {
+	return func(s *Service) {
+		s.exportFormat = strings.ToLower(strings.TrimSpace(format))
+	}
+}
+
+// editorDocument returns the kind and ID of the document behind a Docs,
+// Sheets or Slides editor link
+func editorDocument(rawURL string) (kind, id string, ok bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !strings.EqualFold(parsed.Hostname(), "docs.google.com") {
+		return "", "", false
+	}
+	matches := editorURLRe.FindStringSubmatch(parsed.Path)
+	if matches == nil {
+		return "", "", false
+	}
+	return matches[1], matches[2], true
+}
+
+// exportURL converts an editor link into the URL that exports its document
+// in the service's export format. Without a format, or with one the kind of
+// document can't be exported to, it explains that the link isn't a file.
+func (s *Service) exportURL(rawURL, kind, id string) (string, error) {
+	formats := exportFormats[kind]
+	if s.exportFormat == "" {
+		return "", &interfaces.DownloadError{
+			Type: interfaces.ErrUnsupportedURL.Type,
+			Message: fmt.Sprintf("link opens a %s in the editor, not a file; set an export format (%s) to download it",
+				editorNames[kind], strings.Join(formats, ", ")),
+			URL: rawURL,
+		}
+	}
+
+	for _, format := range formats {
+		if format == s.exportFormat {
+			return fmt.Sprintf("https://docs.google.com/%s/d/%s/export?format=%s", kind, id, format), nil
+		}
+	}
+	return "", &interfaces.DownloadError{
+		Type: interfaces.ErrUnsupportedURL.Type,
+		Message: fmt.Sprintf("a %s can't be exported as %s, only as %s",
+			editorNames[kind], s.exportFormat, strings.Join(formats, ", ")),
+		URL: rawURL,
+	}
+}
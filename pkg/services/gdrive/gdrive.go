@@ -3,26 +3,74 @@ package gdrive
 import (
 	"context"
 	"fmt"
+	"html"
+	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/milindmadhukar/cloudget/pkg/interfaces"
 	"github.com/milindmadhukar/cloudget/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultBaseURL is where files are downloaded from unless WithBaseURL overrides it
+const DefaultBaseURL = "https://drive.google.com"
+
 type Service struct {
-	httpClient *utils.HTTPClient
-	logger     *logrus.Logger
+	httpClient   *utils.HTTPClient
+	logger       *logrus.Logger
+	userAgents   *utils.UserAgentPool
+	baseURL      string
+	exportFormat string // Format editor links are exported to, "" refuses them
+}
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithHTTPClient makes the service use the given HTTP client instead of its own
+func WithHTTPClient(client *utils.HTTPClient) Option {
+	return func(s *Service) {
+		if client != nil {
+			s.httpClient = client
+		}
+	}
+}
+
+// WithUserAgentPool makes the service take the User-Agent of each request from pool
+func WithUserAgentPool(pool *utils.UserAgentPool) Option {
+	return func(s *Service) {
+		s.userAgents = pool
+	}
+}
+
+// WithBaseURL downloads from baseURL instead of DefaultBaseURL, for mirrors
+// behind a proxy or mock servers in tests. Share links are still recognised
+// by their drive.google.com and docs.google.com hosts.
+func WithBaseURL(baseURL string) Option {
+	return func(s *Service) {
+		if baseURL != "" {
+			s.baseURL = strings.TrimRight(baseURL, "/")
+		}
+	}
 }
 
-func New() *Service {
-	return &Service{
+func New(opts ...Option) *Service {
+	service := &Service{
 		httpClient: utils.NewHTTPClient(),
 		logger:     logrus.New(),
+		baseURL:    DefaultBaseURL,
+	}
+
+	for _, opt := range opts {
+		opt(service)
 	}
+
+	return service
 }
 
 func (s *Service) IsSupported(rawURL string) bool {
@@ -39,13 +87,18 @@ func (s *Service) ConvertURL(rawURL string) (string, error) {
 		return "", fmt.Errorf("not a valid Google Drive URL: %s", rawURL)
 	}
 
+	// Editor links lead to the editor, their documents only download as exports
+	if kind, id, ok := editorDocument(rawURL); ok {
+		return s.exportURL(rawURL, kind, id)
+	}
+
 	fileID, err := s.extractFileID(rawURL)
 	if err != nil {
 		return "", fmt.Errorf("could not extract file ID from Google Drive URL: %w", err)
 	}
 
 	// For large files, Google Drive requires additional parameters
-	return fmt.Sprintf("https://drive.google.com/uc?export=download&id=%s&confirm=t", fileID), nil
+	return fmt.Sprintf("%s/uc?export=download&id=%s&confirm=t", s.baseURL, fileID), nil
 }
 
 func (s *Service) extractFileID(rawURL string) (string, error) {
@@ -82,12 +135,12 @@ func (s *Service) GetFileInfo(ctx context.Context, rawURL string) (*interfaces.F
 		return nil, err
 	}
 
-	s.logger.Infof("Getting file info for Google Drive URL: %s", downloadURL)
+	utils.LoggerFromContext(ctx, s.logger).Infof("Getting file info for Google Drive URL: %s", downloadURL)
 
 	// Check if we need to handle virus scan redirect
-	finalURL, err := s.handleVirusScanRedirect(downloadURL)
+	finalURL, err := s.handleVirusScanRedirect(ctx, downloadURL)
 	if err != nil {
-		s.logger.Warnf("Could not handle virus scan redirect: %v", err)
+		utils.LoggerFromContext(ctx, s.logger).Warnf("Could not handle virus scan redirect: %v", err)
 		finalURL = downloadURL
 	}
 
@@ -103,13 +156,31 @@ func (s *Service) GetFileInfo(ctx context.Context, rawURL string) (*interfaces.F
 		Filename:      httpFileInfo.Filename,
 		Size:          httpFileInfo.Size,
 		SupportsRange: httpFileInfo.SupportsRangeRequests,
-		ContentType:   "", // Not available in utils.FileInfo
+		ETag:          httpFileInfo.ETag,
+		ContentType:   httpFileInfo.ContentType,
 	}
 
 	if httpFileInfo.LastModified != nil {
 		fileInfo.LastModified = *httpFileInfo.LastModified
 	}
 
+	// The HEAD often lacks a Content-Length once the virus scan interstitial
+	// is involved, so look at what a GET actually returns
+	if fileInfo.Size == 0 {
+		if page, err := s.probeDownload(ctx, finalURL); err != nil {
+			utils.LoggerFromContext(ctx, s.logger).Warnf("Could not determine file size: %v", err)
+		} else {
+			if page.SizeExact {
+				fileInfo.Size = page.Size
+			} else if page.Size > 0 {
+				utils.LoggerFromContext(ctx, s.logger).Infof("Google Drive reports a size of about %s", utils.FormatBytes(page.Size))
+			}
+			if fileInfo.Filename == "" {
+				fileInfo.Filename = page.Filename
+			}
+		}
+	}
+
 	// Google Drive might not provide a filename in the headers initially
 	// We'll try to extract it from Content-Disposition header or use a default
 	if fileInfo.Filename == "" {
@@ -126,24 +197,21 @@ func (s *Service) PrepareDownload(ctx context.Context, rawURL string) (string, e
 	}
 
 	// Check if we need to handle virus scan redirect
-	finalURL, err := s.handleVirusScanRedirect(downloadURL)
+	finalURL, err := s.handleVirusScanRedirect(ctx, downloadURL)
 	if err != nil {
-		s.logger.Warnf("Could not handle virus scan redirect: %v", err)
+		utils.LoggerFromContext(ctx, s.logger).Warnf("Could not handle virus scan redirect: %v", err)
 		finalURL = downloadURL
 	}
 
 	return finalURL, nil
 }
 
-func (s *Service) handleVirusScanRedirect(downloadURL string) (string, error) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Don't follow redirects automatically, we want to handle them
-			return http.ErrUseLastResponse
-		},
-	}
+// downloadWarningCookie prefixes the cookie Google Drive sets on the virus
+// scan warning for large files. Its value is the confirm token.
+const downloadWarningCookie = "download_warning"
 
-	req, err := http.NewRequest("GET", downloadURL, nil)
+func (s *Service) handleVirusScanRedirect(ctx context.Context, downloadURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
 	if err != nil {
 		return "", err
 	}
@@ -153,17 +221,33 @@ func (s *Service) handleVirusScanRedirect(downloadURL string) (string, error) {
 		req.Header.Set(key, value)
 	}
 
-	resp, err := client.Do(req)
+	// Don't follow redirects automatically, we want to handle them. The
+	// client's jar keeps the warning cookie for the download to send back.
+	resp, err := s.httpClient.Do(req, false)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
-	// Check if we're being redirected to accounts.google.com or virus scan page
-	if resp.StatusCode == http.StatusFound || resp.StatusCode == http.StatusMovedPermanently {
+	// Large files get a warning page along with a cookie holding the token
+	// that confirms the download
+	if token := downloadWarningToken(resp.Cookies()); token != "" {
+		return s.confirmURL(downloadURL, token), nil
+	}
+
+	// Check if we're being redirected to the file, accounts.google.com or virus scan page
+	if isRedirect(resp.StatusCode) {
 		location := resp.Header.Get("Location")
+
+		// Files past the virus scan are served from the content hosts, such
+		// a redirect already is the download URL
+		if target, err := resp.Request.URL.Parse(location); err == nil && isUserContentHost(target.Hostname()) {
+			return target.String(), nil
+		}
+
 		if strings.Contains(location, "accounts.google.com") ||
-			strings.Contains(location, "drive.google.com/uc") {
+			strings.Contains(location, "drive.google.com/uc") ||
+			strings.HasPrefix(location, s.baseURL+"/uc") {
 
 			// Try to extract the actual download URL from the redirect
 			parsedURL, err := url.Parse(location)
@@ -173,8 +257,7 @@ func (s *Service) handleVirusScanRedirect(downloadURL string) (string, error) {
 
 			// If there's a confirm parameter, use it
 			if confirm := parsedURL.Query().Get("confirm"); confirm != "" {
-				fileID, _ := s.extractFileID(downloadURL)
-				return fmt.Sprintf("https://drive.google.com/uc?export=download&confirm=%s&id=%s", confirm, fileID), nil
+				return s.confirmURL(downloadURL, confirm), nil
 			}
 		}
 	}
@@ -182,9 +265,133 @@ func (s *Service) handleVirusScanRedirect(downloadURL string) (string, error) {
 	return downloadURL, nil
 }
 
+// isRedirect reports whether status is an HTTP redirect with a Location
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// isUserContentHost reports whether host serves Google Drive file contents,
+// like drive.usercontent.google.com or doc-0s-8c-docs.googleusercontent.com
+func isUserContentHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range []string{"usercontent.google.com", "googleusercontent.com"} {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadWarningToken returns the confirm token from a download_warning
+// cookie, or "" if there's none
+func downloadWarningToken(cookies []*http.Cookie) string {
+	for _, cookie := range cookies {
+		if strings.HasPrefix(cookie.Name, downloadWarningCookie) && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// confirmURL builds the URL that downloads the file behind downloadURL past
+// the virus scan warning
+func (s *Service) confirmURL(downloadURL, token string) string {
+	fileID, _ := s.extractFileID(downloadURL)
+	return fmt.Sprintf("%s/uc?export=download&confirm=%s&id=%s", s.baseURL, url.QueryEscape(token), fileID)
+}
+
+// maxConfirmPageSize caps how much of an HTML response is read when looking
+// for the file size on the virus scan confirm page
+const maxConfirmPageSize = 1 << 20
+
+// confirmPage holds what could be learned about a file from a download GET
+type confirmPage struct {
+	Filename  string
+	Size      int64
+	SizeExact bool // False when Size comes from a rounded label like "(1.2G)"
+}
+
+var (
+	sizeBytesRe   = regexp.MustCompile(`["']?sizeBytes["']?\s*[:=]\s*["']?(\d+)`)
+	ucNameSizeRe  = regexp.MustCompile(`(?s)class="uc-name-size"[^>]*>\s*<a[^>]*>([^<]+)</a>\s*\(([\d.]+)\s*([KMGT]?)B?\)`)
+	sizeUnitPower = map[string]int{"": 0, "K": 1, "M": 2, "G": 3, "T": 4}
+)
+
+// probeDownload issues a GET for downloadURL and inspects the response
+// without downloading the file. A binary response yields its Content-Length,
+// an HTML confirm page is parsed for the size it advertises.
+func (s *Service) probeDownload(ctx context.Context, downloadURL string) (*confirmPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range s.getDefaultHeaders() {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.httpClient.Do(req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return &confirmPage{Size: resp.ContentLength, SizeExact: resp.ContentLength > 0}, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxConfirmPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read confirm page: %w", err)
+	}
+
+	return parseConfirmPage(string(body)), nil
+}
+
+// parseConfirmPage extracts the filename and size from Google Drive's
+// "can't scan this file for viruses" page. An exact sizeBytes value is
+// preferred over the human-readable label next to the filename.
+func parseConfirmPage(page string) *confirmPage {
+	result := &confirmPage{}
+
+	if matches := ucNameSizeRe.FindStringSubmatch(page); len(matches) > 3 {
+		result.Filename = html.UnescapeString(strings.TrimSpace(matches[1]))
+		if value, err := strconv.ParseFloat(matches[2], 64); err == nil {
+			result.Size = int64(value * math.Pow(1024, float64(sizeUnitPower[matches[3]])))
+		}
+	}
+
+	if matches := sizeBytesRe.FindStringSubmatch(page); len(matches) > 1 {
+		if size, err := strconv.ParseInt(matches[1], 10, 64); err == nil && size > 0 {
+			result.Size = size
+			result.SizeExact = true
+		}
+	}
+
+	return result
+}
+
+// DefaultDownloadOptions retries sparingly and waits long between attempts,
+// since Google Drive answers bursts of retries with more rate limiting
+func (s *Service) DefaultDownloadOptions() *utils.DownloadOptions {
+	return &utils.DownloadOptions{
+		MaxRetries:    2,
+		RetryDelay:    5 * time.Second,
+		MaxRetryAfter: 5 * time.Minute,
+	}
+}
+
 func (s *Service) getDefaultHeaders() map[string]string {
 	return map[string]string{
 		"Accept-Encoding": "identity",
-		"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
+		"User-Agent":      s.userAgents.Next(),
 	}
 }
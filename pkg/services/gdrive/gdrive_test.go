@@ -1,12 +1,17 @@
 package gdrive
 
 import (
+	"bytes"
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+	"github.com/milindmadhukar/cloudget/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -18,6 +23,15 @@ func TestNew(t *testing.T) {
 	assert.NotNil(t, service.logger)
 }
 
+func TestNew_WithHTTPClient(t *testing.T) {
+	client := utils.NewHTTPClient()
+	service := New(WithHTTPClient(client))
+	assert.Same(t, client, service.httpClient)
+
+	service = New(WithHTTPClient(nil))
+	assert.NotNil(t, service.httpClient)
+}
+
 func TestService_GetServiceName(t *testing.T) {
 	service := New()
 	assert.Equal(t, "Google Drive", service.GetServiceName())
@@ -172,10 +186,10 @@ func TestService_ConvertURL(t *testing.T) {
 			expectError: false,
 		},
 		{
-			name:        "Google Docs URL",
+			name:        "Google Docs editor URL without an export format",
 			url:         "https://docs.google.com/document/d/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms/edit",
-			expectedURL: "https://drive.google.com/uc?export=download&id=1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms&confirm=t",
-			expectError: false,
+			expectedURL: "",
+			expectError: true,
 		},
 		{
 			name:        "Unsupported URL",
@@ -234,7 +248,7 @@ func TestService_handleVirusScanRedirect(t *testing.T) {
 		}))
 		defer server.Close()
 
-		result, err := service.handleVirusScanRedirect(server.URL)
+		result, err := service.handleVirusScanRedirect(context.Background(), server.URL)
 		assert.NoError(t, err)
 		assert.Equal(t, server.URL, result)
 	})
@@ -247,7 +261,7 @@ func TestService_handleVirusScanRedirect(t *testing.T) {
 		}))
 		defer server.Close()
 
-		result, err := service.handleVirusScanRedirect(server.URL)
+		result, err := service.handleVirusScanRedirect(context.Background(), server.URL)
 		assert.NoError(t, err)
 		// Should return original URL when redirect doesn't contain file info
 		assert.Equal(t, server.URL, result)
@@ -263,14 +277,76 @@ func TestService_handleVirusScanRedirect(t *testing.T) {
 
 		// Use a URL with file ID that can be extracted
 		testURL := server.URL + "?id=1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms"
-		result, err := service.handleVirusScanRedirect(testURL)
+		result, err := service.handleVirusScanRedirect(context.Background(), testURL)
 		assert.NoError(t, err)
 		assert.Contains(t, result, "confirm=1234")
 		assert.Contains(t, result, "id=1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms")
 	})
 
+	t.Run("Redirect to a content host is the download URL", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			status   int
+			location string
+		}{
+			{
+				name:     "usercontent.google.com",
+				status:   http.StatusSeeOther,
+				location: "https://drive.usercontent.google.com/download?id=1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms&export=download&confirm=t&uuid=abc",
+			},
+			{
+				name:     "googleusercontent.com",
+				status:   http.StatusFound,
+				location: "https://doc-0s-8c-docs.googleusercontent.com/docs/securesc/ha0ro937gcuc7l7deffksulhg5h7mbp1/abc/1700000000000/1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms?e=download",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Location", tt.location)
+					w.WriteHeader(tt.status)
+				}))
+				defer server.Close()
+
+				result, err := service.handleVirusScanRedirect(context.Background(), server.URL+"?id=1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms")
+				assert.NoError(t, err)
+				assert.Equal(t, tt.location, result)
+			})
+		}
+	})
+
+	t.Run("Redirect to a lookalike host is not the download URL", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Location", "https://usercontent.google.com.example.net/download")
+			w.WriteHeader(http.StatusFound)
+		}))
+		defer server.Close()
+
+		result, err := service.handleVirusScanRedirect(context.Background(), server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, server.URL, result)
+	})
+
+	t.Run("Goes through the injected client's transport", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Location", "https://drive.usercontent.google.com/download?id=abc123")
+			w.WriteHeader(http.StatusSeeOther)
+		}))
+		defer server.Close()
+
+		client, err := utils.NewHTTPClientWithConfig(&utils.ClientConfig{
+			DNSOverride: map[string]string{"drive.google.com": server.Listener.Addr().String()},
+		})
+		require.NoError(t, err)
+
+		result, err := New(WithHTTPClient(client)).handleVirusScanRedirect(context.Background(), "http://drive.google.com/uc?id=abc123")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://drive.usercontent.google.com/download?id=abc123", result)
+	})
+
 	t.Run("Invalid URL", func(t *testing.T) {
-		result, err := service.handleVirusScanRedirect("://invalid-url")
+		result, err := service.handleVirusScanRedirect(context.Background(), "://invalid-url")
 		assert.Error(t, err)
 		assert.Equal(t, "", result)
 	})
@@ -429,3 +505,279 @@ func TestService_EdgeCases(t *testing.T) {
 		assert.NotEmpty(t, downloadURL)
 	})
 }
+
+func TestParseConfirmPage(t *testing.T) {
+	tests := []struct {
+		name          string
+		file          string
+		wantFilename  string
+		wantSize      int64
+		wantSizeExact bool
+	}{
+		{
+			name:          "human-readable size label",
+			file:          "confirm_page.html",
+			wantFilename:  "dataset_2024 & notes.tar.gz",
+			wantSize:      1503238553, // 1.4G
+			wantSizeExact: false,
+		},
+		{
+			name:          "exact sizeBytes field",
+			file:          "confirm_page_size_bytes.html",
+			wantFilename:  "dataset_2024 & notes.tar.gz",
+			wantSize:      1503238553,
+			wantSizeExact: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			require.NoError(t, err)
+
+			result := parseConfirmPage(string(page))
+			assert.Equal(t, tt.wantFilename, result.Filename)
+			assert.Equal(t, tt.wantSize, result.Size)
+			assert.Equal(t, tt.wantSizeExact, result.SizeExact)
+		})
+	}
+
+	t.Run("page without size", func(t *testing.T) {
+		result := parseConfirmPage("<html><body>Nothing to see</body></html>")
+		assert.Equal(t, int64(0), result.Size)
+		assert.Empty(t, result.Filename)
+	})
+}
+
+func TestService_probeDownload(t *testing.T) {
+	service := New()
+	confirmPage, err := os.ReadFile(filepath.Join("testdata", "confirm_page_size_bytes.html"))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/confirm":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(confirmPage)
+		case "/file":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Length", "2048")
+			w.Write(make([]byte, 2048))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("size from confirm page", func(t *testing.T) {
+		result, err := service.probeDownload(context.Background(), server.URL+"/confirm")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1503238553), result.Size)
+		assert.True(t, result.SizeExact)
+	})
+
+	t.Run("size from Content-Length of the GET", func(t *testing.T) {
+		result, err := service.probeDownload(context.Background(), server.URL+"/file")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2048), result.Size)
+		assert.True(t, result.SizeExact)
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		_, err := service.probeDownload(context.Background(), server.URL+"/missing")
+		assert.Error(t, err)
+	})
+
+	t.Run("goes through the injected client's transport", func(t *testing.T) {
+		client, err := utils.NewHTTPClientWithConfig(&utils.ClientConfig{
+			DNSOverride: map[string]string{"drive.google.com": server.Listener.Addr().String()},
+		})
+		require.NoError(t, err)
+
+		result, err := New(WithHTTPClient(client)).probeDownload(context.Background(), "http://drive.google.com/file")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2048), result.Size)
+	})
+}
+
+func TestService_UserAgentRotation(t *testing.T) {
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("User-Agent"))
+		w.Header().Set("Content-Length", "16")
+		w.Write(make([]byte, 16))
+	}))
+	defer server.Close()
+
+	probe := func(service *Service) []string {
+		seen = nil
+		for i := 0; i < 5; i++ {
+			_, err := service.probeDownload(context.Background(), server.URL)
+			require.NoError(t, err)
+		}
+		return seen
+	}
+
+	t.Run("rotation enabled", func(t *testing.T) {
+		agents := probe(New(WithUserAgentPool(utils.NewUserAgentPool(true))))
+		for i := 1; i < len(agents); i++ {
+			assert.NotEqual(t, agents[i-1], agents[i], "consecutive requests should use different User-Agents")
+		}
+	})
+
+	t.Run("rotation disabled", func(t *testing.T) {
+		for _, agent := range probe(New()) {
+			assert.Equal(t, utils.BrowserUserAgent, agent)
+		}
+	})
+}
+
+func TestService_WithBaseURL(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path+"?"+r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="mirrored.bin"`)
+		w.Header().Set("Content-Length", "32")
+		if r.Method == http.MethodGet {
+			w.Write(make([]byte, 32))
+		}
+	}))
+	defer server.Close()
+
+	service := New(WithBaseURL(server.URL + "/"))
+	shareURL := "https://drive.google.com/file/d/abc123/view"
+
+	converted, err := service.ConvertURL(shareURL)
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/uc?export=download&id=abc123&confirm=t", converted)
+
+	info, err := service.GetFileInfo(context.Background(), shareURL)
+	require.NoError(t, err)
+	assert.Equal(t, "mirrored.bin", info.Filename)
+	assert.Equal(t, int64(32), info.Size)
+
+	downloadURL, err := service.PrepareDownload(context.Background(), shareURL)
+	require.NoError(t, err)
+	assert.Equal(t, converted, downloadURL)
+
+	require.NotEmpty(t, requested)
+	for _, r := range requested {
+		assert.Equal(t, "/uc?export=download&id=abc123&confirm=t", r)
+	}
+
+	assert.Equal(t, DefaultBaseURL, New(WithBaseURL("")).baseURL)
+}
+
+func TestService_DownloadWarningCookie(t *testing.T) {
+	const token = "Xk9_large"
+	content := []byte("large file content")
+
+	var confirmedWithCookie bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("confirm") != token {
+			// The warning page for files too large to scan
+			http.SetCookie(w, &http.Cookie{Name: "download_warning_13058876669334088843_abc123", Value: token, Path: "/"})
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html>Google Drive can't scan this file for viruses.</html>"))
+			return
+		}
+
+		cookie, err := r.Cookie("download_warning_13058876669334088843_abc123")
+		confirmedWithCookie = err == nil && cookie.Value == token
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="large.bin"`)
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	client := utils.NewHTTPClient()
+	service := New(WithHTTPClient(client), WithBaseURL(server.URL))
+	shareURL := "https://drive.google.com/file/d/abc123/view"
+
+	downloadURL, err := service.PrepareDownload(context.Background(), shareURL)
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/uc?export=download&confirm="+token+"&id=abc123", downloadURL)
+
+	// The download goes through the shared client, which must send the cookie back
+	var buf bytes.Buffer
+	_, err = client.DownloadStream(context.Background(), downloadURL, &buf, nil)
+	require.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+	assert.True(t, confirmedWithCookie, "confirm request should carry the download_warning cookie")
+}
+
+func TestService_ExportFormat(t *testing.T) {
+	const id = "1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms"
+
+	tests := []struct {
+		name         string
+		format       string
+		url          string
+		expectedURL  string
+		errorMessage string
+	}{
+		{
+			name:        "document as pdf",
+			format:      "pdf",
+			url:         "https://docs.google.com/document/d/" + id + "/edit",
+			expectedURL: "https://docs.google.com/document/d/" + id + "/export?format=pdf",
+		},
+		{
+			name:        "document as docx",
+			format:      "DOCX",
+			url:         "https://docs.google.com/document/d/" + id + "/edit?usp=sharing",
+			expectedURL: "https://docs.google.com/document/d/" + id + "/export?format=docx",
+		},
+		{
+			name:        "spreadsheet as xlsx",
+			format:      "xlsx",
+			url:         "https://docs.google.com/spreadsheets/d/" + id + "/edit#gid=0",
+			expectedURL: "https://docs.google.com/spreadsheets/d/" + id + "/export?format=xlsx",
+		},
+		{
+			name:        "presentation as pptx",
+			format:      "pptx",
+			url:         "https://docs.google.com/presentation/d/" + id + "/edit",
+			expectedURL: "https://docs.google.com/presentation/d/" + id + "/export?format=pptx",
+		},
+		{
+			name:        "drive file link is unaffected",
+			format:      "pdf",
+			url:         "https://drive.google.com/file/d/" + id + "/view",
+			expectedURL: "https://drive.google.com/uc?export=download&id=" + id + "&confirm=t",
+		},
+		{
+			name:         "document without a format",
+			url:          "https://docs.google.com/document/d/" + id + "/edit",
+			errorMessage: "not a file",
+		},
+		{
+			name:         "spreadsheet without a format",
+			url:          "https://docs.google.com/spreadsheets/d/" + id + "/edit",
+			errorMessage: "Google Sheets spreadsheet",
+		},
+		{
+			name:         "format the document can't export to",
+			format:       "xlsx",
+			url:          "https://docs.google.com/document/d/" + id + "/edit",
+			errorMessage: "can't be exported as xlsx",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := New(WithExportFormat(tt.format))
+			convertedURL, err := service.ConvertURL(tt.url)
+
+			if tt.errorMessage != "" {
+				require.Error(t, err)
+				assert.ErrorIs(t, err, interfaces.ErrUnsupportedURL)
+				assert.Contains(t, err.Error(), tt.errorMessage)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedURL, convertedURL)
+		})
+	}
+}
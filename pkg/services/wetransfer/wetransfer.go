@@ -14,12 +14,18 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultBaseURL is where the WeTransfer API is reached unless WithBaseURL overrides it
+const DefaultBaseURL = "https://wetransfer.com"
+
 type Service struct {
 	httpClient *utils.HTTPClient
 	logger     *logrus.Logger
+	userAgents *utils.UserAgentPool
+	baseURL    string
 }
 
 type WeTransferFile struct {
+	ID   string `json:"id"`
 	Name string `json:"name"`
 	Size int64  `json:"size"`
 }
@@ -30,19 +36,56 @@ type WeTransferResponse struct {
 }
 
 type DownloadRequest struct {
-	Intent       string `json:"intent"`
-	SecurityHash string `json:"security_hash"`
+	Intent       string   `json:"intent"`
+	SecurityHash string   `json:"security_hash"`
+	FileIDs      []string `json:"file_ids,omitempty"`
 }
 
 type DownloadResponse struct {
 	DirectLink string `json:"direct_link"`
 }
 
-func New() *Service {
-	return &Service{
+// Option configures a Service
+type Option func(*Service)
+
+// WithHTTPClient makes the service use the given HTTP client instead of its own
+func WithHTTPClient(client *utils.HTTPClient) Option {
+	return func(s *Service) {
+		if client != nil {
+			s.httpClient = client
+		}
+	}
+}
+
+// WithUserAgentPool makes the service take the User-Agent of each request from pool
+func WithUserAgentPool(pool *utils.UserAgentPool) Option {
+	return func(s *Service) {
+		s.userAgents = pool
+	}
+}
+
+// WithBaseURL sends API requests to baseURL instead of DefaultBaseURL, for
+// mirrors behind a proxy or mock servers in tests
+func WithBaseURL(baseURL string) Option {
+	return func(s *Service) {
+		if baseURL != "" {
+			s.baseURL = strings.TrimRight(baseURL, "/")
+		}
+	}
+}
+
+func New(opts ...Option) *Service {
+	service := &Service{
 		httpClient: utils.NewHTTPClient(),
 		logger:     logrus.New(),
+		baseURL:    DefaultBaseURL,
 	}
+
+	for _, opt := range opts {
+		opt(service)
+	}
+
+	return service
 }
 
 func (s *Service) IsSupported(rawURL string) bool {
@@ -86,7 +129,7 @@ func (s *Service) GetFileInfo(ctx context.Context, rawURL string) (*interfaces.F
 		return nil, fmt.Errorf("failed to get WeTransfer download info: %w", err)
 	}
 
-	s.logger.Infof("Getting file info for WeTransfer URL: %s", downloadInfo.DownloadURL)
+	utils.LoggerFromContext(ctx, s.logger).Infof("Getting file info for WeTransfer URL: %s", downloadInfo.DownloadURL)
 
 	// Use HTTP client to get file info from the actual download URL
 	httpFileInfo, err := s.httpClient.GetFileInfo(ctx, downloadInfo.DownloadURL, s.getDefaultHeaders())
@@ -99,14 +142,21 @@ func (s *Service) GetFileInfo(ctx context.Context, rawURL string) (*interfaces.F
 		URL:           httpFileInfo.URL,
 		Filename:      downloadInfo.Filename,
 		Size:          httpFileInfo.Size,
+		SizeKnown:     httpFileInfo.SizeKnown,
 		SupportsRange: httpFileInfo.SupportsRangeRequests,
-		ContentType:   "", // Not available in utils.FileInfo
+		ETag:          httpFileInfo.ETag,
+		ContentType:   httpFileInfo.ContentType,
 	}
 
 	if httpFileInfo.LastModified != nil {
 		fileInfo.LastModified = *httpFileInfo.LastModified
 	}
 
+	// The API knows the size even when the storage host doesn't report it
+	if fileInfo.Size == 0 {
+		fileInfo.Size = downloadInfo.Size
+	}
+
 	// Use the filename from WeTransfer API if available
 	if fileInfo.Filename == "" {
 		fileInfo.Filename = "wetransfer_file"
@@ -127,6 +177,7 @@ func (s *Service) PrepareDownload(ctx context.Context, rawURL string) (string, e
 type WeTransferDownloadInfo struct {
 	DownloadURL string
 	Filename    string
+	Size        int64
 }
 
 func (s *Service) getWeTransferDownloadInfo(ctx context.Context, rawURL string) (*WeTransferDownloadInfo, error) {
@@ -135,10 +186,10 @@ func (s *Service) getWeTransferDownloadInfo(ctx context.Context, rawURL string)
 		return nil, err
 	}
 
-	s.logger.Infof("Extracted transfer ID: %s", transferID)
+	utils.LoggerFromContext(ctx, s.logger).Infof("Extracted transfer ID: %s", transferID)
 
 	// First, get the transfer information
-	transferURL := fmt.Sprintf("https://wetransfer.com/api/v4/transfers/%s", transferID)
+	transferURL := fmt.Sprintf("%s/api/v4/transfers/%s", s.baseURL, transferID)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", transferURL, nil)
 	if err != nil {
@@ -180,16 +231,27 @@ func (s *Service) getWeTransferDownloadInfo(ctx context.Context, rawURL string)
 	}
 
 	// Get the first file's information
-	firstFile := transferData.Files[0]
+	file := transferData.Files[0]
 
 	// Request download URL
-	downloadURL := fmt.Sprintf("https://wetransfer.com/api/v4/transfers/%s/download", transferID)
+	downloadURL := fmt.Sprintf("%s/api/v4/transfers/%s/download", s.baseURL, transferID)
 
 	downloadPayload := DownloadRequest{
 		Intent:       "entire_transfer",
 		SecurityHash: transferData.SecurityHash,
 	}
 
+	// A selected file is downloaded on its own instead of the whole transfer
+	if name, ok := utils.SelectedFileFromContext(ctx); ok {
+		selected, err := selectFile(transferData.Files, name)
+		if err != nil {
+			return nil, err
+		}
+		file = selected
+		downloadPayload.Intent = "single_file"
+		downloadPayload.FileIDs = []string{selected.ID}
+	}
+
 	payloadBytes, err := json.Marshal(downloadPayload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal download payload: %w", err)
@@ -232,13 +294,26 @@ func (s *Service) getWeTransferDownloadInfo(ctx context.Context, rawURL string)
 
 	return &WeTransferDownloadInfo{
 		DownloadURL: downloadData.DirectLink,
-		Filename:    firstFile.Name,
+		Filename:    file.Name,
+		Size:        file.Size,
 	}, nil
 }
 
+// selectFile returns the file in a transfer with the given name
+func selectFile(files []WeTransferFile, name string) (WeTransferFile, error) {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.Name == name {
+			return file, nil
+		}
+		names = append(names, file.Name)
+	}
+	return WeTransferFile{}, fmt.Errorf("no file named %q in transfer, it contains: %s", name, strings.Join(names, ", "))
+}
+
 func (s *Service) getDefaultHeaders() map[string]string {
 	return map[string]string{
 		"Accept-Encoding": "identity",
-		"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
+		"User-Agent":      s.userAgents.Next(),
 	}
 }
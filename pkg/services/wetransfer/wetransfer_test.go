@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/milindmadhukar/cloudget/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -19,6 +20,15 @@ func TestNew(t *testing.T) {
 	assert.NotNil(t, service.logger)
 }
 
+func TestNew_WithHTTPClient(t *testing.T) {
+	client := utils.NewHTTPClient()
+	service := New(WithHTTPClient(client))
+	assert.Same(t, client, service.httpClient)
+
+	service = New(WithHTTPClient(nil))
+	assert.NotNil(t, service.httpClient)
+}
+
 func TestService_GetServiceName(t *testing.T) {
 	service := New()
 	assert.Equal(t, "WeTransfer", service.GetServiceName())
@@ -440,3 +450,123 @@ func TestService_EdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestService_WithBaseURL(t *testing.T) {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/transfers/abc123", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(WeTransferResponse{
+			Files:        []WeTransferFile{{Name: "holiday.zip", Size: 64}},
+			SecurityHash: "hash",
+		})
+	})
+	mux.HandleFunc("POST /api/v4/transfers/abc123/download", func(w http.ResponseWriter, r *http.Request) {
+		var payload DownloadRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.SecurityHash != "hash" {
+			http.Error(w, "bad payload", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(DownloadResponse{DirectLink: server.URL + "/files/holiday.zip"})
+	})
+	mux.HandleFunc("/files/holiday.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "64")
+		w.Header().Set("Accept-Ranges", "bytes")
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	service := New(WithBaseURL(server.URL))
+	transferURL := "https://wetransfer.com/downloads/abc123"
+
+	info, err := service.GetFileInfo(context.Background(), transferURL)
+	require.NoError(t, err)
+	assert.Equal(t, "holiday.zip", info.Filename)
+	assert.Equal(t, int64(64), info.Size)
+	assert.True(t, info.SupportsRange)
+
+	downloadURL, err := service.PrepareDownload(context.Background(), transferURL)
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/files/holiday.zip", downloadURL)
+
+	assert.Equal(t, DefaultBaseURL, New().baseURL)
+}
+
+func TestService_SelectFile(t *testing.T) {
+	var server *httptest.Server
+	var payloads []DownloadRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/transfers/abc123", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(WeTransferResponse{
+			Files: []WeTransferFile{
+				{ID: "f1", Name: "slides.pdf", Size: 2048},
+				{ID: "f2", Name: "photos.zip", Size: 4096},
+				{ID: "f3", Name: "notes.txt", Size: 128},
+			},
+			SecurityHash: "hash",
+		})
+	})
+	mux.HandleFunc("POST /api/v4/transfers/abc123/download", func(w http.ResponseWriter, r *http.Request) {
+		var payload DownloadRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "bad payload", http.StatusBadRequest)
+			return
+		}
+		payloads = append(payloads, payload)
+
+		link := server.URL + "/files/transfer.zip"
+		if payload.Intent == "single_file" && len(payload.FileIDs) == 1 {
+			link = server.URL + "/files/" + payload.FileIDs[0]
+		}
+		json.NewEncoder(w).Encode(DownloadResponse{DirectLink: link})
+	})
+	// Storage doesn't report a size, so it has to come from the API
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	service := New(WithBaseURL(server.URL))
+	transferURL := "https://wetransfer.com/downloads/abc123"
+
+	t.Run("selected file", func(t *testing.T) {
+		payloads = nil
+		ctx := utils.WithSelectedFile(context.Background(), "photos.zip")
+
+		info, err := service.GetFileInfo(ctx, transferURL)
+		require.NoError(t, err)
+		assert.Equal(t, "photos.zip", info.Filename)
+		assert.Equal(t, int64(4096), info.Size)
+
+		downloadURL, err := service.PrepareDownload(ctx, transferURL)
+		require.NoError(t, err)
+		assert.Equal(t, server.URL+"/files/f2", downloadURL)
+
+		require.NotEmpty(t, payloads)
+		for _, payload := range payloads {
+			assert.Equal(t, "single_file", payload.Intent)
+			assert.Equal(t, []string{"f2"}, payload.FileIDs)
+		}
+	})
+
+	t.Run("whole transfer when unset", func(t *testing.T) {
+		payloads = nil
+
+		downloadURL, err := service.PrepareDownload(context.Background(), transferURL)
+		require.NoError(t, err)
+		assert.Equal(t, server.URL+"/files/transfer.zip", downloadURL)
+
+		require.Len(t, payloads, 1)
+		assert.Equal(t, "entire_transfer", payloads[0].Intent)
+		assert.Empty(t, payloads[0].FileIDs)
+	})
+
+	t.Run("unknown file", func(t *testing.T) {
+		payloads = nil
+		ctx := utils.WithSelectedFile(context.Background(), "missing.bin")
+
+		_, err := service.PrepareDownload(ctx, transferURL)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `no file named "missing.bin"`)
+		assert.Contains(t, err.Error(), "slides.pdf, photos.zip, notes.txt")
+		assert.Empty(t, payloads)
+	})
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+)
+
+// ChunkDownloaderClient fetches single byte ranges of a file with an
+// HTTPClient, retrying and checking each range like the chunks of a
+// download. It implements interfaces.ChunkDownloader.
+type ChunkDownloaderClient struct {
+	client  *HTTPClient
+	options *DownloadOptions
+}
+
+// NewChunkDownloaderClient creates a chunk downloader that sends its requests
+// through client, a new default client when nil. The headers, retries and
+// redirect limit of options apply to every range, nil options use the
+// defaults.
+func NewChunkDownloaderClient(client *HTTPClient, options *DownloadOptions) *ChunkDownloaderClient {
+	if client == nil {
+		client = NewHTTPClient()
+	}
+	return &ChunkDownloaderClient{
+		client:  client,
+		options: options,
+	}
+}
+
+// DownloadChunk downloads bytes start through end of url, both inclusive.
+// Anything but exactly that range is an error.
+func (c *ChunkDownloaderClient) DownloadChunk(ctx context.Context, url string, start, end int64) ([]byte, error) {
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("invalid byte range %d-%d", start, end)
+	}
+
+	chunk := ChunkInfo{
+		Start: start,
+		End:   end,
+		Size:  end - start + 1,
+	}
+	return c.client.DownloadChunk(ctx, url, chunk, c.options)
+}
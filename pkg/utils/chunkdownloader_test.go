@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milindmadhukar/cloudget/pkg/interfaces"
+)
+
+func TestChunkDownloaderClient_DownloadChunk(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	var downloader interfaces.ChunkDownloader = NewChunkDownloaderClient(nil, &DownloadOptions{MaxRetries: 1, RetryDelay: time.Millisecond})
+
+	tests := []struct {
+		name    string
+		start   int64
+		end     int64
+		want    string
+		wantErr bool
+	}{
+		{name: "first bytes", start: 0, end: 9, want: content[:10]},
+		{name: "middle range", start: 95, end: 204, want: content[95:205]},
+		{name: "last byte", start: 999, end: 999, want: content[999:]},
+		{name: "range past the end", start: 990, end: 1099, wantErr: true},
+		{name: "end before start", start: 10, end: 9, wantErr: true},
+		{name: "negative start", start: -1, end: 9, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := downloader.DownloadChunk(context.Background(), server.URL, tt.start, tt.end)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("DownloadChunk(%d, %d) succeeded, want an error", tt.start, tt.end)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadChunk(%d, %d) failed: %v", tt.start, tt.end, err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("DownloadChunk(%d, %d) = %q, want %q", tt.start, tt.end, data, tt.want)
+			}
+		})
+	}
+}
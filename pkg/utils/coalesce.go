@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// writeCoalescer collects chunks that complete out of order and writes
+// contiguous runs of them with a single WriteAt, so a parallel download makes
+// a few large, mostly sequential writes instead of one per chunk. Chunks from
+// past a gap are held until the gap fills or the buffer limit is reached.
+// It's only used from the goroutine collecting chunk results and is not safe
+// for concurrent use.
+type writeCoalescer struct {
+	w     io.WriterAt
+	limit int64
+
+	run      []byte // Contiguous bytes starting at runStart, not yet written
+	runStart int64
+	pending  map[int64][]byte // Chunks past the end of run, by offset
+	buffered int64            // Bytes in run and pending together
+}
+
+// newWriteCoalescer returns a coalescer writing to w whose contiguous run
+// begins at start. It holds at most about limit bytes before writing.
+func newWriteCoalescer(w io.WriterAt, start, limit int64) *writeCoalescer {
+	return &writeCoalescer{
+		w:        w,
+		limit:    limit,
+		runStart: start,
+		pending:  make(map[int64][]byte),
+	}
+}
+
+// Add buffers the chunk data at offset, writing whatever the buffer can no
+// longer hold
+func (c *writeCoalescer) Add(offset int64, data []byte) error {
+	c.pending[offset] = data
+	c.buffered += int64(len(data))
+
+	// Move every chunk that now continues the run onto it
+	for {
+		next, ok := c.pending[c.runStart+int64(len(c.run))]
+		if !ok {
+			break
+		}
+		delete(c.pending, c.runStart+int64(len(c.run)))
+		if c.run == nil {
+			// The run is reused after every flush, so size it once
+			c.run = make([]byte, 0, c.limit)
+		}
+		c.run = append(c.run, next...)
+	}
+
+	if int64(len(c.run)) >= c.limit {
+		if err := c.flushRun(); err != nil {
+			return err
+		}
+	}
+	if c.buffered > c.limit {
+		return c.flushPending()
+	}
+	return nil
+}
+
+// Flush writes everything still buffered
+func (c *writeCoalescer) Flush() error {
+	if err := c.flushRun(); err != nil {
+		return err
+	}
+	return c.flushPending()
+}
+
+// flushRun writes the contiguous run and starts a new one where it ended
+func (c *writeCoalescer) flushRun() error {
+	if len(c.run) == 0 {
+		return nil
+	}
+	if _, err := c.w.WriteAt(c.run, c.runStart); err != nil {
+		return fmt.Errorf("failed to write chunk to file: %w", err)
+	}
+	c.runStart += int64(len(c.run))
+	c.buffered -= int64(len(c.run))
+	c.run = c.run[:0]
+	return nil
+}
+
+// flushPending writes the chunks waiting past a gap, merging those that are
+// adjacent to each other
+func (c *writeCoalescer) flushPending() error {
+	offsets := make([]int64, 0, len(c.pending))
+	for offset := range c.pending {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	for i := 0; i < len(offsets); {
+		start, end := offsets[i], offsets[i]+int64(len(c.pending[offsets[i]]))
+		j := i + 1
+		for ; j < len(offsets) && offsets[j] == end; j++ {
+			end += int64(len(c.pending[offsets[j]]))
+		}
+
+		data := c.pending[start]
+		if j > i+1 {
+			data = make([]byte, 0, end-start)
+			for _, offset := range offsets[i:j] {
+				data = append(data, c.pending[offset]...)
+			}
+		}
+		if _, err := c.w.WriteAt(data, start); err != nil {
+			return fmt.Errorf("failed to write chunk to file: %w", err)
+		}
+		for _, offset := range offsets[i:j] {
+			c.buffered -= int64(len(c.pending[offset]))
+			delete(c.pending, offset)
+		}
+		i = j
+	}
+	return nil
+}
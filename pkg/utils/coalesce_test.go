@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingWriterAt records the writes made to an in-memory file
+type countingWriterAt struct {
+	data   []byte
+	writes int
+}
+
+func (w *countingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	w.writes++
+	if end := off + int64(len(p)); end > int64(len(w.data)) {
+		w.data = append(w.data, make([]byte, end-int64(len(w.data)))...)
+	}
+	return copy(w.data[off:], p), nil
+}
+
+// shuffledChunks splits content into chunks of chunkSize and returns their
+// offsets shuffled within each run of window chunks, the way that many
+// parallel workers finish them out of order
+func shuffledChunks(content []byte, chunkSize, window int, seed uint64) []int64 {
+	var offsets []int64
+	for offset := 0; offset < len(content); offset += chunkSize {
+		offsets = append(offsets, int64(offset))
+	}
+	r := rand.New(rand.NewPCG(seed, seed))
+	for start := 0; start < len(offsets); start += window {
+		run := offsets[start:min(start+window, len(offsets))]
+		r.Shuffle(len(run), func(i, j int) { run[i], run[j] = run[j], run[i] })
+	}
+	return offsets
+}
+
+func TestWriteCoalescer(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 64*32)) // 32KB
+	const chunkSize = 1024
+
+	tests := []struct {
+		name      string
+		limit     int64
+		maxWrites int
+	}{
+		{name: "buffer holds whole file", limit: int64(len(content)), maxWrites: 1},
+		{name: "small buffer", limit: 4 * chunkSize, maxWrites: 32},
+		{name: "buffer smaller than a chunk", limit: 1, maxWrites: 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := uint64(1); seed <= 5; seed++ {
+				w := &countingWriterAt{}
+				c := newWriteCoalescer(w, 0, tt.limit)
+				for _, offset := range shuffledChunks(content, chunkSize, len(content)/chunkSize, seed) {
+					chunk := append([]byte(nil), content[offset:offset+chunkSize]...)
+					if err := c.Add(offset, chunk); err != nil {
+						t.Fatalf("Add(%d) error = %v", offset, err)
+					}
+				}
+				if err := c.Flush(); err != nil {
+					t.Fatalf("Flush() error = %v", err)
+				}
+
+				if !bytes.Equal(w.data, content) {
+					t.Fatalf("seed %d: written content doesn't match", seed)
+				}
+				if w.writes > tt.maxWrites {
+					t.Errorf("seed %d: %d writes, want at most %d", seed, w.writes, tt.maxWrites)
+				}
+				if c.buffered != 0 {
+					t.Errorf("seed %d: %d bytes still buffered after Flush", seed, c.buffered)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPClient_DownloadToFile_WriteBuffer(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 64*64)) // 64KB
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Jitter makes chunks finish out of order
+		time.Sleep(time.Duration(rand.IntN(3)) * time.Millisecond)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		partial int // Bytes of a partial file to resume from
+	}{
+		{name: "fresh download"},
+		{name: "resumed download", partial: 10 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "file.bin")
+			if tt.partial > 0 {
+				if err := os.WriteFile(filename, content[:tt.partial], 0644); err != nil {
+					t.Fatalf("Failed to create partial file: %v", err)
+				}
+			}
+
+			client := NewHTTPClient()
+			fileInfo := &FileInfo{URL: server.URL, Size: int64(len(content)), SizeKnown: true, SupportsRangeRequests: true}
+			_, err := client.DownloadToFileWithInfo(context.Background(), server.URL, filename, fileInfo, &DownloadOptions{
+				ChunkSize:       1024,
+				Concurrency:     8,
+				Resume:          tt.partial > 0,
+				WriteBufferSize: 8 * 1024,
+			})
+			if err != nil {
+				t.Fatalf("DownloadToFileWithInfo() error = %v", err)
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil || !bytes.Equal(data, content) {
+				t.Errorf("downloaded file doesn't match the server's content: %v", err)
+			}
+		})
+	}
+}
+
+func BenchmarkWriteCoalescer(b *testing.B) {
+	content := make([]byte, 16*1024*1024)
+	const chunkSize = 64 * 1024
+	offsets := shuffledChunks(content, chunkSize, 8, 1) // As 8 connections would finish them
+
+	for _, limit := range []int64{0, 1024 * 1024, 8 * 1024 * 1024} {
+		b.Run(fmt.Sprintf("buffer=%s", FormatBytes(limit)), func(b *testing.B) {
+			var writes int
+			for i := 0; i < b.N; i++ {
+				w := &countingWriterAt{data: make([]byte, len(content))}
+				if limit == 0 {
+					// One write per chunk, as without a buffer
+					for _, offset := range offsets {
+						w.WriteAt(content[offset:offset+chunkSize], offset)
+					}
+				} else {
+					c := newWriteCoalescer(w, 0, limit)
+					for _, offset := range offsets {
+						c.Add(offset, content[offset:offset+chunkSize])
+					}
+					c.Flush()
+				}
+				writes += w.writes
+			}
+			b.ReportMetric(float64(writes)/float64(b.N), "writes/op")
+		})
+	}
+}
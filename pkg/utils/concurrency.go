@@ -0,0 +1,88 @@
+package utils
+
+import "time"
+
+// concurrencyController decides how many chunks may be downloaded at once.
+// With a fixed limit it always allows the configured maximum. In adaptive
+// mode it starts with a single connection, adds one more each time a full
+// round of chunks achieves better throughput than the round before, and
+// halves the limit whenever a chunk needs retries. It is only used from the
+// goroutine scheduling chunks and is not safe for concurrent use.
+type concurrencyController struct {
+	adaptive bool
+	limit    int
+	max      int
+
+	roundStart  time.Time
+	roundBytes  int64
+	roundChunks int
+	lastRate    float64
+}
+
+func newConcurrencyController(max int, adaptive bool, now time.Time) *concurrencyController {
+	if max < 1 {
+		max = 1
+	}
+
+	limit := max
+	if adaptive {
+		limit = 1
+	}
+
+	return &concurrencyController{
+		adaptive:   adaptive,
+		limit:      limit,
+		max:        max,
+		roundStart: now,
+	}
+}
+
+// Limit returns the number of chunks currently allowed in flight
+func (c *concurrencyController) Limit() int {
+	return c.limit
+}
+
+// OnSuccess records a chunk that completed without retries
+func (c *concurrencyController) OnSuccess(bytes int64, now time.Time) {
+	if !c.adaptive {
+		return
+	}
+
+	c.roundBytes += bytes
+	c.roundChunks++
+	if c.roundChunks < c.limit {
+		return
+	}
+
+	elapsed := now.Sub(c.roundStart).Seconds()
+	if elapsed <= 0 {
+		elapsed = time.Millisecond.Seconds()
+	}
+	rate := float64(c.roundBytes) / elapsed
+
+	if rate > c.lastRate && c.limit < c.max {
+		c.limit++
+	}
+	c.lastRate = rate
+	c.startRound(now)
+}
+
+// OnError records a chunk that failed or needed retries and backs off
+func (c *concurrencyController) OnError(now time.Time) {
+	if !c.adaptive {
+		return
+	}
+
+	c.limit /= 2
+	if c.limit < 1 {
+		c.limit = 1
+	}
+	c.lastRate = 0
+	c.startRound(now)
+}
+
+func (c *concurrencyController) startRound(now time.Time) {
+	c.roundStart = now
+	c.roundBytes = 0
+	c.roundChunks = 0
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyController(t *testing.T) {
+	start := time.Unix(0, 0)
+
+	t.Run("fixed limit ignores feedback", func(t *testing.T) {
+		c := newConcurrencyController(4, false, start)
+		c.OnError(start)
+		c.OnSuccess(1024, start.Add(time.Second))
+		if c.Limit() != 4 {
+			t.Errorf("Limit() = %d, want 4", c.Limit())
+		}
+	})
+
+	t.Run("adaptive grows while throughput improves", func(t *testing.T) {
+		c := newConcurrencyController(4, true, start)
+		if c.Limit() != 1 {
+			t.Fatalf("initial Limit() = %d, want 1", c.Limit())
+		}
+
+		// Each round finishes in the same time while carrying one more chunk
+		now := start
+		for round := 1; c.Limit() < 4; round++ {
+			now = now.Add(100 * time.Millisecond)
+			for i := 0; i < c.Limit(); i++ {
+				c.OnSuccess(1024, now)
+			}
+			if round > 4 {
+				t.Fatalf("Limit() = %d after %d rounds, want growth to 4", c.Limit(), round)
+			}
+		}
+
+		now = now.Add(100 * time.Millisecond)
+		for i := 0; i < 4; i++ {
+			c.OnSuccess(1024, now)
+		}
+		if c.Limit() != 4 {
+			t.Errorf("Limit() = %d, want it capped at 4", c.Limit())
+		}
+	})
+
+	t.Run("adaptive holds when throughput stops improving", func(t *testing.T) {
+		c := newConcurrencyController(8, true, start)
+		c.OnSuccess(1024, start.Add(100*time.Millisecond))
+		if c.Limit() != 2 {
+			t.Fatalf("Limit() = %d, want 2", c.Limit())
+		}
+
+		// Twice the chunks in four times the time is a slower round
+		c.OnSuccess(1024, start.Add(500*time.Millisecond))
+		c.OnSuccess(1024, start.Add(500*time.Millisecond))
+		if c.Limit() != 2 {
+			t.Errorf("Limit() = %d, want 2 after a slower round", c.Limit())
+		}
+	})
+
+	t.Run("adaptive halves on errors", func(t *testing.T) {
+		c := newConcurrencyController(8, true, start)
+		now := start
+		for c.Limit() < 8 {
+			now = now.Add(100 * time.Millisecond)
+			for i := c.Limit(); i > 0; i-- {
+				c.OnSuccess(1024, now)
+			}
+		}
+
+		c.OnError(now)
+		if c.Limit() != 4 {
+			t.Errorf("Limit() = %d, want 4", c.Limit())
+		}
+		c.OnError(now)
+		c.OnError(now)
+		c.OnError(now)
+		if c.Limit() != 1 {
+			t.Errorf("Limit() = %d, want it floored at 1", c.Limit())
+		}
+	})
+}
+
+// newLatencyServer serves content with a fixed delay per ranged request and
+// records the highest number of requests it saw in flight. Requests for which
+// failFirst returns true get a 503 on their first attempt.
+func newLatencyServer(content []byte, delay time.Duration, failFirst func(rangeHeader string) bool) (*httptest.Server, *atomic.Int32) {
+	var inFlight, peak atomic.Int32
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader := r.Header.Get("Range")
+		if r.Method == http.MethodGet && rangeHeader != "" {
+			current := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				p := peak.Load()
+				if current <= p || peak.CompareAndSwap(p, current) {
+					break
+				}
+			}
+
+			time.Sleep(delay)
+
+			if failFirst != nil && failFirst(rangeHeader) {
+				mu.Lock()
+				first := !seen[rangeHeader]
+				seen[rangeHeader] = true
+				mu.Unlock()
+				if first {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+			}
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+
+	return server, &peak
+}
+
+func TestHTTPClient_DownloadToFile_AdaptiveConcurrency(t *testing.T) {
+	content := bytes.Repeat([]byte("adaptive"), 8*1024) // 64KB, 64 chunks of 1KB
+
+	t.Run("grows when chunks succeed quickly", func(t *testing.T) {
+		server, peak := newLatencyServer(content, 10*time.Millisecond, nil)
+		defer server.Close()
+
+		client := NewHTTPClient()
+		filename := filepath.Join(t.TempDir(), "adaptive.bin")
+		options := &DownloadOptions{ChunkSize: 1024, Concurrency: 8, AdaptiveConcurrency: true}
+
+		stats, err := client.DownloadToFile(context.Background(), server.URL, filename, options)
+		if err != nil {
+			t.Fatalf("DownloadToFile failed: %v", err)
+		}
+
+		if stats.PeakConcurrency < 3 {
+			t.Errorf("PeakConcurrency = %d, want growth beyond the initial connection", stats.PeakConcurrency)
+		}
+		if peak.Load() > 8 {
+			t.Errorf("server saw %d concurrent requests, want at most 8", peak.Load())
+		}
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("Failed to read downloaded file: %v", err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Error("Downloaded content does not match")
+		}
+	})
+
+	t.Run("backs off after induced errors", func(t *testing.T) {
+		// Every chunk needs a retry, so the controller never leaves one connection
+		server, peak := newLatencyServer(content[:16*1024], time.Millisecond, func(string) bool { return true })
+		defer server.Close()
+
+		client := NewHTTPClient()
+		filename := filepath.Join(t.TempDir(), "backoff.bin")
+		options := &DownloadOptions{
+			ChunkSize:           1024,
+			Concurrency:         8,
+			AdaptiveConcurrency: true,
+			RetryDelay:          time.Millisecond,
+		}
+
+		stats, err := client.DownloadToFile(context.Background(), server.URL, filename, options)
+		if err != nil {
+			t.Fatalf("DownloadToFile failed: %v", err)
+		}
+
+		if stats.Retries != 16 {
+			t.Errorf("Retries = %d, want 16", stats.Retries)
+		}
+		if stats.PeakConcurrency != 1 || peak.Load() != 1 {
+			t.Errorf("PeakConcurrency = %d (server saw %d), want a single connection after errors",
+				stats.PeakConcurrency, peak.Load())
+		}
+	})
+}
+
+func TestHTTPClient_DownloadToFile_ParallelFailureKeepsPrefix(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1024) // 16KB, 16 chunks of 1KB
+
+	// The sixth chunk always fails while every other chunk succeeds
+	const failingRange = "bytes=5120-6143"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == failingRange {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	filename := filepath.Join(t.TempDir(), "partial.bin")
+	options := &DownloadOptions{
+		ChunkSize:   1024,
+		Concurrency: 4,
+		MaxRetries:  1,
+		RetryDelay:  time.Millisecond,
+		Resume:      true,
+	}
+
+	if _, err := client.DownloadToFile(context.Background(), server.URL, filename, options); err == nil {
+		t.Fatal("Expected download to fail")
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read partial file: %v", err)
+	}
+	if len(data) > 5120 {
+		t.Errorf("partial file is %d bytes, want at most the 5120 byte prefix before the failed chunk", len(data))
+	}
+	if !bytes.Equal(data, content[:len(data)]) {
+		t.Error("partial file does not match the start of the content")
+	}
+}
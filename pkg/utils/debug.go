@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// redactedHeaders carry credentials, their values never appear in debug logs
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// debugTransport logs the headers of every request it sends and every
+// response it gets back, redirects included, at debug level
+type debugTransport struct {
+	base   http.RoundTripper
+	client *HTTPClient
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	logger := t.client.log(req.Context())
+
+	logger.Debugf("> %s %s %s", req.Method, req.URL, req.Proto)
+	for _, line := range headerLines(req.Header) {
+		logger.Debugf("> %s", line)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		logger.Debugf("! %s %s failed: %v", req.Method, req.URL, err)
+		return resp, err
+	}
+
+	logger.Debugf("< %s %s", resp.Proto, resp.Status)
+	for _, line := range headerLines(resp.Header) {
+		logger.Debugf("< %s", line)
+	}
+
+	return resp, nil
+}
+
+// SetDebugHTTP logs the request and response headers of every exchange at
+// debug level, with credentials redacted. It wraps the current transport, so
+// call it after any other transport settings.
+func (h *HTTPClient) SetDebugHTTP(enabled bool) {
+	base := h.client.GetClient().Transport
+	current, wrapped := base.(*debugTransport)
+
+	switch {
+	case enabled && !wrapped:
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		h.client.SetTransport(&debugTransport{base: base, client: h})
+	case !enabled && wrapped:
+		h.client.SetTransport(current.base)
+	}
+}
+
+// headerLines formats headers as sorted "Name: value" lines
+func headerLines(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		for _, value := range header[name] {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] {
+				value = "[REDACTED]"
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s", name, strings.TrimSpace(value)))
+		}
+	}
+	return lines
+}
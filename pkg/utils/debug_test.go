@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestHTTPClient_SetDebugHTTP(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/file", http.StatusFound)
+	})
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "mock")
+		w.Header().Set("Set-Cookie", "session=server-secret")
+		w.Write([]byte("ok"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		enable  []bool
+		wantLog bool
+	}{
+		{name: "enabled", enable: []bool{true}, wantLog: true},
+		{name: "enabled twice", enable: []bool{true, true}, wantLog: true},
+		{name: "disabled", enable: nil, wantLog: false},
+		{name: "enabled then disabled", enable: []bool{true, false}, wantLog: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := logtest.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+
+			client := NewHTTPClient()
+			client.SetLogger(logger)
+			for _, enabled := range tt.enable {
+				client.SetDebugHTTP(enabled)
+			}
+
+			_, err := client.client.R().
+				SetContext(context.Background()).
+				SetHeader("Authorization", "Bearer client-secret").
+				Get(server.URL + "/start")
+			if err != nil {
+				t.Fatalf("GET failed: %v", err)
+			}
+
+			var lines []string
+			for _, entry := range hook.AllEntries() {
+				lines = append(lines, entry.Message)
+			}
+			log := strings.Join(lines, "\n")
+
+			if strings.Contains(log, "client-secret") || strings.Contains(log, "server-secret") {
+				t.Errorf("credentials were logged:\n%s", log)
+			}
+
+			for _, want := range []string{
+				"> GET " + server.URL + "/start",
+				"> GET " + server.URL + "/file",
+				"> Authorization: [REDACTED]",
+				"< HTTP/1.1 302 Found",
+				"< X-Served-By: mock",
+				"< Set-Cookie: [REDACTED]",
+			} {
+				if got := strings.Contains(log, want); got != tt.wantLog {
+					t.Errorf("log contains %q = %v, want %v\n%s", want, got, tt.wantLog, log)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// filenameRecorder keeps the first Content-Disposition filename among the
+// responses of one download, which may only name the file in its GET
+// responses and not in the HEAD response the download was planned from
+type filenameRecorder struct {
+	mu       sync.Mutex
+	filename string
+}
+
+type filenameRecorderKey struct{}
+
+// withFilenameRecorder returns a copy of ctx that the responses of a
+// download record their Content-Disposition filename in
+func withFilenameRecorder(ctx context.Context) (context.Context, *filenameRecorder) {
+	recorder := &filenameRecorder{}
+	return context.WithValue(ctx, filenameRecorderKey{}, recorder), recorder
+}
+
+// recordFilename notes the Content-Disposition filename of a response in the
+// recorder of ctx, if there is one and it has no filename yet
+func recordFilename(ctx context.Context, header http.Header) {
+	recorder, _ := ctx.Value(filenameRecorderKey{}).(*filenameRecorder)
+	if recorder == nil {
+		return
+	}
+	filename := extractFilename(header.Get("Content-Disposition"))
+	if filename == "" {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorder.filename == "" {
+		recorder.filename = filename
+	}
+}
+
+func (r *filenameRecorder) get() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.filename
+}
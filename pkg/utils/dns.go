@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// defaultDNSPort is the port of a DNS server given without one
+const defaultDNSPort = "53"
+
+// hostResolver picks the addresses connections to a host are made to: the
+// override pinned for the host if there is one, else what the custom DNS
+// server answers. Without either the dialer resolves the host as usual.
+type hostResolver struct {
+	overrides map[string]string // Lowercase host to IP or IP:port
+	resolver  *net.Resolver     // Nil leaves resolution to the dialer
+}
+
+// newHostResolver checks that overrides map hosts to IPs, optionally with a
+// port, and that dnsServer is an IP with an optional port, defaulting to 53.
+// It returns nil when both are empty.
+func newHostResolver(overrides map[string]string, dnsServer string) (*hostResolver, error) {
+	if len(overrides) == 0 && dnsServer == "" {
+		return nil, nil
+	}
+
+	r := &hostResolver{overrides: make(map[string]string, len(overrides))}
+	for host, target := range overrides {
+		host = strings.ToLower(strings.TrimSpace(host))
+		target = strings.TrimSpace(target)
+		if host == "" {
+			return nil, fmt.Errorf("DNS override for %q has no host", target)
+		}
+		if !isIPAddress(target) {
+			return nil, fmt.Errorf("invalid DNS override for %s: %q is not an IP address or IP:port", host, target)
+		}
+		r.overrides[host] = target
+	}
+
+	if dnsServer != "" {
+		server := strings.TrimSpace(dnsServer)
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), defaultDNSPort)
+		}
+		if !isIPAddress(server) {
+			return nil, fmt.Errorf("invalid DNS server %q, want an IP address with an optional port", dnsServer)
+		}
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return r, nil
+}
+
+// isIPAddress reports whether s is an IP address, or one with a port
+func isIPAddress(s string) bool {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return net.ParseIP(strings.Trim(s, "[]")) != nil
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return false
+	}
+	return net.ParseIP(host) != nil
+}
+
+// addresses returns the addresses to try, in order, for a connection to addr
+func (r *hostResolver) addresses(ctx context.Context, addr string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if target, ok := r.overrides[strings.ToLower(host)]; ok {
+		if _, _, err := net.SplitHostPort(target); err == nil {
+			return []string{target}, nil
+		}
+		return []string{net.JoinHostPort(strings.Trim(target, "[]"), port)}, nil
+	}
+
+	if r.resolver == nil || net.ParseIP(host) != nil {
+		return []string{addr}, nil
+	}
+	ips, err := r.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	return addrs, nil
+}
+
+// dialContext wraps dial so each connection goes to the addresses picked for
+// its host, trying them in turn until one connects
+func (r *hostResolver) dialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		addrs, err := r.addresses(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range addrs {
+			var conn net.Conn
+			if conn, err = dial(ctx, network, target); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// dialQUIC opens HTTP/3 connections to the addresses picked for their host.
+// TLS still verifies the certificate against the host, which tlsCfg names.
+func (r *hostResolver) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	addrs, err := r.addresses(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range addrs {
+		var conn *quic.Conn
+		if conn, err = quic.DialAddrEarly(ctx, target, tlsCfg, cfg); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// Dial connects to addr the way the client's requests do, going to the
+// address a DNS override or the custom DNS server gives for its host, so
+// checks made outside the client reach the same server
+func (h *HTTPClient) Dial(ctx context.Context, network, addr string, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	if h.resolver == nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return h.resolver.dialContext(dialer.DialContext)(ctx, network, addr)
+}
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// serveFakeDNS answers every A query sent to the returned UDP address with
+// 127.0.0.1 and every other query with no records, counting the queries
+func serveFakeDNS(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP unavailable: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	queries := new(atomic.Int32)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+			queries.Add(1)
+
+			// The question is the labels of the name, then its type and class
+			end := 12
+			for end < n && query[end] != 0 {
+				end += int(query[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			isA := query[end-4] == 0 && query[end-3] == 1
+
+			answers := byte(0)
+			if isA {
+				answers = 1
+			}
+			resp := append([]byte{query[0], query[1], 0x81, 0x80, 0, 1, 0, answers, 0, 0, 0, 0}, query[12:end]...)
+			if isA {
+				resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 127, 0, 0, 1)
+			}
+			conn.WriteTo(resp, from)
+		}
+	}()
+	return conn.LocalAddr().String(), queries
+}
+
+func TestNewHTTPClientWithConfig_DNSOverride(t *testing.T) {
+	var gotHost string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		w.Write([]byte("staging"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	tests := []struct {
+		name     string
+		override map[string]string
+		url      string
+		wantHost string
+	}{
+		{
+			name:     "IP and port",
+			override: map[string]string{"files.cloudget.test": server.Listener.Addr().String()},
+			url:      "http://files.cloudget.test/data.bin",
+			wantHost: "files.cloudget.test",
+		},
+		{
+			name:     "IP keeps the port of the URL",
+			override: map[string]string{"files.cloudget.test": "127.0.0.1"},
+			url:      "http://files.cloudget.test:" + port + "/data.bin",
+			wantHost: "files.cloudget.test:" + port,
+		},
+		{
+			name:     "hosts match regardless of case",
+			override: map[string]string{"Files.CloudGet.Test": server.Listener.Addr().String()},
+			url:      "http://FILES.cloudget.test/data.bin",
+			wantHost: "FILES.cloudget.test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotHost = ""
+			client, err := NewHTTPClientWithConfig(&ClientConfig{DNSOverride: tt.override})
+			if err != nil {
+				t.Fatalf("NewHTTPClientWithConfig() error = %v", err)
+			}
+
+			data, err := client.DownloadChunk(context.Background(), tt.url, ChunkInfo{Start: 0, End: 6, Size: 7}, nil)
+			if err != nil {
+				t.Fatalf("DownloadChunk() error = %v", err)
+			}
+			if string(data) != "staging" {
+				t.Errorf("DownloadChunk() = %q, want the server's content", data)
+			}
+			if gotHost != tt.wantHost {
+				t.Errorf("server saw Host %q, want %q", gotHost, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientWithConfig_DNSOverrideHTTP3(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP unavailable: %v", err)
+	}
+	h3Server := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: tlsServer.TLS.Certificates}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto + " " + r.Host))
+		}),
+	}
+	go h3Server.Serve(conn)
+	defer h3Server.Close()
+
+	client, err := NewHTTPClientWithConfig(&ClientConfig{
+		InsecureSkipVerify: true,
+		HTTPVersion:        HTTPVersion3,
+		DNSOverride:        map[string]string{"files.cloudget.test": conn.LocalAddr().String()},
+	})
+	if err != nil {
+		t.Fatalf("NewHTTPClientWithConfig() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := client.client.R().SetContext(ctx).Get("https://files.cloudget.test/")
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	if got := resp.String(); got != "HTTP/3.0 files.cloudget.test" {
+		t.Errorf("server answered %q, want an HTTP/3.0 request for files.cloudget.test", got)
+	}
+}
+
+func TestNewHTTPClientWithConfig_DNSServer(t *testing.T) {
+	dnsAddr, queries := serveFakeDNS(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("resolved"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	client, err := NewHTTPClientWithConfig(&ClientConfig{DNSServer: dnsAddr})
+	if err != nil {
+		t.Fatalf("NewHTTPClientWithConfig() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	data, err := client.DownloadChunk(ctx, "http://files.cloudget.test:"+port+"/", ChunkInfo{Start: 0, End: 7, Size: 8}, nil)
+	if err != nil {
+		t.Fatalf("DownloadChunk() error = %v", err)
+	}
+	if string(data) != "resolved" {
+		t.Errorf("DownloadChunk() = %q, want the server's content", data)
+	}
+	if queries.Load() == 0 {
+		t.Error("the DNS server was never asked")
+	}
+}
+
+func TestNewHTTPClientWithConfig_DNSErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ClientConfig
+		wantErr string
+	}{
+		{name: "override to a hostname", config: ClientConfig{DNSOverride: map[string]string{"a.test": "b.test"}}, wantErr: "not an IP address"},
+		{name: "override with a bad port", config: ClientConfig{DNSOverride: map[string]string{"a.test": "127.0.0.1:http"}}, wantErr: "not an IP address"},
+		{name: "override without a host", config: ClientConfig{DNSOverride: map[string]string{" ": "127.0.0.1"}}, wantErr: "has no host"},
+		{name: "DNS server hostname", config: ClientConfig{DNSServer: "dns.example.com"}, wantErr: "invalid DNS server"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHTTPClientWithConfig(&tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewHTTPClientWithConfig() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	for _, server := range []string{"1.1.1.1", "1.1.1.1:5353", "2606:4700::1111", "[2606:4700::1111]:53"} {
+		if _, err := NewHTTPClientWithConfig(&ClientConfig{DNSServer: server}); err != nil {
+			t.Errorf("NewHTTPClientWithConfig() with DNS server %s error = %v", server, err)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package utils
+
+import "io"
+
+// maxDrainBytes is how much of a response body left unread is discarded
+// before closing it. A longer rest, like a whole file sent in place of a
+// range, costs more to read than opening a new connection.
+const maxDrainBytes = 1 << 20
+
+// drainBody reads what's left of body, up to maxDrainBytes, then closes it.
+// A body closed before its end takes its connection down with it, so
+// retries after an error page would each open a new one.
+func drainBody(body io.ReadCloser) {
+	io.CopyN(io.Discard, body, maxDrainBytes)
+	body.Close()
+}
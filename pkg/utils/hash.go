@@ -28,36 +28,105 @@ func (h *HashCalculator) CalculateHash(filePath string, algorithm string) (strin
 	}
 	defer file.Close()
 
-	var hasher hash.Hash
-	switch strings.ToLower(algorithm) {
-	case "md5":
-		hasher = md5.New()
-	case "sha1":
-		hasher = sha1.New()
-	case "sha256":
-		hasher = sha256.New()
-	case "sha512":
-		hasher = sha512.New()
-	default:
-		return "", fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+	return h.CalculateHashReader(file, algorithm)
+}
+
+// CalculateHashReader calculates the hash of everything read from r until
+// EOF, for data that isn't on disk such as a download being streamed
+func (h *HashCalculator) CalculateHashReader(r io.Reader, algorithm string) (string, error) {
+	hasher, err := newHasher(algorithm)
+	if err != nil {
+		return "", err
 	}
 
-	// Copy file content to hasher in chunks to handle large files efficiently
+	// Copy content to hasher in chunks to handle large inputs efficiently
 	buffer := make([]byte, 32*1024) // 32KB buffer
-	for {
-		n, err := file.Read(buffer)
-		if n > 0 {
-			hasher.Write(buffer[:n])
-		}
-		if err == io.EOF {
-			break
+	if _, err := io.CopyBuffer(hasher, r, buffer); err != nil {
+		return "", fmt.Errorf("failed to read data: %w", err)
+	}
+
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// CalculateHashes calculates several hashes of a file in a single read,
+// returning them keyed by algorithm name as given
+func (h *HashCalculator) CalculateHashes(filePath string, algorithms []string) (map[string]string, error) {
+	hashers := make(map[string]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		if _, seen := hashers[algorithm]; seen {
+			continue
 		}
+		hasher, err := newHasher(algorithm)
 		if err != nil {
-			return "", fmt.Errorf("failed to read file: %w", err)
+			return nil, err
 		}
+		hashers[algorithm] = hasher
+		writers = append(writers, hasher)
 	}
 
-	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	buffer := make([]byte, 32*1024) // 32KB buffer
+	if _, err := io.CopyBuffer(io.MultiWriter(writers...), file, buffer); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	hashes := make(map[string]string, len(hashers))
+	for algorithm, hasher := range hashers {
+		hashes[algorithm] = fmt.Sprintf("%x", hasher.Sum(nil))
+	}
+
+	return hashes, nil
+}
+
+// HashingReader hashes everything read through it, so data can be verified
+// in the same pass that writes it
+type HashingReader struct {
+	reader io.Reader
+	hasher hash.Hash
+}
+
+// NewHashingReader wraps reader, hashing it with the named algorithm
+func NewHashingReader(reader io.Reader, algorithm string) (*HashingReader, error) {
+	hasher, err := newHasher(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &HashingReader{reader: reader, hasher: hasher}, nil
+}
+
+func (r *HashingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.hasher.Write(p[:n])
+	}
+	return n, err
+}
+
+// Sum returns the hex digest of everything read so far
+func (r *HashingReader) Sum() string {
+	return fmt.Sprintf("%x", r.hasher.Sum(nil))
+}
+
+// newHasher returns a fresh hash.Hash for the named algorithm
+func newHasher(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+	}
 }
 
 // VerifyHash verifies a file against an expected hash
@@ -1,9 +1,15 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestNewHashCalculator(t *testing.T) {
@@ -177,3 +183,109 @@ func TestCalculateHashLargeFile(t *testing.T) {
 		t.Errorf("MD5 hash length = %d, want 32", len(hash))
 	}
 }
+
+func TestCalculateHashes(t *testing.T) {
+	calc := NewHashCalculator()
+
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "multi.bin")
+	content := make([]byte, 100*1024) // Spans several read buffers
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	if err := os.WriteFile(testFile, content, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	algorithms := []string{"md5", "sha1", "sha256"}
+	hashes, err := calc.CalculateHashes(testFile, algorithms)
+	if err != nil {
+		t.Fatalf("CalculateHashes failed: %v", err)
+	}
+
+	if len(hashes) != len(algorithms) {
+		t.Fatalf("CalculateHashes returned %d hashes, want %d", len(hashes), len(algorithms))
+	}
+
+	for _, algorithm := range algorithms {
+		single, err := calc.CalculateHash(testFile, algorithm)
+		if err != nil {
+			t.Fatalf("CalculateHash(%s) failed: %v", algorithm, err)
+		}
+		if hashes[algorithm] != single {
+			t.Errorf("CalculateHashes()[%s] = %s, want %s", algorithm, hashes[algorithm], single)
+		}
+	}
+}
+
+func TestCalculateHashesUnsupportedAlgorithm(t *testing.T) {
+	calc := NewHashCalculator()
+
+	testFile := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if _, err := calc.CalculateHashes(testFile, []string{"sha256", "crc32"}); err == nil {
+		t.Error("Expected error for unsupported algorithm, got nil")
+	}
+}
+
+func TestHashingReader(t *testing.T) {
+	content := strings.Repeat("streamed content ", 4096)
+
+	reader, err := NewHashingReader(strings.NewReader(content), "sha256")
+	if err != nil {
+		t.Fatalf("NewHashingReader failed: %v", err)
+	}
+
+	var out strings.Builder
+	if _, err := io.Copy(&out, reader); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if out.String() != content {
+		t.Error("HashingReader changed the data passing through it")
+	}
+
+	want := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	if got := reader.Sum(); got != want {
+		t.Errorf("Sum() = %s, want %s", got, want)
+	}
+
+	if _, err := NewHashingReader(strings.NewReader(content), "crc32"); err == nil {
+		t.Error("NewHashingReader() error = nil, want an unsupported algorithm error")
+	}
+}
+
+func TestCalculateHashReader(t *testing.T) {
+	calc := NewHashCalculator()
+	content := strings.Repeat("hash me from memory ", 5000)
+
+	testFile := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	for _, algorithm := range calc.GetSupportedAlgorithms() {
+		t.Run(algorithm, func(t *testing.T) {
+			fromReader, err := calc.CalculateHashReader(strings.NewReader(content), algorithm)
+			if err != nil {
+				t.Fatalf("CalculateHashReader(%s) failed: %v", algorithm, err)
+			}
+			fromFile, err := calc.CalculateHash(testFile, algorithm)
+			if err != nil {
+				t.Fatalf("CalculateHash(%s) failed: %v", algorithm, err)
+			}
+			if fromReader != fromFile {
+				t.Errorf("CalculateHashReader(%s) = %s, CalculateHash = %s", algorithm, fromReader, fromFile)
+			}
+		})
+	}
+
+	if _, err := calc.CalculateHashReader(strings.NewReader(content), "crc32"); err == nil {
+		t.Error("CalculateHashReader() error = nil, want an unsupported algorithm error")
+	}
+	if _, err := calc.CalculateHashReader(iotest.ErrReader(io.ErrUnexpectedEOF), "sha256"); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("CalculateHashReader() error = %v, want the read error", err)
+	}
+}
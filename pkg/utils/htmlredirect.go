@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxLandingPageSize is how much of an HTML landing page is read when looking for a redirect
+const maxLandingPageSize = 512 * 1024
+
+var (
+	metaTagPattern        = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	httpEquivPattern      = regexp.MustCompile(`(?i)http-equiv\s*=\s*["']?refresh`)
+	metaContentPattern    = regexp.MustCompile(`(?is)content\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	refreshURLPattern     = regexp.MustCompile(`(?i)^\s*\d*(?:\.\d+)?\s*[;,]\s*url\s*=\s*['"]?([^'"]+)['"]?\s*$`)
+	jsLocationPattern     = regexp.MustCompile(`(?:window\.|document\.|top\.|self\.)?location(?:\.href)?\s*=\s*["']([^"']+)["']`)
+	jsLocationCallPattern = regexp.MustCompile(`(?:window\.|document\.|top\.|self\.)?location\.(?:replace|assign)\(\s*["']([^"']+)["']\s*\)`)
+)
+
+// ResolveHTMLRedirects follows landing pages that redirect with a
+// <meta http-equiv="refresh"> tag or a window.location assignment instead of
+// a 3xx status, and returns the URL of the first response that isn't such a
+// page. Every hop counts against options.MaxRedirects.
+func (h *HTTPClient) ResolveHTMLRedirects(ctx context.Context, urlStr string, options *DownloadOptions) (string, error) {
+	maxRedirects := DefaultMaxRedirects
+	if options != nil && options.MaxRedirects != 0 {
+		maxRedirects = options.MaxRedirects
+	}
+
+	visited := map[string]bool{}
+	current := urlStr
+	for hops := 0; ; hops++ {
+		visited[current] = true
+
+		target, err := h.htmlRedirectTarget(ctx, current, options)
+		if err != nil {
+			return "", err
+		}
+		if target == "" {
+			return current, nil
+		}
+
+		if visited[target] {
+			return "", fmt.Errorf("%w: %s was already visited", ErrRedirectLoop, target)
+		}
+		if hops >= maxRedirects {
+			return "", fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, max(maxRedirects, 0))
+		}
+
+		h.log(ctx).Debugf("Following HTML redirect from %s to %s", current, target)
+		current = target
+	}
+}
+
+// htmlRedirectTarget fetches urlStr and returns the absolute URL its HTML
+// redirects to, or "" when the response isn't a redirecting HTML page
+func (h *HTTPClient) htmlRedirectTarget(ctx context.Context, urlStr string, options *DownloadOptions) (string, error) {
+	req := h.client.R().SetContext(withMaxRedirects(ctx, options)).SetDoNotParseResponse(true)
+	if options != nil && options.Headers != nil {
+		req.SetHeaders(options.Headers)
+	}
+
+	resp, err := req.Get(urlStr)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch landing page: %w", err)
+	}
+
+	body := resp.RawBody()
+	defer body.Close()
+
+	if resp.StatusCode() != http.StatusOK {
+		return "", nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header().Get("Content-Type")); mediaType != "text/html" {
+		return "", nil
+	}
+
+	page, err := io.ReadAll(io.LimitReader(body, maxLandingPageSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read landing page: %w", err)
+	}
+
+	target := findHTMLRedirect(string(page))
+	if target == "" {
+		return "", nil
+	}
+
+	base, err := url.Parse(responseURL(resp, urlStr))
+	if err != nil {
+		return "", fmt.Errorf("invalid landing page URL: %w", err)
+	}
+	ref, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid HTML redirect target %q: %w", target, err)
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+// findHTMLRedirect returns the redirect target of a page, preferring a meta
+// refresh over a script assignment, or "" if it has neither
+func findHTMLRedirect(page string) string {
+	for _, tag := range metaTagPattern.FindAllString(page, -1) {
+		if !httpEquivPattern.MatchString(tag) {
+			continue
+		}
+		content := metaContentPattern.FindStringSubmatch(tag)
+		if content == nil {
+			continue
+		}
+		value := content[1] + content[2]
+		if match := refreshURLPattern.FindStringSubmatch(html.UnescapeString(value)); match != nil {
+			return strings.TrimSpace(match[1])
+		}
+	}
+
+	for _, pattern := range []*regexp.Regexp{jsLocationPattern, jsLocationCallPattern} {
+		if match := pattern.FindStringSubmatch(page); match != nil {
+			return html.UnescapeString(match[1])
+		}
+	}
+
+	return ""
+}
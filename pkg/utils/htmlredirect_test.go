@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFindHTMLRedirect(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{
+			name: "meta refresh",
+			page: `<html><head><meta http-equiv="refresh" content="0; url=/files/report.pdf"></head></html>`,
+			want: "/files/report.pdf",
+		},
+		{
+			name: "meta refresh with attributes swapped and quoted url",
+			page: `<META CONTENT='5;URL="https://cdn.example.com/a.zip?x=1&amp;y=2"' HTTP-EQUIV=Refresh>`,
+			want: "https://cdn.example.com/a.zip?x=1&y=2",
+		},
+		{
+			name: "meta refresh without a url only reloads",
+			page: `<meta http-equiv="refresh" content="30">`,
+			want: "",
+		},
+		{
+			name: "window.location assignment",
+			page: `<script>window.location = "https://cdn.example.com/file.bin";</script>`,
+			want: "https://cdn.example.com/file.bin",
+		},
+		{
+			name: "location.href assignment",
+			page: `<script>setTimeout(function() { location.href='/download/file.bin' }, 100)</script>`,
+			want: "/download/file.bin",
+		},
+		{
+			name: "location.replace call",
+			page: `<script>window.location.replace("/download/file.bin")</script>`,
+			want: "/download/file.bin",
+		},
+		{
+			name: "other meta tags are ignored",
+			page: `<meta name="description" content="0; url=/nope"><p>Nothing here</p>`,
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findHTMLRedirect(tt.page); got != tt.want {
+				t.Errorf("findHTMLRedirect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// landingServer serves /file as a binary and HTML pages under /meta/N and
+// /js/N that redirect to N-1, ending at /file
+func landingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.WriteString(w, "the real file")
+	})
+	mux.HandleFunc("/meta/{n}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<html><head><meta http-equiv="refresh" content="0;url=%s"></head><body>Redirecting</body></html>`, nextHop(r, "meta"))
+	})
+	mux.HandleFunc("/js/{n}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><script>window.location.href = "%s";</script></html>`, nextHop(r, "js"))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<meta http-equiv="refresh" content="0; url=/loop">`)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func nextHop(r *http.Request, kind string) string {
+	var n int
+	fmt.Sscanf(r.PathValue("n"), "%d", &n)
+	if n <= 1 {
+		return "/file"
+	}
+	return fmt.Sprintf("/%s/%d", kind, n-1)
+}
+
+func TestHTTPClient_ResolveHTMLRedirects(t *testing.T) {
+	server := landingServer(t)
+
+	tests := []struct {
+		name         string
+		path         string
+		maxRedirects int
+		want         string
+		wantErr      error
+	}{
+		{name: "meta refresh page", path: "/meta/1", want: "/file"},
+		{name: "script redirect page", path: "/js/1", want: "/file"},
+		{name: "chain within limit", path: "/meta/3", maxRedirects: 3, want: "/file"},
+		{name: "chain over limit", path: "/js/4", maxRedirects: 3, wantErr: ErrTooManyRedirects},
+		{name: "page redirecting to itself", path: "/loop", wantErr: ErrRedirectLoop},
+		{name: "not a landing page", path: "/file", want: "/file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewHTTPClient()
+
+			got, err := client.ResolveHTMLRedirects(context.Background(), server.URL+tt.path, &DownloadOptions{MaxRedirects: tt.maxRedirects})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ResolveHTMLRedirects() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveHTMLRedirects() error = %v", err)
+			}
+			if got != server.URL+tt.want {
+				t.Errorf("ResolveHTMLRedirects() = %q, want %q", got, server.URL+tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,17 @@
 package utils
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -11,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/sirupsen/logrus"
@@ -19,6 +29,10 @@ import (
 type HTTPClient struct {
 	client *resty.Client
 	logger *logrus.Logger
+	netrc  *Netrc // Credentials added to requests by netrcAuth
+	// resolver picks the addresses connections go to, nil when there are
+	// no DNS overrides or custom DNS server
+	resolver *hostResolver
 }
 
 type ChunkInfo struct {
@@ -27,14 +41,68 @@ type ChunkInfo struct {
 	Size  int64
 }
 
+// ChunkState is how far a chunk of a chunked download has got
+type ChunkState int
+
+const (
+	ChunkPending ChunkState = iota
+	ChunkDownloading
+	ChunkCompleted
+	ChunkFailed
+)
+
+// spotCheckSampleSize is the length of each byte range re-read by a spot check
+const spotCheckSampleSize = 4096
+
+// ErrSpotCheckFailed is returned when re-read byte ranges don't match the downloaded file
+var ErrSpotCheckFailed = errors.New("spot check failed")
+
+// resumeTailSize is how many bytes at the end of a partial file are re-read
+// and compared with the server before the download is resumed from there
+const resumeTailSize = 4096
+
+// DefaultMaxRetryAfter caps how long a server-provided Retry-After may delay a retry
+const DefaultMaxRetryAfter = 2 * time.Minute
+
 type DownloadOptions struct {
-	ChunkSize    int64
-	MaxRetries   int
-	RetryDelay   time.Duration
-	Headers      map[string]string
-	UserAgent    string
-	Timeout      time.Duration
-	ProgressFunc func(downloaded, total int64)
+	ChunkSize           int64
+	MaxRetries          int
+	RetryDelay          time.Duration
+	MaxRetryAfter       time.Duration // Upper bound for Retry-After delays, defaults to DefaultMaxRetryAfter
+	Headers             map[string]string
+	UserAgent           string
+	Timeout             time.Duration
+	Resume              bool
+	Concurrency         int    // Maximum chunks downloaded in parallel, defaults to 1
+	AdaptiveConcurrency bool   // Start with one connection and grow while throughput improves
+	MinChunkedSize      int64  // Files smaller than this are downloaded with a single request
+	SpotChecks          int    // Number of random byte ranges re-read and compared after a chunked download
+	IfRange             string // ETag of the partial file, resumes an unknown-size download while the server still matches it
+	MaxRedirects        int    // Redirects followed per request, defaults to DefaultMaxRedirects, negative disables them
+	Segments            int    // When above 1, stream this many contiguous ranges in parallel instead of downloading chunks
+	HashAlgorithm       string // Hash single-request downloads with this algorithm as they stream, reported in DownloadStats.Hash
+	Journal             bool   // Sync each chunk and record it in a journal next to the file, resume then trusts only journaled chunks
+	ForceSimple         bool   // Always fetch the file with one plain GET, never with ranges, for hosts that mishandle them
+	TotalRetryBudget    int    // Retries shared by all chunks of a download, defaults to MaxRetries for each chunk
+	WriteBufferSize     int64  // When positive, chunks are buffered up to this many bytes and written in contiguous runs
+	UseMmap             bool   // With Journal, preallocate the file and copy chunks into a memory mapping of it, falling back to WriteAt where that fails
+	ProgressFunc        func(downloaded, total int64)
+	ChunkFunc           func(index int) // Called as each chunk or segment is written, concurrently for segments
+	// ChunkStateFunc is called as each chunk of a chunked download is
+	// planned, requested, written or fails, from one goroutine at a time.
+	// Chunks a resumed download already has go straight to completed.
+	ChunkStateFunc func(index int, chunk ChunkInfo, state ChunkState)
+}
+
+// DownloadStats reports how a file download was carried out
+type DownloadStats struct {
+	ChunksUsed      int
+	Resumed         bool
+	Retries         int
+	PeakConcurrency int    // Most chunks that were in flight at the same time
+	FinalURL        string // URL the content was served from after redirects
+	Filename        string // Content-Disposition filename of the download's responses, empty if none gave one
+	Hash            string // Hash computed while streaming, empty unless DownloadOptions.HashAlgorithm applied
 }
 
 func NewHTTPClient() *HTTPClient {
@@ -43,21 +111,224 @@ func NewHTTPClient() *HTTPClient {
 	client.SetRetryCount(3)
 	client.SetRetryWaitTime(2 * time.Second)
 	client.SetRetryMaxWaitTime(10 * time.Second)
+	client.SetRetryAfter(func(c *resty.Client, resp *resty.Response) (time.Duration, error) {
+		// Zero makes resty fall back to its own backoff
+		delay, _ := parseRetryAfter(resp.Header().Get("Retry-After"), time.Now())
+		return delay, nil
+	})
+	client.AddRetryCondition(func(resp *resty.Response, err error) bool {
+		// Chunks and segments retry in their own loops, against the retry budget
+		if resp != nil && resp.Request.Context().Value(noClientRetryKey{}) != nil {
+			return false
+		}
+		// A certificate that fails verification won't pass on the next attempt either
+		var certErr *tls.CertificateVerificationError
+		return err != nil && !errors.As(err, &certErr) && !isRedirectError(err)
+	})
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(redirectPolicy))
 	client.SetHeader("User-Agent", "Go-Downloader/1.0")
 
 	logger := logrus.New()
 	logger.SetLevel(logrus.InfoLevel)
 
-	return &HTTPClient{
+	h := &HTTPClient{
 		client: client,
 		logger: logger,
 	}
+	client.OnBeforeRequest(h.netrcAuth)
+
+	return h
+}
+
+// ClientConfig holds transport settings for NewHTTPClientWithConfig
+type ClientConfig struct {
+	InsecureSkipVerify  bool          // Accept any server certificate, only meant for trusted self-hosted endpoints
+	CACertFile          string        // PEM file with extra root CAs trusted alongside the system pool
+	MaxIdleConnsPerHost int           // Keep-alive connections kept per host, size it to the download concurrency
+	MaxConnsPerHost     int           // Limit on connections per host, zero leaves it unlimited
+	IdleConnTimeout     time.Duration // How long an unused keep-alive connection is kept open
+	// DialTimeout, TLSHandshakeTimeout and ResponseHeaderTimeout bound the
+	// stages before the body starts, so a server that stalls there fails
+	// fast while a long body transfer is still allowed the full timeout
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	NetrcFile             string // netrc file with per-host credentials sent as Basic auth
+	// HTTPVersion selects the protocol, "" is the same as HTTPVersionAuto
+	HTTPVersion HTTPVersion
+	// DNSOverride connects to the IP given for a host, such as
+	// "203.0.113.7" or "127.0.0.1:8443", instead of resolving it, while
+	// requests and TLS still name the host. DNSServer resolves the other
+	// hosts with the DNS server at this IP, port 53 unless given.
+	DNSOverride map[string]string
+	DNSServer   string
+}
+
+// dialKeepAlive is the keep-alive period of connections opened with a DialTimeout
+const dialKeepAlive = 30 * time.Second
+
+// NewHTTPClientWithConfig creates a client like NewHTTPClient with the given
+// TLS and connection pool settings applied. Zero values keep the defaults. A
+// nil config is the same as NewHTTPClient.
+func NewHTTPClientWithConfig(config *ClientConfig) (*HTTPClient, error) {
+	h := NewHTTPClient()
+	if config == nil {
+		return h, nil
+	}
+
+	if config.InsecureSkipVerify || config.CACertFile != "" {
+		tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+
+		if config.CACertFile != "" {
+			pem, err := os.ReadFile(config.CACertFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA certificate file: %w", err)
+			}
+
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no valid certificates found in %s", config.CACertFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		h.client.SetTLSClientConfig(tlsConfig)
+	}
+
+	if config.MaxIdleConnsPerHost > 0 || config.MaxConnsPerHost > 0 || config.IdleConnTimeout > 0 {
+		transport, err := h.client.Transport()
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure connection pool: %w", err)
+		}
+		if config.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+			if transport.MaxIdleConns > 0 && transport.MaxIdleConns < config.MaxIdleConnsPerHost {
+				transport.MaxIdleConns = config.MaxIdleConnsPerHost
+			}
+		}
+		if config.MaxConnsPerHost > 0 {
+			transport.MaxConnsPerHost = config.MaxConnsPerHost
+		}
+		if config.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = config.IdleConnTimeout
+		}
+	}
+
+	if config.DialTimeout > 0 || config.TLSHandshakeTimeout > 0 || config.ResponseHeaderTimeout > 0 {
+		transport, err := h.client.Transport()
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure timeouts: %w", err)
+		}
+		if config.DialTimeout > 0 {
+			dialer := &net.Dialer{Timeout: config.DialTimeout, KeepAlive: dialKeepAlive}
+			transport.DialContext = dialer.DialContext
+		}
+		if config.TLSHandshakeTimeout > 0 {
+			transport.TLSHandshakeTimeout = config.TLSHandshakeTimeout
+		}
+		if config.ResponseHeaderTimeout > 0 {
+			transport.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+		}
+	}
+
+	resolver, err := newHostResolver(config.DNSOverride, config.DNSServer)
+	if err != nil {
+		return nil, err
+	}
+	if resolver != nil {
+		transport, err := h.client.Transport()
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure DNS: %w", err)
+		}
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{KeepAlive: dialKeepAlive}).DialContext
+		}
+		transport.DialContext = resolver.dialContext(dial)
+		h.resolver = resolver
+	}
+
+	// Last, since an HTTP/3 round tripper replaces the transport configured above
+	if config.HTTPVersion != "" && config.HTTPVersion != HTTPVersionAuto {
+		version, err := ParseHTTPVersion(string(config.HTTPVersion))
+		if err != nil {
+			return nil, err
+		}
+		transport, err := h.client.Transport()
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure HTTP version: %w", err)
+		}
+		h.client.SetTransport(withHTTPVersion(transport, version, resolver))
+	}
+
+	if config.NetrcFile != "" {
+		netrc, err := LoadNetrc(config.NetrcFile)
+		if err != nil {
+			return nil, err
+		}
+		h.SetNetrc(netrc)
+	}
+
+	return h, nil
 }
 
 func (h *HTTPClient) SetLogger(logger *logrus.Logger) {
 	h.logger = logger
 }
 
+// log returns the client's logger with the request ID from ctx attached
+func (h *HTTPClient) log(ctx context.Context) *logrus.Entry {
+	return LoggerFromContext(ctx, h.logger)
+}
+
+// SetTransport replaces the underlying HTTP transport, e.g. to route requests through a proxy or test server
+func (h *HTTPClient) SetTransport(transport http.RoundTripper) {
+	h.client.SetTransport(transport)
+}
+
+// CookieJar returns the jar the client keeps cookies in, so requests made
+// with another http.Client can share them
+func (h *HTTPClient) CookieJar() http.CookieJar {
+	return h.client.GetClient().Jar
+}
+
+// Do sends req the way the client's own requests go: through its
+// transport, with its TLS, proxy and DNS settings and -debug-http logging,
+// its cookie jar, timeout, default headers such as the User-Agent and netrc
+// credentials. Headers req already has are kept. Redirects are followed
+// under the client's redirect policy, or, unless followRedirects, returned
+// for the caller to handle. The caller closes the response body.
+func (h *HTTPClient) Do(req *http.Request, followRedirects bool) (*http.Response, error) {
+	client := *h.client.GetClient()
+	if !followRedirects {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	for name, values := range h.client.Header {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+
+	if req.Header.Get("Authorization") == "" && req.URL.User == nil {
+		if auth := h.netrcAuthorization(req.URL.Hostname()); auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+	}
+
+	return client.Do(req)
+}
+
+// CloseIdleConnections closes keep-alive connections that aren't in use
+func (h *HTTPClient) CloseIdleConnections() {
+	h.client.GetClient().CloseIdleConnections()
+}
+
 func (h *HTTPClient) GetFileInfo(ctx context.Context, urlStr string, headers map[string]string) (*FileInfo, error) {
 	req := h.client.R().SetContext(ctx)
 
@@ -71,25 +342,75 @@ func (h *HTTPClient) GetFileInfo(ctx context.Context, urlStr string, headers map
 	}
 
 	if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusPartialContent {
+		// Some servers refuse HEAD but answer a ranged GET just fine
+		h.log(ctx).Debugf("HEAD returned %d, probing with a ranged GET", resp.StatusCode())
+		return h.probeFileInfo(ctx, urlStr, headers)
+	}
+
+	return fileInfoFromHeader(urlStr, resp.Header()), nil
+}
+
+// probeFileInfo gets file info with a GET for the first byte. A 206 reply
+// gives the size in its Content-Range and shows ranges are supported. A 200
+// reply ignored the range, so whatever its Accept-Ranges says, ranges aren't
+// supported.
+func (h *HTTPClient) probeFileInfo(ctx context.Context, urlStr string, headers map[string]string) (*FileInfo, error) {
+	req := h.client.R().SetContext(ctx).SetDoNotParseResponse(true)
+
+	if headers != nil {
+		req.SetHeaders(headers)
+	}
+	req.SetHeader("Range", "bytes=0-0")
+
+	resp, err := req.Get(urlStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	resp.RawBody().Close()
+
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		fileInfo := fileInfoFromHeader(urlStr, resp.Header())
+		fileInfo.SupportsRangeRequests = false
+		return fileInfo, nil
+	case http.StatusPartialContent:
+		fileInfo := fileInfoFromHeader(urlStr, resp.Header())
+		fileInfo.Size = 0
+		fileInfo.SizeKnown = false
+		if _, _, total, err := parseContentRange(resp.Header().Get("Content-Range")); err == nil && total > 0 {
+			fileInfo.Size = total
+			fileInfo.SizeKnown = true
+		}
+		fileInfo.SupportsRangeRequests = true
+		return fileInfo, nil
+	default:
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode())
 	}
+}
 
+// fileInfoFromHeader reads the file info in the headers of a response for urlStr
+func fileInfoFromHeader(urlStr string, header http.Header) *FileInfo {
 	fileInfo := &FileInfo{
 		URL: urlStr,
 	}
 
-	if contentLength := resp.Header().Get("Content-Length"); contentLength != "" {
-		if size, err := strconv.ParseInt(contentLength, 10, 64); err == nil {
+	if contentLength := header.Get("Content-Length"); contentLength != "" {
+		if size, err := strconv.ParseInt(contentLength, 10, 64); err == nil && size >= 0 {
 			fileInfo.Size = size
+			fileInfo.SizeKnown = true
 		}
 	}
 
-	if contentDisposition := resp.Header().Get("Content-Disposition"); contentDisposition != "" {
+	if contentDisposition := header.Get("Content-Disposition"); contentDisposition != "" {
 		if filename := extractFilename(contentDisposition); filename != "" {
 			fileInfo.Filename = filename
 		}
 	}
 
+	if fileInfo.Filename == "" {
+		fileInfo.Filename = QueryFilename(urlStr)
+	}
+
 	if fileInfo.Filename == "" {
 		if parsedURL, err := url.Parse(fileInfo.URL); err == nil {
 			fileInfo.Filename = path.Base(parsedURL.Path)
@@ -99,23 +420,31 @@ func (h *HTTPClient) GetFileInfo(ctx context.Context, urlStr string, headers map
 		}
 	}
 
-	fileInfo.SupportsRangeRequests = resp.Header().Get("Accept-Ranges") == "bytes"
+	fileInfo.SupportsRangeRequests = header.Get("Accept-Ranges") == "bytes"
+	fileInfo.ContentType = header.Get("Content-Type")
 
-	if etag := resp.Header().Get("ETag"); etag != "" {
+	if etag := header.Get("ETag"); etag != "" {
 		fileInfo.ETag = strings.Trim(etag, `"`)
 	}
 
-	if lastModified := resp.Header().Get("Last-Modified"); lastModified != "" {
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
 		if t, err := time.Parse(time.RFC1123, lastModified); err == nil {
 			fileInfo.LastModified = &t
 		}
 	}
 
-	return fileInfo, nil
+	return fileInfo
 }
 
 func (h *HTTPClient) DownloadChunk(ctx context.Context, urlStr string, chunk ChunkInfo, options *DownloadOptions) ([]byte, error) {
-	req := h.client.R().SetContext(ctx)
+	data, _, _, err := h.downloadChunk(ctx, urlStr, chunk, options)
+	return data, err
+}
+
+// downloadChunk downloads a single chunk and also reports how many retries it
+// took and the URL that served it
+func (h *HTTPClient) downloadChunk(ctx context.Context, urlStr string, chunk ChunkInfo, options *DownloadOptions) ([]byte, int, string, error) {
+	req := h.client.R().SetContext(withoutClientRetries(withMaxRedirects(ctx, options))).SetLogger(discardRestyLogger{})
 
 	if options != nil && options.Headers != nil {
 		req.SetHeaders(options.Headers)
@@ -126,6 +455,7 @@ func (h *HTTPClient) DownloadChunk(ctx context.Context, urlStr string, chunk Chu
 
 	maxRetries := 3
 	retryDelay := 2 * time.Second
+	maxRetryAfter := DefaultMaxRetryAfter
 	if options != nil {
 		if options.MaxRetries > 0 {
 			maxRetries = options.MaxRetries
@@ -133,129 +463,703 @@ func (h *HTTPClient) DownloadChunk(ctx context.Context, urlStr string, chunk Chu
 		if options.RetryDelay > 0 {
 			retryDelay = options.RetryDelay
 		}
+		if options.MaxRetryAfter > 0 {
+			maxRetryAfter = options.MaxRetryAfter
+		}
 	}
 
 	var lastErr error
+	wait := retryDelay
+	budget := retryBudgetFromContext(ctx)
+	retries := retryLogFromContext(ctx)
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
-			h.logger.Warnf("Retrying chunk download (attempt %d/%d) for range %d-%d",
+			if !budget.take() {
+				return nil, attempt - 1, "", fmt.Errorf("%w after %d attempts of this chunk: %w", ErrRetryBudgetExhausted, attempt, lastErr)
+			}
+			retries.warnf(h.log(ctx), "Retrying chunk download (attempt %d/%d) for range %d-%d",
 				attempt, maxRetries, chunk.Start, chunk.End)
 
 			select {
 			case <-ctx.Done():
-				return nil, ctx.Err()
-			case <-time.After(retryDelay):
+				return nil, attempt - 1, "", ctx.Err()
+			case <-time.After(wait):
 			}
 		}
+		wait = retryDelay
 
 		resp, err := req.Get(urlStr)
 		if err != nil {
+			if isRedirectError(err) {
+				return nil, attempt, "", fmt.Errorf("HTTP request failed: %w", err)
+			}
 			lastErr = fmt.Errorf("HTTP request failed: %w", err)
 			continue
 		}
 
 		if resp.StatusCode() != http.StatusPartialContent && resp.StatusCode() != http.StatusOK {
 			lastErr = fmt.Errorf("unexpected status code: %d", resp.StatusCode())
+
+			if resp.StatusCode() == http.StatusTooManyRequests || resp.StatusCode() == http.StatusServiceUnavailable {
+				if delay, ok := parseRetryAfter(resp.Header().Get("Retry-After"), time.Now()); ok {
+					if delay > maxRetryAfter {
+						delay = maxRetryAfter
+					}
+					if delay > wait {
+						wait = delay
+					}
+					h.log(ctx).Debugf("Server asked to retry after %v, waiting %v", delay, wait)
+				}
+			}
 			continue
 		}
 
+		// A missing Content-Range is tolerated, the length check below still applies
+		if contentRange := resp.Header().Get("Content-Range"); resp.StatusCode() == http.StatusPartialContent && contentRange != "" {
+			start, end, _, err := parseContentRange(contentRange)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if start != chunk.Start || end != chunk.End {
+				lastErr = fmt.Errorf("server returned range %d-%d, requested %d-%d", start, end, chunk.Start, chunk.End)
+				continue
+			}
+		}
+
 		body := resp.Body()
 		if int64(len(body)) != chunk.Size {
 			lastErr = fmt.Errorf("received %d bytes, expected %d bytes", len(body), chunk.Size)
 			continue
 		}
 
-		return body, nil
+		recordFilename(ctx, resp.Header())
+		return body, attempt, responseURL(resp, urlStr), nil
 	}
 
-	return nil, fmt.Errorf("failed to download chunk after %d attempts: %w", maxRetries+1, lastErr)
+	return nil, maxRetries, "", fmt.Errorf("failed to download chunk after %d attempts: %w", maxRetries+1, lastErr)
 }
 
-func (h *HTTPClient) DownloadToFile(ctx context.Context, urlStr, filename string, options *DownloadOptions) error {
-	fileInfo, err := h.GetFileInfo(ctx, urlStr, options.Headers)
-	if err != nil {
-		return fmt.Errorf("failed to get file info: %w", err)
+func (h *HTTPClient) DownloadToFile(ctx context.Context, urlStr, filename string, options *DownloadOptions) (*DownloadStats, error) {
+	return h.DownloadToFileWithInfo(ctx, urlStr, filename, nil, options)
+}
+
+// DownloadToFileWithInfo downloads like DownloadToFile but reuses already fetched
+// file info instead of probing the URL again. A nil fileInfo triggers a probe.
+func (h *HTTPClient) DownloadToFileWithInfo(ctx context.Context, urlStr, filename string, fileInfo *FileInfo, options *DownloadOptions) (*DownloadStats, error) {
+	ctx, recorder := withFilenameRecorder(ctx)
+	stats, err := h.downloadToFile(ctx, urlStr, filename, fileInfo, options)
+	if stats != nil {
+		stats.Filename = recorder.get()
+	}
+	return stats, err
+}
+
+// downloadToFile picks how to download urlStr for DownloadToFileWithInfo
+func (h *HTTPClient) downloadToFile(ctx context.Context, urlStr, filename string, fileInfo *FileInfo, options *DownloadOptions) (*DownloadStats, error) {
+	ctx = withMaxRedirects(ctx, options)
+
+	if options != nil && options.ForceSimple {
+		h.log(ctx).Debug("Chunking is disabled, using simple download")
+		return h.downloadSimple(ctx, urlStr, filename, options)
+	}
+
+	if fileInfo == nil {
+		var headers map[string]string
+		if options != nil {
+			headers = options.Headers
+		}
+
+		var err error
+		fileInfo, err = h.GetFileInfo(ctx, urlStr, headers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file info: %w", err)
+		}
 	}
 
 	if fileInfo.Size == 0 {
+		if options != nil && options.Resume && options.IfRange != "" && !strings.HasPrefix(options.IfRange, "W/") {
+			if info, err := os.Stat(filename); err == nil && info.Size() > 0 {
+				return h.downloadRevalidated(ctx, urlStr, filename, info.Size(), options)
+			}
+		}
 		return h.downloadSimple(ctx, urlStr, filename, options)
 	}
 
 	if !fileInfo.SupportsRangeRequests {
-		h.logger.Warn("Server doesn't support range requests, falling back to simple download")
+		h.log(ctx).Warn("Server doesn't support range requests, falling back to simple download")
 		return h.downloadSimple(ctx, urlStr, filename, options)
 	}
 
-	chunkSize := int64(1024 * 1024) // 1MB default
-	if options != nil && options.ChunkSize > 0 {
-		chunkSize = options.ChunkSize
+	if options != nil && fileInfo.Size < options.MinChunkedSize {
+		h.log(ctx).Debugf("File is smaller than %s, using simple download", FormatBytes(options.MinChunkedSize))
+		return h.downloadSimple(ctx, urlStr, filename, options)
 	}
 
-	return h.downloadChunked(ctx, urlStr, filename, fileInfo.Size, chunkSize, options)
+	var stats *DownloadStats
+	var err error
+	if options != nil && options.Segments > 1 {
+		stats, err = h.downloadSegmented(ctx, urlStr, filename, fileInfo.Size, options.Segments, options)
+	} else {
+		chunkSize := int64(1024 * 1024) // 1MB default
+		if options != nil && options.ChunkSize > 0 {
+			chunkSize = options.ChunkSize
+		}
+		stats, err = h.downloadChunked(ctx, urlStr, filename, fileInfo.Size, chunkSize, options)
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	if options != nil && options.SpotChecks > 0 {
+		if err := h.SpotCheck(ctx, urlStr, filename, fileInfo, options.SpotChecks, options); err != nil {
+			// The file has the right size but wrong content, don't let it pass as complete
+			os.Remove(filename)
+			return stats, err
+		}
+	}
+
+	return stats, nil
 }
 
-func (h *HTTPClient) downloadSimple(ctx context.Context, urlStr, filename string, options *DownloadOptions) error {
-	req := h.client.R().SetContext(ctx)
+// SpotCheck re-requests samples random byte ranges of urlStr and compares
+// them against the file at filePath, which should hold all of info.Size bytes
+func (h *HTTPClient) SpotCheck(ctx context.Context, urlStr, filePath string, info *FileInfo, samples int, options *DownloadOptions) error {
+	if info.Size <= 0 {
+		return nil
+	}
 
-	if options != nil && options.Headers != nil {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file for spot check: %w", err)
+	}
+	defer file.Close()
+
+	sampleSize := int64(spotCheckSampleSize)
+	if sampleSize > info.Size {
+		sampleSize = info.Size
+	}
+
+	local := make([]byte, sampleSize)
+	for i := 0; i < samples; i++ {
+		start := rand.Int64N(info.Size - sampleSize + 1)
+		chunk := ChunkInfo{Start: start, End: start + sampleSize - 1, Size: sampleSize}
+
+		remote, err := h.DownloadChunk(ctx, urlStr, chunk, options)
+		if err != nil {
+			return fmt.Errorf("spot check request failed: %w", err)
+		}
+
+		if _, err := file.ReadAt(local, start); err != nil {
+			return fmt.Errorf("failed to read file for spot check: %w", err)
+		}
+
+		if !bytes.Equal(local, remote) {
+			return fmt.Errorf("%w: bytes %d-%d differ from the server", ErrSpotCheckFailed, chunk.Start, chunk.End)
+		}
+	}
+
+	h.log(ctx).Debugf("Spot check passed (%d samples)", samples)
+	return nil
+}
+
+// matchesResumeTail re-requests the last bytes of the partial file, which
+// is existingSize bytes long, and reports whether they match the server. A
+// mismatch means the file changed since the partial download, so resuming
+// would stitch two versions together.
+func (h *HTTPClient) matchesResumeTail(ctx context.Context, urlStr, filename string, existingSize int64, options *DownloadOptions) (bool, error) {
+	tailSize := int64(resumeTailSize)
+	if tailSize > existingSize {
+		tailSize = existingSize
+	}
+	chunk := ChunkInfo{Start: existingSize - tailSize, End: existingSize - 1, Size: tailSize}
+
+	remote, err := h.DownloadChunk(ctx, urlStr, chunk, options)
+	if err != nil {
+		return false, fmt.Errorf("failed to re-read the end of the partial file: %w", err)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, fmt.Errorf("failed to open partial file: %w", err)
+	}
+	defer file.Close()
+
+	local := make([]byte, tailSize)
+	if _, err := file.ReadAt(local, chunk.Start); err != nil {
+		return false, fmt.Errorf("failed to read partial file: %w", err)
+	}
+
+	return bytes.Equal(local, remote), nil
+}
+
+// checkResumeTail returns existingSize if the partial file can be resumed,
+// or zero to start over because its tail doesn't match the server
+func (h *HTTPClient) checkResumeTail(ctx context.Context, urlStr, filename string, existingSize int64, options *DownloadOptions) (int64, error) {
+	if existingSize == 0 {
+		return 0, nil
+	}
+
+	matches, err := h.matchesResumeTail(ctx, urlStr, filename, existingSize, options)
+	if err != nil {
+		return 0, err
+	}
+	if !matches {
+		h.log(ctx).Warn("Partial file doesn't match the server's copy, restarting the download")
+		return 0, nil
+	}
+	return existingSize, nil
+}
+
+// downloadSimple fetches the whole file with a single request. The body is
+// copied through a buffer the size of a chunk so slow filesystems see a few
+// large writes instead of one per network read.
+func (h *HTTPClient) downloadSimple(ctx context.Context, urlStr, filename string, options *DownloadOptions) (*DownloadStats, error) {
+	opened, err := h.OpenDownload(ctx, urlStr, options)
+	if err != nil {
+		return nil, err
+	}
+	return h.DownloadOpened(ctx, opened, filename, options)
+}
+
+// downloadRevalidated continues a download of unknown size from the end of
+// the partial file. If-Range makes the server send only the missing bytes
+// while the file still has the same ETag, and the whole file once it changed.
+func (h *HTTPClient) downloadRevalidated(ctx context.Context, urlStr, filename string, existingSize int64, options *DownloadOptions) (*DownloadStats, error) {
+	req := h.client.R().SetContext(ctx).SetDoNotParseResponse(true)
+
+	if options.Headers != nil {
 		req.SetHeaders(options.Headers)
 	}
+	req.SetHeader("Range", fmt.Sprintf("bytes=%d-", existingSize))
+	req.SetHeader("If-Range", `"`+options.IfRange+`"`)
+
+	resp, err := req.Get(urlStr)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
 
-	file, err := os.Create(filename)
+	body := resp.RawBody()
+	defer drainBody(body)
+
+	recordFilename(ctx, resp.Header())
+	stats := &DownloadStats{ChunksUsed: 1, FinalURL: responseURL(resp, urlStr)}
+	flags := os.O_WRONLY
+	switch resp.StatusCode() {
+	case http.StatusPartialContent:
+		h.log(ctx).Infof("Resuming download after %s", FormatBytes(existingSize))
+		flags |= os.O_APPEND
+		stats.Resumed = true
+	case http.StatusOK:
+		h.log(ctx).Info("File changed on the server since the partial download, restarting")
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The version we have is no longer than the partial file, so it's complete
+		stats.Resumed = true
+		return stats, nil
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+
+	file, err := os.OpenFile(filename, flags, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	resp, err := req.SetOutput(filename).Get(urlStr)
+	if _, err := io.Copy(file, body); err != nil {
+		return stats, fmt.Errorf("failed to write response: %w", err)
+	}
+
+	return stats, nil
+}
+
+// DownloadStream writes the response body of urlStr to w as it arrives,
+// without touching the filesystem, and returns the number of bytes written
+func (h *HTTPClient) DownloadStream(ctx context.Context, urlStr string, w io.Writer, options *DownloadOptions) (int64, error) {
+	req := h.client.R().SetContext(withMaxRedirects(ctx, options)).SetDoNotParseResponse(true)
+
+	if options != nil && options.Headers != nil {
+		req.SetHeaders(options.Headers)
+	}
+
+	resp, err := req.Get(urlStr)
 	if err != nil {
-		return fmt.Errorf("download failed: %w", err)
+		return 0, fmt.Errorf("download failed: %w", err)
 	}
 
+	body := resp.RawBody()
+	defer drainBody(body)
+
 	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode())
+		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode())
 	}
 
-	return nil
+	if options != nil && options.ProgressFunc != nil {
+		w = &progressWriter{w: w, total: resp.RawResponse.ContentLength, progress: options.ProgressFunc}
+	}
+
+	written, err := io.Copy(w, body)
+	if err != nil {
+		return written, fmt.Errorf("failed to stream response: %w", err)
+	}
+
+	return written, nil
+}
+
+// progressWriter reports the running byte count of everything written through it
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress func(downloaded, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.progress(p.written, p.total)
+	return n, err
 }
 
-func (h *HTTPClient) downloadChunked(ctx context.Context, urlStr, filename string, totalSize, chunkSize int64, options *DownloadOptions) error {
-	file, err := os.Create(filename)
+func (h *HTTPClient) downloadChunked(ctx context.Context, urlStr, filename string, totalSize, chunkSize int64, options *DownloadOptions) (*DownloadStats, error) {
+	resume := options != nil && options.Resume
+
+	// With a journal, the chunks it lists are all that's trusted of a partial
+	// file. Its size says nothing, chunks past a gap extend it too.
+	var journal *Journal
+	if options != nil && options.Journal {
+		if !resume {
+			if err := RemoveJournal(filename); err != nil {
+				return nil, fmt.Errorf("failed to reset journal: %w", err)
+			}
+		}
+		var err error
+		journal, err = OpenJournal(JournalPath(filename))
+		if err != nil {
+			return nil, err
+		}
+		defer journal.Close()
+	}
+
+	// Keep an existing partial file around when resuming, chunks it already
+	// fully covers are skipped below
+	var existingSize int64
+	if resume && journal == nil {
+		if info, err := os.Stat(filename); err == nil && info.Size() < totalSize {
+			existingSize, err = h.checkResumeTail(ctx, urlStr, filename, info.Size(), options)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// A shared writable mapping needs the file open for reading too
+	flags := os.O_CREATE | os.O_WRONLY
+	if options != nil && options.UseMmap && journal != nil {
+		flags = os.O_CREATE | os.O_RDWR
+	}
+	if existingSize == 0 && (journal == nil || len(journal.Completed()) == 0) {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(filename, flags, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
 	defer file.Close()
 
 	chunks := calculateChunks(totalSize, chunkSize)
+	stats := &DownloadStats{}
+
+	chunkState := func(index int, state ChunkState) {
+		if options != nil && options.ChunkStateFunc != nil {
+			options.ChunkStateFunc(index, chunks[index], state)
+		}
+	}
 
-	// Download chunks sequentially for now
-	// TODO: Implement parallel downloading with worker pool
 	var downloaded int64
-	for _, chunk := range chunks {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+	completed := make([]bool, len(chunks))
+	var pending []int
+	for i, chunk := range chunks {
+		chunkState(i, ChunkPending)
+		if chunk.End < existingSize || (journal != nil && journal.Covers(chunk.Start, chunk.End)) {
+			completed[i] = true
+			downloaded += chunk.Size
+			stats.Resumed = true
+			chunkState(i, ChunkCompleted)
+			continue
 		}
+		pending = append(pending, i)
+	}
 
-		data, err := h.DownloadChunk(ctx, urlStr, chunk, options)
-		if err != nil {
-			return fmt.Errorf("failed to download chunk %d-%d: %w", chunk.Start, chunk.End, err)
+	maxConcurrency := 1
+	adaptive := false
+	if options != nil {
+		if options.Concurrency > 0 {
+			maxConcurrency = options.Concurrency
 		}
+		adaptive = options.AdaptiveConcurrency
+	}
+	controller := newConcurrencyController(maxConcurrency, adaptive, time.Now())
 
-		if _, err := file.WriteAt(data, chunk.Start); err != nil {
-			return fmt.Errorf("failed to write chunk to file: %w", err)
+	maxRetries := 3
+	if options != nil && options.MaxRetries > 0 {
+		maxRetries = options.MaxRetries
+	}
+	retryLog := newRetryLog("chunks")
+	defer retryLog.flush(h.log(ctx))
+	workerCtx, cancel := context.WithCancel(withRetryLog(withRetryBudget(ctx, newRetryBudget(options, maxRetries, len(pending))), retryLog))
+	defer cancel()
+
+	// Workers write chunks through out, the file itself or a mapping of it
+	var out io.WriterAt = file
+	var synced syncer = file
+	// A preallocated file has its full size from the start, so only a
+	// journal can tell what of it was written if the download is killed
+	var mapped *mappedFile
+	if options != nil && options.UseMmap && journal != nil && len(pending) > 0 {
+		if mapped, err = mmapFile(file, totalSize); err != nil {
+			h.log(ctx).Debugf("Memory-mapped writes unavailable, using regular writes: %v", err)
+			mapped = nil
+		} else {
+			out, synced = mapped, mapped
+			defer mapped.Close()
+		}
+	}
+
+	// Without a journal, finished chunks may be held in memory and written
+	// in contiguous runs. A journal needs each chunk on disk as it finishes.
+	var coalescer *writeCoalescer
+	if options != nil && options.WriteBufferSize > 0 && journal == nil && mapped == nil && len(pending) > 0 {
+		coalescer = newWriteCoalescer(file, chunks[pending[0]].Start, options.WriteBufferSize)
+	}
+
+	type chunkResult struct {
+		index    int
+		data     []byte // Set instead of writing the chunk when coalescing
+		retries  int
+		finalURL string
+		err      error
+	}
+	results := make(chan chunkResult)
+
+	var firstErr error
+	active, next := 0, 0
+	for active > 0 || (firstErr == nil && next < len(pending)) {
+		for firstErr == nil && active < controller.Limit() && next < len(pending) {
+			index := pending[next]
+			next++
+			active++
+			if active > stats.PeakConcurrency {
+				stats.PeakConcurrency = active
+			}
+			chunkState(index, ChunkDownloading)
+
+			go func() {
+				chunk := chunks[index]
+				data, retries, finalURL, err := h.downloadChunk(workerCtx, urlStr, chunk, options)
+				var buffered []byte
+				if err != nil {
+					err = fmt.Errorf("failed to download chunk %d-%d: %w", chunk.Start, chunk.End, err)
+				} else if coalescer != nil {
+					buffered = data
+				} else if _, writeErr := out.WriteAt(data, chunk.Start); writeErr != nil {
+					err = fmt.Errorf("failed to write chunk to file: %w", writeErr)
+				} else if journal != nil {
+					err = journalChunk(synced, journal, chunk)
+				}
+				results <- chunkResult{index: index, data: buffered, retries: retries, finalURL: finalURL, err: err}
+			}()
+		}
+
+		res := <-results
+		active--
+		stats.Retries += res.retries
+
+		if res.err == nil && coalescer != nil {
+			res.err = coalescer.Add(chunks[res.index].Start, res.data)
+		}
+		if res.err != nil {
+			chunkState(res.index, ChunkFailed)
+			if firstErr == nil {
+				firstErr = res.err
+				cancel()
+			}
+			continue
 		}
 
-		downloaded += chunk.Size
+		if res.retries > 0 {
+			controller.OnError(time.Now())
+		} else {
+			controller.OnSuccess(chunks[res.index].Size, time.Now())
+		}
+
+		if stats.FinalURL == "" {
+			stats.FinalURL = res.finalURL
+		}
+		completed[res.index] = true
+		chunkState(res.index, ChunkCompleted)
+		if options != nil && options.ChunkFunc != nil {
+			options.ChunkFunc(res.index)
+		}
+		stats.ChunksUsed++
+		downloaded += chunks[res.index].Size
 		if options != nil && options.ProgressFunc != nil {
 			options.ProgressFunc(downloaded, totalSize)
 		}
 	}
 
+	// Chunks still buffered count as completed, they have to reach the file
+	if coalescer != nil {
+		if err := coalescer.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// The file can only be truncated once nothing maps it
+	if mapped != nil {
+		if err := mapped.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to unmap file: %w", err)
+		}
+	}
+
+	if firstErr != nil && journal != nil {
+		// Every finished chunk is journaled, gaps and all, so nothing is thrown away
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		return stats, firstErr
+	}
+
+	if firstErr != nil {
+		// Chunks finish out of order, so drop everything past the contiguous
+		// completed prefix to keep the partial file safe to resume
+		var prefix int64
+		for i, chunk := range chunks {
+			if !completed[i] {
+				break
+			}
+			prefix = chunk.End + 1
+		}
+		if coalescer != nil && coalescer.runStart < prefix {
+			// A failed flush left part of the completed prefix unwritten
+			prefix = coalescer.runStart
+		}
+		if err := file.Truncate(prefix); err != nil {
+			h.log(ctx).Warnf("Failed to truncate partial file: %v", err)
+		}
+
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		return stats, firstErr
+	}
+
+	if journal != nil {
+		if err := journal.Remove(); err != nil {
+			h.log(ctx).Warnf("Failed to remove journal: %v", err)
+		}
+	}
+
+	if stats.Resumed {
+		if journal != nil {
+			h.log(ctx).Infof("Resumed download with %d journaled chunks", len(chunks)-len(pending))
+		} else {
+			h.log(ctx).Infof("Resumed download from %s", FormatBytes(existingSize))
+		}
+	}
+	if stats.FinalURL == "" {
+		// Every chunk was already on disk
+		stats.FinalURL = urlStr
+	}
+
+	return stats, nil
+}
+
+// syncer is a file, or a mapping of one, that can be flushed to disk
+type syncer interface {
+	Sync() error
+}
+
+// journalChunk makes a written chunk durable and then records it, so the
+// journal never lists bytes that a crash could still lose
+func journalChunk(file syncer, journal *Journal, chunk ChunkInfo) error {
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync chunk to disk: %w", err)
+	}
+	if err := journal.Record(chunk.Start, chunk.End); err != nil {
+		return err
+	}
 	return nil
 }
 
+// parseContentRange parses a "bytes start-end/total" Content-Range header.
+// The total is -1 when the server gives it as "*".
+func parseContentRange(value string) (start, end, total int64, err error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("unsupported Content-Range: %q", value)
+	}
+
+	rangePart, totalPart, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("malformed Content-Range: %q", value)
+	}
+
+	startPart, endPart, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("malformed Content-Range: %q", value)
+	}
+
+	start, err = strconv.ParseInt(strings.TrimSpace(startPart), 10, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed Content-Range start: %q", value)
+	}
+	end, err = strconv.ParseInt(strings.TrimSpace(endPart), 10, 64)
+	if err != nil || end < start {
+		return 0, 0, 0, fmt.Errorf("malformed Content-Range end: %q", value)
+	}
+
+	total = -1
+	if totalPart = strings.TrimSpace(totalPart); totalPart != "*" {
+		total, err = strconv.ParseInt(totalPart, 10, 64)
+		if err != nil || total <= end {
+			return 0, 0, 0, fmt.Errorf("malformed Content-Range total: %q", value)
+		}
+	}
+
+	return start, end, total, nil
+}
+
+// parseRetryAfter parses a Retry-After header given either as delay-seconds or as an HTTP-date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > int64(math.MaxInt64/time.Second) {
+			return time.Duration(math.MaxInt64), true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
 func calculateChunks(totalSize, chunkSize int64) []ChunkInfo {
 	var chunks []ChunkInfo
 
@@ -275,29 +1179,84 @@ func calculateChunks(totalSize, chunkSize int64) []ChunkInfo {
 	return chunks
 }
 
+// QueryFilename returns the filename in the response-content-disposition
+// query parameter of a signed S3 or GCS style URL, or "" if there is none.
+// Servers that don't honour the parameter leave it as the only hint.
+func QueryFilename(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return extractFilename(parsedURL.Query().Get("response-content-disposition"))
+}
+
+// extendedFilenameRe matches the RFC 5987 filename* parameter, which
+// mime.ParseMediaType only decodes for UTF-8 and US-ASCII
+var extendedFilenameRe = regexp.MustCompile(`(?i)filename\*\s*=\s*([^;\s]+)`)
+
 func extractFilename(contentDisposition string) string {
 	// Try to extract filename from Content-Disposition header
-	// Format: attachment; filename="filename.ext" or filename*=UTF-8''filename.ext
+	// Format: attachment; filename="filename.ext" and/or filename*=UTF-8''filename.ext
+	// When both are present the extended filename* form wins (RFC 6266)
+	if contentDisposition == "" {
+		return ""
+	}
 
-	// First try the standard filename parameter
+	// Decode filename* ourselves first so charsets the mime package
+	// doesn't know about still take precedence over the plain filename
+	if matches := extendedFilenameRe.FindStringSubmatch(contentDisposition); len(matches) > 1 {
+		if decoded, ok := decodeExtendedValue(matches[1]); ok && decoded != "" {
+			return decoded
+		}
+	}
+
+	if _, params, err := mime.ParseMediaType(contentDisposition); err == nil {
+		if name := strings.TrimSpace(params["filename"]); name != "" {
+			return name
+		}
+		return ""
+	}
+
+	// Fall back to a lenient match for malformed headers such as unquoted names with spaces
 	re := regexp.MustCompile(`filename="?([^";\r\n]+)"?`)
 	matches := re.FindStringSubmatch(contentDisposition)
 	if len(matches) > 1 {
 		return strings.TrimSpace(matches[1])
 	}
 
-	// Try filename* for UTF-8 encoded filenames
-	re = regexp.MustCompile(`filename\*=UTF-8''([^;\r\n]+)`)
-	matches = re.FindStringSubmatch(contentDisposition)
-	if len(matches) > 1 {
-		// URL decode the filename
-		if decoded, err := url.QueryUnescape(matches[1]); err == nil {
-			return decoded
-		}
-		return matches[1]
+	return ""
+}
+
+// decodeExtendedValue decodes an RFC 5987 ext-value of the form
+// charset'language'percent-encoded-value
+func decodeExtendedValue(value string) (string, bool) {
+	value = strings.Trim(value, `"`)
+	parts := strings.SplitN(value, "'", 3)
+	if len(parts) != 3 {
+		return "", false
 	}
 
-	return ""
+	raw, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "utf-8", "us-ascii":
+		if !utf8.ValidString(raw) {
+			return "", false
+		}
+		return raw, true
+	case "iso-8859-1", "latin1":
+		// Latin-1 bytes map directly onto the first 256 Unicode code points
+		runes := make([]rune, len(raw))
+		for i := 0; i < len(raw); i++ {
+			runes[i] = rune(raw[i])
+		}
+		return string(runes), true
+	default:
+		return "", false
+	}
 }
 
 // FileInfo represents information about a downloadable file
@@ -305,6 +1264,8 @@ type FileInfo struct {
 	URL                   string
 	Filename              string
 	Size                  int64
+	SizeKnown             bool // The server gave the size, so a zero Size is an empty file rather than an unknown one
+	ContentType           string
 	ETag                  string
 	LastModified          *time.Time
 	SupportsRangeRequests bool
@@ -1,15 +1,26 @@
 package utils
 
 import (
+	"bytes"
 	"context"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 )
 
 func TestNewHTTPClient(t *testing.T) {
@@ -27,11 +38,12 @@ func TestNewHTTPClient(t *testing.T) {
 
 func TestHTTPClient_GetFileInfo(t *testing.T) {
 	tests := []struct {
-		name           string
-		setupServer    func() *httptest.Server
-		expectError    bool
-		expectFilename string
-		expectSize     int64
+		name            string
+		setupServer     func() *httptest.Server
+		expectError     bool
+		expectFilename  string
+		expectSize      int64
+		expectSizeKnown bool
 	}{
 		{
 			name: "successful file info with content-disposition",
@@ -48,9 +60,10 @@ func TestHTTPClient_GetFileInfo(t *testing.T) {
 					w.WriteHeader(http.StatusOK)
 				}))
 			},
-			expectError:    false,
-			expectFilename: "test.txt",
-			expectSize:     1024,
+			expectError:     false,
+			expectFilename:  "test.txt",
+			expectSize:      1024,
+			expectSizeKnown: true,
 		},
 		{
 			name: "file info from URL path",
@@ -60,9 +73,32 @@ func TestHTTPClient_GetFileInfo(t *testing.T) {
 					w.WriteHeader(http.StatusOK)
 				}))
 			},
-			expectError:    false,
-			expectFilename: "",
-			expectSize:     2048,
+			expectError:     false,
+			expectFilename:  "",
+			expectSize:      2048,
+			expectSizeKnown: true,
+		},
+		{
+			name: "empty file",
+			setupServer: func() *httptest.Server {
+				return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Length", "0")
+					w.WriteHeader(http.StatusOK)
+				}))
+			},
+			expectSize:      0,
+			expectSizeKnown: true,
+		},
+		{
+			name: "no content length",
+			setupServer: func() *httptest.Server {
+				return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Transfer-Encoding", "chunked")
+					w.WriteHeader(http.StatusOK)
+				}))
+			},
+			expectSize:      0,
+			expectSizeKnown: false,
 		},
 		{
 			name: "server error",
@@ -107,10 +143,92 @@ func TestHTTPClient_GetFileInfo(t *testing.T) {
 			if fileInfo.Size != tt.expectSize {
 				t.Errorf("Expected size %d, got %d", tt.expectSize, fileInfo.Size)
 			}
+			if fileInfo.SizeKnown != tt.expectSizeKnown {
+				t.Errorf("Expected SizeKnown %v, got %v", tt.expectSizeKnown, fileInfo.SizeKnown)
+			}
+		})
+	}
+}
+
+// noHeadServer rejects HEAD with 405 and serves content to every GET,
+// honouring Range headers only when ranges is set
+func noHeadServer(content []byte, ranges bool, gets *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		gets.Add(1)
+		if !ranges {
+			r.Header.Del("Range")
+		}
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(content))
+	}))
+}
+
+func TestHTTPClient_GetFileInfo_HeadNotAllowed(t *testing.T) {
+	content := bytes.Repeat([]byte("no head "), 512)
+
+	tests := []struct {
+		name        string
+		ranges      bool
+		expectRange bool
+	}{
+		{name: "size from content-range", ranges: true, expectRange: true},
+		{name: "size from content-length when range is ignored", ranges: false, expectRange: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets atomic.Int32
+			server := noHeadServer(content, tt.ranges, &gets)
+			defer server.Close()
+
+			fileInfo, err := NewHTTPClient().GetFileInfo(context.Background(), server.URL+"/data.bin", nil)
+			if err != nil {
+				t.Fatalf("GetFileInfo failed: %v", err)
+			}
+			if fileInfo.Size != int64(len(content)) {
+				t.Errorf("Size = %d, want %d", fileInfo.Size, len(content))
+			}
+			if fileInfo.SupportsRangeRequests != tt.expectRange {
+				t.Errorf("SupportsRangeRequests = %v, want %v", fileInfo.SupportsRangeRequests, tt.expectRange)
+			}
+			if fileInfo.Filename != "data.bin" {
+				t.Errorf("Filename = %q, want data.bin", fileInfo.Filename)
+			}
+			if gets.Load() != 1 {
+				t.Errorf("GET requests = %d, want 1", gets.Load())
+			}
 		})
 	}
 }
 
+func TestHTTPClient_DownloadToFile_HeadNotAllowed(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256)
+
+	var gets atomic.Int32
+	server := noHeadServer(content, true, &gets)
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "data.bin")
+	stats, err := NewHTTPClient().DownloadToFile(context.Background(), server.URL+"/data.bin", filename, &DownloadOptions{ChunkSize: 1024})
+	if err != nil {
+		t.Fatalf("DownloadToFile failed: %v", err)
+	}
+
+	if stats.ChunksUsed != 4 {
+		t.Errorf("ChunksUsed = %d, want 4", stats.ChunksUsed)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("downloaded content doesn't match")
+	}
+}
+
 func TestHTTPClient_DownloadChunk(t *testing.T) {
 	testData := "Hello, World! This is test data for chunk download."
 
@@ -160,6 +278,95 @@ func TestHTTPClient_DownloadChunk(t *testing.T) {
 	}
 }
 
+func TestHTTPClient_DownloadChunk_ContentRange(t *testing.T) {
+	testData := "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	tests := []struct {
+		name        string
+		offset      int  // Shift applied to the range the server sends back
+		omitHeader  bool // Send 206 without a Content-Range header
+		wantErr     bool
+		wantRetries bool
+	}{
+		{name: "correct range", offset: 0},
+		{name: "shifted range", offset: 3, wantErr: true, wantRetries: true},
+		{name: "missing header", omitHeader: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+
+				var start, end int
+				if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+					http.Error(w, "Invalid range", http.StatusBadRequest)
+					return
+				}
+				start += tt.offset
+				end += tt.offset
+
+				if !tt.omitHeader {
+					w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(testData)))
+				}
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte(testData[start : end+1]))
+			}))
+			defer server.Close()
+
+			client := NewHTTPClient()
+			chunk := ChunkInfo{Start: 10, End: 19, Size: 10}
+			options := &DownloadOptions{MaxRetries: 2, RetryDelay: time.Millisecond}
+
+			data, err := client.DownloadChunk(context.Background(), server.URL, chunk, options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DownloadChunk() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(data) != testData[10:20] {
+				t.Errorf("DownloadChunk() = %q, want %q", data, testData[10:20])
+			}
+			if tt.wantRetries && requests.Load() != 3 {
+				t.Errorf("server saw %d requests, want the mismatch retried", requests.Load())
+			}
+		})
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantStart int64
+		wantEnd   int64
+		wantTotal int64
+		wantErr   bool
+	}{
+		{value: "bytes 0-499/1234", wantStart: 0, wantEnd: 499, wantTotal: 1234},
+		{value: "bytes 500-999/*", wantStart: 500, wantEnd: 999, wantTotal: -1},
+		{value: "bytes */1234", wantErr: true},
+		{value: "items 0-10/20", wantErr: true},
+		{value: "bytes 10-5/20", wantErr: true},
+		{value: "bytes 0-19/20", wantStart: 0, wantEnd: 19, wantTotal: 20},
+		{value: "bytes 0-20/20", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			start, end, total, err := parseContentRange(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseContentRange(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if start != tt.wantStart || end != tt.wantEnd || total != tt.wantTotal {
+				t.Errorf("parseContentRange(%q) = %d, %d, %d, want %d, %d, %d",
+					tt.value, start, end, total, tt.wantStart, tt.wantEnd, tt.wantTotal)
+			}
+		})
+	}
+}
+
 func TestCalculateChunks(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -251,6 +458,46 @@ func TestExtractFilename(t *testing.T) {
 			contentDisposition: `attachment; filename="file with spaces.txt"`,
 			expected:           "file with spaces.txt",
 		},
+		{
+			name:               "extended filename wins over plain filename",
+			contentDisposition: `attachment; filename="fallback.txt"; filename*=UTF-8''%E2%82%AC%20rates.txt`,
+			expected:           "€ rates.txt",
+		},
+		{
+			name:               "extended filename before plain filename",
+			contentDisposition: `attachment; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf; filename="resume.pdf"`,
+			expected:           "résumé.pdf",
+		},
+		{
+			name:               "ISO-8859-1 extended filename",
+			contentDisposition: `attachment; filename="fallback.txt"; filename*=ISO-8859-1'en'caf%E9.txt`,
+			expected:           "café.txt",
+		},
+		{
+			name:               "unknown charset falls back to plain filename",
+			contentDisposition: `attachment; filename="fallback.txt"; filename*=KOI8-R''%F0%D2%C9.txt`,
+			expected:           "fallback.txt",
+		},
+		{
+			name:               "RTL Hebrew filename",
+			contentDisposition: `attachment; filename*=UTF-8''%D7%A9%D7%9C%D7%95%D7%9D.txt`,
+			expected:           "שלום.txt",
+		},
+		{
+			name:               "RTL Arabic filename",
+			contentDisposition: `attachment; filename*=utf-8''%D9%85%D9%84%D9%81.pdf`,
+			expected:           "ملف.pdf",
+		},
+		{
+			name:               "quoted filename with escaped quote",
+			contentDisposition: `attachment; filename="say \"hi\".txt"`,
+			expected:           `say "hi".txt`,
+		},
+		{
+			name:               "unquoted filename with spaces",
+			contentDisposition: `attachment; filename=file with spaces.txt`,
+			expected:           "file with spaces.txt",
+		},
 		{
 			name:               "no filename",
 			contentDisposition: `attachment`,
@@ -273,6 +520,60 @@ func TestExtractFilename(t *testing.T) {
 	}
 }
 
+func TestQueryFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{
+			name:     "S3 style",
+			url:      "https://bucket.s3.amazonaws.com/key?response-content-disposition=attachment%3B%20filename%3D%22file.pdf%22&X-Amz-Expires=300",
+			expected: "file.pdf",
+		},
+		{
+			name:     "GCS style with extended filename",
+			url:      "https://storage.googleapis.com/bucket/obj?response-content-disposition=attachment%3B%20filename%2A%3DUTF-8%27%27r%C3%A9sum%C3%A9.pdf",
+			expected: "résumé.pdf",
+		},
+		{
+			name:     "no parameter",
+			url:      "https://example.com/file.bin?token=abc",
+			expected: "",
+		},
+		{
+			name:     "parameter without filename",
+			url:      "https://example.com/file.bin?response-content-disposition=inline",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QueryFilename(tt.url); got != tt.expected {
+				t.Errorf("QueryFilename() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_GetFileInfo_QueryFilename(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "3")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	query := "?response-content-disposition=attachment%3B%20filename%3D%22file.pdf%22"
+	fileInfo, err := NewHTTPClient().GetFileInfo(context.Background(), server.URL+"/8f2c1d"+query, nil)
+	if err != nil {
+		t.Fatalf("GetFileInfo() error = %v", err)
+	}
+	if fileInfo.Filename != "file.pdf" {
+		t.Errorf("Filename = %q, want file.pdf", fileInfo.Filename)
+	}
+}
+
 func TestFormatBytes(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -330,7 +631,7 @@ func TestHTTPClient_DownloadToFile(t *testing.T) {
 		ChunkSize: 1024,
 	}
 
-	err := client.DownloadToFile(ctx, server.URL, filename, options)
+	_, err := client.DownloadToFile(ctx, server.URL, filename, options)
 	if err != nil {
 		t.Fatalf("DownloadToFile failed: %v", err)
 	}
@@ -390,3 +691,950 @@ func TestHTTPClientWithContext(t *testing.T) {
 		t.Errorf("Expected context deadline exceeded error, got: %v", err)
 	}
 }
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"seconds", "120", 120 * time.Second, true},
+		{"zero seconds", "0", 0, true},
+		{"HTTP date", now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{"HTTP date in the past", now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"empty", "", 0, false},
+		{"negative seconds", "-5", 0, false},
+		{"garbage", "soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := parseRetryAfter(tt.value, now)
+			if ok != tt.ok {
+				t.Fatalf("parseRetryAfter(%q) ok = %v, want %v", tt.value, ok, tt.ok)
+			}
+			if delay != tt.expected {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, delay, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_DownloadChunk_RetryAfter(t *testing.T) {
+	testData := "Hello, World!"
+
+	newThrottlingServer := func(retryAfter string) *httptest.Server {
+		var requests int
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				w.Header().Set("Retry-After", retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(testData[:5]))
+		}))
+	}
+
+	chunk := ChunkInfo{Start: 0, End: 4, Size: 5}
+
+	t.Run("waits for numeric Retry-After", func(t *testing.T) {
+		server := newThrottlingServer("1")
+		defer server.Close()
+
+		client := NewHTTPClient()
+		start := time.Now()
+		data, err := client.DownloadChunk(context.Background(), server.URL, chunk, &DownloadOptions{
+			RetryDelay: 10 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("DownloadChunk failed: %v", err)
+		}
+		if string(data) != "Hello" {
+			t.Errorf("Expected chunk data Hello, got %s", string(data))
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("Expected to wait at least 1s for Retry-After, waited %v", elapsed)
+		}
+	})
+
+	t.Run("waits for HTTP-date Retry-After", func(t *testing.T) {
+		server := newThrottlingServer(time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat))
+		defer server.Close()
+
+		client := NewHTTPClient()
+		start := time.Now()
+		if _, err := client.DownloadChunk(context.Background(), server.URL, chunk, &DownloadOptions{
+			RetryDelay: 10 * time.Millisecond,
+		}); err != nil {
+			t.Fatalf("DownloadChunk failed: %v", err)
+		}
+		// HTTP dates have second precision, so allow for truncation
+		if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+			t.Errorf("Expected to wait for the Retry-After date, waited %v", elapsed)
+		}
+	})
+
+	t.Run("caps absurd Retry-After", func(t *testing.T) {
+		server := newThrottlingServer("86400")
+		defer server.Close()
+
+		client := NewHTTPClient()
+		start := time.Now()
+		if _, err := client.DownloadChunk(context.Background(), server.URL, chunk, &DownloadOptions{
+			RetryDelay:    10 * time.Millisecond,
+			MaxRetryAfter: 50 * time.Millisecond,
+		}); err != nil {
+			t.Fatalf("DownloadChunk failed: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Expected Retry-After to be capped, waited %v", elapsed)
+		}
+	})
+
+	t.Run("respects context cancellation", func(t *testing.T) {
+		server := newThrottlingServer("30")
+		defer server.Close()
+
+		client := NewHTTPClient()
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := client.DownloadChunk(ctx, server.URL, chunk, &DownloadOptions{RetryDelay: 10 * time.Millisecond})
+		if err == nil {
+			t.Fatal("Expected error after context cancellation")
+		}
+		if !strings.Contains(err.Error(), "context deadline exceeded") {
+			t.Errorf("Expected context deadline exceeded error, got: %v", err)
+		}
+	})
+}
+
+func TestHTTPClient_SpotCheck(t *testing.T) {
+	content := []byte(strings.Repeat("spot check content ", 1000))
+	altered := bytes.ToUpper(content)
+	var serveAltered atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := content
+		if serveAltered.Load() {
+			data = altered
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "spot.txt")
+	options := &DownloadOptions{ChunkSize: 4096, RetryDelay: 10 * time.Millisecond}
+
+	if _, err := client.DownloadToFile(ctx, server.URL, filename, options); err != nil {
+		t.Fatalf("DownloadToFile failed: %v", err)
+	}
+
+	info := &FileInfo{URL: server.URL, Size: int64(len(content)), SupportsRangeRequests: true}
+
+	t.Run("matching content passes", func(t *testing.T) {
+		if err := client.SpotCheck(ctx, server.URL, filename, info, 5, options); err != nil {
+			t.Errorf("Expected spot check to pass, got: %v", err)
+		}
+	})
+
+	t.Run("altered re-read is detected", func(t *testing.T) {
+		serveAltered.Store(true)
+		defer serveAltered.Store(false)
+
+		err := client.SpotCheck(ctx, server.URL, filename, info, 5, options)
+		if !errors.Is(err, ErrSpotCheckFailed) {
+			t.Errorf("Expected ErrSpotCheckFailed, got: %v", err)
+		}
+	})
+
+	t.Run("download with spot checks enabled", func(t *testing.T) {
+		checked := filepath.Join(t.TempDir(), "checked.txt")
+		spotOptions := &DownloadOptions{ChunkSize: 4096, SpotChecks: 3}
+
+		if _, err := client.DownloadToFile(ctx, server.URL, checked, spotOptions); err != nil {
+			t.Fatalf("DownloadToFile with spot checks failed: %v", err)
+		}
+
+		data, err := os.ReadFile(checked)
+		if err != nil {
+			t.Fatalf("Failed to read downloaded file: %v", err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Error("Downloaded content does not match")
+		}
+	})
+}
+
+func TestHTTPClient_DownloadToFile_MinChunkedSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          int
+		wantRanged    bool
+		wantMinChunks int32
+	}{
+		{name: "small file uses single GET", size: 8 * 1024, wantRanged: false},
+		{name: "large file uses range requests", size: 64 * 1024, wantRanged: true, wantMinChunks: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := bytes.Repeat([]byte("x"), tt.size)
+			var gets, ranged atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					gets.Add(1)
+					if r.Header.Get("Range") != "" {
+						ranged.Add(1)
+					}
+				}
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+			}))
+			defer server.Close()
+
+			client := NewHTTPClient()
+			filename := filepath.Join(t.TempDir(), "file.bin")
+			options := &DownloadOptions{ChunkSize: 16 * 1024, MinChunkedSize: 32 * 1024}
+
+			if _, err := client.DownloadToFile(context.Background(), server.URL, filename, options); err != nil {
+				t.Fatalf("DownloadToFile failed: %v", err)
+			}
+
+			if tt.wantRanged {
+				if ranged.Load() < tt.wantMinChunks {
+					t.Errorf("Range requests = %d, want at least %d", ranged.Load(), tt.wantMinChunks)
+				}
+			} else {
+				if gets.Load() != 1 || ranged.Load() != 0 {
+					t.Errorf("GET requests = %d (ranged %d), want a single unranged GET", gets.Load(), ranged.Load())
+				}
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to read downloaded file: %v", err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Error("Downloaded content does not match")
+			}
+		})
+	}
+}
+
+func TestHTTPClient_downloadSimple_Buffered(t *testing.T) {
+	// Not a multiple of the buffer size, so the final Flush carries a partial buffer
+	content := bytes.Repeat([]byte("buffered write "), 20*1024+7)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Dribble the body out in small pieces like a slow connection
+		flusher := w.(http.Flusher)
+		for rest := content; len(rest) > 0; {
+			n := 1000
+			if n > len(rest) {
+				n = len(rest)
+			}
+			w.Write(rest[:n])
+			flusher.Flush()
+			rest = rest[n:]
+		}
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	filename := filepath.Join(t.TempDir(), "buffered.bin")
+
+	stats, err := client.downloadSimple(context.Background(), server.URL, filename, &DownloadOptions{ChunkSize: 64 * 1024})
+	if err != nil {
+		t.Fatalf("downloadSimple failed: %v", err)
+	}
+	if stats.ChunksUsed != 1 {
+		t.Errorf("ChunksUsed = %d, want 1", stats.ChunksUsed)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("file has %d bytes, want %d matching bytes", len(data), len(content))
+	}
+}
+
+func TestHTTPClient_downloadSimple_StreamingHash(t *testing.T) {
+	content := bytes.Repeat([]byte("hash me while streaming "), 10*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	calculator := NewHashCalculator()
+
+	for _, algorithm := range calculator.GetSupportedAlgorithms() {
+		t.Run(algorithm, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "hashed.bin")
+
+			stats, err := client.downloadSimple(context.Background(), server.URL, filename, &DownloadOptions{HashAlgorithm: algorithm})
+			if err != nil {
+				t.Fatalf("downloadSimple failed: %v", err)
+			}
+
+			want, err := calculator.CalculateHash(filename, algorithm)
+			if err != nil {
+				t.Fatalf("CalculateHash failed: %v", err)
+			}
+			if stats.Hash != want {
+				t.Errorf("streamed hash = %s, want %s", stats.Hash, want)
+			}
+		})
+	}
+
+	t.Run("not requested", func(t *testing.T) {
+		stats, err := client.downloadSimple(context.Background(), server.URL, filepath.Join(t.TempDir(), "plain.bin"), nil)
+		if err != nil {
+			t.Fatalf("downloadSimple failed: %v", err)
+		}
+		if stats.Hash != "" {
+			t.Errorf("Hash = %q, want none when no algorithm is set", stats.Hash)
+		}
+	})
+}
+
+func TestHTTPClient_downloadSimple_ErrorStatusWritesNothing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	client.client.SetRetryCount(0)
+	filename := filepath.Join(t.TempDir(), "missing.bin")
+
+	if _, err := client.downloadSimple(context.Background(), server.URL, filename, nil); err == nil {
+		t.Fatal("Expected an error for a 404 response")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("error page was written to disk: %v", err)
+	}
+}
+
+func BenchmarkHTTPClient_downloadSimple(b *testing.B) {
+	content := bytes.Repeat([]byte("x"), 8*1024*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	filename := filepath.Join(b.TempDir(), "bench.bin")
+
+	for _, bufferSize := range []int64{4 * 1024, 1024 * 1024} {
+		b.Run(FormatBytes(bufferSize), func(b *testing.B) {
+			options := &DownloadOptions{ChunkSize: bufferSize}
+			b.SetBytes(int64(len(content)))
+			for i := 0; i < b.N; i++ {
+				if _, err := client.downloadSimple(context.Background(), server.URL, filename, options); err != nil {
+					b.Fatalf("downloadSimple failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPClient_DownloadToFile_IfRangeResume(t *testing.T) {
+	original := []byte(strings.Repeat("version one of the file ", 64))
+	partial := original[:500]
+
+	tests := []struct {
+		name        string
+		serverETag  string
+		serverBody  []byte
+		wantResumed bool
+	}{
+		{name: "unchanged file appends", serverETag: `"v1"`, serverBody: original, wantResumed: true},
+		{name: "changed file restarts", serverETag: `"v2"`, serverBody: []byte(strings.Repeat("version two ", 100)), wantResumed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRange, gotIfRange string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRange = r.Header.Get("Range")
+				gotIfRange = r.Header.Get("If-Range")
+				w.Header().Set("ETag", tt.serverETag)
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(tt.serverBody))
+			}))
+			defer server.Close()
+
+			filename := filepath.Join(t.TempDir(), "unknown-size.bin")
+			if err := os.WriteFile(filename, partial, 0644); err != nil {
+				t.Fatalf("Failed to write partial file: %v", err)
+			}
+
+			client := NewHTTPClient()
+			info := &FileInfo{URL: server.URL, Filename: "unknown-size.bin", SupportsRangeRequests: true}
+			options := &DownloadOptions{Resume: true, IfRange: "v1"}
+
+			stats, err := client.DownloadToFileWithInfo(context.Background(), server.URL, filename, info, options)
+			if err != nil {
+				t.Fatalf("DownloadToFileWithInfo failed: %v", err)
+			}
+
+			if gotRange != fmt.Sprintf("bytes=%d-", len(partial)) {
+				t.Errorf("Range = %q, want the bytes after the partial file", gotRange)
+			}
+			if gotIfRange != `"v1"` {
+				t.Errorf("If-Range = %q, want %q", gotIfRange, `"v1"`)
+			}
+			if stats.Resumed != tt.wantResumed {
+				t.Errorf("Resumed = %v, want %v", stats.Resumed, tt.wantResumed)
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to read downloaded file: %v", err)
+			}
+			if !bytes.Equal(data, tt.serverBody) {
+				t.Errorf("file has %d bytes, want the server's %d byte body", len(data), len(tt.serverBody))
+			}
+		})
+	}
+}
+
+func TestHTTPClient_DownloadToFile_ResumeTailCheck(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1024) // 16KB, 16 chunks of 1KB
+	chunkSize := int64(1024)
+	existing := 6 * chunkSize
+
+	tests := []struct {
+		name        string
+		partial     []byte
+		wantResumed bool
+	}{
+		{name: "matching tail continues", partial: content[:existing], wantResumed: true},
+		{name: "mismatched tail restarts", partial: bytes.Repeat([]byte("x"), int(existing)), wantResumed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var ranges []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				mu.Unlock()
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+			}))
+			defer server.Close()
+
+			filename := filepath.Join(t.TempDir(), "partial.bin")
+			if err := os.WriteFile(filename, tt.partial, 0644); err != nil {
+				t.Fatalf("Failed to write partial file: %v", err)
+			}
+
+			client := NewHTTPClient()
+			info := &FileInfo{URL: server.URL, Size: int64(len(content)), SupportsRangeRequests: true}
+			options := &DownloadOptions{Resume: true, ChunkSize: chunkSize, Concurrency: 1}
+
+			stats, err := client.DownloadToFileWithInfo(context.Background(), server.URL, filename, info, options)
+			if err != nil {
+				t.Fatalf("DownloadToFileWithInfo failed: %v", err)
+			}
+
+			wantTail := fmt.Sprintf("bytes=%d-%d", existing-resumeTailSize, existing-1)
+			if len(ranges) == 0 || ranges[0] != wantTail {
+				t.Errorf("first request Range = %v, want the tail %q", ranges, wantTail)
+			}
+			if stats.Resumed != tt.wantResumed {
+				t.Errorf("Resumed = %v, want %v", stats.Resumed, tt.wantResumed)
+			}
+
+			// A resume only fetches the chunks after the partial file
+			wantRequests := 1 + int(int64(len(content))/chunkSize)
+			if tt.wantResumed {
+				wantRequests -= int(existing / chunkSize)
+			}
+			if len(ranges) != wantRequests {
+				t.Errorf("made %d requests, want %d", len(ranges), wantRequests)
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to read downloaded file: %v", err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Error("downloaded file doesn't match the server's content")
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientWithConfig(t *testing.T) {
+	content := "trusted through a custom CA"
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, certPEM, 0644); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		config  *ClientConfig
+		wantErr bool
+	}{
+		{name: "default verification rejects self-signed", config: nil, wantErr: true},
+		{name: "custom CA is trusted", config: &ClientConfig{CACertFile: caFile}},
+		{name: "insecure skips verification", config: &ClientConfig{InsecureSkipVerify: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewHTTPClientWithConfig(tt.config)
+			if err != nil {
+				t.Fatalf("NewHTTPClientWithConfig() error = %v", err)
+			}
+
+			_, err = client.GetFileInfo(context.Background(), server.URL, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetFileInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("missing CA file", func(t *testing.T) {
+		if _, err := NewHTTPClientWithConfig(&ClientConfig{CACertFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+			t.Error("Expected error for missing CA file")
+		}
+	})
+
+	t.Run("CA file without certificates", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "invalid.pem")
+		if err := os.WriteFile(invalid, []byte("not a certificate"), 0644); err != nil {
+			t.Fatalf("Failed to write CA file: %v", err)
+		}
+		if _, err := NewHTTPClientWithConfig(&ClientConfig{CACertFile: invalid}); err == nil {
+			t.Error("Expected error for CA file without certificates")
+		}
+	})
+}
+
+// poolServer counts the connections clients open and the most requests it
+// has served at once. Each request is held briefly so concurrent requests overlap.
+func poolServer(t *testing.T) (server *httptest.Server, newConns, peak *atomic.Int32) {
+	t.Helper()
+
+	newConns, peak = &atomic.Int32{}, &atomic.Int32{}
+	var active atomic.Int32
+	server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "ok")
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return server, newConns, peak
+}
+
+// fetchConcurrently issues n simultaneous GETs and waits for all of them
+func fetchConcurrently(t *testing.T, client *HTTPClient, url string, n int) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.client.R().Get(url); err != nil {
+				t.Errorf("GET failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNewHTTPClientWithConfig_ConnectionPool(t *testing.T) {
+	const workers = 8
+
+	t.Run("idle connections are kept for every worker", func(t *testing.T) {
+		server, newConns, peak := poolServer(t)
+		client, err := NewHTTPClientWithConfig(&ClientConfig{MaxIdleConnsPerHost: workers, IdleConnTimeout: time.Minute})
+		if err != nil {
+			t.Fatalf("NewHTTPClientWithConfig failed: %v", err)
+		}
+
+		fetchConcurrently(t, client, server.URL, workers)
+		fetchConcurrently(t, client, server.URL, workers)
+
+		if peak.Load() <= 2 {
+			t.Errorf("peak concurrent requests = %d, want more than 2", peak.Load())
+		}
+		// The second round reuses every connection of the first
+		if newConns.Load() != workers {
+			t.Errorf("connections opened = %d, want %d", newConns.Load(), workers)
+		}
+	})
+
+	t.Run("connections per host are capped", func(t *testing.T) {
+		server, _, peak := poolServer(t)
+		client, err := NewHTTPClientWithConfig(&ClientConfig{MaxConnsPerHost: 3})
+		if err != nil {
+			t.Fatalf("NewHTTPClientWithConfig failed: %v", err)
+		}
+
+		fetchConcurrently(t, client, server.URL, workers)
+
+		if peak.Load() > 3 {
+			t.Errorf("peak concurrent requests = %d, want at most 3", peak.Load())
+		}
+	})
+}
+
+func TestNewHTTPClientWithConfig_ResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("too late"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewHTTPClientWithConfig(&ClientConfig{
+		DialTimeout:           time.Second,
+		TLSHandshakeTimeout:   time.Second,
+		ResponseHeaderTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewHTTPClientWithConfig failed: %v", err)
+	}
+	// Fail on the first stall instead of waiting out resty's retries
+	client.client.SetRetryCount(0)
+	client.client.SetTimeout(10 * time.Second)
+
+	start := time.Now()
+	_, err = client.client.R().Get(server.URL)
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("expected a timeout waiting for response headers")
+	}
+	if !strings.Contains(err.Error(), "timeout awaiting response headers") {
+		t.Errorf("error = %v, want a response header timeout", err)
+	}
+	if elapsed >= 5*time.Second {
+		t.Errorf("request failed after %s, want well before the overall timeout", elapsed)
+	}
+}
+
+func TestHTTPClient_DownloadStream(t *testing.T) {
+	content := strings.Repeat("stream me ", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+
+	t.Run("writes body and reports progress", func(t *testing.T) {
+		var buf bytes.Buffer
+		var lastProgress int64
+		options := &DownloadOptions{ProgressFunc: func(downloaded, total int64) { lastProgress = downloaded }}
+
+		written, err := client.DownloadStream(context.Background(), server.URL, &buf, options)
+		if err != nil {
+			t.Fatalf("DownloadStream failed: %v", err)
+		}
+		if written != int64(len(content)) || buf.String() != content {
+			t.Errorf("DownloadStream wrote %d bytes, want %d matching bytes", written, len(content))
+		}
+		if lastProgress != int64(len(content)) {
+			t.Errorf("last progress = %d, want %d", lastProgress, len(content))
+		}
+	})
+
+	t.Run("error status writes nothing", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := client.DownloadStream(context.Background(), server.URL+"/missing", &buf, nil); err == nil {
+			t.Error("Expected error for 404 response")
+		}
+		if buf.Len() != 0 {
+			t.Errorf("wrote %d bytes for an error response, want 0", buf.Len())
+		}
+	})
+}
+
+// flakyServer answers its first requests, as many as failures, with a 503
+// and an error page too long for the transport to discard on its own, then
+// serves content with ranges. newConns counts the connections clients opened.
+func flakyServer(t *testing.T, content []byte, failures int32) (server *httptest.Server, newConns *atomic.Int32) {
+	t.Helper()
+
+	newConns = &atomic.Int32{}
+	var requests atomic.Int32
+	errorPage := strings.Repeat("<p>Service temporarily unavailable</p>\n", 20000)
+	server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, errorPage)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return server, newConns
+}
+
+func TestHTTPClient_RetriesReuseConnections(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 256))
+	options := &DownloadOptions{MaxRetries: 3, RetryDelay: time.Millisecond}
+
+	tests := []struct {
+		name     string
+		download func(client *HTTPClient, url string) error
+	}{
+		{
+			name: "chunk",
+			download: func(client *HTTPClient, url string) error {
+				_, err := client.DownloadChunk(context.Background(), url, ChunkInfo{Start: 0, End: 1023, Size: 1024}, options)
+				return err
+			},
+		},
+		{
+			name: "segment",
+			download: func(client *HTTPClient, url string) error {
+				filename := filepath.Join(t.TempDir(), "segment.bin")
+				_, err := client.downloadSegmented(context.Background(), url, filename, int64(len(content)), 1, options)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, newConns := flakyServer(t, content, 3)
+
+			if err := tt.download(NewHTTPClient(), server.URL); err != nil {
+				t.Fatalf("download failed after retries: %v", err)
+			}
+			if newConns.Load() != 1 {
+				t.Errorf("connections opened = %d, want 1 reused across every retry", newConns.Load())
+			}
+		})
+	}
+
+	t.Run("failed stream", func(t *testing.T) {
+		server, newConns := flakyServer(t, content, 2)
+		client := NewHTTPClient()
+
+		for range 2 {
+			if _, err := client.DownloadStream(context.Background(), server.URL, io.Discard, nil); err == nil {
+				t.Fatal("Expected the failing stream to return an error")
+			}
+		}
+		if _, err := client.DownloadStream(context.Background(), server.URL, io.Discard, nil); err != nil {
+			t.Fatalf("DownloadStream failed: %v", err)
+		}
+		if newConns.Load() != 1 {
+			t.Errorf("connections opened = %d, want 1 reused after the failures", newConns.Load())
+		}
+	})
+}
+
+func TestHTTPClient_downloadChunked_ChunkStates(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 320)) // 5 chunks of 1KB
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	fresh := []ChunkState{ChunkPending, ChunkDownloading, ChunkCompleted}
+	alreadyHad := []ChunkState{ChunkPending, ChunkCompleted}
+
+	tests := []struct {
+		name     string
+		existing int64 // Bytes of a partial file to resume from
+		want     [][]ChunkState
+	}{
+		{
+			name: "every chunk is fetched",
+			want: [][]ChunkState{fresh, fresh, fresh, fresh, fresh},
+		},
+		{
+			name:     "chunks of the partial file are completed from the start",
+			existing: 2048,
+			want:     [][]ChunkState{alreadyHad, alreadyHad, fresh, fresh, fresh},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "chunks.bin")
+			if tt.existing > 0 {
+				if err := os.WriteFile(filename, content[:tt.existing], 0644); err != nil {
+					t.Fatalf("Failed to create partial file: %v", err)
+				}
+			}
+
+			// Called from one goroutine at a time, so no lock is needed
+			states := make(map[int][]ChunkState)
+			options := &DownloadOptions{
+				Concurrency: 2,
+				Resume:      tt.existing > 0,
+				ChunkStateFunc: func(index int, chunk ChunkInfo, state ChunkState) {
+					if chunk.Start != int64(index)*1024 {
+						t.Errorf("chunk %d starts at %d, want %d", index, chunk.Start, index*1024)
+					}
+					states[index] = append(states[index], state)
+				},
+			}
+
+			if _, err := NewHTTPClient().downloadChunked(context.Background(), server.URL, filename, int64(len(content)), 1024, options); err != nil {
+				t.Fatalf("downloadChunked failed: %v", err)
+			}
+
+			for index, want := range tt.want {
+				if fmt.Sprint(states[index]) != fmt.Sprint(want) {
+					t.Errorf("chunk %d went through %v, want %v", index, states[index], want)
+				}
+			}
+			if len(states) != len(tt.want) {
+				t.Errorf("states reported for %d chunks, want %d", len(states), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestHTTPClient_Do(t *testing.T) {
+	var gotAuth, gotUserAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			gotUserAgent = r.Header.Get("User-Agent")
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			http.Redirect(w, r, "/end", http.StatusFound)
+		case "/end":
+			gotAuth = r.Header.Get("Authorization")
+			if cookie, err := r.Cookie("session"); err == nil {
+				io.WriteString(w, cookie.Value)
+			}
+		}
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	netrc, err := ParseNetrc(strings.NewReader("machine " + serverURL.Hostname() + " login alice password s3cret\n"))
+	if err != nil {
+		t.Fatalf("ParseNetrc() error = %v", err)
+	}
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	client := NewHTTPClient()
+	client.SetNetrc(netrc)
+	client.SetLogger(logger)
+	client.SetDebugHTTP(true)
+
+	tests := []struct {
+		name            string
+		followRedirects bool
+		wantStatus      int
+		wantBody        string
+	}{
+		{name: "redirect is returned", wantStatus: http.StatusFound},
+		{name: "redirect is followed with the jar's cookie", followRedirects: true, wantStatus: http.StatusOK, wantBody: "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/start", nil)
+			if err != nil {
+				t.Fatalf("NewRequest() error = %v", err)
+			}
+			resp, err := client.Do(req, tt.followRedirects)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Do() status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if !tt.followRedirects {
+				if location := resp.Header.Get("Location"); location != "/end" {
+					t.Errorf("Location = %q, want /end", location)
+				}
+				return
+			}
+			if body, _ := io.ReadAll(resp.Body); string(body) != tt.wantBody {
+				t.Errorf("Do() body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	if !strings.HasPrefix(gotAuth, "Basic ") {
+		t.Errorf("Authorization = %q, want the netrc credentials", gotAuth)
+	}
+	if gotUserAgent != "Go-Downloader/1.0" {
+		t.Errorf("User-Agent = %q, want the client's default", gotUserAgent)
+	}
+
+	var logged bool
+	for _, entry := range hook.AllEntries() {
+		logged = logged || strings.HasPrefix(entry.Message, "> GET "+server.URL+"/start")
+	}
+	if !logged {
+		t.Error("request wasn't logged by -debug-http")
+	}
+
+	t.Run("request's own User-Agent is kept", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/start", nil)
+		req.Header.Set("User-Agent", BrowserUserAgent)
+		resp, err := client.Do(req, false)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+		if gotUserAgent != BrowserUserAgent {
+			t.Errorf("User-Agent = %q, want the request's own", gotUserAgent)
+		}
+	})
+}
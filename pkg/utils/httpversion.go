@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTPVersion selects the protocol the client speaks to servers
+type HTTPVersion string
+
+const (
+	// HTTPVersionAuto negotiates HTTP/2 with servers that offer it over TLS and uses HTTP/1.1 otherwise
+	HTTPVersionAuto HTTPVersion = "auto"
+	// HTTPVersion1 always uses HTTP/1.1, one connection per concurrent request
+	HTTPVersion1 HTTPVersion = "h1"
+	// HTTPVersion2 always uses HTTP/2, over TLS or as h2c over plain http,
+	// multiplexing concurrent requests to a host over a single connection
+	HTTPVersion2 HTTPVersion = "h2"
+	// HTTPVersion3 sends https requests over HTTP/3 (QUIC), falling back to
+	// HTTPVersionAuto for hosts where a QUIC connection can't be made
+	HTTPVersion3 HTTPVersion = "h3"
+)
+
+// h3HandshakeTimeout is how long connecting to a host over QUIC may take
+// before its requests fall back to TCP
+var h3HandshakeTimeout = 5 * time.Second
+
+// ParseHTTPVersion returns the HTTPVersion with the given name, "" is auto
+func ParseHTTPVersion(name string) (HTTPVersion, error) {
+	switch version := HTTPVersion(strings.ToLower(strings.TrimSpace(name))); version {
+	case "":
+		return HTTPVersionAuto, nil
+	case HTTPVersionAuto, HTTPVersion1, HTTPVersion2, HTTPVersion3:
+		return version, nil
+	default:
+		return "", fmt.Errorf("unknown HTTP version %q, want auto, h1, h2 or h3", name)
+	}
+}
+
+// withHTTPVersion limits transport to the protocols of version and returns
+// the round tripper requests should go through. A non-nil resolver picks the
+// addresses of HTTP/3 connections, as it does for transport's.
+func withHTTPVersion(transport *http.Transport, version HTTPVersion, resolver *hostResolver) http.RoundTripper {
+	switch version {
+	case HTTPVersion1:
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		transport.Protocols = protocols
+	case HTTPVersion2:
+		protocols := new(http.Protocols)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		transport.Protocols = protocols
+	case HTTPVersion3:
+		return newH3Transport(transport, resolver)
+	}
+	return transport
+}
+
+// h3Transport sends https requests over HTTP/3. Plain http requests, and
+// requests to hosts HTTP/3 already failed for, go through the TCP transport.
+type h3Transport struct {
+	h3       *http3.Transport
+	fallback *http.Transport
+
+	mu     sync.Mutex
+	broken map[string]bool // Hosts whose HTTP/3 requests failed
+}
+
+func newH3Transport(fallback *http.Transport, resolver *hostResolver) *h3Transport {
+	var tlsConfig *tls.Config
+	if fallback.TLSClientConfig != nil {
+		tlsConfig = fallback.TLSClientConfig.Clone()
+		// http3 negotiates its own ALPN
+		tlsConfig.NextProtos = nil
+	}
+
+	h3 := &http3.Transport{
+		TLSClientConfig: tlsConfig,
+		QUICConfig:      &quic.Config{HandshakeIdleTimeout: h3HandshakeTimeout},
+	}
+	if resolver != nil {
+		h3.Dial = resolver.dialQUIC
+	}
+
+	return &h3Transport{
+		h3:       h3,
+		fallback: fallback,
+		broken:   make(map[string]bool),
+	}
+}
+
+func (t *h3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" || t.isBroken(req.URL.Host) {
+		return t.fallback.RoundTrip(req)
+	}
+
+	resp, err := t.h3.RoundTrip(req)
+	if err == nil {
+		return resp, nil
+	}
+	// A cancelled request fails the same way over TCP, and a consumed body
+	// can't be sent a second time
+	if req.Context().Err() != nil || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.broken[req.URL.Host] = true
+	t.mu.Unlock()
+
+	retry := req
+	if req.GetBody != nil {
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, err
+		}
+		retry = req.Clone(req.Context())
+		retry.Body = body
+	}
+	return t.fallback.RoundTrip(retry)
+}
+
+func (t *h3Transport) isBroken(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.broken[host]
+}
+
+// CloseIdleConnections closes idle connections of both transports
+func (t *h3Transport) CloseIdleConnections() {
+	t.h3.CloseIdleConnections()
+	t.fallback.CloseIdleConnections()
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestParseHTTPVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    HTTPVersion
+		wantErr bool
+	}{
+		{name: "", want: HTTPVersionAuto},
+		{name: "auto", want: HTTPVersionAuto},
+		{name: "h1", want: HTTPVersion1},
+		{name: " H2 ", want: HTTPVersion2},
+		{name: "h3", want: HTTPVersion3},
+		{name: "http2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHTTPVersion(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHTTPVersion(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseHTTPVersion(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientWithConfig_HTTPVersion(t *testing.T) {
+	oldTimeout := h3HandshakeTimeout
+	h3HandshakeTimeout = 200 * time.Millisecond
+	defer func() { h3HandshakeTimeout = oldTimeout }()
+
+	protoHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	tlsServer := httptest.NewUnstartedServer(protoHandler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	// Plain http server that also accepts h2c with prior knowledge
+	h2cServer := httptest.NewUnstartedServer(protoHandler)
+	h2cServer.Config.Protocols = new(http.Protocols)
+	h2cServer.Config.Protocols.SetHTTP1(true)
+	h2cServer.Config.Protocols.SetUnencryptedHTTP2(true)
+	h2cServer.Start()
+	defer h2cServer.Close()
+
+	tests := []struct {
+		name    string
+		version HTTPVersion
+		url     string
+		want    string
+	}{
+		{name: "default negotiates HTTP/2 over TLS", url: tlsServer.URL, want: "HTTP/2.0"},
+		{name: "auto negotiates HTTP/2 over TLS", version: HTTPVersionAuto, url: tlsServer.URL, want: "HTTP/2.0"},
+		{name: "h1 over TLS", version: HTTPVersion1, url: tlsServer.URL, want: "HTTP/1.1"},
+		{name: "h2 over TLS", version: HTTPVersion2, url: tlsServer.URL, want: "HTTP/2.0"},
+		{name: "auto over plain http", version: HTTPVersionAuto, url: h2cServer.URL, want: "HTTP/1.1"},
+		{name: "h2 over plain http uses h2c", version: HTTPVersion2, url: h2cServer.URL, want: "HTTP/2.0"},
+		{name: "h3 falls back without QUIC", version: HTTPVersion3, url: tlsServer.URL, want: "HTTP/2.0"},
+		{name: "h3 over plain http", version: HTTPVersion3, url: h2cServer.URL, want: "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewHTTPClientWithConfig(&ClientConfig{InsecureSkipVerify: true, HTTPVersion: tt.version})
+			if err != nil {
+				t.Fatalf("NewHTTPClientWithConfig() error = %v", err)
+			}
+
+			// The second request shows a failed QUIC host isn't tried again
+			for i := range 2 {
+				start := time.Now()
+				resp, err := client.client.R().Get(tt.url)
+				if err != nil {
+					t.Fatalf("request %d error = %v", i+1, err)
+				}
+				if got := resp.String(); got != tt.want {
+					t.Errorf("request %d used %s, want %s", i+1, got, tt.want)
+				}
+				if i == 1 && time.Since(start) >= h3HandshakeTimeout {
+					t.Errorf("request %d took %v, want no second QUIC attempt", i+1, time.Since(start))
+				}
+			}
+		})
+	}
+
+	t.Run("unknown version", func(t *testing.T) {
+		if _, err := NewHTTPClientWithConfig(&ClientConfig{HTTPVersion: "h4"}); err == nil {
+			t.Error("Expected error for unknown HTTP version")
+		}
+	})
+}
+
+func TestNewHTTPClientWithConfig_HTTP3(t *testing.T) {
+	// Borrow the test server's certificate for the QUIC listener
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP unavailable: %v", err)
+	}
+	h3Server := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: tlsServer.TLS.Certificates}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}),
+	}
+	go h3Server.Serve(conn)
+	defer h3Server.Close()
+
+	client, err := NewHTTPClientWithConfig(&ClientConfig{InsecureSkipVerify: true, HTTPVersion: HTTPVersion3})
+	if err != nil {
+		t.Fatalf("NewHTTPClientWithConfig() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := client.client.R().SetContext(ctx).Get("https://" + conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	if got := resp.String(); got != "HTTP/3.0" {
+		t.Errorf("request used %s, want HTTP/3.0", got)
+	}
+}
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+	"sync"
+)
+
+// JournalSuffix is appended to a partial file's name to get its journal
+const JournalSuffix = ".journal"
+
+// journalCompactThreshold is how many records are appended before the
+// journal is rewritten with its merged ranges
+const journalCompactThreshold = 256
+
+// Journal records the byte ranges of a partial file that are known to be on
+// disk. Each range is appended as its own line with a checksum and synced
+// before Record returns, so after a crash the journal holds exactly the
+// ranges written before it, and a torn last line is dropped on open.
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	ranges  []ChunkInfo // Sorted and merged
+	records int         // Lines in the file, compaction brings it back to len(ranges)
+}
+
+// JournalPath returns the journal path for the partial file filename
+func JournalPath(filename string) string {
+	return filename + JournalSuffix
+}
+
+// RemoveJournal deletes the journal of filename, if it has one
+func RemoveJournal(filename string) error {
+	if err := os.Remove(JournalPath(filename)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// OpenJournal opens the journal at path, creating it if needed. Records
+// that can't be read back, such as a line cut short by a crash, end the
+// journal there and are cut off so new records follow the last good one.
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	j := &Journal{path: path, file: file}
+
+	valid, err := j.load()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate journal: %w", err)
+	}
+	if _, err := file.Seek(valid, 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek journal: %w", err)
+	}
+
+	return j, nil
+}
+
+// load reads every valid record and returns the offset just past the last one
+func (j *Journal) load() (int64, error) {
+	var valid int64
+
+	reader := bufio.NewReader(j.file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A line without its newline was never fully written
+			return valid, nil
+		}
+
+		start, end, ok := parseJournalRecord(line)
+		if !ok {
+			return valid, nil
+		}
+
+		j.add(start, end)
+		j.records++
+		valid += int64(len(line))
+	}
+}
+
+// Record marks bytes start through end (inclusive) as written. The caller
+// must have synced them to disk first, the journal can only vouch for what
+// was durable when it was told.
+func (j *Journal) Record(start, end int64) error {
+	if start < 0 || end < start {
+		return fmt.Errorf("invalid journal range %d-%d", start, end)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(formatJournalRecord(start, end)); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+
+	j.add(start, end)
+	j.records++
+
+	if j.records-len(j.ranges) >= journalCompactThreshold {
+		return j.compact()
+	}
+	return nil
+}
+
+// Completed returns the recorded ranges, sorted and with adjacent or
+// overlapping ranges merged
+func (j *Journal) Completed() []ChunkInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]ChunkInfo(nil), j.ranges...)
+}
+
+// Covers reports whether every byte from start through end has been recorded
+func (j *Journal) Covers(start, end int64) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, r := range j.ranges {
+		if r.Start <= start && end <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Compact rewrites the journal with one record per merged range
+func (j *Journal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.compact()
+}
+
+// compact writes the merged ranges to a new file and moves it over the
+// journal, so a crash part way leaves the old journal intact. The caller
+// must hold j.mu.
+func (j *Journal) compact() error {
+	var buf bytes.Buffer
+	for _, r := range j.ranges {
+		buf.Write(formatJournalRecord(r.Start, r.End))
+	}
+
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+
+	// Appends continue on the new file, already positioned at its end
+	j.file.Close()
+	j.file = tmp
+	j.records = len(j.ranges)
+	return nil
+}
+
+// Close closes the journal file, keeping it on disk for a later resume
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
+
+// Remove closes and deletes the journal once its file is complete
+func (j *Journal) Remove() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.file.Close()
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	return nil
+}
+
+// add merges start-end into j.ranges. The caller must hold j.mu or own j.
+func (j *Journal) add(start, end int64) {
+	i := sort.Search(len(j.ranges), func(i int) bool { return j.ranges[i].End+1 >= start })
+
+	merged := ChunkInfo{Start: start, End: end}
+	k := i
+	for ; k < len(j.ranges) && j.ranges[k].Start <= end+1; k++ {
+		if j.ranges[k].Start < merged.Start {
+			merged.Start = j.ranges[k].Start
+		}
+		if j.ranges[k].End > merged.End {
+			merged.End = j.ranges[k].End
+		}
+	}
+	merged.Size = merged.End - merged.Start + 1
+
+	j.ranges = append(j.ranges[:i], append([]ChunkInfo{merged}, j.ranges[k:]...)...)
+}
+
+// formatJournalRecord encodes a range as "start end checksum\n"
+func formatJournalRecord(start, end int64) []byte {
+	payload := fmt.Sprintf("%d %d", start, end)
+	return fmt.Appendf(nil, "%s %08x\n", payload, crc32.ChecksumIEEE([]byte(payload)))
+}
+
+// parseJournalRecord decodes a line written by formatJournalRecord
+func parseJournalRecord(line []byte) (start, end int64, ok bool) {
+	var checksum uint32
+	if _, err := fmt.Sscanf(string(line), "%d %d %08x\n", &start, &end, &checksum); err != nil {
+		return 0, 0, false
+	}
+	if start < 0 || end < start {
+		return 0, 0, false
+	}
+	if crc32.ChecksumIEEE(fmt.Appendf(nil, "%d %d", start, end)) != checksum {
+		return 0, 0, false
+	}
+	return start, end, true
+}
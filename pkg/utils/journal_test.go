@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJournal_RecordAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.part.journal")
+
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	for _, r := range [][2]int64{{200, 299}, {0, 99}, {500, 599}, {100, 199}} {
+		if err := journal.Record(r[0], r[1]); err != nil {
+			t.Fatalf("Record(%d, %d) failed: %v", r[0], r[1], err)
+		}
+	}
+	if err := journal.Record(10, 5); err == nil {
+		t.Error("Record(10, 5) succeeded, want an error for an inverted range")
+	}
+	journal.Close()
+
+	reopened, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	defer reopened.Close()
+
+	want := []ChunkInfo{{Start: 0, End: 299, Size: 300}, {Start: 500, End: 599, Size: 100}}
+	if got := reopened.Completed(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Completed() = %v, want %v", got, want)
+	}
+	if !reopened.Covers(100, 250) || reopened.Covers(250, 550) {
+		t.Error("Covers() doesn't match the merged ranges")
+	}
+}
+
+func TestJournal_Crash(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{
+			name:    "last record cut short",
+			corrupt: func(data []byte) []byte { return data[:len(data)-4] },
+		},
+		{
+			name:    "last record without newline",
+			corrupt: func(data []byte) []byte { return data[:len(data)-1] },
+		},
+		{
+			name: "last record has a bad checksum",
+			corrupt: func(data []byte) []byte {
+				return bytes.Replace(data, []byte("200 299 "), []byte("200 399 "), 1)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.part.journal")
+
+			journal, err := OpenJournal(path)
+			if err != nil {
+				t.Fatalf("OpenJournal failed: %v", err)
+			}
+			for _, r := range [][2]int64{{0, 99}, {400, 499}, {200, 299}} {
+				if err := journal.Record(r[0], r[1]); err != nil {
+					t.Fatalf("Record failed: %v", err)
+				}
+			}
+			journal.Close()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read journal: %v", err)
+			}
+			if err := os.WriteFile(path, tt.corrupt(data), 0644); err != nil {
+				t.Fatalf("failed to corrupt journal: %v", err)
+			}
+
+			recovered, err := OpenJournal(path)
+			if err != nil {
+				t.Fatalf("OpenJournal failed: %v", err)
+			}
+			want := []ChunkInfo{{Start: 0, End: 99, Size: 100}, {Start: 400, End: 499, Size: 100}}
+			if got := recovered.Completed(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Completed() after crash = %v, want %v", got, want)
+			}
+
+			// New records carry on after the last good one
+			if err := recovered.Record(100, 199); err != nil {
+				t.Fatalf("Record failed: %v", err)
+			}
+			recovered.Close()
+
+			again, err := OpenJournal(path)
+			if err != nil {
+				t.Fatalf("OpenJournal failed: %v", err)
+			}
+			defer again.Close()
+			want = []ChunkInfo{{Start: 0, End: 199, Size: 200}, {Start: 400, End: 499, Size: 100}}
+			if got := again.Completed(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Completed() after recovery = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestJournal_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.part.journal")
+
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	defer journal.Close()
+
+	// Enough adjacent records to trigger compaction on their own
+	for i := int64(0); i < journalCompactThreshold+10; i++ {
+		if err := journal.Record(i*10, i*10+9); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read journal: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines >= journalCompactThreshold {
+		t.Errorf("journal has %d lines after compaction, want fewer than %d", lines, journalCompactThreshold)
+	}
+
+	if err := journal.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	want := []ChunkInfo{{Start: 0, End: (journalCompactThreshold+10)*10 - 1, Size: (journalCompactThreshold + 10) * 10}}
+
+	reopened, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	defer reopened.Close()
+	if got := reopened.Completed(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Completed() after compaction = %v, want %v", got, want)
+	}
+
+	data, _ = os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("compacted journal has %d lines, want 1", lines)
+	}
+}
+
+func TestHTTPClient_downloadChunked_JournalRecovery(t *testing.T) {
+	content := make([]byte, 400)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "file.bin")
+
+	// The crash hit after chunks 0, 1 and 3 were written but before chunk 1
+	// was journaled, so it may hold anything
+	partial := make([]byte, len(content))
+	copy(partial[0:100], content[0:100])
+	copy(partial[100:200], bytes.Repeat([]byte{0xff}, 100))
+	copy(partial[300:400], content[300:400])
+	if err := os.WriteFile(filename, partial, 0644); err != nil {
+		t.Fatalf("failed to write partial file: %v", err)
+	}
+	journal, err := OpenJournal(JournalPath(filename))
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	journal.Record(0, 99)
+	journal.Record(300, 399)
+	journal.Close()
+
+	client := NewHTTPClient()
+	stats, err := client.downloadChunked(context.Background(), server.URL, filename, int64(len(content)), 100, &DownloadOptions{
+		Resume:      true,
+		Journal:     true,
+		Concurrency: 2,
+	})
+	if err != nil {
+		t.Fatalf("downloadChunked failed: %v", err)
+	}
+
+	sort.Strings(ranges)
+	if want := []string{"bytes=100-199", "bytes=200-299"}; !reflect.DeepEqual(ranges, want) {
+		t.Errorf("requested ranges = %v, want %v", ranges, want)
+	}
+	if !stats.Resumed {
+		t.Error("stats.Resumed = false, want true")
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("recovered file doesn't match the original")
+	}
+	if _, err := os.Stat(JournalPath(filename)); !os.IsNotExist(err) {
+		t.Errorf("journal still exists after a complete download: %v", err)
+	}
+}
+
+func TestHTTPClient_downloadChunked_JournalKeepsChunksAfterFailure(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 40)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=100-199" {
+			http.Error(w, "gone", http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "file.bin")
+	client := NewHTTPClient()
+	_, err := client.downloadChunked(context.Background(), server.URL, filename, int64(len(content)), 100, &DownloadOptions{
+		Resume:     true,
+		Journal:    true,
+		RetryDelay: time.Millisecond,
+	})
+	if err == nil {
+		t.Fatal("downloadChunked succeeded, want the failing chunk's error")
+	}
+
+	journal, err := OpenJournal(JournalPath(filename))
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	defer journal.Close()
+
+	for _, chunk := range journal.Completed() {
+		if chunk.Start <= 100 && chunk.End >= 199 {
+			t.Errorf("journal lists %d-%d, which includes the failed chunk", chunk.Start, chunk.End)
+		}
+	}
+	if !journal.Covers(0, 99) {
+		t.Error("journal doesn't list the chunk before the failure")
+	}
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDField is the log field that carries a download's correlation ID
+const RequestIDField = "request_id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying a correlation ID that is
+// attached to every log line written for work done under it
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the correlation ID stored in ctx, if any
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// LoggerFromContext returns an entry for logger that includes the request ID from ctx
+func LoggerFromContext(ctx context.Context, logger *logrus.Logger) *logrus.Entry {
+	entry := logrus.NewEntry(logger)
+	if id, ok := RequestIDFromContext(ctx); ok {
+		entry = entry.WithField(RequestIDField, id)
+	}
+	return entry
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// errMmapUnsupported is returned by mapFile on platforms without
+// memory-mapped files, downloads write chunks with WriteAt there
+var errMmapUnsupported = errors.New("memory-mapped writes are not supported on this platform")
+
+// mmapFile maps a file for chunk workers to copy into. Tests replace it to
+// exercise the WriteAt fallback.
+var mmapFile = mapFile
+
+// mappedFile is a download's file mapped into memory, preallocated to its
+// full size. Chunk workers copy into their own regions of it concurrently.
+type mappedFile struct {
+	data []byte
+}
+
+// WriteAt copies p into the mapping at off
+func (m *mappedFile) WriteAt(p []byte, off int64) (int, error) {
+	if m.data == nil {
+		return 0, errors.New("write to a closed mapping")
+	}
+	if off < 0 || off+int64(len(p)) > int64(len(m.data)) {
+		return 0, fmt.Errorf("write of %d bytes at %d is outside the %d byte mapping", len(p), off, len(m.data))
+	}
+	return copy(m.data[off:], p), nil
+}
+
+// mapFile preallocates file to size bytes and maps it for writing. On
+// failure the file keeps its original size.
+func mapFile(file *os.File, size int64) (*mappedFile, error) {
+	if size <= 0 || int64(int(size)) != size {
+		return nil, fmt.Errorf("can't map a file of %d bytes", size)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	originalSize := info.Size()
+
+	if err := preallocate(file, size); err != nil {
+		file.Truncate(originalSize)
+		return nil, fmt.Errorf("failed to preallocate file: %w", err)
+	}
+
+	data, err := mapRegion(file, int(size))
+	if err != nil {
+		file.Truncate(originalSize)
+		return nil, fmt.Errorf("failed to map file: %w", err)
+	}
+
+	return &mappedFile{data: data}, nil
+}
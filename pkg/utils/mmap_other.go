@@ -0,0 +1,18 @@
+//go:build !unix
+
+package utils
+
+import "os"
+
+func mapRegion(file *os.File, size int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func (m *mappedFile) Sync() error {
+	return nil
+}
+
+func (m *mappedFile) Close() error {
+	m.data = nil
+	return nil
+}
@@ -0,0 +1,188 @@
+//go:build linux
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useMmapFile swaps the function that maps files for the rest of the test
+func useMmapFile(t *testing.T, fn func(*os.File, int64) (*mappedFile, error)) {
+	original := mmapFile
+	mmapFile = fn
+	t.Cleanup(func() { mmapFile = original })
+}
+
+func TestHTTPClient_DownloadToFile_Mmap(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 64*64)) // 64KB
+	server := newRangeTestServer(content, nil)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		partial    int // Bytes of a partial file to resume from
+		journal    bool
+		mapFails   bool
+		wantMapped bool
+	}{
+		{name: "journaled download", journal: true, wantMapped: true},
+		{name: "resumed journaled download", partial: 10 * 1024, journal: true, wantMapped: true},
+		{name: "not mapped without a journal"},
+		{name: "resumed without a journal", partial: 10 * 1024},
+		{name: "falls back to WriteAt", journal: true, mapFails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mapped atomic.Int32
+			useMmapFile(t, func(file *os.File, size int64) (*mappedFile, error) {
+				if tt.mapFails {
+					return nil, errMmapUnsupported
+				}
+				m, err := mapFile(file, size)
+				if err == nil {
+					mapped.Add(1)
+				}
+				return m, err
+			})
+
+			filename := filepath.Join(t.TempDir(), "file.bin")
+			if tt.partial > 0 {
+				if err := os.WriteFile(filename, content[:tt.partial], 0644); err != nil {
+					t.Fatalf("Failed to create partial file: %v", err)
+				}
+				if tt.journal {
+					journal, err := OpenJournal(JournalPath(filename))
+					if err != nil {
+						t.Fatalf("OpenJournal() error = %v", err)
+					}
+					if err := journal.Record(0, int64(tt.partial)-1); err != nil {
+						t.Fatalf("Record() error = %v", err)
+					}
+					journal.Close()
+				}
+			}
+
+			client := NewHTTPClient()
+			fileInfo := &FileInfo{URL: server.URL, Size: int64(len(content)), SizeKnown: true, SupportsRangeRequests: true}
+			_, err := client.DownloadToFileWithInfo(context.Background(), server.URL, filename, fileInfo, &DownloadOptions{
+				ChunkSize:   1024,
+				Concurrency: 8,
+				Resume:      tt.partial > 0 || tt.journal,
+				Journal:     tt.journal,
+				UseMmap:     true,
+			})
+			if err != nil {
+				t.Fatalf("DownloadToFileWithInfo() error = %v", err)
+			}
+
+			if got := mapped.Load() == 1; got != tt.wantMapped {
+				t.Errorf("file mapped = %v, want %v", got, tt.wantMapped)
+			}
+			data, err := os.ReadFile(filename)
+			if err != nil || !bytes.Equal(data, content) {
+				t.Errorf("downloaded file doesn't match the server's content: %v", err)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_DownloadToFile_MmapFailureKeepsJournal(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789abcdef", 64*16)) // 16KB
+	server := newRangeTestServer(content, func(r *http.Request) bool {
+		return strings.HasPrefix(r.Header.Get("Range"), "bytes=8192-")
+	})
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "file.bin")
+	client := NewHTTPClient()
+	fileInfo := &FileInfo{URL: server.URL, Size: int64(len(content)), SizeKnown: true, SupportsRangeRequests: true}
+	_, err := client.DownloadToFileWithInfo(context.Background(), server.URL, filename, fileInfo, &DownloadOptions{
+		ChunkSize:  1024,
+		MaxRetries: 1,
+		RetryDelay: time.Millisecond,
+		Resume:     true,
+		Journal:    true,
+		UseMmap:    true,
+	})
+	if err == nil {
+		t.Fatal("DownloadToFileWithInfo() succeeded, want the failing chunk to fail it")
+	}
+
+	// The preallocated file keeps its full size, the journal is what shows
+	// a resume that the failed chunk is still missing
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat partial file: %v", err)
+	}
+	if info.Size() != int64(len(content)) {
+		t.Errorf("partial file has %d bytes, want the preallocated %d", info.Size(), len(content))
+	}
+
+	journal, err := OpenJournal(JournalPath(filename))
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+	defer journal.Close()
+	if !journal.Covers(0, 8191) {
+		t.Errorf("journal = %v, want the chunks before the failure recorded", journal.Completed())
+	}
+	if journal.Covers(8192, 9215) {
+		t.Error("journal records the chunk that failed")
+	}
+}
+
+func TestMappedFile_WriteAt(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "mapped.bin"))
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer file.Close()
+
+	m, err := mapFile(file, 16)
+	if err != nil {
+		t.Fatalf("mapFile() error = %v", err)
+	}
+
+	if _, err := m.WriteAt([]byte("cloudget"), 4); err != nil {
+		t.Errorf("WriteAt() inside the mapping error = %v", err)
+	}
+	if _, err := m.WriteAt([]byte("too long"), 12); err == nil {
+		t.Error("WriteAt() past the end of the mapping succeeded")
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := m.WriteAt([]byte("x"), 0); err == nil {
+		t.Error("WriteAt() after Close succeeded")
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if want := "\x00\x00\x00\x00cloudget\x00\x00\x00\x00"; string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+}
+
+// newRangeTestServer serves content with range support, answering 500 to
+// requests fail matches
+func newRangeTestServer(content []byte, fail func(*http.Request) bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail != nil && fail(r) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package utils
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapRegion maps the first size bytes of file, shared so writes reach it
+func mapRegion(file *os.File, size int) ([]byte, error) {
+	return unix.Mmap(int(file.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+}
+
+// Sync writes the mapping's dirty pages to disk
+func (m *mappedFile) Sync() error {
+	if m.data == nil {
+		return nil
+	}
+	return unix.Msync(m.data, unix.MS_SYNC)
+}
+
+// Close unmaps the file. It's safe to call more than once.
+func (m *mappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := unix.Munmap(m.data)
+	m.data = nil
+	return err
+}
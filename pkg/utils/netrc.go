@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// NetrcCredentials is the login and password a netrc file gives for a host
+type NetrcCredentials struct {
+	Login    string
+	Password string
+}
+
+// Netrc holds the entries of a netrc file in the format curl and wget read:
+// "machine", "login" and "password" tokens separated by any whitespace,
+// including newlines, with an optional "default" entry for every other host.
+// "account" values and "macdef" macros are skipped.
+type Netrc struct {
+	machines []*netrcMachine
+	fallback *NetrcCredentials // The "default" entry
+}
+
+type netrcMachine struct {
+	host string
+	NetrcCredentials
+}
+
+// DefaultNetrcPath returns the file named by $NETRC, or else ~/.netrc, or
+// %USERPROFILE%\_netrc on Windows
+func DefaultNetrcPath() (string, error) {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the netrc file: %w", err)
+	}
+
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	return filepath.Join(home, name), nil
+}
+
+// LoadNetrc reads and parses the netrc file at path
+func LoadNetrc(path string) (*Netrc, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netrc file: %w", err)
+	}
+	defer file.Close()
+
+	netrc, err := ParseNetrc(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return netrc, nil
+}
+
+// ParseNetrc parses netrc entries from r. A token starting with "#" comments
+// out the rest of its line, and tokens may be double quoted.
+func ParseNetrc(r io.Reader) (*Netrc, error) {
+	netrc := &Netrc{}
+	var current *NetrcCredentials
+	var keyword string // Keyword still waiting for its value
+	inMacro := false
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+
+		// A macro's body runs up to the next empty line
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+	fields:
+		for _, field := range netrcFields(line) {
+			if keyword != "" {
+				switch keyword {
+				case "machine":
+					machine := &netrcMachine{host: strings.ToLower(field)}
+					netrc.machines = append(netrc.machines, machine)
+					current = &machine.NetrcCredentials
+				case "login", "password":
+					if current == nil {
+						return nil, fmt.Errorf("line %d: %s outside of a machine or default entry", lineNumber, keyword)
+					}
+					if keyword == "login" {
+						current.Login = field
+					} else {
+						current.Password = field
+					}
+				case "macdef":
+					inMacro = true
+				}
+				keyword = ""
+				if inMacro {
+					break fields
+				}
+				continue
+			}
+
+			if strings.HasPrefix(field, "#") {
+				break
+			}
+
+			switch field {
+			case "default":
+				netrc.fallback = &NetrcCredentials{}
+				current = netrc.fallback
+			case "machine", "login", "password", "account", "macdef":
+				keyword = field
+			default:
+				return nil, fmt.Errorf("line %d: unexpected token %q", lineNumber, field)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if keyword != "" {
+		return nil, fmt.Errorf("missing value for %s", keyword)
+	}
+
+	return netrc, nil
+}
+
+// netrcFields splits a netrc line into tokens. A token in double quotes may
+// hold spaces and backslash escapes, as curl allows for passwords.
+func netrcFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	inField, quoted, escaped := false, false, false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"' && (quoted || !inField):
+			quoted = !quoted
+			inField = true
+		case !quoted && unicode.IsSpace(r):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+
+	return fields
+}
+
+// Lookup returns the credentials of the first entry for host, falling back
+// to the default entry
+func (n *Netrc) Lookup(host string) (NetrcCredentials, bool) {
+	host = strings.ToLower(host)
+
+	for _, machine := range n.machines {
+		if machine.host == host {
+			return machine.NetrcCredentials, true
+		}
+	}
+	if n.fallback != nil {
+		return *n.fallback, true
+	}
+	return NetrcCredentials{}, false
+}
+
+// SetNetrc makes the client send Basic auth credentials from netrc to the
+// hosts it lists, on requests that don't carry their own Authorization
+// header. Nil stops it.
+func (h *HTTPClient) SetNetrc(netrc *Netrc) {
+	h.netrc = netrc
+}
+
+// netrcAuth is a request middleware that adds the netrc credentials for the
+// request's host. Redirects to another host don't get them, net/http drops
+// the header there.
+func (h *HTTPClient) netrcAuth(c *resty.Client, r *resty.Request) error {
+	if h.netrc == nil || r.Header.Get("Authorization") != "" || c.Header.Get("Authorization") != "" || r.UserInfo != nil {
+		return nil
+	}
+
+	parsedURL, err := url.Parse(r.URL)
+	if err != nil || parsedURL.Host == "" {
+		return nil
+	}
+
+	if auth := h.netrcAuthorization(parsedURL.Hostname()); auth != "" {
+		r.SetHeader("Authorization", auth)
+	}
+	return nil
+}
+
+// netrcAuthorization returns the Basic Authorization header for host's
+// netrc credentials, or "" if netrc has none for it
+func (h *HTTPClient) netrcAuthorization(host string) string {
+	if h.netrc == nil {
+		return ""
+	}
+	credentials, ok := h.netrc.Lookup(host)
+	if !ok || (credentials.Login == "" && credentials.Password == "") {
+		return ""
+	}
+
+	token := base64.StdEncoding.EncodeToString([]byte(credentials.Login + ":" + credentials.Password))
+	return "Basic " + token
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleNetrc = `# Personal credentials
+machine files.example.com login alice password s3cret
+
+machine Mirror.Example.org
+	login   bob
+	account ops
+	password "hunter 2 \"quoted\""
+
+macdef init
+cd /pub
+binary
+
+machine ftp.example.net login carol # password below is read too
+password carolpw
+
+default login anonymous password guest@example.com
+`
+
+func TestParseNetrc(t *testing.T) {
+	netrc, err := ParseNetrc(strings.NewReader(sampleNetrc))
+	if err != nil {
+		t.Fatalf("ParseNetrc() error = %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want NetrcCredentials
+	}{
+		{host: "files.example.com", want: NetrcCredentials{Login: "alice", Password: "s3cret"}},
+		{host: "mirror.example.org", want: NetrcCredentials{Login: "bob", Password: `hunter 2 "quoted"`}},
+		{host: "FILES.example.com", want: NetrcCredentials{Login: "alice", Password: "s3cret"}},
+		{host: "ftp.example.net", want: NetrcCredentials{Login: "carol", Password: "carolpw"}},
+		{host: "other.example.com", want: NetrcCredentials{Login: "anonymous", Password: "guest@example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got, ok := netrc.Lookup(tt.host)
+			if !ok {
+				t.Fatalf("Lookup(%q) found nothing", tt.host)
+			}
+			if got != tt.want {
+				t.Errorf("Lookup(%q) = %+v, want %+v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetrc_NoDefault(t *testing.T) {
+	netrc, err := ParseNetrc(strings.NewReader("machine a.example.com login a password one\nmachine a.example.com login b password two\n"))
+	if err != nil {
+		t.Fatalf("ParseNetrc() error = %v", err)
+	}
+
+	if got, _ := netrc.Lookup("a.example.com"); got.Login != "a" {
+		t.Errorf("Lookup() = %+v, want the first matching entry", got)
+	}
+	if got, ok := netrc.Lookup("b.example.com"); ok {
+		t.Errorf("Lookup() of an unlisted host = %+v, want nothing", got)
+	}
+}
+
+func TestParseNetrc_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "unknown token", input: "machine a.example.com user alice"},
+		{name: "missing value", input: "machine a.example.com login"},
+		{name: "login without machine", input: "login alice password s3cret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseNetrc(strings.NewReader(tt.input)); err == nil {
+				t.Error("ParseNetrc() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientWithConfig_NetrcFile(t *testing.T) {
+	var gotUser, gotPassword, gotHeader string
+	var gotAuth bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("Authorization")
+		gotUser, gotPassword, gotAuth = r.BasicAuth()
+		w.Write([]byte("private"))
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	netrcPath := filepath.Join(t.TempDir(), "netrc")
+	content := "machine " + serverURL.Hostname() + " login alice password s3cret\n"
+	if err := os.WriteFile(netrcPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write netrc: %v", err)
+	}
+
+	client, err := NewHTTPClientWithConfig(&ClientConfig{NetrcFile: netrcPath})
+	if err != nil {
+		t.Fatalf("NewHTTPClientWithConfig() error = %v", err)
+	}
+
+	if _, err := client.DownloadChunk(context.Background(), server.URL, ChunkInfo{Start: 0, End: 6, Size: 7}, nil); err != nil {
+		t.Fatalf("DownloadChunk() error = %v", err)
+	}
+	if !gotAuth || gotUser != "alice" || gotPassword != "s3cret" {
+		t.Errorf("server saw Basic auth %q:%q (%v), want alice:s3cret", gotUser, gotPassword, gotAuth)
+	}
+
+	// An Authorization header the caller set wins over the netrc entry
+	options := &DownloadOptions{Headers: map[string]string{"Authorization": "Bearer token"}}
+	if _, err := client.DownloadChunk(context.Background(), server.URL, ChunkInfo{Start: 0, End: 6, Size: 7}, options); err != nil {
+		t.Fatalf("DownloadChunk() error = %v", err)
+	}
+	if gotHeader != "Bearer token" {
+		t.Errorf("Authorization = %q, want the caller's header", gotHeader)
+	}
+
+	if _, err := NewHTTPClientWithConfig(&ClientConfig{NetrcFile: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("NewHTTPClientWithConfig() with a missing netrc file succeeded, want an error")
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// OpenedDownload is a GET whose response headers have arrived but whose body
+// hasn't been read yet. A small file can be described by its headers and
+// then written out from the same response, without a HEAD request first.
+type OpenedDownload struct {
+	Info     *FileInfo // Read from the response headers, like GetFileInfo would
+	FinalURL string    // URL that served the response after redirects
+	body     io.ReadCloser
+}
+
+// Close discards the response body, for a download that won't be written
+// out after all. It's safe to call more than once.
+func (d *OpenedDownload) Close() error {
+	if d.body == nil {
+		return nil
+	}
+	err := d.body.Close()
+	d.body = nil
+	return err
+}
+
+// OpenDownload sends a GET for urlStr and returns as soon as the response
+// headers are in. Anything but a 200 is an error.
+func (h *HTTPClient) OpenDownload(ctx context.Context, urlStr string, options *DownloadOptions) (*OpenedDownload, error) {
+	req := h.client.R().SetContext(withMaxRedirects(ctx, options)).SetDoNotParseResponse(true)
+	if options != nil && options.Headers != nil {
+		req.SetHeaders(options.Headers)
+	}
+
+	resp, err := req.Get(urlStr)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+
+	body := resp.RawBody()
+	if resp.StatusCode() != http.StatusOK {
+		drainBody(body)
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+
+	recordFilename(ctx, resp.Header())
+	return &OpenedDownload{
+		Info:     fileInfoFromHeader(urlStr, resp.Header()),
+		FinalURL: responseURL(resp, urlStr),
+		body:     body,
+	}, nil
+}
+
+// DownloadOpened writes the body of an opened download to filename and
+// closes it
+func (h *HTTPClient) DownloadOpened(ctx context.Context, opened *OpenedDownload, filename string, options *DownloadOptions) (*DownloadStats, error) {
+	defer opened.Close()
+	if opened.body == nil {
+		return nil, fmt.Errorf("download of %s was already closed", opened.FinalURL)
+	}
+
+	bufferSize := 1024 * 1024 // 1MB default, like the chunk size
+	var hashAlgorithm string
+	if options != nil {
+		if options.ChunkSize > 0 {
+			bufferSize = int(options.ChunkSize)
+		}
+		hashAlgorithm = options.HashAlgorithm
+	}
+
+	// The body arrives in order, so it can be hashed in the same pass
+	var reader io.Reader = opened.body
+	var hashing *HashingReader
+	if hashAlgorithm != "" {
+		var err error
+		if hashing, err = NewHashingReader(opened.body, hashAlgorithm); err != nil {
+			return nil, err
+		}
+		reader = hashing
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriterSize(file, bufferSize)
+	if _, err := io.Copy(writer, reader); err != nil {
+		// Keep what arrived so a resumed download doesn't start from nothing
+		writer.Flush()
+		return nil, fmt.Errorf("failed to write response: %w", err)
+	}
+
+	// Everything has to be on disk before the caller checks the file size
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync file: %w", err)
+	}
+
+	stats := &DownloadStats{ChunksUsed: 1, FinalURL: opened.FinalURL}
+	if hashing != nil {
+		stats.Hash = hashing.Sum()
+	}
+
+	return stats, nil
+}
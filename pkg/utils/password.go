@@ -0,0 +1,23 @@
+package utils
+
+import "context"
+
+type linkPasswordKey struct{}
+
+// WithLinkPassword returns a copy of ctx carrying the password that opens a
+// password-protected share link, for services that support such links
+func WithLinkPassword(ctx context.Context, password string) context.Context {
+	if password == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, linkPasswordKey{}, password)
+}
+
+// LinkPasswordFromContext returns the password stored with WithLinkPassword, if any
+func LinkPasswordFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	password, ok := ctx.Value(linkPasswordKey{}).(string)
+	return password, ok && password != ""
+}
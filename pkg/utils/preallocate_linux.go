@@ -0,0 +1,13 @@
+package utils
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves size bytes for file on disk, so a full disk fails
+// here instead of crashing a write into the mapping with SIGBUS
+func preallocate(file *os.File, size int64) error {
+	return unix.Fallocate(int(file.Fd()), 0, 0, size)
+}
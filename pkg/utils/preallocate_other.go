@@ -0,0 +1,18 @@
+//go:build !linux
+
+package utils
+
+import "os"
+
+// preallocate extends file to size bytes. Without fallocate the blocks
+// aren't reserved, the free space check before the download has to do.
+func preallocate(file *os.File, size int64) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() >= size {
+		return nil
+	}
+	return file.Truncate(size)
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// DownloadRange writes bytes start through end (inclusive) of the remote file
+// to filename. A negative end reads through to the end of the file. Servers
+// that ignore the Range header and send the whole file are handled by
+// skipping the bytes before start.
+func (h *HTTPClient) DownloadRange(ctx context.Context, urlStr, filename string, start, end int64, options *DownloadOptions) (*DownloadStats, error) {
+	if start < 0 || (end >= 0 && end < start) {
+		return nil, fmt.Errorf("invalid byte range %d-%d", start, end)
+	}
+
+	req := h.client.R().SetContext(withMaxRedirects(ctx, options)).SetDoNotParseResponse(true)
+
+	bufferSize := 1024 * 1024 // 1MB default, like the chunk size
+	if options != nil {
+		if options.Headers != nil {
+			req.SetHeaders(options.Headers)
+		}
+		if options.ChunkSize > 0 {
+			bufferSize = int(options.ChunkSize)
+		}
+	}
+
+	if end >= 0 {
+		req.SetHeader("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	} else {
+		req.SetHeader("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+
+	resp, err := req.Get(urlStr)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+
+	body := resp.RawBody()
+	defer drainBody(body)
+
+	var reader io.Reader = body
+	switch resp.StatusCode() {
+	case http.StatusPartialContent:
+		if contentRange := resp.Header().Get("Content-Range"); contentRange != "" {
+			gotStart, gotEnd, _, err := parseContentRange(contentRange)
+			if err != nil {
+				return nil, err
+			}
+			if gotStart != start || (end >= 0 && gotEnd != end) {
+				return nil, fmt.Errorf("server returned range %d-%d, requested %d-%d", gotStart, gotEnd, start, end)
+			}
+		}
+	case http.StatusOK:
+		h.log(ctx).Warn("Server ignored the byte range, skipping to the requested offset")
+		if _, err := io.CopyN(io.Discard, body, start); err != nil {
+			return nil, fmt.Errorf("failed to skip to range start: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+
+	total := int64(-1)
+	if end >= 0 {
+		total = end - start + 1
+		reader = io.LimitReader(reader, total)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	buffered := bufio.NewWriterSize(file, bufferSize)
+	var w io.Writer = buffered
+	if options != nil && options.ProgressFunc != nil {
+		w = &progressWriter{w: w, total: total, progress: options.ProgressFunc}
+	}
+
+	if _, err := io.Copy(w, reader); err != nil {
+		buffered.Flush()
+		return nil, fmt.Errorf("failed to write response: %w", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync file: %w", err)
+	}
+
+	return &DownloadStats{ChunksUsed: 1, FinalURL: responseURL(resp, urlStr)}, nil
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPClient_DownloadRange(t *testing.T) {
+	content := make([]byte, 1000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	rangeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer rangeServer.Close()
+
+	// Sends the whole file whatever the request asks for
+	fullServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer fullServer.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		start   int64
+		end     int64
+		want    []byte
+		wantErr bool
+	}{
+		{name: "middle of file", url: rangeServer.URL, start: 100, end: 199, want: content[100:200]},
+		{name: "open ended", url: rangeServer.URL, start: 900, end: -1, want: content[900:]},
+		{name: "server ignores range", url: fullServer.URL, start: 100, end: 199, want: content[100:200]},
+		{name: "end before start", url: rangeServer.URL, start: 200, end: 100, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewHTTPClient()
+			filename := filepath.Join(t.TempDir(), "range.bin")
+
+			var reported int64
+			options := &DownloadOptions{ProgressFunc: func(downloaded, total int64) { reported = downloaded }}
+
+			_, err := client.DownloadRange(context.Background(), tt.url, filename, tt.start, tt.end, options)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("DownloadRange() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadRange() error = %v", err)
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("Failed to read downloaded file: %v", err)
+			}
+			if !bytes.Equal(data, tt.want) {
+				t.Errorf("downloaded %d bytes, want the %d requested bytes", len(data), len(tt.want))
+			}
+			if reported != int64(len(tt.want)) {
+				t.Errorf("progress reported %d bytes, want %d", reported, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestHTTPClient_DownloadRange_WrongContentRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", "bytes 0-99/1000")
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, string(make([]byte, 100)))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	filename := filepath.Join(t.TempDir(), "range.bin")
+
+	if _, err := client.DownloadRange(context.Background(), server.URL, filename, 100, 199, nil); err == nil {
+		t.Error("DownloadRange() error = nil, want a range mismatch error")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("file was created for a mismatched range: %v", err)
+	}
+}
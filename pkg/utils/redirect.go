@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// DefaultMaxRedirects is how many redirects a request follows when
+// DownloadOptions.MaxRedirects is zero
+const DefaultMaxRedirects = 10
+
+// ErrRedirectLoop is returned when a redirect leads back to a URL the request already visited
+var ErrRedirectLoop = errors.New("redirect loop detected")
+
+// ErrTooManyRedirects is returned when a request is redirected more often than allowed
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+type maxRedirectsKey struct{}
+
+// withMaxRedirects returns a copy of ctx carrying the redirect limit from options
+func withMaxRedirects(ctx context.Context, options *DownloadOptions) context.Context {
+	if options == nil || options.MaxRedirects == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, maxRedirectsKey{}, options.MaxRedirects)
+}
+
+// redirectPolicy stops a request that revisits a URL or exceeds the redirect
+// limit stored in its context. A negative limit disables redirects.
+func redirectPolicy(req *http.Request, via []*http.Request) error {
+	maxRedirects := DefaultMaxRedirects
+	if n, ok := req.Context().Value(maxRedirectsKey{}).(int); ok {
+		maxRedirects = n
+	}
+	if maxRedirects < 0 {
+		maxRedirects = 0
+	}
+
+	target := req.URL.String()
+	for _, prev := range via {
+		if prev.URL.String() == target {
+			return fmt.Errorf("%w: %s was already visited", ErrRedirectLoop, target)
+		}
+	}
+
+	if len(via) > maxRedirects {
+		return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, maxRedirects)
+	}
+
+	return nil
+}
+
+// responseURL returns the URL that produced resp once redirects were
+// followed, or fallback if the response doesn't record it
+func responseURL(resp *resty.Response, fallback string) string {
+	if resp == nil || resp.RawResponse == nil || resp.RawResponse.Request == nil {
+		return fallback
+	}
+	return resp.RawResponse.Request.URL.String()
+}
+
+// isRedirectError reports whether err came from redirectPolicy, retrying
+// such a request would only follow the same redirects again
+func isRedirectError(err error) bool {
+	return errors.Is(err, ErrRedirectLoop) || errors.Is(err, ErrTooManyRedirects)
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPClient_DownloadToFile_RedirectLoop(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// /a and /b send the client back and forth forever
+		if r.URL.Path == "/a" {
+			http.Redirect(w, r, "/b", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/a", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	filename := filepath.Join(t.TempDir(), "loop.bin")
+
+	start := time.Now()
+	_, err := client.DownloadToFile(context.Background(), server.URL+"/a", filename, &DownloadOptions{MaxRedirects: 20})
+	if !errors.Is(err, ErrRedirectLoop) {
+		t.Fatalf("DownloadToFile() error = %v, want %v", err, ErrRedirectLoop)
+	}
+
+	// The loop is caught on the first revisit instead of after the limit or any retries
+	if n := requests.Load(); n != 2 {
+		t.Errorf("server saw %d requests, want 2", n)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("loop detection took %v, want it to fail fast", elapsed)
+	}
+}
+
+func TestHTTPClient_DownloadToFile_MaxRedirects(t *testing.T) {
+	content := "reached the end of the redirect chain"
+
+	// /hop/N redirects to /hop/N-1 until /hop/0 serves the file
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/hop/%d", n-1), http.StatusFound)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		hops         int
+		maxRedirects int
+		wantErr      error
+	}{
+		{name: "within limit", hops: 3, maxRedirects: 3},
+		{name: "over limit", hops: 4, maxRedirects: 3, wantErr: ErrTooManyRedirects},
+		{name: "default limit", hops: 10, maxRedirects: 0},
+		{name: "redirects disabled", hops: 1, maxRedirects: -1, wantErr: ErrTooManyRedirects},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewHTTPClient()
+			filename := filepath.Join(t.TempDir(), "chain.bin")
+			url := fmt.Sprintf("%s/hop/%d", server.URL, tt.hops)
+
+			_, err := client.DownloadToFile(context.Background(), url, filename, &DownloadOptions{MaxRedirects: tt.maxRedirects})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("DownloadToFile() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("DownloadToFile() error = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -30,9 +32,11 @@ func NewResumeManager(resumeDir string) *ResumeManager {
 	}
 }
 
-// SaveProgress saves download progress for resumption
+// SaveProgress saves download progress for resumption. The record is kept
+// per URL and progress.FilePath, so one URL can be downloaded to several
+// paths without the partial files trampling each other's progress.
 func (rm *ResumeManager) SaveProgress(url string, progress *interfaces.ResumeData) error {
-	filename := rm.getResumeFilename(url)
+	filename := rm.getResumeFilename(url, progress.FilePath)
 	filepath := filepath.Join(rm.resumeDir, filename)
 
 	data, err := json.MarshalIndent(progress, "", "  ")
@@ -48,9 +52,9 @@ func (rm *ResumeManager) SaveProgress(url string, progress *interfaces.ResumeDat
 	return nil
 }
 
-// LoadProgress loads saved download progress
-func (rm *ResumeManager) LoadProgress(url string) (*interfaces.ResumeData, error) {
-	filename := rm.getResumeFilename(url)
+// LoadProgress loads saved progress of downloading url to outputPath
+func (rm *ResumeManager) LoadProgress(url string, outputPath string) (*interfaces.ResumeData, error) {
+	filename := rm.getResumeFilename(url, outputPath)
 	filepath := filepath.Join(rm.resumeDir, filename)
 
 	data, err := os.ReadFile(filepath)
@@ -70,9 +74,9 @@ func (rm *ResumeManager) LoadProgress(url string) (*interfaces.ResumeData, error
 	return &progress, nil
 }
 
-// ClearProgress removes saved progress data
-func (rm *ResumeManager) ClearProgress(url string) error {
-	filename := rm.getResumeFilename(url)
+// ClearProgress removes saved progress of downloading url to outputPath
+func (rm *ResumeManager) ClearProgress(url string, outputPath string) error {
+	filename := rm.getResumeFilename(url, outputPath)
 	filepath := filepath.Join(rm.resumeDir, filename)
 
 	err := os.Remove(filepath)
@@ -85,7 +89,7 @@ func (rm *ResumeManager) ClearProgress(url string) error {
 
 // IsResumable checks if a download can be resumed
 func (rm *ResumeManager) IsResumable(url string, outputPath string) (bool, *interfaces.ResumeData, error) {
-	progress, err := rm.LoadProgress(url)
+	progress, err := rm.LoadProgress(url, outputPath)
 	if err != nil {
 		return false, nil, err
 	}
@@ -120,7 +124,8 @@ func (rm *ResumeManager) IsResumable(url string, outputPath string) (bool, *inte
 	return true, progress, nil
 }
 
-// CleanupOldResumeData removes resume data older than the specified duration
+// CleanupOldResumeData removes resume data older than the specified duration,
+// along with the partial downloads those records were kept for
 func (rm *ResumeManager) CleanupOldResumeData(ctx context.Context, maxAge time.Duration) error {
 	entries, err := os.ReadDir(rm.resumeDir)
 	if err != nil {
@@ -146,30 +151,51 @@ func (rm *ResumeManager) CleanupOldResumeData(ctx context.Context, maxAge time.D
 		}
 
 		if info.ModTime().Before(cutoff) {
-			filepath := filepath.Join(rm.resumeDir, entry.Name())
-			os.Remove(filepath) // Ignore errors for cleanup
+			path := filepath.Join(rm.resumeDir, entry.Name())
+			removeOrphanedPartial(path, cutoff)
+			os.Remove(path) // Ignore errors for cleanup
 		}
 	}
 
 	return nil
 }
 
-// getResumeFilename generates a safe filename for resume data based on URL
-func (rm *ResumeManager) getResumeFilename(url string) string {
-	// Create a simple hash-like filename based on URL
-	// In a real implementation, you'd want to properly hash the URL
-	filename := ""
-	for i, r := range url {
-		if i >= 20 {
-			break
-		}
-		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
-			filename += string(r)
-		} else {
-			filename += "_"
-		}
+// removeOrphanedPartial deletes the partial download a stale resume record
+// points to, as long as it still looks like that partial: a regular file that
+// is unfinished and wasn't written to since cutoff. Anything else at that
+// path, such as a completed download, is left alone.
+func removeOrphanedPartial(resumeFile string, cutoff time.Time) {
+	data, err := os.ReadFile(resumeFile)
+	if err != nil {
+		return
+	}
+
+	var record interfaces.ResumeData
+	if err := json.Unmarshal(data, &record); err != nil || record.FilePath == "" {
+		return
+	}
+
+	info, err := os.Lstat(record.FilePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	if info.ModTime().After(cutoff) {
+		return
+	}
+	if record.TotalSize > 0 && info.Size() >= record.TotalSize {
+		return
 	}
-	return fmt.Sprintf("resume_%s.json", filename)
+
+	os.Remove(record.FilePath) // Ignore errors for cleanup
+	RemoveJournal(record.FilePath)
+}
+
+// getResumeFilename generates a safe filename for the resume data of
+// downloading url to outputPath
+func (rm *ResumeManager) getResumeFilename(url string, outputPath string) string {
+	// A NUL can't appear in either part, so distinct pairs never share a key
+	sum := sha256.Sum256([]byte(url + "\x00" + outputPath))
+	return fmt.Sprintf("resume_%s.json", hex.EncodeToString(sum[:16]))
 }
 
 func min(a, b int) int {
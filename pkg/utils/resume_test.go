@@ -72,7 +72,7 @@ func TestResumeManager_SaveProgress(t *testing.T) {
 	}
 
 	// Verify file was created
-	filename := rm.getResumeFilename(testURL)
+	filename := rm.getResumeFilename(testURL, progressData.FilePath)
 	resumePath := filepath.Join(tmpDir, filename)
 
 	if _, err := os.Stat(resumePath); os.IsNotExist(err) {
@@ -120,7 +120,7 @@ func TestResumeManager_LoadProgress(t *testing.T) {
 	}
 
 	// Load and verify
-	loaded, err := rm.LoadProgress(testURL)
+	loaded, err := rm.LoadProgress(testURL, progressData.FilePath)
 	if err != nil {
 		t.Fatalf("LoadProgress failed: %v", err)
 	}
@@ -143,7 +143,7 @@ func TestResumeManager_LoadProgressNonExistent(t *testing.T) {
 
 	testURL := "https://example.com/nonexistent.zip"
 
-	loaded, err := rm.LoadProgress(testURL)
+	loaded, err := rm.LoadProgress(testURL, "/tmp/nonexistent.zip")
 	if err != nil {
 		t.Fatalf("LoadProgress failed: %v", err)
 	}
@@ -172,13 +172,13 @@ func TestResumeManager_ClearProgress(t *testing.T) {
 	}
 
 	// Clear and verify
-	err = rm.ClearProgress(testURL)
+	err = rm.ClearProgress(testURL, progressData.FilePath)
 	if err != nil {
 		t.Fatalf("ClearProgress failed: %v", err)
 	}
 
 	// Verify file was removed
-	loaded, err := rm.LoadProgress(testURL)
+	loaded, err := rm.LoadProgress(testURL, progressData.FilePath)
 	if err != nil {
 		t.Fatalf("LoadProgress after clear failed: %v", err)
 	}
@@ -188,6 +188,60 @@ func TestResumeManager_ClearProgress(t *testing.T) {
 	}
 }
 
+func TestResumeManager_SameURLDifferentPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	rm := NewResumeManager(tmpDir)
+
+	testURL := "https://example.com/file.zip"
+	pathA := filepath.Join(tmpDir, "a.txt")
+	pathB := filepath.Join(tmpDir, "b.txt")
+	if err := os.WriteFile(pathA, make([]byte, 100), 0644); err != nil {
+		t.Fatalf("Failed to create %s: %v", pathA, err)
+	}
+	if err := os.WriteFile(pathB, make([]byte, 300), 0644); err != nil {
+		t.Fatalf("Failed to create %s: %v", pathB, err)
+	}
+
+	saved := time.Now().Add(time.Minute)
+	for path, downloaded := range map[string]int64{pathA: 100, pathB: 300} {
+		err := rm.SaveProgress(testURL, &interfaces.ResumeData{
+			URL:          testURL,
+			FilePath:     path,
+			TotalSize:    1000,
+			Downloaded:   downloaded,
+			LastModified: saved,
+		})
+		if err != nil {
+			t.Fatalf("SaveProgress(%s) failed: %v", path, err)
+		}
+	}
+
+	for path, want := range map[string]int64{pathA: 100, pathB: 300} {
+		resumable, data, err := rm.IsResumable(testURL, path)
+		if err != nil {
+			t.Fatalf("IsResumable(%s) failed: %v", path, err)
+		}
+		if !resumable {
+			t.Errorf("IsResumable(%s) = false, want true", path)
+			continue
+		}
+		if data.Downloaded != want {
+			t.Errorf("IsResumable(%s) Downloaded = %d, want %d", path, data.Downloaded, want)
+		}
+	}
+
+	// Clearing one path leaves the other's progress in place
+	if err := rm.ClearProgress(testURL, pathA); err != nil {
+		t.Fatalf("ClearProgress failed: %v", err)
+	}
+	if loaded, _ := rm.LoadProgress(testURL, pathA); loaded != nil {
+		t.Errorf("LoadProgress(%s) after clear = %+v, want nil", pathA, loaded)
+	}
+	if loaded, _ := rm.LoadProgress(testURL, pathB); loaded == nil || loaded.Downloaded != 300 {
+		t.Errorf("LoadProgress(%s) = %+v, want the 300 bytes saved for it", pathB, loaded)
+	}
+}
+
 func TestResumeManager_IsResumable(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -352,7 +406,7 @@ func TestResumeManager_getResumeFilename(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			filename := rm.getResumeFilename(tt.url)
+			filename := rm.getResumeFilename(tt.url, "/tmp/file.zip")
 
 			if filename == "" {
 				t.Error("getResumeFilename returned empty string")
@@ -437,3 +491,83 @@ func TestResumeManager_WithContext(t *testing.T) {
 		t.Errorf("Expected context.Canceled error, got: %v", err)
 	}
 }
+
+func TestResumeManager_CleanupOldResumeData_OrphanedParts(t *testing.T) {
+	resumeDir := t.TempDir()
+	downloadDir := t.TempDir()
+	rm := NewResumeManager(resumeDir)
+
+	oldTime := time.Now().Add(-2 * time.Hour)
+	writeOld := func(path string, size int) {
+		t.Helper()
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+		if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+			t.Fatalf("Failed to change file time: %v", err)
+		}
+	}
+
+	// saveRecord writes a resume record for path and makes it stale
+	saveRecord := func(url, path string, totalSize int64, stale bool) {
+		t.Helper()
+		if err := rm.SaveProgress(url, &interfaces.ResumeData{URL: url, FilePath: path, TotalSize: totalSize}); err != nil {
+			t.Fatalf("SaveProgress failed: %v", err)
+		}
+		if stale {
+			record := filepath.Join(resumeDir, rm.getResumeFilename(url, path))
+			if err := os.Chtimes(record, oldTime, oldTime); err != nil {
+				t.Fatalf("Failed to change file time: %v", err)
+			}
+		}
+	}
+
+	orphan := filepath.Join(downloadDir, "orphan.bin.cloudget.part")
+	writeOld(orphan, 100)
+	saveRecord("https://a.example/orphan", orphan, 1000, true)
+
+	completed := filepath.Join(downloadDir, "completed.bin")
+	writeOld(completed, 1000)
+	saveRecord("https://b.example/completed", completed, 1000, true)
+
+	// Written to after the cutoff, so something is still working on it
+	active := filepath.Join(downloadDir, "active.bin.cloudget.part")
+	if err := os.WriteFile(active, make([]byte, 100), 0644); err != nil {
+		t.Fatalf("Failed to create active part: %v", err)
+	}
+	saveRecord("https://c.example/active", active, 1000, true)
+
+	recent := filepath.Join(downloadDir, "recent.bin.cloudget.part")
+	writeOld(recent, 100)
+	saveRecord("https://d.example/recent", recent, 1000, false)
+
+	unrelated := filepath.Join(downloadDir, "unrelated.bin.cloudget.part")
+	writeOld(unrelated, 100)
+
+	if err := rm.CleanupOldResumeData(context.Background(), time.Hour); err != nil {
+		t.Fatalf("CleanupOldResumeData failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantGone bool
+	}{
+		{name: "stale record", path: filepath.Join(resumeDir, rm.getResumeFilename("https://a.example/orphan", orphan)), wantGone: true},
+		{name: "orphaned part file", path: orphan, wantGone: true},
+		{name: "completed download", path: completed, wantGone: false},
+		{name: "part file still being written", path: active, wantGone: false},
+		{name: "part file with a recent record", path: recent, wantGone: false},
+		{name: "recent record", path: filepath.Join(resumeDir, rm.getResumeFilename("https://d.example/recent", recent)), wantGone: false},
+		{name: "part file without a record", path: unrelated, wantGone: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := os.Stat(tt.path)
+			if gone := os.IsNotExist(err); gone != tt.wantGone {
+				t.Errorf("%s removed = %v, want %v", tt.path, gone, tt.wantGone)
+			}
+		})
+	}
+}
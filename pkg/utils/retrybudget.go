@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrRetryBudgetExhausted is returned when the chunks of a download have
+// used up every retry they were allowed between them
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// retryBudget is the number of retries left for all the chunks or segments
+// of one download, shared by its workers
+type retryBudget struct {
+	remaining atomic.Int64
+}
+
+// newRetryBudget returns the budget for a download split into parts pieces:
+// DownloadOptions.TotalRetryBudget, or else maxRetries for every piece
+func newRetryBudget(options *DownloadOptions, maxRetries, parts int) *retryBudget {
+	total := int64(maxRetries) * int64(parts)
+	if options != nil && options.TotalRetryBudget > 0 {
+		total = int64(options.TotalRetryBudget)
+	}
+
+	budget := &retryBudget{}
+	budget.remaining.Store(total)
+	return budget
+}
+
+// take uses up one retry and reports whether there was one left. A nil
+// budget never runs out.
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	return b.remaining.Add(-1) >= 0
+}
+
+type retryBudgetKey struct{}
+
+// withRetryBudget returns a copy of ctx carrying budget
+func withRetryBudget(ctx context.Context, budget *retryBudget) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, budget)
+}
+
+// retryBudgetFromContext returns the budget stored in ctx, or nil for
+// requests that aren't part of a chunked download
+func retryBudgetFromContext(ctx context.Context) *retryBudget {
+	budget, _ := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	return budget
+}
+
+type noClientRetryKey struct{}
+
+// withoutClientRetries returns a copy of ctx for a request whose caller
+// retries it and charges the budget, so resty mustn't retry it on its own
+func withoutClientRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noClientRetryKey{}, true)
+}
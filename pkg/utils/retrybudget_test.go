@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPClient_DownloadToFile_RetryBudget(t *testing.T) {
+	const (
+		fileSize    = 20 * 1024
+		chunkSize   = 1024 // 20 chunks
+		maxRetries  = 10
+		concurrency = 4
+		budget      = 5
+	)
+
+	tests := []struct {
+		name     string
+		segments int
+		reset    bool // Drop the connection instead of answering
+	}{
+		{name: "chunks"},
+		{name: "segments", segments: concurrency},
+		{name: "chunks with connection resets", reset: true},
+		{name: "segments with connection resets", segments: concurrency, reset: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				if tt.reset {
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if err != nil {
+						t.Errorf("Hijack() error = %v", err)
+						return
+					}
+					conn.Close()
+					return
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+
+			client := NewHTTPClient()
+			fileInfo := &FileInfo{URL: server.URL, Size: fileSize, SizeKnown: true, SupportsRangeRequests: true}
+			_, err := client.DownloadToFileWithInfo(context.Background(), server.URL, filepath.Join(t.TempDir(), "file.bin"), fileInfo, &DownloadOptions{
+				ChunkSize:        chunkSize,
+				MaxRetries:       maxRetries,
+				RetryDelay:       time.Millisecond,
+				Concurrency:      concurrency,
+				Segments:         tt.segments,
+				TotalRetryBudget: budget,
+			})
+			if !errors.Is(err, ErrRetryBudgetExhausted) {
+				t.Fatalf("DownloadToFileWithInfo() error = %v, want ErrRetryBudgetExhausted", err)
+			}
+
+			// Every piece in flight gets its first attempt, retries all come out
+			// of the budget. Without it this would be 20 chunks * 11 attempts.
+			if got := attempts.Load(); got > concurrency+budget {
+				t.Errorf("server saw %d attempts, want at most %d", got, concurrency+budget)
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    *DownloadOptions
+		maxRetries int
+		parts      int
+		want       int
+	}{
+		{name: "defaults to retries per part", maxRetries: 3, parts: 4, want: 12},
+		{name: "explicit budget", options: &DownloadOptions{TotalRetryBudget: 5}, maxRetries: 3, parts: 4, want: 5},
+		{name: "nothing to retry", maxRetries: 3, parts: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := newRetryBudget(tt.options, tt.maxRetries, tt.parts)
+			taken := 0
+			for budget.take() {
+				taken++
+			}
+			if taken != tt.want {
+				t.Errorf("took %d retries, want %d", taken, tt.want)
+			}
+		})
+	}
+
+	var unlimited *retryBudget
+	if !unlimited.take() {
+		t.Error("nil budget ran out")
+	}
+}
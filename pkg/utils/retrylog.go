@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// retryLogInterval is how often a download logs a retry warning at most,
+// the retries in between are summed up in one line
+const retryLogInterval = 10 * time.Second
+
+// retryLog throttles the retry warnings of one download, so a flaky link
+// retrying hundreds of chunks doesn't flood the output. The first retry of
+// each interval is logged as usual and the others are only counted, then
+// summarized with the next warning that gets through or when the download
+// ends. At debug level every retry is logged.
+type retryLog struct {
+	mu         sync.Mutex
+	unit       string // What is retried, e.g. "chunks"
+	interval   time.Duration
+	now        func() time.Time
+	last       time.Time // When the last warning was logged
+	suppressed int
+}
+
+// newRetryLog returns a retry log for the retries of unit, such as "chunks"
+func newRetryLog(unit string) *retryLog {
+	return &retryLog{unit: unit, interval: retryLogInterval, now: time.Now}
+}
+
+type retryLogKey struct{}
+
+// withRetryLog returns a copy of ctx carrying log
+func withRetryLog(ctx context.Context, log *retryLog) context.Context {
+	return context.WithValue(ctx, retryLogKey{}, log)
+}
+
+// retryLogFromContext returns the retry log stored in ctx, or nil for
+// requests that aren't part of a chunked download
+func retryLogFromContext(ctx context.Context) *retryLog {
+	log, _ := ctx.Value(retryLogKey{}).(*retryLog)
+	return log
+}
+
+// warnf logs a retry warning unless one was already logged this interval.
+// A nil log logs every warning.
+func (l *retryLog) warnf(entry *logrus.Entry, format string, args ...any) {
+	if l == nil || entry.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		entry.Warnf(format, args...)
+		return
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	if !l.last.IsZero() && now.Sub(l.last) < l.interval {
+		l.suppressed++
+		l.mu.Unlock()
+		return
+	}
+	suppressed, since := l.suppressed, now.Sub(l.last)
+	l.last, l.suppressed = now, 0
+	l.mu.Unlock()
+
+	if suppressed > 0 {
+		entry.Warnf("Retried %d more %s in the last %s", suppressed, l.unit, since.Round(time.Second))
+	}
+	entry.Warnf(format, args...)
+}
+
+// flush logs the summary of retries that weren't logged yet, once the
+// download is over
+func (l *retryLog) flush(entry *logrus.Entry) {
+	l.mu.Lock()
+	suppressed, since := l.suppressed, l.now().Sub(l.last)
+	l.suppressed = 0
+	l.mu.Unlock()
+
+	if suppressed > 0 {
+		entry.Warnf("Retried %d more %s in the last %s", suppressed, l.unit, since.Round(time.Second))
+	}
+}
+
+// discardRestyLogger drops resty's own messages for chunk and segment
+// requests, whose failures are logged through their retryLog instead
+type discardRestyLogger struct{}
+
+func (discardRestyLogger) Errorf(string, ...any) {}
+func (discardRestyLogger) Warnf(string, ...any)  {}
+func (discardRestyLogger) Debugf(string, ...any) {}
@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRetryLog_Warnf(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	now := time.Unix(0, 0)
+	log := newRetryLog("chunks")
+	log.now = func() time.Time { return now }
+	entry := logrus.NewEntry(logger)
+
+	messages := func() []string {
+		var lines []string
+		for _, e := range hook.AllEntries() {
+			lines = append(lines, e.Message)
+		}
+		hook.Reset()
+		return lines
+	}
+
+	for i := range 50 {
+		log.warnf(entry, "retry %d", i)
+	}
+	if got := messages(); len(got) != 1 || got[0] != "retry 0" {
+		t.Errorf("50 retries in one interval logged %q, want only the first", got)
+	}
+
+	now = now.Add(retryLogInterval + time.Second)
+	log.warnf(entry, "retry %d", 50)
+	want := []string{"Retried 49 more chunks in the last 11s", "retry 50"}
+	if got := messages(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("retry after the interval logged %q, want %q", got, want)
+	}
+
+	log.flush(entry)
+	if got := messages(); len(got) != 0 {
+		t.Errorf("flush with nothing suppressed logged %q", got)
+	}
+
+	log.warnf(entry, "retry %d", 51)
+	now = now.Add(2 * time.Second)
+	log.flush(entry)
+	if got := messages(); fmt.Sprint(got) != fmt.Sprint([]string{"Retried 1 more chunks in the last 2s"}) {
+		t.Errorf("flush logged %q, want the summary of the suppressed retry", got)
+	}
+
+	t.Run("debug level logs every retry", func(t *testing.T) {
+		logger.SetLevel(logrus.DebugLevel)
+		defer logger.SetLevel(logrus.InfoLevel)
+		for i := range 5 {
+			log.warnf(entry, "retry %d", i)
+		}
+		if got := messages(); len(got) != 5 {
+			t.Errorf("logged %d lines at debug level, want 5", len(got))
+		}
+	})
+
+	t.Run("nil log logs every retry", func(t *testing.T) {
+		var nilLog *retryLog
+		for i := range 5 {
+			nilLog.warnf(entry, "retry %d", i)
+		}
+		if got := messages(); len(got) != 5 {
+			t.Errorf("logged %d lines without a retry log, want 5", len(got))
+		}
+	})
+}
+
+func TestHTTPClient_DownloadToFile_RetryLogThrottled(t *testing.T) {
+	const (
+		fileSize  = 20 * 1024
+		chunkSize = 1024 // 20 chunks, each failing twice before it succeeds
+	)
+	content := strings.Repeat("f", fileSize)
+
+	var mu sync.Mutex
+	failures := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		failures[r.Header.Get("Range")]++
+		failed := failures[r.Header.Get("Range")]
+		mu.Unlock()
+		if failed <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		level        logrus.Level
+		wantWarnings int // Upper bound
+	}{
+		// The first retry, then one summary of the other 39 when the download ends
+		{name: "throttled", level: logrus.InfoLevel, wantWarnings: 2},
+		{name: "debug logs every retry", level: logrus.DebugLevel, wantWarnings: 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			clear(failures)
+			mu.Unlock()
+
+			logger, hook := logtest.NewNullLogger()
+			logger.SetLevel(tt.level)
+			client := NewHTTPClient()
+			client.SetLogger(logger)
+
+			fileInfo := &FileInfo{URL: server.URL, Size: fileSize, SizeKnown: true, SupportsRangeRequests: true}
+			_, err := client.DownloadToFileWithInfo(context.Background(), server.URL, filepath.Join(t.TempDir(), "file.bin"), fileInfo, &DownloadOptions{
+				ChunkSize:   chunkSize,
+				MaxRetries:  3,
+				RetryDelay:  time.Millisecond,
+				Concurrency: 4,
+			})
+			if err != nil {
+				t.Fatalf("DownloadToFileWithInfo() error = %v", err)
+			}
+
+			var warnings []string
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel {
+					warnings = append(warnings, entry.Message)
+				}
+			}
+			if len(warnings) > tt.wantWarnings {
+				t.Errorf("logged %d warnings for 40 retries, want at most %d: %q", len(warnings), tt.wantWarnings, warnings)
+			}
+			if tt.level == logrus.InfoLevel && !strings.HasPrefix(warnings[len(warnings)-1], "Retried 39 more chunks") {
+				t.Errorf("last warning = %q, want a summary of the other retries", warnings[len(warnings)-1])
+			}
+		})
+	}
+}
+
+// restyRecorder collects what resty logs on its own
+type restyRecorder struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *restyRecorder) record(format string, v ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, fmt.Sprintf(format, v...))
+}
+
+func (r *restyRecorder) Errorf(format string, v ...any) { r.record(format, v...) }
+func (r *restyRecorder) Warnf(format string, v ...any)  { r.record(format, v...) }
+func (r *restyRecorder) Debugf(format string, v ...any) { r.record(format, v...) }
+
+func TestHTTPClient_DownloadToFile_NoRestyRetryWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments int
+	}{
+		{name: "chunks"},
+		{name: "segments", segments: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Errorf("Hijack() error = %v", err)
+					return
+				}
+				conn.Close()
+			}))
+			defer server.Close()
+
+			logger, hook := logtest.NewNullLogger()
+			client := NewHTTPClient()
+			client.SetLogger(logger)
+			recorder := &restyRecorder{}
+			client.client.SetLogger(recorder)
+
+			fileInfo := &FileInfo{URL: server.URL, Size: 4096, SizeKnown: true, SupportsRangeRequests: true}
+			_, err := client.DownloadToFileWithInfo(context.Background(), server.URL, filepath.Join(t.TempDir(), "file.bin"), fileInfo, &DownloadOptions{
+				ChunkSize:   1024,
+				MaxRetries:  2,
+				RetryDelay:  time.Millisecond,
+				Concurrency: 4,
+				Segments:    tt.segments,
+			})
+			if err == nil {
+				t.Fatal("DownloadToFileWithInfo() succeeded against a server that drops every connection")
+			}
+
+			if len(recorder.messages) > 0 {
+				t.Errorf("resty logged %q, want retries reported only through the retry log", recorder.messages)
+			}
+			if len(hook.AllEntries()) == 0 {
+				t.Error("no retry warnings were logged")
+			}
+		})
+	}
+}
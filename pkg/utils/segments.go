@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// segmentBufferSize is how much of a segment's stream is read per write
+const segmentBufferSize = 64 * 1024
+
+// downloadSegmented splits the file into a few large contiguous segments and
+// streams each one over its own connection, writing sequentially from the
+// segment's base offset. Unlike chunking, every connection makes a single
+// long-lived request, and a failed segment is retried from where it stopped.
+func (h *HTTPClient) downloadSegmented(ctx context.Context, urlStr, filename string, totalSize int64, segments int, options *DownloadOptions) (*DownloadStats, error) {
+	var existingSize int64
+	if options.Resume {
+		if info, err := os.Stat(filename); err == nil && info.Size() < totalSize {
+			existingSize, err = h.checkResumeTail(ctx, urlStr, filename, info.Size(), options)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if existingSize == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(filename, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	ranges := splitSegments(existingSize, totalSize, segments)
+	stats := &DownloadStats{
+		ChunksUsed:      len(ranges),
+		PeakConcurrency: len(ranges),
+		Resumed:         existingSize > 0,
+	}
+
+	// Progress from all segments is funnelled through one lock so
+	// ProgressFunc never runs concurrently
+	var progressMu sync.Mutex
+	downloaded := existingSize
+	report := func(n int64) {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		downloaded += n
+		if options.ProgressFunc != nil {
+			options.ProgressFunc(downloaded, totalSize)
+		}
+	}
+
+	maxRetries := 3
+	if options.MaxRetries > 0 {
+		maxRetries = options.MaxRetries
+	}
+	retryLog := newRetryLog("segments")
+	defer retryLog.flush(h.log(ctx))
+	workerCtx, cancel := context.WithCancel(withRetryLog(withRetryBudget(ctx, newRetryBudget(options, maxRetries, len(ranges))), retryLog))
+	defer cancel()
+
+	written := make([]int64, len(ranges))
+	retries := make([]int, len(ranges))
+	errs := make([]error, len(ranges))
+	finalURLs := make([]string, len(ranges))
+
+	var wg sync.WaitGroup
+	for i, segment := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retries[i], finalURLs[i], errs[i] = h.downloadSegment(workerCtx, urlStr, file, segment, &written[i], report, options)
+			if errs[i] != nil {
+				cancel()
+			} else if options.ChunkFunc != nil {
+				options.ChunkFunc(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var firstErr error
+	for i := range ranges {
+		stats.Retries += retries[i]
+		if stats.FinalURL == "" {
+			stats.FinalURL = finalURLs[i]
+		}
+		// Segments cancelled because another one failed aren't the cause
+		if errs[i] != nil && (firstErr == nil || errors.Is(firstErr, context.Canceled)) {
+			firstErr = errs[i]
+		}
+	}
+	if stats.FinalURL == "" {
+		stats.FinalURL = urlStr
+	}
+
+	if firstErr != nil {
+		// Only the bytes up to the first unfinished segment are contiguous
+		prefix := existingSize
+		for i, segment := range ranges {
+			prefix = segment.Start + written[i]
+			if written[i] < segment.Size {
+				break
+			}
+		}
+		if err := file.Truncate(prefix); err != nil {
+			h.log(ctx).Warnf("Failed to truncate partial file: %v", err)
+		}
+
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		return stats, firstErr
+	}
+
+	if stats.Resumed {
+		h.log(ctx).Infof("Resumed download from %s", FormatBytes(existingSize))
+	}
+
+	return stats, nil
+}
+
+// downloadSegment streams one segment into file, retrying from the last
+// written byte when the connection fails. written is advanced as bytes land.
+func (h *HTTPClient) downloadSegment(ctx context.Context, urlStr string, file *os.File, segment ChunkInfo, written *int64, report func(int64), options *DownloadOptions) (int, string, error) {
+	maxRetries := 3
+	retryDelay := 2 * time.Second
+	if options.MaxRetries > 0 {
+		maxRetries = options.MaxRetries
+	}
+	if options.RetryDelay > 0 {
+		retryDelay = options.RetryDelay
+	}
+
+	var lastErr error
+	budget := retryBudgetFromContext(ctx)
+	retries := retryLogFromContext(ctx)
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if !budget.take() {
+				return attempt - 1, "", fmt.Errorf("%w after %d attempts of segment %d-%d: %w",
+					ErrRetryBudgetExhausted, attempt, segment.Start, segment.End, lastErr)
+			}
+			retries.warnf(h.log(ctx), "Retrying segment download (attempt %d/%d) from byte %d of range %d-%d",
+				attempt, maxRetries, segment.Start+*written, segment.Start, segment.End)
+
+			select {
+			case <-ctx.Done():
+				return attempt - 1, "", ctx.Err()
+			case <-time.After(retryDelay):
+			}
+		}
+
+		finalURL, err := h.streamSegment(ctx, urlStr, file, segment, written, report, options)
+		if err == nil {
+			return attempt, finalURL, nil
+		}
+		if ctx.Err() != nil {
+			return attempt, "", ctx.Err()
+		}
+		if isRedirectError(err) {
+			return attempt, "", err
+		}
+		lastErr = err
+	}
+
+	return maxRetries, "", fmt.Errorf("failed to download segment %d-%d after %d attempts: %w",
+		segment.Start, segment.End, maxRetries+1, lastErr)
+}
+
+// streamSegment requests the rest of a segment and writes it at its offset
+func (h *HTTPClient) streamSegment(ctx context.Context, urlStr string, file *os.File, segment ChunkInfo, written *int64, report func(int64), options *DownloadOptions) (string, error) {
+	start := segment.Start + *written
+
+	req := h.client.R().SetContext(withoutClientRetries(withMaxRedirects(ctx, options))).SetDoNotParseResponse(true).SetLogger(discardRestyLogger{})
+	if options.Headers != nil {
+		req.SetHeaders(options.Headers)
+	}
+	req.SetHeader("Range", fmt.Sprintf("bytes=%d-%d", start, segment.End))
+
+	resp, err := req.Get(urlStr)
+	if err != nil {
+		return "", fmt.Errorf("HTTP request failed: %w", err)
+	}
+
+	body := resp.RawBody()
+	defer drainBody(body)
+
+	if resp.StatusCode() != http.StatusPartialContent {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+	if contentRange := resp.Header().Get("Content-Range"); contentRange != "" {
+		gotStart, gotEnd, _, err := parseContentRange(contentRange)
+		if err != nil {
+			return "", err
+		}
+		if gotStart != start || gotEnd != segment.End {
+			return "", fmt.Errorf("server returned range %d-%d, requested %d-%d", gotStart, gotEnd, start, segment.End)
+		}
+	}
+
+	remaining := segment.Size - *written
+	reader := io.LimitReader(body, remaining)
+	buf := make([]byte, segmentBufferSize)
+	for remaining > 0 {
+		n, readErr := reader.Read(buf)
+		if n > 0 {
+			if _, err := file.WriteAt(buf[:n], segment.Start+*written); err != nil {
+				return "", fmt.Errorf("failed to write segment to file: %w", err)
+			}
+			*written += int64(n)
+			remaining -= int64(n)
+			report(int64(n))
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", fmt.Errorf("failed to read segment: %w", readErr)
+		}
+	}
+
+	if remaining > 0 {
+		return "", fmt.Errorf("segment ended %d bytes early", remaining)
+	}
+
+	recordFilename(ctx, resp.Header())
+	return responseURL(resp, urlStr), nil
+}
+
+// splitSegments divides the bytes from start up to totalSize into at most n
+// contiguous ranges of nearly equal size
+func splitSegments(start, totalSize int64, n int) []ChunkInfo {
+	size := totalSize - start
+	if size <= 0 || n < 1 {
+		return nil
+	}
+	if int64(n) > size {
+		n = int(size)
+	}
+
+	segmentSize := (size + int64(n) - 1) / int64(n)
+
+	var segments []ChunkInfo
+	for ; start < totalSize; start += segmentSize {
+		end := start + segmentSize - 1
+		if end >= totalSize {
+			end = totalSize - 1
+		}
+		segments = append(segments, ChunkInfo{Start: start, End: end, Size: end - start + 1})
+	}
+
+	return segments
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSplitSegments(t *testing.T) {
+	tests := []struct {
+		name      string
+		start     int64
+		totalSize int64
+		n         int
+		want      []ChunkInfo
+	}{
+		{
+			name:      "even split",
+			totalSize: 300,
+			n:         3,
+			want: []ChunkInfo{
+				{Start: 0, End: 99, Size: 100},
+				{Start: 100, End: 199, Size: 100},
+				{Start: 200, End: 299, Size: 100},
+			},
+		},
+		{
+			name:      "last segment is shorter",
+			totalSize: 10,
+			n:         3,
+			want: []ChunkInfo{
+				{Start: 0, End: 3, Size: 4},
+				{Start: 4, End: 7, Size: 4},
+				{Start: 8, End: 9, Size: 2},
+			},
+		},
+		{
+			name:      "resumes from start",
+			start:     100,
+			totalSize: 300,
+			n:         2,
+			want: []ChunkInfo{
+				{Start: 100, End: 199, Size: 100},
+				{Start: 200, End: 299, Size: 100},
+			},
+		},
+		{
+			name:      "more segments than bytes",
+			totalSize: 2,
+			n:         5,
+			want: []ChunkInfo{
+				{Start: 0, End: 0, Size: 1},
+				{Start: 1, End: 1, Size: 1},
+			},
+		},
+		{
+			name:      "nothing left",
+			start:     300,
+			totalSize: 300,
+			n:         3,
+			want:      nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSegments(tt.start, tt.totalSize, tt.n)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSegments(%d, %d, %d) = %v, want %v", tt.start, tt.totalSize, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_downloadSegmented(t *testing.T) {
+	// Every byte differs from its neighbours so a misplaced segment shows up
+	content := make([]byte, 300*1024+7)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	filename := filepath.Join(t.TempDir(), "segmented.bin")
+
+	stats, err := client.downloadSegmented(context.Background(), server.URL, filename, int64(len(content)), 3, &DownloadOptions{})
+	if err != nil {
+		t.Fatalf("downloadSegmented failed: %v", err)
+	}
+
+	if stats.ChunksUsed != 3 {
+		t.Errorf("ChunksUsed = %d, want 3", stats.ChunksUsed)
+	}
+
+	// One streaming request per segment, each starting at its base offset
+	sort.Strings(ranges)
+	want := []string{"bytes=0-102402", "bytes=102403-204805", "bytes=204806-307206"}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("Range headers = %v, want %v", ranges, want)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	for _, segment := range splitSegments(0, int64(len(content)), 3) {
+		got := data[segment.Start : segment.End+1]
+		if !bytes.Equal(got, content[segment.Start:segment.End+1]) {
+			t.Errorf("segment %d-%d does not match the original bytes", segment.Start, segment.End)
+		}
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("Reassembled file does not match the original")
+	}
+}
+
+func TestHTTPClient_downloadSegmented_ResumesCutSegment(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 3*1024)
+
+	// The first request for the middle segment is cut off halfway through
+	var cut atomic.Bool
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader := r.Header.Get("Range")
+		mu.Lock()
+		ranges = append(ranges, rangeHeader)
+		mu.Unlock()
+
+		if rangeHeader == "bytes=10240-20479" && cut.CompareAndSwap(false, true) {
+			w.Header().Set("Content-Range", "bytes 10240-20479/30720")
+			w.Header().Set("Content-Length", "10240")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[10240:15360])
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	filename := filepath.Join(t.TempDir(), "segmented.bin")
+	options := &DownloadOptions{RetryDelay: 10 * time.Millisecond}
+
+	stats, err := client.downloadSegmented(context.Background(), server.URL, filename, int64(len(content)), 3, options)
+	if err != nil {
+		t.Fatalf("downloadSegmented failed: %v", err)
+	}
+	if stats.Retries != 1 {
+		t.Errorf("Retries = %d, want 1", stats.Retries)
+	}
+
+	// The retry asks only for the bytes that never arrived
+	found := false
+	for _, r := range ranges {
+		if r == "bytes=15360-20479" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Range headers = %v, want a retry for bytes=15360-20479", ranges)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("Reassembled file does not match the original")
+	}
+}
+
+func TestHTTPClient_DownloadToFile_Segments(t *testing.T) {
+	content := bytes.Repeat([]byte("segment"), 16*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient()
+	filename := filepath.Join(t.TempDir(), "file.bin")
+
+	stats, err := client.DownloadToFile(context.Background(), server.URL, filename, &DownloadOptions{Segments: 3})
+	if err != nil {
+		t.Fatalf("DownloadToFile failed: %v", err)
+	}
+	if stats.ChunksUsed != 3 {
+		t.Errorf("ChunksUsed = %d, want 3", stats.ChunksUsed)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("Downloaded content does not match")
+	}
+}
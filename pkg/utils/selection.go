@@ -0,0 +1,23 @@
+package utils
+
+import "context"
+
+type selectedFileKey struct{}
+
+// WithSelectedFile returns a copy of ctx asking services that host several
+// files behind one link to download only the file with the given name
+func WithSelectedFile(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, selectedFileKey{}, name)
+}
+
+// SelectedFileFromContext returns the filename stored with WithSelectedFile, if any
+func SelectedFileFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	name, ok := ctx.Value(selectedFileKey{}).(string)
+	return name, ok && name != ""
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// SniffFilename asks for the first byte of urlStr with a GET, following any
+// redirects, and returns the filename of the final response. The
+// Content-Disposition filename is preferred, then one in the final URL's
+// response-content-disposition parameter. Otherwise the last segment of the
+// final URL's path is used, but only if it has an extension, since redirect
+// targets often end in an opaque ID. It returns "" when none gives a name.
+func (h *HTTPClient) SniffFilename(ctx context.Context, urlStr string, options *DownloadOptions) (string, error) {
+	req := h.client.R().SetContext(withMaxRedirects(ctx, options)).SetDoNotParseResponse(true)
+	if options != nil && options.Headers != nil {
+		req.SetHeaders(options.Headers)
+	}
+	req.SetHeader("Range", "bytes=0-0")
+
+	resp, err := req.Get(urlStr)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", urlStr, err)
+	}
+	resp.RawBody().Close()
+
+	if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusPartialContent {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+
+	if filename := extractFilename(resp.Header().Get("Content-Disposition")); filename != "" {
+		return filename, nil
+	}
+
+	finalURLStr := responseURL(resp, urlStr)
+	if filename := QueryFilename(finalURLStr); filename != "" {
+		return filename, nil
+	}
+
+	finalURL, err := url.Parse(finalURLStr)
+	if err != nil {
+		return "", nil
+	}
+	if name := path.Base(finalURL.Path); path.Ext(name) != "" && name != "." {
+		return name, nil
+	}
+
+	return "", nil
+}
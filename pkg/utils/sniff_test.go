@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPClient_SniffFilename(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/share", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/files/report.pdf", http.StatusFound)
+	})
+	mux.HandleFunc("/files/report.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("%"))
+	})
+	mux.HandleFunc("/uc", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/blob/8f2c1d", http.StatusFound)
+	})
+	mux.HandleFunc("/blob/8f2c1d", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "bytes=0-0" {
+			t.Errorf("Range = %q, want bytes=0-0", r.Header.Get("Range"))
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="quarterly results.xlsx"`)
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("P"))
+	})
+	mux.HandleFunc("/signed", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/blob/a7e3?response-content-disposition=attachment%3B%20filename%3D%22file.pdf%22", http.StatusFound)
+	})
+	mux.HandleFunc("/blob/a7e3", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("%"))
+	})
+	mux.HandleFunc("/opaque", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("x"))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "content disposition of final response", path: "/uc", want: "quarterly results.xlsx"},
+		{name: "final URL path", path: "/share", want: "report.pdf"},
+		{name: "final URL query", path: "/signed", want: "file.pdf"},
+		{name: "path without extension", path: "/opaque", want: ""},
+		{name: "error status", path: "/missing", wantErr: true},
+	}
+
+	client := NewHTTPClient()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.SniffFilename(context.Background(), server.URL+tt.path, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SniffFilename() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SniffFilename() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
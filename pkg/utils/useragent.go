@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+// BrowserUserAgent is the User-Agent sent to services that expect a browser
+// when rotation is off
+const BrowserUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
+// browserUserAgents are the realistic browser strings handed out by rotation
+var browserUserAgents = []string{
+	BrowserUserAgent,
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+}
+
+// UserAgentPool hands out the User-Agent for each request to a service. With
+// rotation it cycles through browserUserAgents from a random starting point,
+// so consecutive requests never share one. A nil pool always returns
+// BrowserUserAgent. It is safe for concurrent use.
+type UserAgentPool struct {
+	rotate bool
+	next   atomic.Uint64
+}
+
+// NewUserAgentPool creates a pool that rotates User-Agents if rotate is set
+func NewUserAgentPool(rotate bool) *UserAgentPool {
+	pool := &UserAgentPool{rotate: rotate}
+	if rotate {
+		pool.next.Store(rand.Uint64N(uint64(len(browserUserAgents))))
+	}
+	return pool
+}
+
+// Next returns the User-Agent for the next request
+func (p *UserAgentPool) Next() string {
+	if p == nil || !p.rotate {
+		return BrowserUserAgent
+	}
+	i := p.next.Add(1) - 1
+	return browserUserAgents[i%uint64(len(browserUserAgents))]
+}
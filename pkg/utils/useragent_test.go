@@ -0,0 +1,38 @@
+package utils
+
+import "testing"
+
+func TestUserAgentPool(t *testing.T) {
+	t.Run("rotating pool cycles through every agent", func(t *testing.T) {
+		pool := NewUserAgentPool(true)
+		seen := make(map[string]bool)
+		prev := ""
+		for i := 0; i < len(browserUserAgents); i++ {
+			agent := pool.Next()
+			if agent == prev {
+				t.Errorf("Next() returned %q twice in a row", agent)
+			}
+			seen[agent] = true
+			prev = agent
+		}
+		if len(seen) != len(browserUserAgents) {
+			t.Errorf("saw %d distinct agents, want %d", len(seen), len(browserUserAgents))
+		}
+	})
+
+	t.Run("fixed pool always returns the browser agent", func(t *testing.T) {
+		pool := NewUserAgentPool(false)
+		for i := 0; i < 3; i++ {
+			if agent := pool.Next(); agent != BrowserUserAgent {
+				t.Errorf("Next() = %q, want %q", agent, BrowserUserAgent)
+			}
+		}
+	})
+
+	t.Run("nil pool returns the browser agent", func(t *testing.T) {
+		var pool *UserAgentPool
+		if agent := pool.Next(); agent != BrowserUserAgent {
+			t.Errorf("Next() = %q, want %q", agent, BrowserUserAgent)
+		}
+	})
+}
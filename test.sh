@@ -90,6 +90,7 @@ main() {
         "pkg/services/dropbox:Dropbox Service"
         "pkg/services/gdrive:Google Drive Service"
         "pkg/services/wetransfer:WeTransfer Service"
+        "pkg/services/direct:Direct Service"
         "pkg/downloader:Download Manager"
         "cmd/downloader:Main Application"
     )